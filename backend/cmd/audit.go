@@ -0,0 +1,320 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"nb2/pkg/database"
+)
+
+// ========== 操作日志相关模型 ==========
+
+// AuditLog 操作日志模型
+type AuditLog struct {
+	ID         int             `json:"id"`
+	EntityType string          `json:"entityType"`
+	EntityID   string          `json:"entityId"`
+	Action     string          `json:"action"`
+	UserID     int             `json:"userId"`
+	Username   string          `json:"username"`
+	IP         string          `json:"ip"`
+	Before     json.RawMessage `json:"before"`
+	After      json.RawMessage `json:"after"`
+	CreatedAt  string          `json:"createdAt"`
+}
+
+// 操作类型
+const (
+	auditActionCreate = "create"
+	auditActionUpdate = "update"
+	auditActionDelete = "delete"
+)
+
+// 实体类型
+const (
+	auditProduct         = "product"
+	auditDictionaryType  = "dictionary_type"
+	auditDictionaryItem  = "dictionary_item"
+	auditSetting         = "setting"
+	auditCustomer        = "customer"
+	auditInvoice         = "invoice"
+	auditPayment         = "payment"
+	auditSaleOrder       = "sale_order"
+	auditUser            = "user"
+	auditRole            = "role"
+	auditSupplier        = "supplier"
+	auditPurchaseOrder   = "purchase_order"
+	auditSupplierPayment = "supplier_payment"
+)
+
+// dbExecutor *sql.DB 和 *sql.Tx 的公共方法，便于在事务内外复用
+type dbExecutor interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// auditChild 快照中需要一并记录的子表（删除主记录时会被级联删除的数据）
+type auditChild struct {
+	Name         string
+	Table        string
+	ForeignKey   string
+	ParentColumn string
+}
+
+// auditEntity 实体对应的数据表
+type auditEntity struct {
+	Table     string
+	KeyColumn string
+	Omit      []string
+	Children  []auditChild
+}
+
+// auditEntities 实体类型与数据表的对应关系
+var auditEntities = map[string]auditEntity{
+	auditProduct: {Table: "products", KeyColumn: "id", Omit: productPinyinTable.columns()},
+	auditDictionaryType: {Table: "dictionary_types", KeyColumn: "id", Children: []auditChild{
+		{Name: "items", Table: "dictionary_items", ForeignKey: "dict_type_code", ParentColumn: "code"},
+	}},
+	auditDictionaryItem: {Table: "dictionary_items", KeyColumn: "id"},
+	auditSetting:        {Table: "settings", KeyColumn: "`key`"},
+	auditCustomer:       {Table: "customers", KeyColumn: "id", Omit: customerPinyinTable.columns()},
+	auditInvoice:        {Table: "invoices", KeyColumn: "id"},
+	auditPayment:        {Table: "payments", KeyColumn: "id"},
+	auditSaleOrder: {Table: "sale_orders", KeyColumn: "id", Children: []auditChild{
+		{Name: "items", Table: "sale_order_items", ForeignKey: "sale_order_id", ParentColumn: "id"},
+	}},
+	auditUser: {Table: "users", KeyColumn: "id", Omit: []string{"password_hash"}, Children: []auditChild{
+		{Name: "roles", Table: "user_roles", ForeignKey: "user_id", ParentColumn: "id"},
+	}},
+	auditRole: {Table: "roles", KeyColumn: "id", Children: []auditChild{
+		{Name: "permissions", Table: "role_permissions", ForeignKey: "role_id", ParentColumn: "id"},
+	}},
+	auditSupplier: {Table: "suppliers", KeyColumn: "id"},
+	auditPurchaseOrder: {Table: "purchase_orders", KeyColumn: "id", Children: []auditChild{
+		{Name: "items", Table: "purchase_order_items", ForeignKey: "purchase_order_id", ParentColumn: "id"},
+		{Name: "receipts", Table: "purchase_receipts", ForeignKey: "purchase_order_id", ParentColumn: "id"},
+	}},
+	auditSupplierPayment: {Table: "supplier_payments", KeyColumn: "id"},
+}
+
+// scanRowMaps 将查询结果转换为 字段名->值 的列表
+func scanRowMaps(rows *sql.Rows, omit []string) ([]map[string]interface{}, error) {
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	skip := make(map[string]bool, len(omit))
+	for _, col := range omit {
+		skip[col] = true
+	}
+
+	result := []map[string]interface{}{}
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		ptrs := make([]interface{}, len(columns))
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, err
+		}
+
+		row := make(map[string]interface{}, len(columns))
+		for i, col := range columns {
+			if skip[col] {
+				continue
+			}
+			// 驱动返回的字符串和DECIMAL是[]byte，转成字符串后JSON才可读
+			if b, ok := values[i].([]byte); ok {
+				row[col] = string(b)
+			} else {
+				row[col] = values[i]
+			}
+		}
+		result = append(result, row)
+	}
+	return result, rows.Err()
+}
+
+// snapshotEntity 获取实体当前的完整数据（含子表），记录不存在时返回nil
+func snapshotEntity(q dbExecutor, entityType string, key interface{}) (map[string]interface{}, error) {
+	entity, ok := auditEntities[entityType]
+	if !ok {
+		return nil, fmt.Errorf("unknown audit entity type: %s", entityType)
+	}
+
+	rows, err := q.Query(fmt.Sprintf("SELECT * FROM %s WHERE %s = ?", entity.Table, entity.KeyColumn), key)
+	if err != nil {
+		return nil, err
+	}
+	records, err := scanRowMaps(rows, entity.Omit)
+	rows.Close()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	snapshot := records[0]
+	for _, child := range entity.Children {
+		rows, err := q.Query(fmt.Sprintf("SELECT * FROM %s WHERE %s = ? ORDER BY id", child.Table, child.ForeignKey), snapshot[child.ParentColumn])
+		if err != nil {
+			return nil, err
+		}
+		children, err := scanRowMaps(rows, nil)
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+		snapshot[child.Name] = children
+	}
+	return snapshot, nil
+}
+
+// recordAudit 记录一条操作日志，修改后的数据从数据库读取（删除时为空）
+// 在事务中调用时传入tx，日志与业务数据一起提交或回滚
+func recordAudit(q dbExecutor, c *gin.Context, entityType string, key interface{}, action string, before map[string]interface{}) error {
+	after, err := snapshotEntity(q, entityType, key)
+	if err != nil {
+		return fmt.Errorf("failed to snapshot %s %v: %w", entityType, key, err)
+	}
+	var userID interface{}
+	if id := c.GetInt(ctxUserIDKey); id > 0 {
+		userID = id
+	}
+	_, err = q.Exec(
+		"INSERT INTO audit_logs (entity_type, entity_id, action, user_id, username, ip, before_data, after_data) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		entityType, fmt.Sprint(key), action, userID, c.GetString(ctxUsernameKey), c.ClientIP(),
+		nullableJSON(before), nullableJSON(after),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to write audit log for %s %v: %w", entityType, key, err)
+	}
+	return nil
+}
+
+// snapshotEntities 批量获取实体快照，key为实体ID，不存在的记录不返回
+func snapshotEntities(q dbExecutor, entityType string, ids []int) (map[int]map[string]interface{}, error) {
+	snapshots := make(map[int]map[string]interface{}, len(ids))
+	for _, id := range ids {
+		snapshot, err := snapshotEntity(q, entityType, id)
+		if err != nil {
+			return nil, err
+		}
+		if snapshot != nil {
+			snapshots[id] = snapshot
+		}
+	}
+	return snapshots, nil
+}
+
+// recordAuditDeletes 批量删除后在同一事务中为每条被删除的记录写入操作日志
+func recordAuditDeletes(q dbExecutor, c *gin.Context, entityType string, snapshots map[int]map[string]interface{}) error {
+	ids := make([]int, 0, len(snapshots))
+	for id := range snapshots {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		if err := recordAudit(q, c, entityType, id, auditActionDelete, snapshots[id]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// nullableJSON 序列化快照，快照为空时写入NULL
+func nullableJSON(data map[string]interface{}) interface{} {
+	if data == nil {
+		return nil
+	}
+	b, err := json.Marshal(data)
+	if err != nil {
+		return nil
+	}
+	return string(b)
+}
+
+// auditLogListSort 操作日志列表可排序字段
+var auditLogListSort = listSort{
+	Fields: map[string]string{
+		"createdAt":  "created_at",
+		"entityType": "entity_type",
+		"action":     "action",
+		"username":   "username",
+	},
+	Default:    "createdAt",
+	Desc:       true,
+	TieBreaker: "id",
+}
+
+// getAuditLogs 查询操作日志，支持按实体、操作人和时间范围筛选
+func getAuditLogs(c *gin.Context) {
+	lq, err := newListQuery(c, auditLogListSort)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	lq.eq("entityType", "entity_type")
+	lq.eq("entityId", "entity_id")
+	lq.intEq("userId", "user_id")
+	lq.eq("action", "action")
+	if startTime := strings.TrimSpace(c.Query("startTime")); startTime != "" {
+		lq.where("created_at >= ?", startTime)
+	}
+	if endTime := strings.TrimSpace(c.Query("endTime")); endTime != "" {
+		// 只传日期时包含当天全部记录
+		if len(endTime) == len("2006-01-02") {
+			endTime += " 23:59:59"
+		}
+		lq.where("created_at <= ?", endTime)
+	}
+	if lq.err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": lq.err.Error()})
+		return
+	}
+
+	total, err := lq.count("audit_logs")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count audit logs"})
+		return
+	}
+
+	query, args := lq.pageSQL("SELECT id, entity_type, entity_id, action, COALESCE(user_id, 0), COALESCE(username, ''), COALESCE(ip, ''), before_data, after_data, created_at FROM audit_logs")
+	rows, err := database.DB.Query(query, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch audit logs"})
+		return
+	}
+	defer rows.Close()
+
+	records := []AuditLog{}
+	for rows.Next() {
+		var l AuditLog
+		var before, after sql.NullString
+		if err := rows.Scan(&l.ID, &l.EntityType, &l.EntityID, &l.Action, &l.UserID, &l.Username, &l.IP, &before, &after, &l.CreatedAt); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan audit log"})
+			return
+		}
+		if before.Valid {
+			l.Before = json.RawMessage(before.String)
+		}
+		if after.Valid {
+			l.After = json.RawMessage(after.String)
+		}
+		records = append(records, l)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"total":   total,
+		"records": records,
+	})
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"nb2/pkg/database"
+)
+
+// TestAuditLogWrittenInTransaction 操作日志与业务数据在同一事务中提交，日志写入失败时业务修改一并回滚
+func TestAuditLogWrittenInTransaction(t *testing.T) {
+	openTestDB(t)
+	w := callHandler(t, createCustomer, http.MethodPost, CreateCustomerRequest{Name: "华东五金", Phone: "13800000000", Status: 1})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("createCustomer: %d %s", w.Code, w.Body.String())
+	}
+	var customer Customer
+	if err := json.Unmarshal(w.Body.Bytes(), &customer); err != nil {
+		t.Fatal(err)
+	}
+	customerID := customer.ID
+	param := gin.Param{Key: "id", Value: strconv.Itoa(customerID)}
+
+	w = callHandler(t, updateCustomer, http.MethodPut, UpdateCustomerRequest{Name: "华东五金商行"}, param)
+	if w.Code != http.StatusOK {
+		t.Fatalf("updateCustomer: %d %s", w.Code, w.Body.String())
+	}
+	for _, action := range []string{auditActionCreate, auditActionUpdate} {
+		var logs int
+		if err := database.DB.QueryRow("SELECT COUNT(*) FROM audit_logs WHERE entity_type = ? AND entity_id = ? AND action = ?",
+			auditCustomer, strconv.Itoa(customerID), action).Scan(&logs); err != nil {
+			t.Fatal(err)
+		}
+		if logs != 1 {
+			t.Fatalf("%s audit logs = %d, want 1", action, logs)
+		}
+	}
+
+	mustExec(t, "DROP TABLE audit_logs")
+	w = callHandler(t, updateCustomer, http.MethodPut, UpdateCustomerRequest{Name: "华东五金有限公司"}, param)
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("updateCustomer without audit_logs: %d %s, want 500", w.Code, w.Body.String())
+	}
+	var name string
+	if err := database.DB.QueryRow("SELECT name FROM customers WHERE id = ?", customerID).Scan(&name); err != nil {
+		t.Fatal(err)
+	}
+	if name != "华东五金商行" {
+		t.Fatalf("name = %q, want the update rolled back", name)
+	}
+}
+
+// TestCustomerSnapshotOwnFieldsOnly 客户快照只包含客户本身的字段，不包含其销售订单和收款
+func TestCustomerSnapshotOwnFieldsOnly(t *testing.T) {
+	openTestDB(t)
+	customerID := mustExec(t, "INSERT INTO customers (code, name, phone) VALUES (?, ?, ?)", "C00001", "张三", "13800000000")
+	mustExec(t, "INSERT INTO sale_orders (code, create_time, customer_id, customer_name, customer_phone, customer_city, total_amount, payable_amount) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		"SO001", "2026-01-01 00:00:00", customerID, "张三", "13800000000", "", "100", "100")
+	mustExec(t, "INSERT INTO payments (customer_id, amount, payment_date) VALUES (?, ?, ?)", customerID, "100", "2026-01-02")
+
+	snapshot, err := snapshotEntity(database.DB, auditCustomer, customerID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snapshot["name"] != "张三" {
+		t.Fatalf("snapshot name = %v, want 张三", snapshot["name"])
+	}
+	for _, key := range []string{"invoices", "saleOrders", "payments", "name_pinyin"} {
+		if _, ok := snapshot[key]; ok {
+			t.Errorf("customer snapshot contains %q", key)
+		}
+	}
+}
+
+// TestGetAuditLogsListQuery 操作日志列表使用统一的分页、排序和筛选参数
+func TestGetAuditLogsListQuery(t *testing.T) {
+	openTestDB(t)
+	for i, action := range []string{auditActionCreate, auditActionUpdate, auditActionUpdate} {
+		mustExec(t, "INSERT INTO audit_logs (entity_type, entity_id, action, username, created_at) VALUES (?, ?, ?, ?, ?)",
+			auditCustomer, "1", action, "admin", "2026-01-0"+strconv.Itoa(i+1)+" 10:00:00")
+	}
+
+	list := func(query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/api/audit-logs?"+query, nil)
+		getAuditLogs(c)
+		return w
+	}
+
+	tests := []struct {
+		query string
+		total int
+		first string
+	}{
+		{"", 3, "2026-01-03"},
+		{"order=asc", 3, "2026-01-01"},
+		{"action=update&pageSize=1", 2, "2026-01-03"},
+		{"startTime=2026-01-02&endTime=2026-01-02", 1, "2026-01-02"},
+	}
+	for _, tt := range tests {
+		w := list(tt.query)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%q: %d %s", tt.query, w.Code, w.Body.String())
+		}
+		var resp struct {
+			Total   int        `json:"total"`
+			Records []AuditLog `json:"records"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.Total != tt.total {
+			t.Errorf("%q: total = %d, want %d", tt.query, resp.Total, tt.total)
+		}
+		if len(resp.Records) == 0 || resp.Records[0].CreatedAt[:10] != tt.first {
+			t.Errorf("%q: first record %+v, want created on %s", tt.query, resp.Records, tt.first)
+		}
+	}
+
+	for _, query := range []string{"pageSize=5000", "sort=before_data", "userId=abc"} {
+		if w := list(query); w.Code != http.StatusBadRequest {
+			t.Errorf("%q: %d, want 400", query, w.Code)
+		}
+	}
+}
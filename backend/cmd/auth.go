@@ -0,0 +1,255 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+
+	"nb2/internal/config"
+	"nb2/pkg/database"
+)
+
+// ========== 用户和登录相关模型 ==========
+
+// User 用户模型
+type User struct {
+	ID          int    `json:"id"`
+	Username    string `json:"username"`
+	Name        string `json:"name"`
+	Status      int    `json:"status"`
+	LastLoginAt string `json:"lastLoginAt"`
+	CreatedAt   string `json:"createdAt"`
+	UpdatedAt   string `json:"updatedAt"`
+}
+
+// LoginRequest 登录请求
+type LoginRequest struct {
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+// 登录用户信息在gin.Context中的key
+const (
+	ctxUserIDKey   = "userID"
+	ctxUsernameKey = "username"
+	ctxTokenKey    = "sessionTokenHash"
+)
+
+// sessionTTL 登录令牌有效期，启动时根据配置设置
+var sessionTTL = 7 * 24 * time.Hour
+
+// initAuth 初始化登录配置，系统中没有任何用户时创建管理员账号
+func initAuth(cfg *config.AuthConfig) error {
+	if cfg.SessionTTL > 0 {
+		sessionTTL = cfg.SessionTTL
+	}
+
+	var count int
+	if err := database.DB.QueryRow("SELECT COUNT(*) FROM users").Scan(&count); err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	if cfg.AdminPassword == "" {
+		log.Println("Warning: no users exist, set AUTH_ADMIN_PASSWORD to create the initial admin account")
+		return nil
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(cfg.AdminPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(
+		"INSERT INTO users (username, password_hash, name, status) VALUES (?, ?, ?, 1)",
+		cfg.AdminUsername, string(hash), "管理员",
+	)
+	if err != nil {
+		return err
+	}
+	userID, _ := result.LastInsertId()
+	if _, err := tx.Exec("INSERT INTO user_roles (user_id, role_id) SELECT ?, id FROM roles WHERE code = 'admin'", userID); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	log.Printf("Initial admin user %s created", cfg.AdminUsername)
+	return nil
+}
+
+// hashToken 计算令牌的SHA-256摘要，数据库中只保存摘要
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// generateToken 生成随机登录令牌
+func generateToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// bearerToken 从Authorization请求头中取出令牌
+func bearerToken(c *gin.Context) string {
+	header := c.GetHeader("Authorization")
+	if len(header) > 7 && strings.EqualFold(header[:7], "Bearer ") {
+		return strings.TrimSpace(header[7:])
+	}
+	return ""
+}
+
+// authMiddleware 登录验证中间件，未登录或令牌过期时返回401
+func authMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := bearerToken(c)
+		if token == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+
+		tokenHash := hashToken(token)
+		var userID int
+		var username string
+		var expiresAt time.Time
+		err := database.DB.QueryRow(
+			"SELECT u.id, u.username, s.expires_at FROM user_sessions s JOIN users u ON s.user_id = u.id WHERE s.token_hash = ? AND u.status = 1",
+			tokenHash,
+		).Scan(&userID, &username, &expiresAt)
+		if err != nil {
+			if err != sql.ErrNoRows {
+				log.Printf("查询登录会话失败：%v\n", err)
+			}
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+		if time.Now().After(expiresAt) {
+			database.DB.Exec("DELETE FROM user_sessions WHERE token_hash = ?", tokenHash)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Session expired"})
+			return
+		}
+
+		c.Set(ctxUserIDKey, userID)
+		c.Set(ctxUsernameKey, username)
+		c.Set(ctxTokenKey, tokenHash)
+		c.Next()
+	}
+}
+
+// login 用户登录
+func login(c *gin.Context) {
+	var req LoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var userID int
+	var passwordHash string
+	err := database.DB.QueryRow("SELECT id, password_hash FROM users WHERE username = ? AND status = 1", req.Username).Scan(&userID, &passwordHash)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "用户名或密码错误"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user"})
+		return
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(req.Password)); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "用户名或密码错误"})
+		return
+	}
+
+	token, err := generateToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+	expiresAt := time.Now().Add(sessionTTL)
+
+	if _, err := database.DB.Exec(
+		"INSERT INTO user_sessions (token_hash, user_id, expires_at) VALUES (?, ?, ?)",
+		hashToken(token), userID, expiresAt,
+	); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create session"})
+		return
+	}
+
+	// 记录登录时间，顺便清理该用户已过期的会话
+	database.DB.Exec("UPDATE users SET last_login_at = CURRENT_TIMESTAMP WHERE id = ?", userID)
+	database.DB.Exec("DELETE FROM user_sessions WHERE user_id = ? AND expires_at < ?", userID, time.Now())
+
+	user, err := getUser(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"token":     token,
+		"expiresAt": expiresAt.Format(time.RFC3339),
+		"user":      user,
+	})
+}
+
+// logout 退出登录，使当前令牌失效
+func logout(c *gin.Context) {
+	if _, err := database.DB.Exec("DELETE FROM user_sessions WHERE token_hash = ?", c.GetString(ctxTokenKey)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to logout"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
+}
+
+// getCurrentUser 获取当前登录用户及其角色和权限
+func getCurrentUser(c *gin.Context) {
+	userID := c.GetInt(ctxUserIDKey)
+	user, err := getUser(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user"})
+		return
+	}
+	roles, err := getUserRoles(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user roles"})
+		return
+	}
+	permissions, err := getUserPermissions(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user permissions"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"user":        user,
+		"roles":       roles,
+		"permissions": permissions,
+	})
+}
+
+// getUser 根据ID获取用户
+func getUser(id int) (User, error) {
+	var u User
+	err := database.DB.QueryRow("SELECT id, username, COALESCE(name, ''), status, COALESCE(last_login_at, ''), created_at, updated_at FROM users WHERE id = ?", id).Scan(
+		&u.ID, &u.Username, &u.Name, &u.Status, &u.LastLoginAt, &u.CreatedAt, &u.UpdatedAt,
+	)
+	return u, err
+}
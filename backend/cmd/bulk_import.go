@@ -0,0 +1,636 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+	"github.com/xuri/excelize/v2"
+	"golang.org/x/text/encoding/simplifiedchinese"
+
+	"nb2/pkg/database"
+)
+
+// 产品和客户批量导入：上传 CSV 或 XLSX，第一行为表头，按列映射把表头对应到字段
+// 默认 dryRun=true 只校验并返回每一行的错误；dryRun=false 且全部通过校验时在一个事务中写入
+// 未填写编号的行按 generateProductCode / generateCustomerCode 的规则依次生成编号
+
+const (
+	maxImportFileSize = 10 << 20
+	maxImportRows     = 5000
+)
+
+// importField 导入文件中可映射的字段
+type importField struct {
+	Key      string   `json:"key"`
+	Label    string   `json:"label"`
+	Aliases  []string `json:"-"` // 自动识别表头时可匹配的其他列名
+	Required bool     `json:"required"`
+	MaxLen   int      `json:"-"` // 与数据库列长度一致，0 表示不限
+}
+
+// importRowError 一行数据的校验错误，Row 为文件中的行号（表头为第1行）
+type importRowError struct {
+	Row     int    `json:"row"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+// importErrors 导入校验错误
+type importErrors []importRowError
+
+// add 记录第 row 行某个字段的错误
+func (e *importErrors) add(row int, field, format string, args ...interface{}) {
+	*e = append(*e, importRowError{Row: row, Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// importRow 按列映射取出的一行数据，键为字段名
+type importRow struct {
+	Row    int
+	Values map[string]string
+}
+
+// importSpec 一类数据的导入规则
+type importSpec[T any] struct {
+	Name   string // 用于提示信息，如“产品”
+	Fields []importField
+	// validate 校验全部行并转换为待写入的记录，校验错误记入 errs
+	validate func(q dbExecutor, rows []importRow, errs *importErrors) ([]T, error)
+	// insert 在事务中写入记录
+	insert func(tx *sql.Tx, c *gin.Context, records []T) error
+}
+
+// readImportFile 读取上传的 CSV 或 XLSX 文件，返回表头和数据行
+// XLSX 只读取第一个工作表；CSV 兼容 UTF-8（含 BOM）和 Excel 另存的 GBK 编码
+func readImportFile(c *gin.Context) ([]string, [][]string, error) {
+	fh, err := c.FormFile("file")
+	if err != nil {
+		return nil, nil, fmt.Errorf("请上传导入文件")
+	}
+	if fh.Size > maxImportFileSize {
+		return nil, nil, fmt.Errorf("导入文件不能超过%dMB", maxImportFileSize>>20)
+	}
+	f, err := fh.Open()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var records [][]string
+	switch strings.ToLower(filepath.Ext(fh.Filename)) {
+	case ".csv":
+		data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+		if !utf8.Valid(data) {
+			if data, err = simplifiedchinese.GB18030.NewDecoder().Bytes(data); err != nil {
+				return nil, nil, fmt.Errorf("无法识别 CSV 文件编码")
+			}
+		}
+		r := csv.NewReader(bytes.NewReader(data))
+		r.FieldsPerRecord = -1
+		r.LazyQuotes = true
+		if records, err = r.ReadAll(); err != nil {
+			return nil, nil, fmt.Errorf("CSV 文件格式错误：%v", err)
+		}
+	case ".xlsx":
+		wb, err := excelize.OpenReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, nil, fmt.Errorf("无法读取 Excel 文件：%v", err)
+		}
+		defer wb.Close()
+		if records, err = wb.GetRows(wb.GetSheetName(0)); err != nil {
+			return nil, nil, fmt.Errorf("无法读取 Excel 文件：%v", err)
+		}
+	default:
+		return nil, nil, fmt.Errorf("只支持 .csv 和 .xlsx 文件")
+	}
+
+	if len(records) == 0 {
+		return nil, nil, fmt.Errorf("导入文件为空")
+	}
+	headers := make([]string, len(records[0]))
+	for i, h := range records[0] {
+		headers[i] = strings.TrimSpace(h)
+	}
+	if len(records)-1 > maxImportRows {
+		return nil, nil, fmt.Errorf("一次最多导入%d行", maxImportRows)
+	}
+	return headers, records[1:], nil
+}
+
+// resolveImportMapping 确定每一列对应的字段
+// 请求中的 mapping 为 {"表头": "字段名"}，字段名为空表示忽略该列；未提交 mapping 时按字段名称和别名自动识别
+func resolveImportMapping(c *gin.Context, headers []string, fields []importField) (map[string]string, error) {
+	known := make(map[string]importField, len(fields))
+	for _, f := range fields {
+		known[f.Key] = f
+	}
+
+	mapping := map[string]string{}
+	if raw := strings.TrimSpace(c.PostForm("mapping")); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &mapping); err != nil {
+			return nil, fmt.Errorf("列映射格式错误")
+		}
+	} else {
+		// 每个字段只取第一列匹配的表头
+		taken := map[string]bool{}
+		for _, h := range headers {
+			for _, f := range fields {
+				if taken[f.Key] {
+					continue
+				}
+				for _, name := range append([]string{f.Key, f.Label}, f.Aliases...) {
+					if strings.EqualFold(h, name) {
+						mapping[h] = f.Key
+						taken[f.Key] = true
+						break
+					}
+				}
+				if mapping[h] != "" {
+					break
+				}
+			}
+		}
+	}
+
+	mapped := map[string]string{}
+	for header, key := range mapping {
+		if key == "" {
+			continue
+		}
+		f, ok := known[key]
+		if !ok {
+			return nil, fmt.Errorf("未知的导入字段：%s", key)
+		}
+		if other, dup := mapped[key]; dup {
+			return nil, fmt.Errorf("「%s」和「%s」两列都映射到了%s", other, header, f.Label)
+		}
+		mapped[key] = header
+	}
+	for _, f := range fields {
+		if _, ok := mapped[f.Key]; f.Required && !ok {
+			return nil, fmt.Errorf("缺少必填列：%s", f.Label)
+		}
+	}
+	return mapping, nil
+}
+
+// mapImportRows 按列映射取出每行数据，跳过空行，并检查必填和长度
+func mapImportRows(headers []string, records [][]string, mapping map[string]string, fields []importField, errs *importErrors) []importRow {
+	columns := map[int]string{}
+	for i, h := range headers {
+		if key := mapping[h]; key != "" {
+			columns[i] = key
+		}
+	}
+
+	var rows []importRow
+	for i, record := range records {
+		r := importRow{Row: i + 2, Values: map[string]string{}}
+		empty := true
+		for col, value := range record {
+			value = strings.TrimSpace(value)
+			if value != "" {
+				empty = false
+			}
+			if key, ok := columns[col]; ok {
+				r.Values[key] = value
+			}
+		}
+		if empty {
+			continue
+		}
+		for _, f := range fields {
+			v := r.Values[f.Key]
+			if f.Required && v == "" {
+				errs.add(r.Row, f.Key, "%s不能为空", f.Label)
+			}
+			if f.MaxLen > 0 && utf8.RuneCountInString(v) > f.MaxLen {
+				errs.add(r.Row, f.Key, "%s不能超过%d个字符", f.Label, f.MaxLen)
+			}
+		}
+		rows = append(rows, r)
+	}
+	return rows
+}
+
+// assignImportCodes 校验文件中填写的编号，并为未填写编号的行生成编号
+// 生成规则与逐条新增相同：从当前最大编号往后递增，文件中前面的行填写了更大的编号时从该编号继续，跳过文件中已填写的编号
+func assignImportCodes(q dbExecutor, table, prefix string, generate func(dbExecutor) (string, error), rows []importRow, errs *importErrors) ([]string, error) {
+	codes := make([]string, len(rows))
+	firstRow := map[string]int{}
+	var explicit []interface{}
+	for i, r := range rows {
+		code := r.Values["code"]
+		if code == "" {
+			continue
+		}
+		codes[i] = code
+		if row, dup := firstRow[code]; dup {
+			errs.add(r.Row, "code", "编号「%s」与第%d行重复", code, row)
+			continue
+		}
+		firstRow[code] = r.Row
+		explicit = append(explicit, code)
+	}
+
+	// 与已有数据重复的编号
+	if len(explicit) > 0 {
+		placeholders := strings.TrimSuffix(strings.Repeat("?,", len(explicit)), ",")
+		existing, err := q.Query("SELECT code FROM "+table+" WHERE code IN ("+placeholders+")", explicit...)
+		if err != nil {
+			return nil, err
+		}
+		for existing.Next() {
+			var code string
+			if err := existing.Scan(&code); err != nil {
+				existing.Close()
+				return nil, err
+			}
+			errs.add(firstRow[code], "code", "编号「%s」已存在", code)
+		}
+		existing.Close()
+		if err := existing.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	first, err := generate(q)
+	if err != nil {
+		return nil, err
+	}
+	next, _ := strconv.Atoi(first[len(prefix):])
+	sequence := regexp.MustCompile("^" + regexp.QuoteMeta(prefix) + "[0-9]+$")
+	for i := range rows {
+		if codes[i] != "" {
+			if sequence.MatchString(codes[i]) {
+				if n, err := strconv.Atoi(codes[i][len(prefix):]); err == nil && n >= next {
+					next = n + 1
+				}
+			}
+			continue
+		}
+		code := fmt.Sprintf("%s%04d", prefix, next)
+		for firstRow[code] != 0 {
+			next++
+			code = fmt.Sprintf("%s%04d", prefix, next)
+		}
+		codes[i] = code
+		next++
+	}
+	return codes, nil
+}
+
+// parseImportStatus 解析状态列：空或“启用”为1，“禁用”为0
+func parseImportStatus(v string) (int, bool) {
+	switch v {
+	case "", "启用", "1", "是":
+		return 1, true
+	case "禁用", "停用", "0", "否":
+		return 0, true
+	}
+	return 0, false
+}
+
+// importDictionary 系统设置中为产品分类、品牌、单位配置的字典，文件中可填写字典项名称或编码，保存编码
+type importDictionary struct {
+	Label    string
+	TypeCode string
+	items    map[string]string // 字典项名称或编码 → 编码
+}
+
+// loadImportDictionary 读取 settingKey 对应字典类型的启用字典项，未配置字典时不校验
+func loadImportDictionary(q dbExecutor, settingKey, label string) (*importDictionary, error) {
+	d := &importDictionary{Label: label, items: map[string]string{}}
+	err := q.QueryRow("SELECT value FROM settings WHERE `key` = ?", settingKey).Scan(&d.TypeCode)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	if d.TypeCode == "" {
+		return d, nil
+	}
+
+	rows, err := q.Query("SELECT code, name FROM dictionary_items WHERE dict_type_code = ? AND status = 1", d.TypeCode)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var codes []string
+	for rows.Next() {
+		var code, name string
+		if err := rows.Scan(&code, &name); err != nil {
+			return nil, err
+		}
+		d.items[name] = code
+		codes = append(codes, code)
+	}
+	// 名称与其他字典项编码相同时以编码为准
+	for _, code := range codes {
+		d.items[code] = code
+	}
+	return d, rows.Err()
+}
+
+// resolve 把名称或编码转换为字典项编码，不在字典中时记录错误
+func (d *importDictionary) resolve(r importRow, field string, errs *importErrors) string {
+	v := r.Values[field]
+	if v == "" || d.TypeCode == "" {
+		return v
+	}
+	code, ok := d.items[v]
+	if !ok {
+		errs.add(r.Row, field, "%s「%s」不在字典中", d.Label, v)
+	}
+	return code
+}
+
+// importResult 导入接口的返回结果
+type importResult struct {
+	DryRun   bool              `json:"dryRun"`
+	Headers  []string          `json:"headers"`
+	Mapping  map[string]string `json:"mapping"`
+	Fields   []importField     `json:"fields"`
+	Total    int               `json:"total"`
+	Errors   importErrors      `json:"errors"`
+	Records  interface{}       `json:"records"`
+	Imported int               `json:"imported"`
+}
+
+// runImport 导入接口的公共流程：读取文件 → 列映射 → 校验 → 全部通过且非预览时在一个事务中写入
+func runImport[T any](c *gin.Context, spec importSpec[T]) {
+	dryRun := true
+	if s := c.DefaultPostForm("dryRun", c.Query("dryRun")); s != "" {
+		v, err := strconv.ParseBool(s)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid dryRun"})
+			return
+		}
+		dryRun = v
+	}
+
+	headers, records, err := readImportFile(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	mapping, err := resolveImportMapping(c, headers, spec.Fields)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "headers": headers, "fields": spec.Fields})
+		return
+	}
+
+	errs := importErrors{}
+	rows := mapImportRows(headers, records, mapping, spec.Fields, &errs)
+	if len(rows) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "导入文件中没有数据"})
+		return
+	}
+	result := importResult{DryRun: dryRun, Headers: headers, Mapping: mapping, Fields: spec.Fields, Total: len(rows)}
+
+	// 正式导入时在事务中重新校验，避免预览之后数据发生变化
+	var q dbExecutor = database.DB
+	var tx *sql.Tx
+	if !dryRun {
+		if tx, err = database.DB.Begin(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction"})
+			return
+		}
+		defer tx.Rollback()
+		q = tx
+	}
+
+	list, err := spec.validate(q, rows, &errs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to validate %s import: %v", spec.Name, err)})
+		return
+	}
+	sort.SliceStable(errs, func(i, j int) bool { return errs[i].Row < errs[j].Row })
+	result.Records = list
+	result.Errors = errs
+	if dryRun {
+		c.JSON(http.StatusOK, result)
+		return
+	}
+	if len(errs) > 0 {
+		result.Records = nil
+		c.JSON(http.StatusBadRequest, result)
+		return
+	}
+
+	if err := spec.insert(tx, c, list); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("导入%s失败：%v", spec.Name, err)})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+	result.Imported = len(list)
+	c.JSON(http.StatusOK, result)
+}
+
+// ========== 产品导入 ==========
+
+// productImportFields 产品导入字段，列名与产品列表导出一致
+var productImportFields = []importField{
+	{Key: "code", Label: "产品编码", Aliases: []string{"产品编号", "编码", "编号"}, MaxLen: 50},
+	{Key: "name", Label: "产品名称", Aliases: []string{"名称"}, Required: true, MaxLen: 255},
+	{Key: "category", Label: "产品分类", Aliases: []string{"分类"}, MaxLen: 100},
+	{Key: "brand", Label: "品牌", MaxLen: 100},
+	{Key: "unit", Label: "单位", MaxLen: 50},
+	{Key: "price", Label: "价格", Aliases: []string{"单价"}, Required: true},
+	{Key: "status", Label: "状态"},
+	{Key: "remark", Label: "备注"},
+}
+
+// importedProduct 校验通过的一行产品
+type importedProduct struct {
+	Row int `json:"row"`
+	CreateProductRequest
+}
+
+// validateProductImport 校验产品：编号唯一、价格大于0、分类/品牌/单位在字典中
+func validateProductImport(q dbExecutor, rows []importRow, errs *importErrors) ([]importedProduct, error) {
+	codes, err := assignImportCodes(q, "products", "P", generateProductCode, rows, errs)
+	if err != nil {
+		return nil, err
+	}
+	var dicts [3]*importDictionary
+	for i, d := range [][2]string{{"product_category_dict", "产品分类"}, {"product_brand_dict", "品牌"}, {"product_unit_dict", "单位"}} {
+		if dicts[i], err = loadImportDictionary(q, d[0], d[1]); err != nil {
+			return nil, err
+		}
+	}
+
+	list := make([]importedProduct, 0, len(rows))
+	for i, r := range rows {
+		p := importedProduct{Row: r.Row, CreateProductRequest: CreateProductRequest{
+			Name:     r.Values["name"],
+			Code:     codes[i],
+			Category: dicts[0].resolve(r, "category", errs),
+			Brand:    dicts[1].resolve(r, "brand", errs),
+			Unit:     dicts[2].resolve(r, "unit", errs),
+			Remark:   r.Values["remark"],
+		}}
+		if v := r.Values["price"]; v != "" {
+			price, err := decimal.NewFromString(strings.ReplaceAll(v, ",", ""))
+			if err != nil || !price.IsPositive() {
+				errs.add(r.Row, "price", "价格「%s」必须是大于0的数字", v)
+			}
+			p.Price = roundAmount(price)
+		}
+		status, ok := parseImportStatus(r.Values["status"])
+		if !ok {
+			errs.add(r.Row, "status", "状态只能填写启用或禁用")
+		}
+		p.Status = status
+		list = append(list, p)
+	}
+	return list, nil
+}
+
+// insertProductImport 写入产品及拼音检索列，并逐条记录操作日志
+func insertProductImport(tx *sql.Tx, c *gin.Context, list []importedProduct) error {
+	for _, p := range list {
+		namePinyin, nameInitials := searchPinyin(p.Name)
+		brandPinyin, brandInitials, err := brandSearchPinyin(tx, p.Brand)
+		if err != nil {
+			return fmt.Errorf("第%d行：%w", p.Row, err)
+		}
+		result, err := tx.Exec(
+			"INSERT INTO products (name, code, category, brand, unit, price, status, remark, name_pinyin, name_initials, brand_pinyin, brand_initials) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+			p.Name, p.Code, p.Category, p.Brand, p.Unit, p.Price, p.Status, p.Remark, namePinyin, nameInitials, brandPinyin, brandInitials,
+		)
+		if err != nil {
+			return fmt.Errorf("第%d行：%w", p.Row, err)
+		}
+		id, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+		if err := recordAudit(tx, c, auditProduct, id, auditActionCreate, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var productImportSpec = importSpec[importedProduct]{
+	Name:     "产品",
+	Fields:   productImportFields,
+	validate: validateProductImport,
+	insert:   insertProductImport,
+}
+
+// importProducts 批量导入产品
+func importProducts(c *gin.Context) {
+	runImport(c, productImportSpec)
+}
+
+// ========== 客户导入 ==========
+
+// customerImportFields 客户导入字段，列名与客户列表导出一致
+var customerImportFields = []importField{
+	{Key: "code", Label: "客户编号", Aliases: []string{"编号"}, MaxLen: 20},
+	{Key: "name", Label: "客户姓名", Aliases: []string{"客户名称", "姓名", "名称"}, Required: true, MaxLen: 100},
+	{Key: "phone", Label: "手机号", Aliases: []string{"电话", "手机"}, MaxLen: 20},
+	{Key: "company", Label: "公司名", Aliases: []string{"公司", "公司名称"}, MaxLen: 100},
+	{Key: "province", Label: "省份", MaxLen: 50},
+	{Key: "city", Label: "城市", MaxLen: 50},
+	{Key: "district", Label: "区县", MaxLen: 50},
+	{Key: "address", Label: "地址", MaxLen: 200},
+	{Key: "status", Label: "状态"},
+	{Key: "remark", Label: "备注"},
+}
+
+// customerPhonePattern 手机号格式，与客户表单的校验规则一致
+var customerPhonePattern = regexp.MustCompile(`^1[3-9]\d{9}$`)
+
+// importedCustomer 校验通过的一行客户
+type importedCustomer struct {
+	Row int `json:"row"`
+	CreateCustomerRequest
+}
+
+// validateCustomerImport 校验客户：编号唯一、手机号格式正确
+func validateCustomerImport(q dbExecutor, rows []importRow, errs *importErrors) ([]importedCustomer, error) {
+	codes, err := assignImportCodes(q, "customers", "C", generateCustomerCode, rows, errs)
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]importedCustomer, 0, len(rows))
+	for i, r := range rows {
+		customer := importedCustomer{Row: r.Row, CreateCustomerRequest: CreateCustomerRequest{
+			Name:     r.Values["name"],
+			Code:     codes[i],
+			Phone:    r.Values["phone"],
+			Province: r.Values["province"],
+			City:     r.Values["city"],
+			District: r.Values["district"],
+			Address:  r.Values["address"],
+			Company:  r.Values["company"],
+			Remark:   r.Values["remark"],
+		}}
+		if customer.Phone != "" && !customerPhonePattern.MatchString(customer.Phone) {
+			errs.add(r.Row, "phone", "手机号「%s」格式不正确", customer.Phone)
+		}
+		status, ok := parseImportStatus(r.Values["status"])
+		if !ok {
+			errs.add(r.Row, "status", "状态只能填写启用或禁用")
+		}
+		customer.Status = status
+		list = append(list, customer)
+	}
+	return list, nil
+}
+
+// insertCustomerImport 写入客户及拼音检索列，并逐条记录操作日志
+func insertCustomerImport(tx *sql.Tx, c *gin.Context, list []importedCustomer) error {
+	for _, customer := range list {
+		namePinyin, nameInitials := searchPinyin(customer.Name)
+		companyPinyin, companyInitials := searchPinyin(customer.Company)
+		result, err := tx.Exec(
+			"INSERT INTO customers (name, code, phone, province, city, district, address, company, status, remark, name_pinyin, name_initials, company_pinyin, company_initials) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+			customer.Name, customer.Code, customer.Phone, customer.Province, customer.City, customer.District, customer.Address, customer.Company, customer.Status, customer.Remark, namePinyin, nameInitials, companyPinyin, companyInitials,
+		)
+		if err != nil {
+			return fmt.Errorf("第%d行：%w", customer.Row, err)
+		}
+		id, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+		if err := recordAudit(tx, c, auditCustomer, id, auditActionCreate, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var customerImportSpec = importSpec[importedCustomer]{
+	Name:     "客户",
+	Fields:   customerImportFields,
+	validate: validateCustomerImport,
+	insert:   insertCustomerImport,
+}
+
+// importCustomers 批量导入客户
+func importCustomers(c *gin.Context) {
+	runImport(c, customerImportSpec)
+}
@@ -0,0 +1,354 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+
+	"github.com/shopspring/decimal"
+
+	"nb2/pkg/database"
+)
+
+// ========== 客户对帐单分录 ==========
+//
+// 客户对帐单是按单据记帐的流水：销售订单、收款记录新增、修改、删除时，在同一事务里追加分录。
+// 已入帐的分录不再改金额，单据的客户、日期或金额变化时先追加一条冲销分录，再按新内容追加一条分录。
+// 每条分录的结余是同一客户按 (date, id) 排序累计到该条为止的余额，补记日期较早的分录时顺延调整其后分录的结余。
+// 同一客户的记帐通过锁定客户行串行执行。
+
+const (
+	statementSourceSaleOrder = "sale_order"
+	statementSourcePayment   = "payment"
+
+	ledgerEntryNormal   = "entry"    // 按单据入帐
+	ledgerEntryReversal = "reversal" // 冲销 reversal_of 指向的分录
+)
+
+// ledgerPosting 单据在对帐单上应记的内容
+type ledgerPosting struct {
+	CustomerID    int
+	Date          string
+	SaleAmount    decimal.Decimal
+	PaymentAmount decimal.Decimal
+	Remark        string
+}
+
+// sameAmount 客户、日期和金额都没变时不需要冲销重记
+func (p ledgerPosting) sameAmount(o ledgerPosting) bool {
+	return p.CustomerID == o.CustomerID && p.Date == o.Date &&
+		p.SaleAmount.Equal(o.SaleAmount) && p.PaymentAmount.Equal(o.PaymentAmount)
+}
+
+// ledgerEntry 已入帐且尚未被冲销的分录
+type ledgerEntry struct {
+	ID int
+	ledgerPosting
+}
+
+// ledgerCustomer 分录上冗余保存的客户编号和名称
+type ledgerCustomer struct {
+	Code string
+	Name string
+}
+
+// ledgerDate 只保留日期部分，DATETIME 和带时区的日期都按 YYYY-MM-DD 入帐
+func ledgerDate(s string) string {
+	if len(s) > 10 {
+		return s[:10]
+	}
+	return s
+}
+
+// loadLedgerSource 读取单据当前应记的内容，单据已删除时返回 nil
+func loadLedgerSource(q dbExecutor, sourceType string, sourceID int) (*ledgerPosting, error) {
+	var query string
+	switch sourceType {
+	case statementSourceSaleOrder:
+		query = "SELECT customer_id, create_time, payable_amount, COALESCE(remark, '') FROM sale_orders WHERE id = ?"
+	case statementSourcePayment:
+		query = "SELECT customer_id, payment_date, amount, COALESCE(remark, '') FROM payments WHERE id = ?"
+	default:
+		return nil, fmt.Errorf("unknown statement source type: %s", sourceType)
+	}
+
+	var p ledgerPosting
+	var amount decimal.Decimal
+	err := q.QueryRow(query, sourceID).Scan(&p.CustomerID, &p.Date, &amount, &p.Remark)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	p.Date = ledgerDate(p.Date)
+	if sourceType == statementSourceSaleOrder {
+		p.SaleAmount = amount
+	} else {
+		p.PaymentAmount = amount
+	}
+	return &p, nil
+}
+
+// lockLedgerCustomer 锁定客户行，同一客户的记帐和结余调整串行执行
+func lockLedgerCustomer(q dbExecutor, customerID int) (ledgerCustomer, error) {
+	var c ledgerCustomer
+	err := q.QueryRow("SELECT COALESCE(code, ''), name FROM customers WHERE id = ?"+database.CurrentDialect().ForUpdate(), customerID).Scan(&c.Code, &c.Name)
+	return c, err
+}
+
+// ledgerSourceCustomers 单据分录所在的客户，更换过客户的单据会有多个
+func ledgerSourceCustomers(q dbExecutor, sourceType string, sourceID int) ([]int, error) {
+	rows, err := q.Query("SELECT DISTINCT customer_id FROM statement_records WHERE source_type = ? AND source_id = ?", sourceType, sourceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// activeLedgerEntries 单据在某个客户名下尚未被冲销的分录，正常情况下至多一条
+// 客户行已锁定，这里用锁定读取拿到最新提交的分录
+func activeLedgerEntries(q dbExecutor, customerID int, sourceType string, sourceID int) ([]ledgerEntry, error) {
+	rows, err := q.Query(
+		"SELECT id, entry_type, reversal_of, date, sale_amount, payment_amount, COALESCE(remark, '') FROM statement_records WHERE customer_id = ? AND source_type = ? AND source_id = ? ORDER BY id"+database.CurrentDialect().ForUpdate(),
+		customerID, sourceType, sourceID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []ledgerEntry
+	reversed := make(map[int]bool)
+	for rows.Next() {
+		var e ledgerEntry
+		var entryType string
+		var reversalOf sql.NullInt64
+		if err := rows.Scan(&e.ID, &entryType, &reversalOf, &e.Date, &e.SaleAmount, &e.PaymentAmount, &e.Remark); err != nil {
+			return nil, err
+		}
+		if entryType == ledgerEntryReversal {
+			reversed[int(reversalOf.Int64)] = true
+			continue
+		}
+		e.CustomerID = customerID
+		e.Date = ledgerDate(e.Date)
+		entries = append(entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	active := entries[:0]
+	for _, e := range entries {
+		if !reversed[e.ID] {
+			active = append(active, e)
+		}
+	}
+	return active, nil
+}
+
+// appendLedgerEntry 追加一条分录，结余接在同一客户该日期（含）之前的最后一条分录之后，
+// 日期更晚的分录结余顺延调整
+func appendLedgerEntry(q dbExecutor, customer ledgerCustomer, p ledgerPosting, sourceType string, sourceID int, entryType string, reversalOf interface{}) error {
+	var balance decimal.Decimal
+	err := q.QueryRow(
+		"SELECT balance FROM statement_records WHERE customer_id = ? AND date <= ? ORDER BY date DESC, id DESC LIMIT 1"+database.CurrentDialect().ForUpdate(),
+		p.CustomerID, p.Date,
+	).Scan(&balance)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	balance = roundAmount(balance.Add(p.SaleAmount).Sub(p.PaymentAmount))
+
+	_, err = q.Exec(
+		"INSERT INTO statement_records (customer_id, customer_code, customer_name, date, sale_amount, payment_amount, balance, remark, source_type, source_id, entry_type, reversal_of) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		p.CustomerID, customer.Code, customer.Name, p.Date, p.SaleAmount, p.PaymentAmount, balance, p.Remark, sourceType, sourceID, entryType, reversalOf,
+	)
+	if err != nil {
+		return err
+	}
+
+	if p.SaleAmount.Equal(p.PaymentAmount) {
+		return nil
+	}
+	return updateLedgerBalances(q, balance,
+		"SELECT id, sale_amount, payment_amount, balance FROM statement_records WHERE customer_id = ? AND date > ? ORDER BY date, id"+database.CurrentDialect().ForUpdate(),
+		p.CustomerID, p.Date,
+	)
+}
+
+// postStatementEntries 在单据所在事务中按单据当前内容记帐：
+// 新单据追加分录；客户、日期或金额变化时冲销原分录再追加新分录；单据已删除时只冲销
+func postStatementEntries(q dbExecutor, sourceType string, sourceID int) error {
+	source, err := loadLedgerSource(q, sourceType, sourceID)
+	if err != nil {
+		return err
+	}
+
+	// 单据原先所在的客户和现在的客户都要锁定，按ID顺序加锁避免死锁
+	customerIDs, err := ledgerSourceCustomers(q, sourceType, sourceID)
+	if err != nil {
+		return err
+	}
+	if source != nil {
+		customerIDs = append(customerIDs, source.CustomerID)
+	}
+	sort.Ints(customerIDs)
+
+	customers := make(map[int]ledgerCustomer)
+	var active []ledgerEntry
+	for _, customerID := range customerIDs {
+		if _, ok := customers[customerID]; ok {
+			continue
+		}
+		customer, err := lockLedgerCustomer(q, customerID)
+		if err != nil {
+			return fmt.Errorf("lock customer %d: %w", customerID, err)
+		}
+		customers[customerID] = customer
+
+		entries, err := activeLedgerEntries(q, customerID, sourceType, sourceID)
+		if err != nil {
+			return err
+		}
+		active = append(active, entries...)
+	}
+
+	if source != nil && len(active) == 1 && active[0].sameAmount(*source) {
+		// 备注不影响金额，只改了备注时直接更新，不产生冲销分录
+		if active[0].Remark != source.Remark {
+			_, err := q.Exec("UPDATE statement_records SET remark = ? WHERE id = ?", source.Remark, active[0].ID)
+			return err
+		}
+		return nil
+	}
+
+	reason := "单据已修改，冲销原分录"
+	if source == nil {
+		reason = "单据已删除，冲销原分录"
+	}
+	for _, e := range active {
+		reversal := ledgerPosting{
+			CustomerID:    e.CustomerID,
+			Date:          e.Date,
+			SaleAmount:    e.SaleAmount.Neg(),
+			PaymentAmount: e.PaymentAmount.Neg(),
+			Remark:        reason,
+		}
+		if err := appendLedgerEntry(q, customers[e.CustomerID], reversal, sourceType, sourceID, ledgerEntryReversal, e.ID); err != nil {
+			return err
+		}
+	}
+
+	if source == nil {
+		return nil
+	}
+	return appendLedgerEntry(q, customers[source.CustomerID], *source, sourceType, sourceID, ledgerEntryNormal, nil)
+}
+
+// ledgerSource 对帐单分录的来源单据
+type ledgerSource struct {
+	Type string
+	ID   int
+}
+
+// reconcileCustomerLedger 按销售订单和收款记录校对客户的对帐单：
+// 补记未入帐的单据，冲销已删除或已改到其他客户的单据，刷新冗余的客户编号和名称，最后按 (date, id) 重算结余
+// 只追加分录，不删除已有分录
+func reconcileCustomerLedger(q dbExecutor, customerID int) error {
+	customer, err := lockLedgerCustomer(q, customerID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := q.Query(
+		"SELECT 'sale_order', id FROM sale_orders WHERE customer_id = ? UNION SELECT 'payment', id FROM payments WHERE customer_id = ? UNION SELECT source_type, source_id FROM statement_records WHERE customer_id = ?",
+		customerID, customerID, customerID,
+	)
+	if err != nil {
+		return err
+	}
+	var sources []ledgerSource
+	for rows.Next() {
+		var s ledgerSource
+		if err := rows.Scan(&s.Type, &s.ID); err != nil {
+			rows.Close()
+			return err
+		}
+		sources = append(sources, s)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, s := range sources {
+		if err := postStatementEntries(q, s.Type, s.ID); err != nil {
+			return fmt.Errorf("post %s %d: %w", s.Type, s.ID, err)
+		}
+	}
+
+	_, err = q.Exec(
+		"UPDATE statement_records SET customer_code = ?, customer_name = ? WHERE customer_id = ? AND (customer_code <> ? OR customer_name <> ?)",
+		customer.Code, customer.Name, customerID, customer.Code, customer.Name,
+	)
+	if err != nil {
+		return err
+	}
+	return rebalanceCustomerLedger(q, customerID)
+}
+
+// rebalanceCustomerLedger 按 (date, id) 顺序重算客户全部分录的结余
+func rebalanceCustomerLedger(q dbExecutor, customerID int) error {
+	return updateLedgerBalances(q, decimal.Zero, "SELECT id, sale_amount, payment_amount, balance FROM statement_records WHERE customer_id = ? ORDER BY date, id", customerID)
+}
+
+// updateLedgerBalances 从 opening 开始按查询顺序逐条累计结余，只更新与累计结果不一致的分录
+// 查询依次返回 id、sale_amount、payment_amount、balance。结余在Go中用decimal计算，
+// 不在SQL里做 balance + ? 之类的加减：SQLite 按浮点数保存 DECIMAL 列，多次累加会偏离到分以下
+func updateLedgerBalances(q dbExecutor, opening decimal.Decimal, query string, args ...interface{}) error {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	type fix struct {
+		ID      int
+		Balance decimal.Decimal
+	}
+	var fixes []fix
+	balance := opening
+	for rows.Next() {
+		var id int
+		var sale, payment, stored decimal.Decimal
+		if err := rows.Scan(&id, &sale, &payment, &stored); err != nil {
+			rows.Close()
+			return err
+		}
+		balance = roundAmount(balance.Add(sale).Sub(payment))
+		if !stored.Equal(balance) {
+			fixes = append(fixes, fix{ID: id, Balance: balance})
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, f := range fixes {
+		if _, err := q.Exec("UPDATE statement_records SET balance = ? WHERE id = ?", f.Balance, f.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
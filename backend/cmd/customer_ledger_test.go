@@ -0,0 +1,130 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/shopspring/decimal"
+
+	"nb2/pkg/database"
+)
+
+// postLedger 在单独的事务中按单据当前内容记帐
+func postLedger(t *testing.T, sourceType string, sourceID int) {
+	t.Helper()
+	tx, err := database.DB.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	if err := postStatementEntries(tx, sourceType, sourceID); err != nil {
+		t.Fatalf("postStatementEntries(%s, %d): %v", sourceType, sourceID, err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// ledgerRow 按 (date, id) 排序后的一条分录
+type ledgerRow struct {
+	Date    string
+	Sale    string
+	Payment string
+	Balance string
+}
+
+func assertLedger(t *testing.T, customerID int, want []ledgerRow) {
+	t.Helper()
+	rows, err := database.DB.Query("SELECT date, sale_amount, payment_amount, balance FROM statement_records WHERE customer_id = ? ORDER BY date, id", customerID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var got []ledgerRow
+	for rows.Next() {
+		var date string
+		var sale, payment, balance decimal.Decimal
+		if err := rows.Scan(&date, &sale, &payment, &balance); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, ledgerRow{ledgerDate(date), sale.StringFixed(moneyScale), payment.StringFixed(moneyScale), balance.String()})
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("ledger = %v, want %v", got, want)
+	}
+	for i := range want {
+		// 结余按原值比较，不能有分以下的浮点误差
+		if w := want[i]; got[i].Date != w.Date || got[i].Sale != w.Sale || got[i].Payment != w.Payment || !decimal.RequireFromString(got[i].Balance).Equal(decimal.RequireFromString(w.Balance)) {
+			t.Fatalf("ledger row %d = %v, want %v\nledger = %v", i, got[i], w, got)
+		}
+	}
+}
+
+func TestCustomerLedgerBalancesExactOnSQLite(t *testing.T) {
+	openTestDB(t)
+	customerID := mustExec(t, "INSERT INTO customers (code, name, phone) VALUES (?, ?, ?)", "C00001", "张三", "13800000000")
+	newPayment := func(code, date, amount string) int {
+		return mustExec(t, "INSERT INTO payments (code, payment_date, customer_id, amount) VALUES (?, ?, ?, ?)", code, date, customerID, amount)
+	}
+
+	orderID := mustExec(t, "INSERT INTO sale_orders (code, create_time, customer_id, customer_name, customer_phone, total_amount, payable_amount) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		"SO000001", "2026-03-10 09:00:00", customerID, "张三", "13800000000", "0.30", "0.30")
+	postLedger(t, statementSourceSaleOrder, orderID)
+
+	p1 := newPayment("P000001", "2026-03-15", "0.10")
+	postLedger(t, statementSourcePayment, p1)
+	assertLedger(t, customerID, []ledgerRow{
+		{"2026-03-10", "0.30", "0.00", "0.3"},
+		{"2026-03-15", "0.00", "0.10", "0.2"},
+	})
+
+	// 补记日期更早的收款，其后分录的结余顺延，0.3 - 0.2 不能变成 0.09999999999999998
+	p2 := newPayment("P000002", "2026-03-01", "0.20")
+	postLedger(t, statementSourcePayment, p2)
+	assertLedger(t, customerID, []ledgerRow{
+		{"2026-03-01", "0.00", "0.20", "-0.2"},
+		{"2026-03-10", "0.30", "0.00", "0.1"},
+		{"2026-03-15", "0.00", "0.10", "0"},
+	})
+
+	// 删除补记的收款：冲销分录记在原日期，其后分录结余恢复
+	if _, err := database.DB.Exec("DELETE FROM payments WHERE id = ?", p2); err != nil {
+		t.Fatal(err)
+	}
+	postLedger(t, statementSourcePayment, p2)
+	assertLedger(t, customerID, []ledgerRow{
+		{"2026-03-01", "0.00", "0.20", "-0.2"},
+		{"2026-03-01", "0.00", "-0.20", "0"},
+		{"2026-03-10", "0.30", "0.00", "0.3"},
+		{"2026-03-15", "0.00", "0.10", "0.2"},
+	})
+
+	// 收款改到更早的日期并改金额：原日期冲销，新日期重记
+	if _, err := database.DB.Exec("UPDATE payments SET payment_date = ?, amount = ? WHERE id = ?", "2026-03-05", "0.20", p1); err != nil {
+		t.Fatal(err)
+	}
+	postLedger(t, statementSourcePayment, p1)
+	assertLedger(t, customerID, []ledgerRow{
+		{"2026-03-01", "0.00", "0.20", "-0.2"},
+		{"2026-03-01", "0.00", "-0.20", "0"},
+		{"2026-03-05", "0.00", "0.20", "-0.2"},
+		{"2026-03-10", "0.30", "0.00", "0.1"},
+		{"2026-03-15", "0.00", "0.10", "0"},
+		{"2026-03-15", "0.00", "-0.10", "0.1"},
+	})
+
+	// 逐笔记帐的结余与整体重算一致
+	if err := rebalanceCustomerLedger(database.DB, customerID); err != nil {
+		t.Fatal(err)
+	}
+	assertLedger(t, customerID, []ledgerRow{
+		{"2026-03-01", "0.00", "0.20", "-0.2"},
+		{"2026-03-01", "0.00", "-0.20", "0"},
+		{"2026-03-05", "0.00", "0.20", "-0.2"},
+		{"2026-03-10", "0.30", "0.00", "0.1"},
+		{"2026-03-15", "0.00", "0.10", "0"},
+		{"2026-03-15", "0.00", "-0.10", "0.1"},
+	})
+}
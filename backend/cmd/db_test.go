@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"nb2/internal/config"
+	"nb2/pkg/database"
+)
+
+// openTestDB 在临时目录创建执行过全部迁移的SQLite数据库，测试结束后关闭
+func openTestDB(t *testing.T) {
+	t.Helper()
+	cfg := &config.DatabaseConfig{Driver: "sqlite", Path: filepath.Join(t.TempDir(), "nb2.db"), AutoMigrate: true}
+	if err := database.InitDB(cfg); err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	t.Cleanup(database.CloseDB)
+}
+
+// mustExec 执行SQL并返回自增ID
+func mustExec(t *testing.T, query string, args ...interface{}) int {
+	t.Helper()
+	result, err := database.DB.Exec(query, args...)
+	if err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return int(id)
+}
+
+// callHandler 以JSON请求体调用处理函数，params 为路由参数（如 "id"）
+func callHandler(t *testing.T, handler gin.HandlerFunc, method string, body interface{}, params ...gin.Param) *httptest.ResponseRecorder {
+	t.Helper()
+	var reader *bytes.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader = bytes.NewReader(data)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(method, "/", reader)
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Params = params
+	handler(c)
+	return w
+}
+
+// createTestSaleOrder 通过创建接口新建销售订单，返回订单ID
+func createTestSaleOrder(t *testing.T, req CreateSaleOrderRequest) int {
+	t.Helper()
+	w := callHandler(t, createSaleOrder, http.MethodPost, req)
+	if w.Code != http.StatusOK && w.Code != http.StatusCreated {
+		t.Fatalf("createSaleOrder: %d %s", w.Code, w.Body.String())
+	}
+	var so SaleOrder
+	if err := json.Unmarshal(w.Body.Bytes(), &so); err != nil {
+		t.Fatalf("decode sale order: %v (%s)", err, w.Body.String())
+	}
+	return so.ID
+}
@@ -0,0 +1,400 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+
+	"nb2/pkg/database"
+)
+
+// ========== 库存相关模型 ==========
+
+// ProductStock 产品库存
+type ProductStock struct {
+	ProductID         int             `json:"productId"`
+	ProductCode       string          `json:"productCode"`
+	ProductName       string          `json:"productName"`
+	Category          string          `json:"category"`
+	Brand             string          `json:"brand"`
+	Unit              string          `json:"unit"`
+	Status            int             `json:"status"`
+	StockQuantity     decimal.Decimal `json:"stockQuantity"`
+	LowStockThreshold decimal.Decimal `json:"lowStockThreshold"`
+	IsLowStock        bool            `json:"isLowStock"`
+}
+
+// StockMovement 库存流水
+type StockMovement struct {
+	ID           int             `json:"id"`
+	ProductID    int             `json:"productId"`
+	MovementType string          `json:"movementType"`
+	Quantity     decimal.Decimal `json:"quantity"`
+	Balance      decimal.Decimal `json:"balance"`
+	SourceType   string          `json:"sourceType"`
+	SourceID     int             `json:"sourceId"`
+	Reason       string          `json:"reason"`
+	UserID       int             `json:"userId"`
+	Username     string          `json:"username"`
+	CreatedAt    string          `json:"createdAt"`
+}
+
+// StockAdjustmentRequest 手工调整库存请求，quantity 为变动数量（正数入库，负数出库）
+type StockAdjustmentRequest struct {
+	ProductID int             `json:"productId" binding:"required"`
+	Quantity  decimal.Decimal `json:"quantity" binding:"required"`
+	Reason    string          `json:"reason" binding:"required"`
+}
+
+// UpdateStockThresholdRequest 设置低库存预警值请求
+type UpdateStockThresholdRequest struct {
+	LowStockThreshold *decimal.Decimal `json:"lowStockThreshold" binding:"required,gte=0"`
+}
+
+// 库存流水类型
+const (
+	movementSaleOut      = "sale_out"      // 销售出库
+	movementSaleAdjust   = "sale_adjust"   // 修改销售单调整
+	movementSaleReverse  = "sale_reverse"  // 删除销售单冲回
+	movementManualAdjust = "manual_adjust" // 手工调整
+	movementPurchaseIn   = "purchase_in"   // 进货收货入库
+)
+
+// productStockSelect 查询产品库存的语句
+const productStockSelect = "SELECT id, COALESCE(code, ''), name, COALESCE(category, ''), COALESCE(brand, ''), COALESCE(unit, ''), status, stock_quantity, low_stock_threshold FROM products"
+
+// applyStockMovement 在事务中变动产品库存并写入流水，产品已被删除时忽略
+// 锁定产品行后在Go中计算变动后的库存，不在SQL里做加减（SQLite 按浮点数保存 DECIMAL 列）
+func applyStockMovement(tx *sql.Tx, c *gin.Context, productID int, change decimal.Decimal, movementType, sourceType string, sourceID int, reason string) error {
+	var stock decimal.Decimal
+	err := tx.QueryRow("SELECT stock_quantity FROM products WHERE id = ?"+database.CurrentDialect().ForUpdate(), productID).Scan(&stock)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	balance := roundQuantity(stock.Add(change))
+	if _, err := tx.Exec("UPDATE products SET stock_quantity = ? WHERE id = ?", balance, productID); err != nil {
+		return err
+	}
+
+	var userID interface{}
+	if id := c.GetInt(ctxUserIDKey); id > 0 {
+		userID = id
+	}
+	var source interface{}
+	if sourceID > 0 {
+		source = sourceID
+	}
+	_, err = tx.Exec(
+		"INSERT INTO stock_movements (product_id, movement_type, quantity, balance, source_type, source_id, reason, user_id, username) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		productID, movementType, change, balance, sourceType, source, reason, userID, c.GetString(ctxUsernameKey),
+	)
+	return err
+}
+
+// saleOrderStockQuantities 按产品汇总销售订单的商品数量
+func saleOrderStockQuantities(tx *sql.Tx, saleOrderID int) (map[int]decimal.Decimal, error) {
+	rows, err := tx.Query("SELECT product_id, SUM(quantity) FROM sale_order_items WHERE sale_order_id = ? GROUP BY product_id", saleOrderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	quantities := make(map[int]decimal.Decimal)
+	for rows.Next() {
+		var productID int
+		var quantity decimal.Decimal
+		if err := rows.Scan(&productID, &quantity); err != nil {
+			return nil, err
+		}
+		quantities[productID] = roundQuantity(quantity)
+	}
+	return quantities, rows.Err()
+}
+
+// applySaleOrderStock 根据销售订单修改前后的商品数量变动库存
+// 新建订单 before 为空（出库），删除订单 after 为空（冲回），修改订单只记录差额
+func applySaleOrderStock(tx *sql.Tx, c *gin.Context, saleOrderID int, before, after map[int]decimal.Decimal, movementType string) error {
+	productIDs := make([]int, 0, len(before)+len(after))
+	for id := range before {
+		productIDs = append(productIDs, id)
+	}
+	for id := range after {
+		if _, ok := before[id]; !ok {
+			productIDs = append(productIDs, id)
+		}
+	}
+	// 固定加锁顺序，避免并发修改订单时死锁
+	sort.Ints(productIDs)
+
+	for _, productID := range productIDs {
+		change := roundQuantity(before[productID].Sub(after[productID]))
+		if change.IsZero() {
+			continue
+		}
+		if err := applyStockMovement(tx, c, productID, change, movementType, "sale_order", saleOrderID, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getInventory 获取产品库存列表，lowStock=1 时只返回低于预警值的产品
+func getInventory(c *gin.Context) {
+	keyword := c.Query("keyword")
+	lowStock := c.Query("lowStock") == "1"
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("pageSize", "100"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 {
+		pageSize = 100
+	}
+
+	where := " WHERE 1=1"
+	args := []interface{}{}
+	if keyword != "" {
+		where += " AND (code LIKE ? OR name LIKE ? OR brand LIKE ?)"
+		like := "%" + keyword + "%"
+		args = append(args, like, like, like)
+	}
+	if lowStock {
+		where += " AND low_stock_threshold > 0 AND stock_quantity < low_stock_threshold"
+	}
+
+	var total int
+	if err := database.DB.QueryRow("SELECT COUNT(*) FROM products"+where, args...).Scan(&total); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count inventory"})
+		return
+	}
+
+	query := productStockSelect +
+		where + " ORDER BY code LIMIT ? OFFSET ?"
+	records, err := queryProductStocks(query, append(args, pageSize, (page-1)*pageSize)...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch inventory"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"total":   total,
+		"records": records,
+	})
+}
+
+// getLowStockProducts 获取低于预警值的启用产品，缺口大的排在前面
+func getLowStockProducts(c *gin.Context) {
+	records, err := queryProductStocks(productStockSelect +
+		" WHERE status = 1 AND low_stock_threshold > 0 AND stock_quantity < low_stock_threshold" +
+		" ORDER BY low_stock_threshold - stock_quantity DESC, code")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch low stock products"})
+		return
+	}
+	c.JSON(http.StatusOK, records)
+}
+
+// queryProductStocks 查询产品库存列表
+func queryProductStocks(query string, args ...interface{}) ([]ProductStock, error) {
+	rows, err := database.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	records := []ProductStock{}
+	for rows.Next() {
+		var s ProductStock
+		if err := rows.Scan(&s.ProductID, &s.ProductCode, &s.ProductName, &s.Category, &s.Brand, &s.Unit, &s.Status, &s.StockQuantity, &s.LowStockThreshold); err != nil {
+			return nil, err
+		}
+		s.IsLowStock = s.LowStockThreshold.IsPositive() && s.StockQuantity.LessThan(s.LowStockThreshold)
+		records = append(records, s)
+	}
+	return records, rows.Err()
+}
+
+// getStockMovements 获取产品的库存流水
+func getStockMovements(c *gin.Context) {
+	productID, err := strconv.Atoi(c.Param("productId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+	startTime := c.Query("startTime")
+	endTime := c.Query("endTime")
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("pageSize", "100"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 {
+		pageSize = 100
+	}
+
+	var exists bool
+	database.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM products WHERE id = ?)", productID).Scan(&exists)
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		return
+	}
+
+	where := " WHERE product_id = ?"
+	args := []interface{}{productID}
+	if startTime != "" {
+		where += " AND created_at >= ?"
+		args = append(args, startTime)
+	}
+	if endTime != "" {
+		// 只传日期时包含当天全部记录
+		if len(endTime) == len("2006-01-02") {
+			endTime += " 23:59:59"
+		}
+		where += " AND created_at <= ?"
+		args = append(args, endTime)
+	}
+
+	var total int
+	if err := database.DB.QueryRow("SELECT COUNT(*) FROM stock_movements"+where, args...).Scan(&total); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count stock movements"})
+		return
+	}
+
+	query := "SELECT id, product_id, movement_type, quantity, balance, COALESCE(source_type, ''), COALESCE(source_id, 0), COALESCE(reason, ''), COALESCE(user_id, 0), COALESCE(username, ''), created_at FROM stock_movements" +
+		where + " ORDER BY id DESC LIMIT ? OFFSET ?"
+	rows, err := database.DB.Query(query, append(args, pageSize, (page-1)*pageSize)...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch stock movements"})
+		return
+	}
+	defer rows.Close()
+
+	records := []StockMovement{}
+	for rows.Next() {
+		var m StockMovement
+		if err := rows.Scan(&m.ID, &m.ProductID, &m.MovementType, &m.Quantity, &m.Balance, &m.SourceType, &m.SourceID, &m.Reason, &m.UserID, &m.Username, &m.CreatedAt); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan stock movement"})
+			return
+		}
+		records = append(records, m)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"total":   total,
+		"records": records,
+	})
+}
+
+// createStockAdjustment 手工调整库存（盘点、报损、采购入库等），必须填写原因
+func createStockAdjustment(c *gin.Context) {
+	var req StockAdjustmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	change := roundQuantity(req.Quantity)
+	if change.IsZero() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Adjustment quantity must not be zero"})
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction: " + err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	before, err := snapshotEntity(tx, auditProduct, req.ProductID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch product: " + err.Error()})
+		return
+	}
+	if before == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		return
+	}
+
+	if err := applyStockMovement(tx, c, req.ProductID, change, movementManualAdjust, "", 0, req.Reason); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to adjust stock: " + err.Error()})
+		return
+	}
+	if err := recordAudit(tx, c, auditProduct, req.ProductID, auditActionUpdate, before); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write audit log: " + err.Error()})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction: " + err.Error()})
+		return
+	}
+
+	records, err := queryProductStocks(productStockSelect+" WHERE id = ?", req.ProductID)
+	if err != nil || len(records) == 0 {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch product stock"})
+		return
+	}
+	c.JSON(http.StatusOK, records[0])
+}
+
+// updateStockThreshold 设置产品的低库存预警值，0 表示不预警
+func updateStockThreshold(c *gin.Context) {
+	productID, err := strconv.Atoi(c.Param("productId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+
+	var req UpdateStockThresholdRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 开始事务，操作日志与数据一起提交
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction: " + err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	before, err := snapshotEntity(tx, auditProduct, productID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch product"})
+		return
+	}
+	if before == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		return
+	}
+
+	if _, err := tx.Exec("UPDATE products SET low_stock_threshold = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?", roundQuantity(*req.LowStockThreshold), productID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update low stock threshold"})
+		return
+	}
+	if err := recordAudit(tx, c, auditProduct, productID, auditActionUpdate, before); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write audit log: " + err.Error()})
+		return
+	}
+
+	// 提交事务
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction: " + err.Error()})
+		return
+	}
+
+	records, err := queryProductStocks(productStockSelect+" WHERE id = ?", productID)
+	if err != nil || len(records) == 0 {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch product stock"})
+		return
+	}
+	c.JSON(http.StatusOK, records[0])
+}
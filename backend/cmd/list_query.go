@@ -0,0 +1,192 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"nb2/pkg/database"
+)
+
+// 列表接口统一的分页、排序和筛选
+// 请求参数：page（从1开始）、pageSize、sort（排序字段）、order（asc/desc），以及各列表自己的筛选条件
+// 返回格式与对帐单、库存列表一致：{"total": 总数, "records": 当前页记录}
+
+const (
+	defaultPageSize = 100
+	maxPageSize     = 1000
+)
+
+// listSort 列表允许的排序字段
+type listSort struct {
+	Fields     map[string]string // 请求中的排序字段 → 数据库列，不在其中的字段一律拒绝
+	Default    string            // 未指定 sort 时使用的字段
+	Desc       bool              // 未指定 order 时是否倒序
+	TieBreaker string            // 排序值相同时追加的唯一列，保证翻页时顺序稳定
+}
+
+// listQuery 一次列表查询的分页、排序和筛选条件
+type listQuery struct {
+	c         *gin.Context
+	page      int
+	pageSize  int
+	orderBy   string
+	orderArgs []interface{}
+	conds     []string
+	args      []interface{}
+	err       error
+}
+
+// newListQuery 解析分页和排序参数，参数不合法时返回错误
+func newListQuery(c *gin.Context, sort listSort) (*listQuery, error) {
+	q := &listQuery{c: c, page: 1, pageSize: defaultPageSize}
+
+	if s := c.Query("page"); s != "" {
+		page, err := strconv.Atoi(s)
+		if err != nil || page < 1 {
+			return nil, fmt.Errorf("Invalid page")
+		}
+		q.page = page
+	}
+	if s := c.Query("pageSize"); s != "" {
+		pageSize, err := strconv.Atoi(s)
+		if err != nil || pageSize < 1 || pageSize > maxPageSize {
+			return nil, fmt.Errorf("Invalid pageSize, must be between 1 and %d", maxPageSize)
+		}
+		q.pageSize = pageSize
+	}
+
+	field := sort.Default
+	if s := c.Query("sort"); s != "" {
+		field = s
+	}
+	column, ok := sort.Fields[field]
+	if !ok {
+		return nil, fmt.Errorf("Invalid sort field: %s", field)
+	}
+
+	desc := sort.Desc
+	switch strings.ToLower(c.Query("order")) {
+	case "":
+	case "asc", "ascend":
+		desc = false
+	case "desc", "descend":
+		desc = true
+	default:
+		return nil, fmt.Errorf("Invalid order, must be asc or desc")
+	}
+	direction := " ASC"
+	if desc {
+		direction = " DESC"
+	}
+	q.orderBy = column + direction
+	if sort.TieBreaker != "" && sort.TieBreaker != column {
+		q.orderBy += ", " + sort.TieBreaker + direction
+	}
+	return q, nil
+}
+
+// where 追加一个筛选条件
+func (q *listQuery) where(cond string, args ...interface{}) {
+	q.conds = append(q.conds, cond)
+	q.args = append(q.args, args...)
+}
+
+// eq 参数不为空时按列精确匹配
+func (q *listQuery) eq(param, column string) {
+	if v := strings.TrimSpace(q.c.Query(param)); v != "" {
+		q.where(column+" = ?", v)
+	}
+}
+
+// intEq 参数不为空时按整数列精确匹配，如 customerId
+func (q *listQuery) intEq(param, column string) {
+	s := strings.TrimSpace(q.c.Query(param))
+	if s == "" {
+		return
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		q.fail("Invalid %s", param)
+		return
+	}
+	q.where(column+" = ?", v)
+}
+
+// contains 参数不为空时在任一列中模糊匹配
+func (q *listQuery) contains(param string, columns ...string) {
+	v := strings.TrimSpace(q.c.Query(param))
+	if v == "" {
+		return
+	}
+	like := "%" + v + "%"
+	conds := make([]string, len(columns))
+	args := make([]interface{}, len(columns))
+	for i, column := range columns {
+		conds[i] = column + " LIKE ?"
+		args[i] = like
+	}
+	q.where("("+strings.Join(conds, " OR ")+")", args...)
+}
+
+// dateRange 按 startDate、endDate（YYYY-MM-DD，均包含当天）筛选日期或时间列
+func (q *listQuery) dateRange(column string) {
+	if s := strings.TrimSpace(q.c.Query("startDate")); s != "" {
+		start, err := time.Parse("2006-01-02", s)
+		if err != nil {
+			q.fail("Invalid startDate, expected YYYY-MM-DD")
+			return
+		}
+		q.where(column+" >= ?", start.Format("2006-01-02"))
+	}
+	if s := strings.TrimSpace(q.c.Query("endDate")); s != "" {
+		end, err := time.Parse("2006-01-02", s)
+		if err != nil {
+			q.fail("Invalid endDate, expected YYYY-MM-DD")
+			return
+		}
+		// 时间列上 <= 当天会漏掉当天 0 点以后的记录，改用 < 次日
+		q.where(column+" < ?", end.AddDate(0, 0, 1).Format("2006-01-02"))
+	}
+}
+
+// rankFirst 未指定 sort 时先按相关度排序，如关键字搜索时编号完全匹配的排在最前
+func (q *listQuery) rankFirst(expr string, args ...interface{}) {
+	if q.c.Query("sort") != "" {
+		return
+	}
+	q.orderBy = expr + ", " + q.orderBy
+	q.orderArgs = append(q.orderArgs, args...)
+}
+
+// fail 记录第一个不合法的筛选参数
+func (q *listQuery) fail(format string, args ...interface{}) {
+	if q.err == nil {
+		q.err = fmt.Errorf(format, args...)
+	}
+}
+
+// whereSQL 拼接后的 WHERE 子句，没有条件时为空
+func (q *listQuery) whereSQL() string {
+	if len(q.conds) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(q.conds, " AND ")
+}
+
+// count 统计满足筛选条件的记录总数，from 为 FROM 之后的表和连接
+func (q *listQuery) count(from string) (int, error) {
+	var total int
+	err := database.DB.QueryRow("SELECT COUNT(*) FROM "+from+q.whereSQL(), q.args...).Scan(&total)
+	return total, err
+}
+
+// pageSQL 在查询语句后拼接筛选、排序和分页，返回完整语句和参数
+func (q *listQuery) pageSQL(selectSQL string) (string, []interface{}) {
+	query := selectSQL + q.whereSQL() + " ORDER BY " + q.orderBy + " LIMIT ? OFFSET ?"
+	args := append(append(append([]interface{}{}, q.args...), q.orderArgs...), q.pageSize, (q.page-1)*q.pageSize)
+	return query, args
+}
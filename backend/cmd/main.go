@@ -7,12 +7,15 @@ import (
 	"log"
 	"math/rand"
 	"net/http"
+	"os"
 	"sort"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/robfig/cron/v3"
+	"github.com/shopspring/decimal"
 
 	"nb2/internal/config"
 	"nb2/pkg/database"
@@ -20,41 +23,41 @@ import (
 
 // Product 产品模型
 type Product struct {
-	ID        int     `json:"id"`
-	Name      string  `json:"name"`
-	Code      string  `json:"code"`
-	Category  string  `json:"category"`
-	Brand     string  `json:"brand"`
-	Unit      string  `json:"unit"`
-	Price     float64 `json:"price"`
-	Status    int     `json:"status"`
-	Remark    string  `json:"remark"`
-	CreatedAt string  `json:"createdAt"`
-	UpdatedAt string  `json:"updatedAt"`
+	ID        int             `json:"id"`
+	Name      string          `json:"name"`
+	Code      string          `json:"code"`
+	Category  string          `json:"category"`
+	Brand     string          `json:"brand"`
+	Unit      string          `json:"unit"`
+	Price     decimal.Decimal `json:"price"`
+	Status    int             `json:"status"`
+	Remark    string          `json:"remark"`
+	CreatedAt string          `json:"createdAt"`
+	UpdatedAt string          `json:"updatedAt"`
 }
 
 // CreateProductRequest 创建产品请求
 type CreateProductRequest struct {
-	Name     string  `json:"name" binding:"required"`
-	Code     string  `json:"code"`
-	Category string  `json:"category"`
-	Brand    string  `json:"brand"`
-	Unit     string  `json:"unit"`
-	Price    float64 `json:"price" binding:"required,gt=0"`
-	Status   int     `json:"status"`
-	Remark   string  `json:"remark"`
+	Name     string          `json:"name" binding:"required"`
+	Code     string          `json:"code"`
+	Category string          `json:"category"`
+	Brand    string          `json:"brand"`
+	Unit     string          `json:"unit"`
+	Price    decimal.Decimal `json:"price" binding:"required,gt=0"`
+	Status   int             `json:"status"`
+	Remark   string          `json:"remark"`
 }
 
 // UpdateProductRequest 更新产品请求
 type UpdateProductRequest struct {
-	Name     string  `json:"name"`
-	Code     string  `json:"code"`
-	Category string  `json:"category"`
-	Brand    string  `json:"brand"`
-	Unit     string  `json:"unit"`
-	Price    float64 `json:"price" binding:"omitempty,gt=0"`
-	Status   int     `json:"status"`
-	Remark   string  `json:"remark"`
+	Name     string          `json:"name"`
+	Code     string          `json:"code"`
+	Category string          `json:"category"`
+	Brand    string          `json:"brand"`
+	Unit     string          `json:"unit"`
+	Price    decimal.Decimal `json:"price" binding:"omitempty,gt=0"`
+	Status   int             `json:"status"`
+	Remark   string          `json:"remark"`
 }
 
 // DictionaryType 字典类型模型
@@ -202,43 +205,44 @@ type UpdateInvoiceRequest struct {
 
 // Payment 收款记录模型
 type Payment struct {
-	ID            int     `json:"id"`
-	Code          string  `json:"code"`
-	PaymentDate   string  `json:"paymentDate"`
-	CustomerID    int     `json:"customerId"`
-	CustomerName  string  `json:"customerName"`
-	SaleOrderIDs  []int   `json:"saleOrderIds"`
-	Amount        float64 `json:"amount"`
-	PaymentMethod string  `json:"paymentMethod"`
-	Account       string  `json:"account"`
-	PayerCompany  string  `json:"payerCompany"`
-	Remark        string  `json:"remark"`
-	CreatedAt     string  `json:"createdAt"`
-	UpdatedAt     string  `json:"updatedAt"`
+	ID              int             `json:"id"`
+	Code            string          `json:"code"`
+	PaymentDate     string          `json:"paymentDate"`
+	CustomerID      int             `json:"customerId"`
+	CustomerName    string          `json:"customerName"`
+	SaleOrderIDs    []int           `json:"saleOrderIds"`
+	Amount          decimal.Decimal `json:"amount"`
+	AmountUppercase string          `json:"amountUppercase"`
+	PaymentMethod   string          `json:"paymentMethod"`
+	Account         string          `json:"account"`
+	PayerCompany    string          `json:"payerCompany"`
+	Remark          string          `json:"remark"`
+	CreatedAt       string          `json:"createdAt"`
+	UpdatedAt       string          `json:"updatedAt"`
 }
 
 // CreatePaymentRequest 创建收款记录请求
 type CreatePaymentRequest struct {
-	PaymentDate   string  `json:"paymentDate" binding:"required"`
-	CustomerID    int     `json:"customerId" binding:"required"`
-	SaleOrderIDs  []int   `json:"saleOrderIds" binding:"required"`
-	Amount        float64 `json:"amount" binding:"required,gt=0"`
-	PaymentMethod string  `json:"paymentMethod"`
-	Account       string  `json:"account"`
-	PayerCompany  string  `json:"payerCompany"`
-	Remark        string  `json:"remark"`
+	PaymentDate   string          `json:"paymentDate" binding:"required"`
+	CustomerID    int             `json:"customerId" binding:"required"`
+	SaleOrderIDs  []int           `json:"saleOrderIds" binding:"required"`
+	Amount        decimal.Decimal `json:"amount" binding:"required,gt=0"`
+	PaymentMethod string          `json:"paymentMethod"`
+	Account       string          `json:"account"`
+	PayerCompany  string          `json:"payerCompany"`
+	Remark        string          `json:"remark"`
 }
 
 // UpdatePaymentRequest 更新收款记录请求
 type UpdatePaymentRequest struct {
-	PaymentDate   string  `json:"paymentDate"`
-	CustomerID    int     `json:"customerId"`
-	SaleOrderIDs  []int   `json:"saleOrderIds"`
-	Amount        float64 `json:"amount" binding:"omitempty,gt=0"`
-	PaymentMethod string  `json:"paymentMethod"`
-	Account       string  `json:"account"`
-	PayerCompany  string  `json:"payerCompany"`
-	Remark        string  `json:"remark"`
+	PaymentDate   string          `json:"paymentDate"`
+	CustomerID    int             `json:"customerId"`
+	SaleOrderIDs  []int           `json:"saleOrderIds"`
+	Amount        decimal.Decimal `json:"amount" binding:"omitempty,gt=0"`
+	PaymentMethod string          `json:"paymentMethod"`
+	Account       string          `json:"account"`
+	PayerCompany  string          `json:"payerCompany"`
+	Remark        string          `json:"remark"`
 }
 
 // BatchCreatePaymentRequest 批量创建收款记录请求
@@ -250,96 +254,116 @@ type BatchCreatePaymentRequest struct {
 
 // SaleOrder 销售订单模型
 type SaleOrder struct {
-	ID            int             `json:"id"`
-	Code          string          `json:"code"`
-	CreateTime    string          `json:"createTime"`
-	CustomerID    int             `json:"customerId"`
-	CustomerName  string          `json:"customerName"`
-	CustomerPhone string          `json:"customerPhone"`
-	CustomerCity  string          `json:"customerCity"`
-	Items         []SaleOrderItem `json:"items"`
-	OrderAmount   float64         `json:"orderAmount"`
-	PaymentAmount float64         `json:"paymentAmount"`
-	Remark        string          `json:"remark"`
-	CreatedAt     string          `json:"createdAt"`
-	UpdatedAt     string          `json:"updatedAt"`
+	ID                     int             `json:"id"`
+	Code                   string          `json:"code"`
+	CreateTime             string          `json:"createTime"`
+	CustomerID             int             `json:"customerId"`
+	CustomerName           string          `json:"customerName"`
+	CustomerPhone          string          `json:"customerPhone"`
+	CustomerCity           string          `json:"customerCity"`
+	OrderType              string          `json:"orderType"`
+	Items                  []SaleOrderItem `json:"items"`
+	OrderAmount            decimal.Decimal `json:"orderAmount"`
+	Freight                decimal.Decimal `json:"freight"`
+	PayableAmount          decimal.Decimal `json:"payableAmount"`
+	PayableAmountUppercase string          `json:"payableAmountUppercase"`
+	PaymentAmount          decimal.Decimal `json:"paymentAmount"`
+	LogisticsCompany       string          `json:"logisticsCompany"`
+	TrackingNumber         string          `json:"trackingNumber"`
+	InvoiceStatus          string          `json:"invoiceStatus"`
+	PaymentStatus          string          `json:"paymentStatus"`
+	ClosedAt               string          `json:"closedAt"`
+	CloseReason            string          `json:"closeReason"`
+	Remark                 string          `json:"remark"`
+	CreatedAt              string          `json:"createdAt"`
+	UpdatedAt              string          `json:"updatedAt"`
 }
 
 // SaleOrderItem 销售订单商品模型
 type SaleOrderItem struct {
-	ID             int     `json:"id"`
-	SaleOrderID    int     `json:"saleOrderId"`
-	ProductID      int     `json:"productId"`
-	ProductCode    string  `json:"productCode"`
-	ProductName    string  `json:"productName"`
-	Quantity       float64 `json:"quantity"`
-	Unit           string  `json:"unit"`
-	Price          float64 `json:"price"`
-	DiscountAmount float64 `json:"discountAmount"`
-	TotalAmount    float64 `json:"totalAmount"`
-	Remark         string  `json:"remark"`
+	ID             int             `json:"id"`
+	SaleOrderID    int             `json:"saleOrderId"`
+	ProductID      int             `json:"productId"`
+	ProductCode    string          `json:"productCode"`
+	ProductName    string          `json:"productName"`
+	Quantity       decimal.Decimal `json:"quantity"`
+	PieceCount     int             `json:"pieceCount"`
+	QuantityDetail string          `json:"quantityDetail"`
+	Unit           string          `json:"unit"`
+	Price          decimal.Decimal `json:"price"`
+	DiscountAmount decimal.Decimal `json:"discountAmount"`
+	TotalAmount    decimal.Decimal `json:"totalAmount"`
+	Remark         string          `json:"remark"`
 }
 
 // CreateSaleOrderRequest 创建销售订单请求
 type CreateSaleOrderRequest struct {
-	Code       string                       `json:"code" binding:"required"`
-	CreateTime string                       `json:"createTime" binding:"required"`
-	CustomerID int                          `json:"customerId" binding:"required"`
-	Items      []CreateSaleOrderItemRequest `json:"items" binding:"required"`
-	Remark     string                       `json:"remark"`
+	Code             string                       `json:"code" binding:"required"`
+	CreateTime       string                       `json:"createTime" binding:"required"`
+	CustomerID       int                          `json:"customerId" binding:"required"`
+	OrderType        string                       `json:"orderType"`
+	Freight          decimal.Decimal              `json:"freight" binding:"gte=0"`
+	LogisticsCompany string                       `json:"logisticsCompany"`
+	TrackingNumber   string                       `json:"trackingNumber"`
+	InvoiceStatus    string                       `json:"invoiceStatus"`
+	Items            []CreateSaleOrderItemRequest `json:"items" binding:"required"`
+	Remark           string                       `json:"remark"`
 }
 
 // CreateSaleOrderItemRequest 创建销售订单商品请求
+// 小计由服务端按 数量 × 单价 − 优惠金额 计算，totalAmount 可不传，传了必须与计算结果一致
+// 油管批发订单可填写件数和数量明细（如 "12.5+13 14.2"），填写了数量明细时数量取明细合计
 type CreateSaleOrderItemRequest struct {
-	ProductID      int     `json:"productId" binding:"required"`
-	ProductCode    string  `json:"productCode" binding:"required"`
-	ProductName    string  `json:"productName" binding:"required"`
-	Quantity       float64 `json:"quantity" binding:"required,gt=0"`
-	Unit           string  `json:"unit" binding:"required"`
-	Price          float64 `json:"price" binding:"required,gt=0"`
-	DiscountAmount float64 `json:"discountAmount"`
-	TotalAmount    float64 `json:"totalAmount"`
-	Remark         string  `json:"remark"`
+	ProductID      int              `json:"productId" binding:"required"`
+	ProductCode    string           `json:"productCode" binding:"required"`
+	ProductName    string           `json:"productName" binding:"required"`
+	Quantity       decimal.Decimal  `json:"quantity" binding:"omitempty,gt=0"`
+	PieceCount     int              `json:"pieceCount"`
+	QuantityDetail string           `json:"quantityDetail"`
+	Unit           string           `json:"unit" binding:"required"`
+	Price          decimal.Decimal  `json:"price" binding:"required,gt=0"`
+	DiscountAmount decimal.Decimal  `json:"discountAmount"`
+	TotalAmount    *decimal.Decimal `json:"totalAmount"`
+	Remark         string           `json:"remark"`
 }
 
 // UpdateSaleOrderRequest 更新销售订单请求
 type UpdateSaleOrderRequest struct {
-	Code       string                       `json:"code" binding:"required"`
-	CreateTime string                       `json:"createTime" binding:"required"`
-	CustomerID int                          `json:"customerId" binding:"required"`
-	Items      []UpdateSaleOrderItemRequest `json:"items" binding:"required"`
-	Remark     string                       `json:"remark"`
+	Code             string                       `json:"code" binding:"required"`
+	CreateTime       string                       `json:"createTime" binding:"required"`
+	CustomerID       int                          `json:"customerId" binding:"required"`
+	OrderType        string                       `json:"orderType"`
+	Freight          decimal.Decimal              `json:"freight" binding:"gte=0"`
+	LogisticsCompany string                       `json:"logisticsCompany"`
+	TrackingNumber   string                       `json:"trackingNumber"`
+	InvoiceStatus    string                       `json:"invoiceStatus"`
+	Items            []UpdateSaleOrderItemRequest `json:"items" binding:"required"`
+	Remark           string                       `json:"remark"`
 }
 
-// UpdateSaleOrderItemRequest 更新销售订单商品请求
+// UpdateSaleOrderItemRequest 更新销售订单商品请求，id 为原有商品行的ID，新增的行不传
 type UpdateSaleOrderItemRequest struct {
-	ID             int     `json:"id,omitempty"`
-	ProductID      int     `json:"productId" binding:"required"`
-	ProductCode    string  `json:"productCode" binding:"required"`
-	ProductName    string  `json:"productName" binding:"required"`
-	Quantity       float64 `json:"quantity" binding:"required,gt=0"`
-	Unit           string  `json:"unit" binding:"required"`
-	Price          float64 `json:"price" binding:"required,gt=0"`
-	DiscountAmount float64 `json:"discountAmount"`
-	TotalAmount    float64 `json:"totalAmount"`
-	Remark         string  `json:"remark"`
+	ID int `json:"id,omitempty"`
+	CreateSaleOrderItemRequest
 }
 
 // StatementRecord 对帐单记录模型
 type StatementRecord struct {
-	ID            int     `json:"id"`
-	CustomerID    int     `json:"customerId"`
-	CustomerCode  string  `json:"customerCode"`
-	CustomerName  string  `json:"customerName"`
-	Date          string  `json:"date"`
-	SaleAmount    float64 `json:"saleAmount"`
-	PaymentAmount float64 `json:"paymentAmount"`
-	Balance       float64 `json:"balance"`
-	Remark        string  `json:"remark"`
-	SourceType    string  `json:"sourceType"`
-	SourceID      int     `json:"sourceId"`
-	CreatedAt     string  `json:"createdAt"`
-	UpdatedAt     string  `json:"updatedAt"`
+	ID            int             `json:"id"`
+	CustomerID    int             `json:"customerId"`
+	CustomerCode  string          `json:"customerCode"`
+	CustomerName  string          `json:"customerName"`
+	Date          string          `json:"date"`
+	SaleAmount    decimal.Decimal `json:"saleAmount"`
+	PaymentAmount decimal.Decimal `json:"paymentAmount"`
+	Balance       decimal.Decimal `json:"balance"`
+	Remark        string          `json:"remark"`
+	SourceType    string          `json:"sourceType"`
+	SourceID      int             `json:"sourceId"`
+	EntryType     string          `json:"entryType"`  // entry 按单据入帐，reversal 冲销
+	ReversalOf    *int            `json:"reversalOf"` // 冲销分录指向被冲销的分录
+	CreatedAt     string          `json:"createdAt"`
+	UpdatedAt     string          `json:"updatedAt"`
 }
 
 func main() {
@@ -349,21 +373,43 @@ func main() {
 	// 加载配置
 	cfg := config.LoadConfig()
 
+	// 数据库迁移命令：nb2 migrate up|down|status|force
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		runMigrateCommand(&cfg.Database, os.Args[2:])
+		return
+	}
+
 	// 初始化数据库连接
 	if err := database.InitDB(&cfg.Database); err != nil {
 		log.Fatalf("Failed to initialize database: %v", err)
 	}
 	defer database.CloseDB()
 
-	// 设置定时同步任务
+	// 补齐历史客户和产品的拼音检索列
+	if err := backfillSearchPinyin(); err != nil {
+		log.Printf("补齐拼音检索列失败：%v\n", err)
+	}
+
+	// 初始化登录配置
+	if err := initAuth(&cfg.Auth); err != nil {
+		log.Fatalf("Failed to initialize auth: %v", err)
+	}
+
+	// PDF字体
+	if err := initPDF(&cfg.PDF); err != nil {
+		log.Fatalf("Failed to initialize PDF: %v", err)
+	}
+
+	// 后台同步任务队列
+	startSyncQueue(&cfg.Sync)
+
+	// 设置定时同步任务（供应商对帐单）
 	c := cron.New()
 	// 每天5:00执行同步
 	_, err := c.AddFunc("0 5 * * *", func() {
-		log.Println("开始执行对帐单同步任务（5:00）")
-		if err := syncStatements(); err != nil {
-			log.Printf("对帐单同步失败：%v\n", err)
-		} else {
-			log.Println("对帐单同步完成")
+		log.Println("提交供应商对帐单同步任务（5:00）")
+		if _, err := requestSyncAll(syncJobSupplierStatement, "SELECT id FROM suppliers"); err != nil {
+			log.Printf("提交供应商对帐单同步任务失败：%v\n", err)
 		}
 	})
 	if err != nil {
@@ -372,11 +418,9 @@ func main() {
 
 	// 每天17:00执行同步
 	_, err = c.AddFunc("0 17 * * *", func() {
-		log.Println("开始执行对帐单同步任务（17:00）")
-		if err := syncStatements(); err != nil {
-			log.Printf("对帐单同步失败：%v\n", err)
-		} else {
-			log.Println("对帐单同步完成")
+		log.Println("提交供应商对帐单同步任务（17:00）")
+		if _, err := requestSyncAll(syncJobSupplierStatement, "SELECT id FROM suppliers"); err != nil {
+			log.Printf("提交供应商对帐单同步任务失败：%v\n", err)
 		}
 	})
 	if err != nil {
@@ -400,101 +444,207 @@ func main() {
 		})
 	})
 
+	// 登录路由（无需验证）
+	r.POST("/api/auth/login", login)
+
+	// 以下所有API均需登录
+	api := r.Group("/api", authMiddleware())
+
+	// 登录用户路由组
+	auth := api.Group("/auth")
+	{
+		auth.POST("/logout", logout)
+		auth.GET("/me", getCurrentUser)
+	}
+
 	// 产品路由组
-	products := r.Group("/api/products")
+	products := api.Group("/products")
 	{
-		products.GET("", getProducts)
-		products.GET("/:id", getProductByID)
-		products.POST("", createProduct)
-		products.PUT("/:id", updateProduct)
-		products.DELETE("/:id", deleteProduct)
-		products.DELETE("/batch", batchDeleteProducts)
-		products.GET("/generate-code", generateProductCodeAPI)
-		products.GET("/check-code", checkProductCode)
+		products.GET("", requirePermission("product:read"), getProducts)
+		products.GET("/:id", requirePermission("product:read"), getProductByID)
+		products.POST("", requirePermission("product:create"), createProduct)
+		products.PUT("/:id", requirePermission("product:update"), updateProduct)
+		products.DELETE("/:id", requirePermission("product:delete"), deleteProduct)
+		products.DELETE("/batch", requirePermission("product:delete"), batchDeleteProducts)
+		products.GET("/generate-code", requirePermission("product:read"), generateProductCodeAPI)
+		products.GET("/check-code", requirePermission("product:read"), checkProductCode)
+		products.GET("/search", requirePermission("product:read"), searchProducts)
+		products.POST("/import", requirePermission("product:create"), importProducts)
 	}
 
 	// 字典路由组
-	dictionaries := r.Group("/api/dictionaries")
+	dictionaries := api.Group("/dictionaries")
 	{
 		// 字典类型管理
-		dictionaries.GET("/types", getDictionaryTypes)
-		dictionaries.GET("/types/:id", getDictionaryTypeByID)
-		dictionaries.POST("/types", createDictionaryType)
-		dictionaries.PUT("/types/:id", updateDictionaryType)
-		dictionaries.DELETE("/types/:id", deleteDictionaryType)
-		dictionaries.DELETE("/types/batch", batchDeleteDictionaryTypes)
+		dictionaries.GET("/types", requirePermission("dictionary:read"), getDictionaryTypes)
+		dictionaries.GET("/types/:id", requirePermission("dictionary:read"), getDictionaryTypeByID)
+		dictionaries.POST("/types", requirePermission("dictionary:create"), createDictionaryType)
+		dictionaries.PUT("/types/:id", requirePermission("dictionary:update"), updateDictionaryType)
+		dictionaries.DELETE("/types/:id", requirePermission("dictionary:delete"), deleteDictionaryType)
+		dictionaries.DELETE("/types/batch", requirePermission("dictionary:delete"), batchDeleteDictionaryTypes)
 
 		// 字典项管理
-		dictionaries.GET("/items", getDictionaryItems)
-		dictionaries.GET("/items/:id", getDictionaryItemByID)
-		dictionaries.POST("/items", createDictionaryItem)
-		dictionaries.PUT("/items/:id", updateDictionaryItem)
-		dictionaries.DELETE("/items/:id", deleteDictionaryItem)
-		dictionaries.DELETE("/items/batch", batchDeleteDictionaryItems)
+		dictionaries.GET("/items", requirePermission("dictionary:read"), getDictionaryItems)
+		dictionaries.GET("/items/:id", requirePermission("dictionary:read"), getDictionaryItemByID)
+		dictionaries.POST("/items", requirePermission("dictionary:create"), createDictionaryItem)
+		dictionaries.PUT("/items/:id", requirePermission("dictionary:update"), updateDictionaryItem)
+		dictionaries.DELETE("/items/:id", requirePermission("dictionary:delete"), deleteDictionaryItem)
+		dictionaries.DELETE("/items/batch", requirePermission("dictionary:delete"), batchDeleteDictionaryItems)
 
 		// 根据字典类型获取字典项
-		dictionaries.GET("/items/type/:code", getDictionaryItemsByTypeCode)
+		dictionaries.GET("/items/type/:code", requirePermission("dictionary:read"), getDictionaryItemsByTypeCode)
 	}
 
 	// 设置路由组
-	settings := r.Group("/api/settings")
+	settings := api.Group("/settings")
 	{
-		settings.GET("", getSettings)
-		settings.PUT("", updateSettings)
+		settings.GET("", requirePermission("settings:read"), getSettings)
+		settings.PUT("", requirePermission("settings:update"), updateSettings)
 	}
 
 	// 客户路由组
-	customers := r.Group("/api/customers")
+	customers := api.Group("/customers")
 	{
 		// 基本客户路由
-		customers.GET("", getCustomers)
-		customers.POST("", createCustomer)
-		customers.DELETE("/batch", batchDeleteCustomers)
+		customers.GET("", requirePermission("customer:read"), getCustomers)
+		customers.POST("", requirePermission("customer:create"), createCustomer)
+		customers.DELETE("/batch", requirePermission("customer:delete"), batchDeleteCustomers)
 		// 客户编号生成和检查（放在动态路由之前）
-		customers.GET("/generate-code", generateCustomerCodeAPI)
-		customers.GET("/check-code", checkCustomerCode)
+		customers.GET("/generate-code", requirePermission("customer:read"), generateCustomerCodeAPI)
+		customers.GET("/check-code", requirePermission("customer:read"), checkCustomerCode)
+		customers.GET("/search", requirePermission("customer:read"), searchCustomers)
+		customers.POST("/import", requirePermission("customer:create"), importCustomers)
 		// 动态路由（放在具体路由之后）
-		customers.GET("/:id", getCustomerByID)
-		customers.PUT("/:id", updateCustomer)
-		customers.DELETE("/:id", deleteCustomer)
+		customers.GET("/:id", requirePermission("customer:read"), getCustomerByID)
+		customers.PUT("/:id", requirePermission("customer:update"), updateCustomer)
+		customers.DELETE("/:id", requirePermission("customer:delete"), deleteCustomer)
 		// 客户发票路由
-		customers.GET("/:id/invoices", getCustomerInvoices)
+		customers.GET("/:id/invoices", requirePermission("customer:read"), getCustomerInvoices)
 	}
 
 	// 发票路由组
-	invoices := r.Group("/api/invoices")
+	invoices := api.Group("/invoices")
 	{
-		invoices.POST("", createInvoice)
-		invoices.PUT("/:id", updateInvoice)
-		invoices.DELETE("/:id", deleteInvoice)
+		invoices.POST("", requirePermission("invoice:create"), createInvoice)
+		invoices.PUT("/:id", requirePermission("invoice:update"), updateInvoice)
+		invoices.DELETE("/:id", requirePermission("invoice:delete"), deleteInvoice)
 	}
 
 	// 收款路由组
-	payments := r.Group("/api/payments")
+	payments := api.Group("/payments")
 	{
-		payments.GET("", getPayments)
-		payments.POST("", createPayment)
-		payments.POST("/batch", batchCreatePayments)
-		payments.PUT("/:id", updatePayment)
-		payments.DELETE("/:id", deletePayment)
+		payments.GET("", requirePermission("payment:read"), getPayments)
+		payments.POST("", requirePermission("payment:create"), createPayment)
+		payments.POST("/batch", requirePermission("payment:create"), batchCreatePayments)
+		payments.PUT("/:id", requirePermission("payment:update"), updatePayment)
+		payments.DELETE("/:id", requirePermission("payment:delete"), deletePayment)
+		payments.GET("/:id/allocations", requirePermission("payment:read"), getPaymentAllocations)
 	}
 
 	// 销售订单路由组
-	saleOrders := r.Group("/api/sale-orders")
+	saleOrders := api.Group("/sale-orders")
 	{
-		saleOrders.GET("", getSaleOrders)
-		saleOrders.GET("/generate-code", generateSaleOrderCodeAPI)
-		saleOrders.GET("/:id", getSaleOrderByID)
-		saleOrders.POST("", createSaleOrder)
-		saleOrders.PUT("/:id", updateSaleOrder)
-		saleOrders.DELETE("/:id", deleteSaleOrder)
+		saleOrders.GET("", requirePermission("sale_order:read"), getSaleOrders)
+		saleOrders.GET("/generate-code", requirePermission("sale_order:read"), generateSaleOrderCodeAPI)
+		saleOrders.GET("/:id", requirePermission("sale_order:read"), getSaleOrderByID)
+		saleOrders.POST("", requirePermission("sale_order:create"), createSaleOrder)
+		saleOrders.PUT("/:id", requirePermission("sale_order:update"), updateSaleOrder)
+		saleOrders.DELETE("/:id", requirePermission("sale_order:delete"), deleteSaleOrder)
+		saleOrders.POST("/:id/close", requirePermission("sale_order:close"), closeSaleOrder)
+		saleOrders.POST("/:id/reopen", requirePermission("sale_order:close"), reopenSaleOrder)
+		saleOrders.GET("/:id/status-logs", requirePermission("sale_order:read"), getSaleOrderStatusLogs)
+		saleOrders.GET("/:id/pdf", requirePermission("sale_order:read"), getSaleOrderPDF)
+		saleOrders.GET("/:id/allocations", requirePermission("sale_order:read"), getSaleOrderAllocations)
 	}
 
 	// 对帐单路由组
-	statements := r.Group("/api/statements")
+	statements := api.Group("/statements")
+	{
+		statements.GET("", requirePermission("statement:read"), getStatements)
+		statements.GET("/sync", requirePermission("statement:sync"), syncStatementsAPI)
+		statements.GET("/export", requirePermission("statement:read"), exportStatements)
+		statements.GET("/pdf", requirePermission("statement:read"), getStatementPDF)
+	}
+
+	// 库存路由组
+	inventory := api.Group("/inventory")
+	{
+		inventory.GET("", requirePermission("inventory:read"), getInventory)
+		inventory.GET("/low-stock", requirePermission("inventory:read"), getLowStockProducts)
+		inventory.POST("/adjustments", requirePermission("inventory:adjust"), createStockAdjustment)
+		inventory.GET("/:productId/movements", requirePermission("inventory:read"), getStockMovements)
+		inventory.PUT("/:productId/threshold", requirePermission("inventory:adjust"), updateStockThreshold)
+	}
+
+	// 供应商路由组
+	suppliers := api.Group("/suppliers")
+	{
+		suppliers.GET("", requirePermission("supplier:read"), getSuppliers)
+		suppliers.GET("/generate-code", requirePermission("supplier:read"), generateSupplierCodeAPI)
+		suppliers.GET("/:id", requirePermission("supplier:read"), getSupplierByID)
+		suppliers.POST("", requirePermission("supplier:create"), createSupplier)
+		suppliers.PUT("/:id", requirePermission("supplier:update"), updateSupplier)
+		suppliers.DELETE("/:id", requirePermission("supplier:delete"), deleteSupplier)
+	}
+
+	// 进货单路由组
+	purchaseOrders := api.Group("/purchase-orders")
+	{
+		purchaseOrders.GET("", requirePermission("purchase_order:read"), getPurchaseOrders)
+		purchaseOrders.GET("/generate-code", requirePermission("purchase_order:read"), generatePurchaseOrderCodeAPI)
+		purchaseOrders.GET("/:id", requirePermission("purchase_order:read"), getPurchaseOrderByID)
+		purchaseOrders.POST("", requirePermission("purchase_order:create"), createPurchaseOrder)
+		purchaseOrders.PUT("/:id", requirePermission("purchase_order:update"), updatePurchaseOrder)
+		purchaseOrders.DELETE("/:id", requirePermission("purchase_order:delete"), deletePurchaseOrder)
+		purchaseOrders.POST("/:id/order", requirePermission("purchase_order:update"), orderPurchaseOrder)
+		purchaseOrders.POST("/:id/receive", requirePermission("purchase_order:receive"), receivePurchaseOrder)
+	}
+
+	// 供应商付款路由组
+	supplierPayments := api.Group("/supplier-payments")
 	{
-		statements.GET("", getStatements)
-		statements.GET("/sync", syncStatementsAPI)
+		supplierPayments.GET("", requirePermission("supplier_payment:read"), getSupplierPayments)
+		supplierPayments.POST("", requirePermission("supplier_payment:create"), createSupplierPayment)
+		supplierPayments.PUT("/:id", requirePermission("supplier_payment:update"), updateSupplierPayment)
+		supplierPayments.DELETE("/:id", requirePermission("supplier_payment:delete"), deleteSupplierPayment)
+	}
+
+	// 供应商对帐单路由组
+	supplierStatements := api.Group("/supplier-statements")
+	{
+		supplierStatements.GET("", requirePermission("supplier_statement:read"), getSupplierStatements)
+		supplierStatements.GET("/sync", requirePermission("supplier_statement:sync"), syncSupplierStatementsAPI)
+	}
+
+	// 操作日志
+	api.GET("/audit-logs", requirePermission("audit_log:read"), getAuditLogs)
+
+	// 后台同步任务路由组
+	syncJobs := api.Group("/sync-jobs")
+	{
+		syncJobs.GET("", requirePermission("sync_job:read"), getSyncJobs)
+		syncJobs.POST("/:id/retry", requirePermission("sync_job:retry"), retrySyncJob)
+	}
+
+	// 权限列表
+	api.GET("/permissions", requirePermission("role:manage"), getPermissions)
+
+	// 角色路由组
+	roles := api.Group("/roles")
+	{
+		roles.GET("", requirePermission("role:manage"), getRoles)
+		roles.POST("", requirePermission("role:manage"), createRole)
+		roles.PUT("/:id", requirePermission("role:manage"), updateRole)
+		roles.DELETE("/:id", requirePermission("role:manage"), deleteRole)
+	}
+
+	// 用户路由组
+	users := api.Group("/users")
+	{
+		users.GET("", requirePermission("user:manage"), getUsers)
+		users.POST("", requirePermission("user:manage"), createUser)
+		users.PUT("/:id", requirePermission("user:manage"), updateUser)
+		users.PUT("/:id/roles", requirePermission("user:manage"), updateUserRoles)
 	}
 
 	// 启动服务器
@@ -522,250 +672,106 @@ func corsMiddleware() gin.HandlerFunc {
 	}
 }
 
-// calculateStatementBalance 计算对帐单记录的结余金额
-func calculateStatementBalance(records []StatementRecord) []StatementRecord {
-	if len(records) == 0 {
-		return records
-	}
-
-	// 按日期升序排序
-	sort.Slice(records, func(i, j int) bool {
-		return records[i].Date < records[j].Date
-	})
-
-	// 计算结余金额
-	balance := 0.0
-	for i := range records {
-		// 每条记录的差额 = 发货金额 - 收款金额
-		diff := records[i].SaleAmount - records[i].PaymentAmount
-		balance += diff
-		records[i].Balance = balance
-	}
-
-	// 按日期降序返回（最新在前）
-	sort.Slice(records, func(i, j int) bool {
-		return records[i].Date > records[j].Date
-	})
-
-	return records
+// statementTable 客户对帐单和供应商对帐单在表名、列名上的差异
+type statementTable struct {
+	Table       string // 对帐单表
+	DebitColumn string // 发货/进货金额列
+	DebitKey    string // 合计中发货/进货金额的字段名
+	PartyColumn string // 客户/供应商ID列
 }
 
-// getAllCustomers 获取所有客户
-func getAllCustomers() ([]Customer, error) {
-	rows, err := database.DB.Query("SELECT id, code, name, phone, province, city, district, address, company, status, remark, created_at, updated_at FROM customers")
+var (
+	customerStatementTable = statementTable{Table: "statement_records", DebitColumn: "sale_amount", DebitKey: "saleAmount", PartyColumn: "customer_id"}
+	supplierStatementTable = statementTable{Table: "supplier_statement_records", DebitColumn: "purchase_amount", DebitKey: "purchaseAmount", PartyColumn: "supplier_id"}
+)
+
+// summary 汇总筛选范围内的发生额，金额同时给出大写
+// 指定了单个客户/供应商时，另外给出截至 endTime 的期末结余
+func (t statementTable) summary(where string, args []interface{}, partyID int, endTime string) (gin.H, error) {
+	var debit, credit decimal.Decimal
+	err := database.DB.QueryRow("SELECT COALESCE(SUM("+t.DebitColumn+"), 0), COALESCE(SUM(payment_amount), 0) FROM "+t.Table+where, args...).Scan(&debit, &credit)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
-
-	var customers []Customer
-	for rows.Next() {
-		var c Customer
-		if err := rows.Scan(&c.ID, &c.Code, &c.Name, &c.Phone, &c.Province, &c.City, &c.District, &c.Address, &c.Company, &c.Status, &c.Remark, &c.CreatedAt, &c.UpdatedAt); err != nil {
-			return nil, err
-		}
-		customers = append(customers, c)
+	debit, credit = roundAmount(debit), roundAmount(credit)
+	summary := gin.H{
+		t.DebitKey:               debit,
+		t.DebitKey + "Uppercase": rmbUppercase(debit),
+		"paymentAmount":          credit,
+		"paymentAmountUppercase": rmbUppercase(credit),
 	}
-
-	return customers, nil
-}
-
-// getCustomerSaleOrders 获取客户的所有销售订单
-func getCustomerSaleOrders(customerID int) ([]SaleOrder, error) {
-	rows, err := database.DB.Query("SELECT id, code, total_amount, paid_amount, create_time, customer_id, customer_name, customer_phone, customer_city, remark, created_at, updated_at FROM sale_orders WHERE customer_id = ?", customerID)
-	if err != nil {
-		return nil, err
+	if partyID <= 0 {
+		return summary, nil
 	}
-	defer rows.Close()
 
-	var orders []SaleOrder
-	for rows.Next() {
-		var o SaleOrder
-		if err := rows.Scan(&o.ID, &o.Code, &o.OrderAmount, &o.PaymentAmount, &o.CreateTime, &o.CustomerID, &o.CustomerName, &o.CustomerPhone, &o.CustomerCity, &o.Remark, &o.CreatedAt, &o.UpdatedAt); err != nil {
-			return nil, err
-		}
-		orders = append(orders, o)
+	query := "SELECT balance FROM " + t.Table + " WHERE " + t.PartyColumn + " = ?"
+	balanceArgs := []interface{}{partyID}
+	if endTime != "" {
+		query += " AND date <= ?"
+		balanceArgs = append(balanceArgs, endTime)
 	}
-
-	return orders, nil
-}
-
-// getCustomerPayments 获取客户的所有收款记录
-func getCustomerPayments(customerID int) ([]Payment, error) {
-	rows, err := database.DB.Query("SELECT id, code, payment_date, customer_id, sale_order_ids, amount, payment_method, account, payer_company, remark, created_at, updated_at FROM payments WHERE customer_id = ?", customerID)
-	if err != nil {
+	var balance decimal.Decimal
+	err = database.DB.QueryRow(query+" ORDER BY date DESC, id DESC LIMIT 1", balanceArgs...).Scan(&balance)
+	if err != nil && err != sql.ErrNoRows {
 		return nil, err
 	}
-	defer rows.Close()
-
-	var payments []Payment
-	for rows.Next() {
-		var p Payment
-		var saleOrderIdsJSON []byte
-		if err := rows.Scan(&p.ID, &p.Code, &p.PaymentDate, &p.CustomerID, &saleOrderIdsJSON, &p.Amount, &p.PaymentMethod, &p.Account, &p.PayerCompany, &p.Remark, &p.CreatedAt, &p.UpdatedAt); err != nil {
-			return nil, err
-		}
-
-		// 解析sale_order_ids JSON
-		if saleOrderIdsJSON != nil && len(saleOrderIdsJSON) > 0 {
-			// 处理空字符串情况
-			saleOrderIdsStr := string(saleOrderIdsJSON)
-			if saleOrderIdsStr != "" && saleOrderIdsStr != "null" {
-				err = json.Unmarshal(saleOrderIdsJSON, &p.SaleOrderIDs)
-				if err != nil {
-					// JSON解析失败时，设置为空数组，增强容错性
-					p.SaleOrderIDs = []int{}
-				}
-			} else {
-				// 空字符串或null时，设置为空数组
-				p.SaleOrderIDs = []int{}
-			}
-		} else {
-			// 未设置值时，设置为空数组
-			p.SaleOrderIDs = []int{}
-		}
-
-		payments = append(payments, p)
-	}
-
-	return payments, nil
+	summary["balance"] = balance
+	summary["balanceUppercase"] = rmbUppercase(balance)
+	return summary, nil
 }
 
-// saveStatementRecords 保存对帐单记录
-func saveStatementRecords(records []StatementRecord) error {
-	// 开始事务
-	tx, err := database.DB.Begin()
-	if err != nil {
-		return err
+// calculateRunningBalance 按日期升序累计每条记录的差额得到结余金额，结果按日期降序返回（最新在前）
+// 客户对帐单和供应商对帐单共用同一套结余算法
+func calculateRunningBalance[T any](records []T, date func(*T) string, diff func(*T) decimal.Decimal, setBalance func(*T, decimal.Decimal)) []T {
+	if len(records) == 0 {
+		return records
 	}
-	defer tx.Rollback()
 
-	// 先删除该客户的所有对帐单记录
-	if len(records) > 0 {
-		_, err := tx.Exec("DELETE FROM statement_records WHERE customer_id = ?", records[0].CustomerID)
-		if err != nil {
-			return err
-		}
-	}
+	// 按日期升序排序，同一天的记录保持原有顺序
+	sort.SliceStable(records, func(i, j int) bool {
+		return date(&records[i]) < date(&records[j])
+	})
 
-	// 批量插入新的对帐单记录
-	stmt, err := tx.Prepare("INSERT INTO statement_records (customer_id, customer_code, customer_name, date, sale_amount, payment_amount, balance, remark, source_type, source_id) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)")
-	if err != nil {
-		return err
+	// 计算结余金额，定点小数累加，与数据库 DECIMAL 列精确一致
+	balance := decimal.Zero
+	for i := range records {
+		balance = balance.Add(diff(&records[i]))
+		setBalance(&records[i], balance)
 	}
-	defer stmt.Close()
 
-	for _, record := range records {
-		_, err := stmt.Exec(record.CustomerID, record.CustomerCode, record.CustomerName, record.Date, record.SaleAmount, record.PaymentAmount, record.Balance, record.Remark, record.SourceType, record.SourceID)
-		if err != nil {
-			return err
-		}
-	}
+	// 按日期降序返回（最新在前）
+	sort.SliceStable(records, func(i, j int) bool {
+		return date(&records[i]) > date(&records[j])
+	})
 
-	// 提交事务
-	return tx.Commit()
+	return records
 }
 
-// syncCustomerStatements 同步单个客户的对帐单数据
+// syncCustomerStatements 校对单个客户的对帐单
+// 分录已在单据修改的同一事务中记帐，这里只补记漏记的单据、重算结余，不会删除已有分录
 func syncCustomerStatements(customerID int) error {
-	log.Printf("开始同步客户 %d 的对帐单\n", customerID)
-	// 获取客户信息
-	var customer Customer
-	err := database.DB.QueryRow("SELECT id, code, name FROM customers WHERE id = ?", customerID).Scan(&customer.ID, &customer.Code, &customer.Name)
-	if err != nil {
-		log.Printf("获取客户 %d 信息失败：%v\n", customerID, err)
-		return err
-	}
-	log.Printf("客户信息：ID=%d, 编号=%s, 名称=%s\n", customer.ID, customer.Code, customer.Name)
+	log.Printf("开始校对客户 %d 的对帐单\n", customerID)
 
-	// 获取该客户的所有销售订单
-	saleOrders, err := getCustomerSaleOrders(customerID)
-	if err != nil {
-		log.Printf("获取客户 %d 销售订单失败：%v\n", customerID, err)
+	// 先重新分配收款，保证分配明细、订单已收款和付款状态与收款记录一致
+	if err := reallocateCustomerPayments(customerID); err != nil {
+		log.Printf("重新分配客户 %d 收款失败：%v\n", customerID, err)
 		return err
 	}
-	log.Printf("获取到 %d 条销售订单\n", len(saleOrders))
 
-	// 获取该客户的所有收款记录
-	payments, err := getCustomerPayments(customerID)
+	tx, err := database.DB.Begin()
 	if err != nil {
-		log.Printf("获取客户 %d 收款记录失败：%v\n", customerID, err)
 		return err
 	}
-	log.Printf("获取到 %d 条收款记录\n", len(payments))
-
-	// 合并并处理数据
-	var records []StatementRecord
-
-	// 处理销售订单
-	for _, order := range saleOrders {
-		// 将createTime转换为日期格式（YYYY-MM-DD）
-		date := order.CreateTime
-		if len(date) > 10 {
-			date = date[:10]
-		}
-
-		records = append(records, StatementRecord{
-			CustomerID:    customer.ID,
-			CustomerCode:  customer.Code,
-			CustomerName:  customer.Name,
-			Date:          date,
-			SaleAmount:    order.OrderAmount,
-			PaymentAmount: 0,
-			Remark:        order.Remark,
-			SourceType:    "sale_order",
-			SourceID:      order.ID,
-		})
-	}
-
-	// 处理收款记录
-	for _, payment := range payments {
-		records = append(records, StatementRecord{
-			CustomerID:    customer.ID,
-			CustomerCode:  customer.Code,
-			CustomerName:  customer.Name,
-			Date:          payment.PaymentDate,
-			SaleAmount:    0,
-			PaymentAmount: payment.Amount,
-			Remark:        payment.Remark,
-			SourceType:    "payment",
-			SourceID:      payment.ID,
-		})
-	}
-
-	log.Printf("共生成 %d 条对帐单记录\n", len(records))
-
-	// 计算结余金额
-	records = calculateStatementBalance(records)
+	defer tx.Rollback()
 
-	// 保存对帐单记录
-	if err := saveStatementRecords(records); err != nil {
-		log.Printf("保存客户 %d 对帐单记录失败：%v\n", customerID, err)
+	if err := reconcileCustomerLedger(tx, customerID); err != nil {
+		log.Printf("校对客户 %d 对帐单失败：%v\n", customerID, err)
 		return err
 	}
-	log.Printf("客户 %d 对帐单同步完成\n", customerID)
-	return nil
-}
-
-// syncStatements 同步所有客户的对帐单数据
-func syncStatements() error {
-	log.Println("开始同步所有客户对帐单")
-	// 获取所有客户
-	customers, err := getAllCustomers()
-	if err != nil {
-		log.Printf("获取客户列表失败：%v\n", err)
+	if err := tx.Commit(); err != nil {
 		return err
 	}
-	log.Printf("共获取到 %d 个客户\n", len(customers))
-
-	for i, customer := range customers {
-		log.Printf("正在同步第 %d/%d 个客户：ID=%d, 名称=%s\n", i+1, len(customers), customer.ID, customer.Name)
-		if err := syncCustomerStatements(customer.ID); err != nil {
-			log.Printf("同步客户 %d 对帐单失败：%v\n", customer.ID, err)
-			return err
-		}
-	}
-	log.Println("所有客户对帐单同步完成")
+	log.Printf("客户 %d 对帐单校对完成\n", customerID)
 	return nil
 }
 
@@ -793,34 +799,31 @@ func getStatements(c *gin.Context) {
 	pageSize, _ := strconv.Atoi(pageSizeStr)
 
 	// 构建查询条件
-	query := "SELECT id, customer_id, customer_code, customer_name, date, sale_amount, payment_amount, balance, remark, source_type, source_id, created_at, updated_at FROM statement_records WHERE 1=1"
+	where := " WHERE 1=1"
 	args := []interface{}{}
 
 	if customerID > 0 {
-		query += " AND customer_id = ?"
+		where += " AND customer_id = ?"
 		args = append(args, customerID)
 	}
 
 	if startTime != "" {
-		query += " AND date >= ?"
+		where += " AND date >= ?"
 		args = append(args, startTime)
 	}
 
 	if endTime != "" {
-		query += " AND date <= ?"
+		where += " AND date <= ?"
 		args = append(args, endTime)
 	}
 
-	// 添加排序
-	query += " ORDER BY date DESC, id DESC"
-
-	// 添加分页
+	// 添加排序和分页
+	query := "SELECT id, customer_id, customer_code, customer_name, date, sale_amount, payment_amount, balance, COALESCE(remark, ''), source_type, source_id, entry_type, reversal_of, created_at, updated_at FROM statement_records" +
+		where + " ORDER BY date DESC, id DESC LIMIT ? OFFSET ?"
 	offset := (page - 1) * pageSize
-	query += " LIMIT ? OFFSET ?"
-	args = append(args, pageSize, offset)
 
 	// 执行查询
-	rows, err := database.DB.Query(query, args...)
+	rows, err := database.DB.Query(query, append(args, pageSize, offset)...)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch statements"})
 		return
@@ -831,7 +834,7 @@ func getStatements(c *gin.Context) {
 	var records []StatementRecord
 	for rows.Next() {
 		var r StatementRecord
-		if err := rows.Scan(&r.ID, &r.CustomerID, &r.CustomerCode, &r.CustomerName, &r.Date, &r.SaleAmount, &r.PaymentAmount, &r.Balance, &r.Remark, &r.SourceType, &r.SourceID, &r.CreatedAt, &r.UpdatedAt); err != nil {
+		if err := rows.Scan(&r.ID, &r.CustomerID, &r.CustomerCode, &r.CustomerName, &r.Date, &r.SaleAmount, &r.PaymentAmount, &r.Balance, &r.Remark, &r.SourceType, &r.SourceID, &r.EntryType, &r.ReversalOf, &r.CreatedAt, &r.UpdatedAt); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan statement record"})
 			return
 		}
@@ -839,51 +842,67 @@ func getStatements(c *gin.Context) {
 	}
 
 	// 获取总记录数
-	countQuery := "SELECT COUNT(*) FROM statement_records WHERE 1=1"
-	countArgs := []interface{}{}
-
-	if customerID > 0 {
-		countQuery += " AND customer_id = ?"
-		countArgs = append(countArgs, customerID)
-	}
-
-	if startTime != "" {
-		countQuery += " AND date >= ?"
-		countArgs = append(countArgs, startTime)
-	}
-
-	if endTime != "" {
-		countQuery += " AND date <= ?"
-		countArgs = append(countArgs, endTime)
-	}
-
 	var total int
-	err = database.DB.QueryRow(countQuery, countArgs...).Scan(&total)
+	err = database.DB.QueryRow("SELECT COUNT(*) FROM statement_records"+where, args...).Scan(&total)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count statements"})
 		return
 	}
 
+	// 合计及大写金额
+	summary, err := customerStatementTable.summary(where, args, customerID, endTime)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to summarize statements: " + err.Error()})
+		return
+	}
+
 	// 返回结果
 	c.JSON(http.StatusOK, gin.H{
 		"total":   total,
 		"records": records,
+		"summary": summary,
 	})
 }
 
-// syncStatementsAPI 手动触发对帐单同步的API
+// syncStatementsAPI 手动触发对帐单同步的API，为全部客户提交校对任务，由后台队列执行
 func syncStatementsAPI(c *gin.Context) {
 	log.Println("手动触发对帐单同步")
-	if err := syncStatements(); err != nil {
-		log.Printf("对帐单同步失败：%v\n", err)
+	count, err := requestSyncAll(syncJobCustomerStatement, "SELECT id FROM customers")
+	if err != nil {
+		log.Printf("提交对帐单同步任务失败：%v\n", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to sync statements", "message": err.Error()})
 		return
 	}
-	log.Println("对帐单同步成功")
-	c.JSON(http.StatusOK, gin.H{"message": "对帐单同步成功"})
+	c.JSON(http.StatusAccepted, gin.H{"message": "对帐单同步任务已提交", "queued": count})
+}
+
+// productSelect 查询产品列表的语句
+const productSelect = "SELECT id, name, COALESCE(code, ''), COALESCE(category, ''), COALESCE(brand, ''), COALESCE(unit, ''), price, status, COALESCE(remark, ''), created_at, updated_at FROM products"
+
+// scanProduct 扫描一行产品数据
+func scanProduct(row interface{ Scan(...interface{}) error }) (Product, error) {
+	var p Product
+	err := row.Scan(&p.ID, &p.Name, &p.Code, &p.Category, &p.Brand, &p.Unit, &p.Price, &p.Status, &p.Remark, &p.CreatedAt, &p.UpdatedAt)
+	return p, err
 }
 
-// getProducts 获取产品列表
+// productListSort 产品列表可排序字段
+var productListSort = listSort{
+	Fields: map[string]string{
+		"createdAt": "created_at",
+		"updatedAt": "updated_at",
+		"code":      "code",
+		"name":      "name",
+		"category":  "category",
+		"brand":     "brand",
+		"price":     "price",
+	},
+	Default:    "createdAt",
+	Desc:       true,
+	TieBreaker: "id",
+}
+
+// getProducts 分页获取产品列表，支持按关键字、编号、名称、分类、品牌和状态筛选
 func getProducts(c *gin.Context) {
 	// 检查数据库连接
 	if database.DB == nil {
@@ -891,24 +910,50 @@ func getProducts(c *gin.Context) {
 		return
 	}
 
-	rows, err := database.DB.Query("SELECT id, name, COALESCE(code, ''), COALESCE(category, ''), COALESCE(brand, ''), COALESCE(unit, ''), CAST(price AS FLOAT) as price, status, COALESCE(remark, ''), created_at, updated_at FROM products ORDER BY created_at DESC")
+	lq, err := newListQuery(c, productListSort)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	lq.contains("keyword", "code", "name", "brand")
+	lq.contains("code", "code")
+	lq.contains("name", "name")
+	lq.eq("category", "category")
+	lq.eq("brand", "brand")
+	lq.eq("status", "status")
+	if lq.err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": lq.err.Error()})
+		return
+	}
+
+	total, err := lq.count("products")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count products: " + err.Error()})
+		return
+	}
+
+	query, args := lq.pageSQL(productSelect)
+	rows, err := database.DB.Query(query, args...)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch products: " + err.Error()})
 		return
 	}
 	defer rows.Close()
 
-	var products []Product
+	products := []Product{}
 	for rows.Next() {
-		var p Product
-		if err := rows.Scan(&p.ID, &p.Name, &p.Code, &p.Category, &p.Brand, &p.Unit, &p.Price, &p.Status, &p.Remark, &p.CreatedAt, &p.UpdatedAt); err != nil {
+		p, err := scanProduct(rows)
+		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan product: " + err.Error()})
 			return
 		}
 		products = append(products, p)
 	}
 
-	c.JSON(http.StatusOK, products)
+	c.JSON(http.StatusOK, gin.H{
+		"total":   total,
+		"records": products,
+	})
 }
 
 // getProductByID 根据ID获取产品
@@ -921,7 +966,7 @@ func getProductByID(c *gin.Context) {
 	}
 
 	var p Product
-	err = database.DB.QueryRow("SELECT id, name, code, category, brand, unit, CAST(price AS FLOAT) as price, status, remark, created_at, updated_at FROM products WHERE id = ?", id).Scan(
+	err = database.DB.QueryRow("SELECT id, name, code, category, brand, unit, price, status, remark, created_at, updated_at FROM products WHERE id = ?", id).Scan(
 		&p.ID, &p.Name, &p.Code, &p.Category, &p.Brand, &p.Unit, &p.Price, &p.Status, &p.Remark, &p.CreatedAt, &p.UpdatedAt,
 	)
 	if err != nil {
@@ -937,10 +982,11 @@ func getProductByID(c *gin.Context) {
 }
 
 // generateProductCode 生成产品编号（P+4位数字递增）
-func generateProductCode(db *sql.DB) (string, error) {
+func generateProductCode(db dbExecutor) (string, error) {
 	// 获取当前最大的产品编号
 	var maxCode sql.NullString
-	err := db.QueryRow("SELECT MAX(code) FROM products WHERE code REGEXP '^P[0-9]+$'").Scan(&maxCode)
+	cond, args := database.CurrentDialect().CodeSequence("code", "P")
+	err := db.QueryRow("SELECT MAX(code) FROM products WHERE "+cond, args...).Scan(&maxCode)
 	if err != nil && err != sql.ErrNoRows {
 		return "", err
 	}
@@ -1004,9 +1050,24 @@ func createProduct(c *gin.Context) {
 		status = 1
 	}
 
-	result, err := database.DB.Exec(
-		"INSERT INTO products (name, code, category, brand, unit, price, status, remark) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
-		req.Name, productCode, req.Category, req.Brand, req.Unit, req.Price, status, req.Remark,
+	namePinyin, nameInitials := searchPinyin(req.Name)
+	brandPinyin, brandInitials, err := brandSearchPinyin(database.DB, req.Brand)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch brand"})
+		return
+	}
+
+	// 开始事务，操作日志与数据一起提交
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction: " + err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(
+		"INSERT INTO products (name, code, category, brand, unit, price, status, remark, name_pinyin, name_initials, brand_pinyin, brand_initials) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		req.Name, productCode, req.Category, req.Brand, req.Unit, req.Price, status, req.Remark, namePinyin, nameInitials, brandPinyin, brandInitials,
 	)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create product"})
@@ -1018,10 +1079,20 @@ func createProduct(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get last insert ID"})
 		return
 	}
+	if err := recordAudit(tx, c, auditProduct, id, auditActionCreate, nil); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write audit log: " + err.Error()})
+		return
+	}
+
+	// 提交事务
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction: " + err.Error()})
+		return
+	}
 
 	// 获取创建的产品
 	var p Product
-	err = database.DB.QueryRow("SELECT id, name, code, category, brand, unit, CAST(price AS FLOAT) as price, status, remark, created_at, updated_at FROM products WHERE id = ?", id).Scan(
+	err = database.DB.QueryRow("SELECT id, name, code, category, brand, unit, price, status, remark, created_at, updated_at FROM products WHERE id = ?", id).Scan(
 		&p.ID, &p.Name, &p.Code, &p.Category, &p.Brand, &p.Unit, &p.Price, &p.Status, &p.Remark, &p.CreatedAt, &p.UpdatedAt,
 	)
 	if err != nil {
@@ -1060,8 +1131,9 @@ func updateProduct(c *gin.Context) {
 	args := []interface{}{}
 
 	if req.Name != "" {
-		query += ", name = ?"
-		args = append(args, req.Name)
+		namePinyin, nameInitials := searchPinyin(req.Name)
+		query += ", name = ?, name_pinyin = ?, name_initials = ?"
+		args = append(args, req.Name, namePinyin, nameInitials)
 	}
 	if req.Code != "" {
 		// 验证产品编号唯一性（排除当前产品）
@@ -1083,14 +1155,19 @@ func updateProduct(c *gin.Context) {
 		args = append(args, req.Category)
 	}
 	if req.Brand != "" {
-		query += ", brand = ?"
-		args = append(args, req.Brand)
+		brandPinyin, brandInitials, err := brandSearchPinyin(database.DB, req.Brand)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch brand"})
+			return
+		}
+		query += ", brand = ?, brand_pinyin = ?, brand_initials = ?"
+		args = append(args, req.Brand, brandPinyin, brandInitials)
 	}
 	if req.Unit != "" {
 		query += ", unit = ?"
 		args = append(args, req.Unit)
 	}
-	if req.Price > 0 {
+	if req.Price.IsPositive() {
 		query += ", price = ?"
 		args = append(args, req.Price)
 	}
@@ -1106,16 +1183,40 @@ func updateProduct(c *gin.Context) {
 	query += " WHERE id = ?"
 	args = append(args, id)
 
+	// 开始事务，操作日志与数据一起提交
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction: " + err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	before, err := snapshotEntity(tx, auditProduct, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch product"})
+		return
+	}
+
 	// 执行更新
-	_, err = database.DB.Exec(query, args...)
+	_, err = tx.Exec(query, args...)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update product"})
 		return
 	}
+	if err := recordAudit(tx, c, auditProduct, id, auditActionUpdate, before); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write audit log: " + err.Error()})
+		return
+	}
+
+	// 提交事务
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction: " + err.Error()})
+		return
+	}
 
 	// 获取更新后的产品
 	var p Product
-	err = database.DB.QueryRow("SELECT id, name, code, category, brand, unit, CAST(price AS FLOAT) as price, status, remark, created_at, updated_at FROM products WHERE id = ?", id).Scan(
+	err = database.DB.QueryRow("SELECT id, name, code, category, brand, unit, price, status, remark, created_at, updated_at FROM products WHERE id = ?", id).Scan(
 		&p.ID, &p.Name, &p.Code, &p.Category, &p.Brand, &p.Unit, &p.Price, &p.Status, &p.Remark, &p.CreatedAt, &p.UpdatedAt,
 	)
 	if err != nil {
@@ -1143,12 +1244,36 @@ func deleteProduct(c *gin.Context) {
 		return
 	}
 
+	// 开始事务，操作日志与数据一起提交
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction: " + err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	before, err := snapshotEntity(tx, auditProduct, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch product"})
+		return
+	}
+
 	// 执行删除
-	_, err = database.DB.Exec("DELETE FROM products WHERE id = ?", id)
+	_, err = tx.Exec("DELETE FROM products WHERE id = ?", id)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete product"})
 		return
 	}
+	if err := recordAudit(tx, c, auditProduct, id, auditActionDelete, before); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write audit log: " + err.Error()})
+		return
+	}
+
+	// 提交事务
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction: " + err.Error()})
+		return
+	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Product deleted successfully"})
 }
@@ -1270,12 +1395,36 @@ func batchDeleteProducts(c *gin.Context) {
 	}
 	query += ")"
 
+	// 开始事务，操作日志与数据一起提交
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction: " + err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	snapshots, err := snapshotEntities(tx, auditProduct, req.IDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch products"})
+		return
+	}
+
 	// 执行批量删除
-	result, err := database.DB.Exec(query, args...)
+	result, err := tx.Exec(query, args...)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete products"})
 		return
 	}
+	if err := recordAuditDeletes(tx, c, auditProduct, snapshots); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write audit log: " + err.Error()})
+		return
+	}
+
+	// 提交事务
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction: " + err.Error()})
+		return
+	}
 
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
@@ -1342,7 +1491,8 @@ func getDictionaryTypeByID(c *gin.Context) {
 func generateDictTypeCode(db *sql.DB) (string, error) {
 	// 获取当前最大的字典类型编码
 	var maxCode sql.NullString
-	err := db.QueryRow("SELECT MAX(code) FROM dictionary_types WHERE code REGEXP '^D[0-9]+$'").Scan(&maxCode)
+	cond, args := database.CurrentDialect().CodeSequence("code", "D")
+	err := db.QueryRow("SELECT MAX(code) FROM dictionary_types WHERE "+cond, args...).Scan(&maxCode)
 	if err != nil && err != sql.ErrNoRows {
 		return "", err
 	}
@@ -1383,7 +1533,15 @@ func createDictionaryType(c *gin.Context) {
 		return
 	}
 
-	result, err := database.DB.Exec(
+	// 开始事务，操作日志与数据一起提交
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction: " + err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(
 		"INSERT INTO dictionary_types (code, name) VALUES (?, ?)",
 		dictTypeCode, req.Name,
 	)
@@ -1397,6 +1555,16 @@ func createDictionaryType(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get last insert ID"})
 		return
 	}
+	if err := recordAudit(tx, c, auditDictionaryType, id, auditActionCreate, nil); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write audit log: " + err.Error()})
+		return
+	}
+
+	// 提交事务
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction: " + err.Error()})
+		return
+	}
 
 	// 获取创建的字典类型
 	var t DictionaryType
@@ -1446,12 +1614,36 @@ func updateDictionaryType(c *gin.Context) {
 	query += " WHERE id = ?"
 	args = append(args, id)
 
+	// 开始事务，操作日志与数据一起提交
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction: " + err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	before, err := snapshotEntity(tx, auditDictionaryType, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch dictionary type"})
+		return
+	}
+
 	// 执行更新
-	_, err = database.DB.Exec(query, args...)
+	_, err = tx.Exec(query, args...)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update dictionary type"})
 		return
 	}
+	if err := recordAudit(tx, c, auditDictionaryType, id, auditActionUpdate, before); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write audit log: " + err.Error()})
+		return
+	}
+
+	// 提交事务
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction: " + err.Error()})
+		return
+	}
 
 	// 获取更新后的字典类型
 	var t DictionaryType
@@ -1483,12 +1675,36 @@ func deleteDictionaryType(c *gin.Context) {
 		return
 	}
 
+	// 开始事务，操作日志与数据一起提交
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction: " + err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	before, err := snapshotEntity(tx, auditDictionaryType, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch dictionary type"})
+		return
+	}
+
 	// 执行删除
-	_, err = database.DB.Exec("DELETE FROM dictionary_types WHERE id = ?", id)
+	_, err = tx.Exec("DELETE FROM dictionary_types WHERE id = ?", id)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete dictionary type"})
 		return
 	}
+	if err := recordAudit(tx, c, auditDictionaryType, id, auditActionDelete, before); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write audit log: " + err.Error()})
+		return
+	}
+
+	// 提交事务
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction: " + err.Error()})
+		return
+	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Dictionary type deleted successfully"})
 }
@@ -1518,12 +1734,36 @@ func batchDeleteDictionaryTypes(c *gin.Context) {
 	}
 	query += ")"
 
+	// 开始事务，操作日志与数据一起提交
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction: " + err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	snapshots, err := snapshotEntities(tx, auditDictionaryType, req.IDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch dictionary types"})
+		return
+	}
+
 	// 执行批量删除
-	result, err := database.DB.Exec(query, args...)
+	result, err := tx.Exec(query, args...)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete dictionary types"})
 		return
 	}
+	if err := recordAuditDeletes(tx, c, auditDictionaryType, snapshots); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write audit log: " + err.Error()})
+		return
+	}
+
+	// 提交事务
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction: " + err.Error()})
+		return
+	}
 
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
@@ -1539,21 +1779,41 @@ func batchDeleteDictionaryTypes(c *gin.Context) {
 
 // ========== 字典项 API ==========
 
-// getDictionaryItems 获取字典项列表
+// dictionaryItemListSort 字典项列表可排序字段
+var dictionaryItemListSort = listSort{
+	Fields: map[string]string{
+		"createdAt": "created_at",
+		"code":      "code",
+		"name":      "name",
+	},
+	Default:    "createdAt",
+	Desc:       true,
+	TieBreaker: "id",
+}
+
+// getDictionaryItems 分页获取字典项列表，支持按字典类型、状态和关键字筛选
 func getDictionaryItems(c *gin.Context) {
+	lq, err := newListQuery(c, dictionaryItemListSort)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	// 支持按字典类型筛选
-	dictTypeCode := c.Query("dictTypeCode")
-
-	var query string
-	var args []interface{}
+	lq.eq("dictTypeCode", "dict_type_code")
+	lq.eq("status", "status")
+	lq.contains("keyword", "code", "name")
+	if lq.err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": lq.err.Error()})
+		return
+	}
 
-	if dictTypeCode != "" {
-		query = "SELECT id, code, name, dict_type_code, status, created_at, updated_at FROM dictionary_items WHERE dict_type_code = ? ORDER BY created_at DESC"
-		args = append(args, dictTypeCode)
-	} else {
-		query = "SELECT id, code, name, dict_type_code, status, created_at, updated_at FROM dictionary_items ORDER BY created_at DESC"
+	total, err := lq.count("dictionary_items")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count dictionary items: " + err.Error()})
+		return
 	}
 
+	query, args := lq.pageSQL("SELECT id, code, name, dict_type_code, status, created_at, updated_at FROM dictionary_items")
 	rows, err := database.DB.Query(query, args...)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch dictionary items: " + err.Error()})
@@ -1561,7 +1821,7 @@ func getDictionaryItems(c *gin.Context) {
 	}
 	defer rows.Close()
 
-	var items []DictionaryItem
+	items := []DictionaryItem{}
 	for rows.Next() {
 		var item DictionaryItem
 		if err := rows.Scan(&item.ID, &item.Code, &item.Name, &item.DictTypeCode, &item.Status, &item.CreatedAt, &item.UpdatedAt); err != nil {
@@ -1571,7 +1831,10 @@ func getDictionaryItems(c *gin.Context) {
 		items = append(items, item)
 	}
 
-	c.JSON(http.StatusOK, items)
+	c.JSON(http.StatusOK, gin.H{
+		"total":   total,
+		"records": items,
+	})
 }
 
 // getDictionaryItemByID 根据ID获取字典项
@@ -1603,7 +1866,9 @@ func getDictionaryItemByID(c *gin.Context) {
 func generateDictItemCode(db *sql.DB, dictTypeCode string) (string, error) {
 	// 获取当前字典类型下最大的字典项编码
 	var maxCode sql.NullString
-	err := db.QueryRow("SELECT MAX(code) FROM dictionary_items WHERE dict_type_code = ? AND code REGEXP '^"+dictTypeCode+"[0-9]+$'", dictTypeCode).Scan(&maxCode)
+	cond, args := database.CurrentDialect().CodeSequence("code", dictTypeCode)
+	args = append([]interface{}{dictTypeCode}, args...)
+	err := db.QueryRow("SELECT MAX(code) FROM dictionary_items WHERE dict_type_code = ? AND "+cond, args...).Scan(&maxCode)
 	if err != nil && err != sql.ErrNoRows {
 		return "", err
 	}
@@ -1659,7 +1924,15 @@ func createDictionaryItem(c *gin.Context) {
 		status = 1
 	}
 
-	result, err := database.DB.Exec(
+	// 开始事务，操作日志与数据一起提交
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction: " + err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(
 		"INSERT INTO dictionary_items (code, name, dict_type_code, status) VALUES (?, ?, ?, ?)",
 		dictItemCode, req.Name, req.DictTypeCode, status,
 	)
@@ -1673,6 +1946,16 @@ func createDictionaryItem(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get last insert ID"})
 		return
 	}
+	if err := recordAudit(tx, c, auditDictionaryItem, id, auditActionCreate, nil); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write audit log: " + err.Error()})
+		return
+	}
+
+	// 提交事务
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction: " + err.Error()})
+		return
+	}
 
 	// 获取创建的字典项
 	var item DictionaryItem
@@ -1703,12 +1986,16 @@ func updateDictionaryItem(c *gin.Context) {
 	}
 
 	// 检查字典项是否存在
-	var exists bool
-	database.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM dictionary_items WHERE id = ?)", id).Scan(&exists)
-	if !exists {
+	var code string
+	err = database.DB.QueryRow("SELECT code FROM dictionary_items WHERE id = ?", id).Scan(&code)
+	if err == sql.ErrNoRows {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Dictionary item not found"})
 		return
 	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch dictionary item"})
+		return
+	}
 
 	// 构建更新语句
 	query := "UPDATE dictionary_items SET updated_at = CURRENT_TIMESTAMP"
@@ -1737,12 +2024,43 @@ func updateDictionaryItem(c *gin.Context) {
 	query += " WHERE id = ?"
 	args = append(args, id)
 
+	// 开始事务，字典项改名与产品品牌拼音一起提交
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction: " + err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	before, err := snapshotEntity(tx, auditDictionaryItem, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch dictionary item"})
+		return
+	}
+
 	// 执行更新
-	_, err = database.DB.Exec(query, args...)
+	_, err = tx.Exec(query, args...)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update dictionary item"})
 		return
 	}
+	// 产品品牌保存的是字典项编码，品牌改名后重新生成这些产品的品牌拼音
+	if req.Name != "" {
+		if err := refreshBrandPinyin(tx, code, req.Name); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update product brand pinyin: " + err.Error()})
+			return
+		}
+	}
+	if err := recordAudit(tx, c, auditDictionaryItem, id, auditActionUpdate, before); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write audit log: " + err.Error()})
+		return
+	}
+
+	// 提交事务
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction: " + err.Error()})
+		return
+	}
 
 	// 获取更新后的字典项
 	var item DictionaryItem
@@ -1774,12 +2092,36 @@ func deleteDictionaryItem(c *gin.Context) {
 		return
 	}
 
+	// 开始事务，操作日志与数据一起提交
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction: " + err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	before, err := snapshotEntity(tx, auditDictionaryItem, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch dictionary item"})
+		return
+	}
+
 	// 执行删除
-	_, err = database.DB.Exec("DELETE FROM dictionary_items WHERE id = ?", id)
+	_, err = tx.Exec("DELETE FROM dictionary_items WHERE id = ?", id)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete dictionary item"})
 		return
 	}
+	if err := recordAudit(tx, c, auditDictionaryItem, id, auditActionDelete, before); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write audit log: " + err.Error()})
+		return
+	}
+
+	// 提交事务
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction: " + err.Error()})
+		return
+	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Dictionary item deleted successfully"})
 }
@@ -1809,12 +2151,36 @@ func batchDeleteDictionaryItems(c *gin.Context) {
 	}
 	query += ")"
 
+	// 开始事务，操作日志与数据一起提交
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction: " + err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	snapshots, err := snapshotEntities(tx, auditDictionaryItem, req.IDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch dictionary items"})
+		return
+	}
+
 	// 执行批量删除
-	result, err := database.DB.Exec(query, args...)
+	result, err := tx.Exec(query, args...)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete dictionary items"})
 		return
 	}
+	if err := recordAuditDeletes(tx, c, auditDictionaryItem, snapshots); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write audit log: " + err.Error()})
+		return
+	}
+
+	// 提交事务
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction: " + err.Error()})
+		return
+	}
 
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
@@ -1892,19 +2258,39 @@ func updateSettings(c *gin.Context) {
 	}
 	defer tx.Rollback()
 
-	// 更新或插入每个设置，使用INSERT ... ON DUPLICATE KEY UPDATE避免重复键冲突
+	// 更新或插入每个设置，按key插入或更新避免重复键冲突
+	upsertSQL := database.CurrentDialect().Upsert("settings",
+		[]string{"`key`", "value", "description"},
+		[]string{"`key`"},
+		[]string{"value", "description", "updated_at = CURRENT_TIMESTAMP"},
+	)
 	for _, setting := range req.Settings {
-		_, err := tx.Exec(
-			"INSERT INTO settings (`key`, value, description, created_at, updated_at) "+
-				"VALUES (?, ?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP) "+
-				"ON DUPLICATE KEY UPDATE "+
-				"value = VALUES(value), description = VALUES(description), updated_at = CURRENT_TIMESTAMP",
-			setting.Key, setting.Value, setting.Description,
-		)
+		before, err := snapshotEntity(tx, auditSetting, setting.Key)
 		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch setting: " + err.Error()})
+			return
+		}
+		// 值和说明都没有变化的设置不更新，也不记录日志
+		if before != nil {
+			description, _ := before["description"].(string)
+			if before["value"] == setting.Value && description == setting.Description {
+				continue
+			}
+		}
+
+		if _, err := tx.Exec(upsertSQL, setting.Key, setting.Value, setting.Description); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update setting: " + err.Error()})
 			return
 		}
+
+		action := auditActionUpdate
+		if before == nil {
+			action = auditActionCreate
+		}
+		if err := recordAudit(tx, c, auditSetting, setting.Key, action, before); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write audit log: " + err.Error()})
+			return
+		}
 	}
 
 	// 提交事务
@@ -1920,10 +2306,11 @@ func updateSettings(c *gin.Context) {
 // ========== 客户管理 API ==========
 
 // generateCustomerCode 生成客户编号（D+4位数字递增）
-func generateCustomerCode(db *sql.DB) (string, error) {
+func generateCustomerCode(db dbExecutor) (string, error) {
 	// 获取当前最大的客户编号
 	var maxCode sql.NullString
-	err := db.QueryRow("SELECT MAX(code) FROM customers WHERE code REGEXP '^C[0-9]+$'").Scan(&maxCode)
+	cond, args := database.CurrentDialect().CodeSequence("code", "C")
+	err := db.QueryRow("SELECT MAX(code) FROM customers WHERE "+cond, args...).Scan(&maxCode)
 	if err != nil && err != sql.ErrNoRows {
 		return "", err
 	}
@@ -1949,7 +2336,32 @@ func generateCustomerCode(db *sql.DB) (string, error) {
 	return newCode, nil
 }
 
-// getCustomers 获取客户列表
+// customerSelect 查询客户列表的语句
+const customerSelect = "SELECT id, code, name, phone, COALESCE(province, ''), COALESCE(city, ''), COALESCE(district, ''), COALESCE(address, ''), COALESCE(company, ''), status, COALESCE(remark, ''), created_at, updated_at FROM customers"
+
+// scanCustomer 扫描一行客户数据
+func scanCustomer(row interface{ Scan(...interface{}) error }) (Customer, error) {
+	var customer Customer
+	err := row.Scan(&customer.ID, &customer.Code, &customer.Name, &customer.Phone, &customer.Province, &customer.City, &customer.District, &customer.Address, &customer.Company, &customer.Status, &customer.Remark, &customer.CreatedAt, &customer.UpdatedAt)
+	return customer, err
+}
+
+// customerListSort 客户列表可排序字段
+var customerListSort = listSort{
+	Fields: map[string]string{
+		"createdAt": "created_at",
+		"updatedAt": "updated_at",
+		"code":      "code",
+		"name":      "name",
+		"province":  "province",
+		"city":      "city",
+	},
+	Default:    "createdAt",
+	Desc:       true,
+	TieBreaker: "id",
+}
+
+// getCustomers 分页获取客户列表，支持单框搜索以及按编号、名称、手机号、公司、地区和状态筛选
 func getCustomers(c *gin.Context) {
 	// 检查数据库连接
 	if database.DB == nil {
@@ -1957,24 +2369,56 @@ func getCustomers(c *gin.Context) {
 		return
 	}
 
-	rows, err := database.DB.Query("SELECT id, code, name, phone, COALESCE(province, ''), COALESCE(city, ''), COALESCE(district, ''), COALESCE(address, ''), COALESCE(company, ''), status, COALESCE(remark, ''), created_at, updated_at FROM customers ORDER BY created_at DESC")
+	lq, err := newListQuery(c, customerListSort)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if q := strings.TrimSpace(c.Query("q")); q != "" {
+		m := matchCustomers(q)
+		lq.where(m.Cond, m.Args...)
+		lq.rankFirst(m.Rank, m.RankArgs...)
+	}
+	lq.contains("code", "code")
+	lq.contains("name", "name")
+	lq.contains("phone", "phone")
+	lq.contains("company", "company")
+	lq.eq("province", "province")
+	lq.eq("city", "city")
+	lq.eq("status", "status")
+	if lq.err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": lq.err.Error()})
+		return
+	}
+
+	total, err := lq.count("customers")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count customers: " + err.Error()})
+		return
+	}
+
+	query, args := lq.pageSQL(customerSelect)
+	rows, err := database.DB.Query(query, args...)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch customers: " + err.Error()})
 		return
 	}
 	defer rows.Close()
 
-	var customers []Customer
+	customers := []Customer{}
 	for rows.Next() {
-		var customer Customer
-		if err := rows.Scan(&customer.ID, &customer.Code, &customer.Name, &customer.Phone, &customer.Province, &customer.City, &customer.District, &customer.Address, &customer.Company, &customer.Status, &customer.Remark, &customer.CreatedAt, &customer.UpdatedAt); err != nil {
+		customer, err := scanCustomer(rows)
+		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan customer: " + err.Error()})
 			return
 		}
 		customers = append(customers, customer)
 	}
 
-	c.JSON(http.StatusOK, customers)
+	c.JSON(http.StatusOK, gin.H{
+		"total":   total,
+		"records": customers,
+	})
 }
 
 // getCustomerByID 根据ID获取客户
@@ -2039,9 +2483,19 @@ func createCustomer(c *gin.Context) {
 		status = 1
 	}
 
-	result, err := database.DB.Exec(
-		"INSERT INTO customers (name, code, phone, province, city, district, address, company, status, remark) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
-		req.Name, customerCode, req.Phone, req.Province, req.City, req.District, req.Address, req.Company, status, req.Remark,
+	namePinyin, nameInitials := searchPinyin(req.Name)
+	companyPinyin, companyInitials := searchPinyin(req.Company)
+	// 开始事务，操作日志与数据一起提交
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction: " + err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(
+		"INSERT INTO customers (name, code, phone, province, city, district, address, company, status, remark, name_pinyin, name_initials, company_pinyin, company_initials) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		req.Name, customerCode, req.Phone, req.Province, req.City, req.District, req.Address, req.Company, status, req.Remark, namePinyin, nameInitials, companyPinyin, companyInitials,
 	)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create customer"})
@@ -2053,6 +2507,16 @@ func createCustomer(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get last insert ID"})
 		return
 	}
+	if err := recordAudit(tx, c, auditCustomer, id, auditActionCreate, nil); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write audit log: " + err.Error()})
+		return
+	}
+
+	// 提交事务
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction: " + err.Error()})
+		return
+	}
 
 	// 获取创建的客户
 	var customer Customer
@@ -2095,8 +2559,9 @@ func updateCustomer(c *gin.Context) {
 	args := []interface{}{}
 
 	if req.Name != "" {
-		query += ", name = ?"
-		args = append(args, req.Name)
+		namePinyin, nameInitials := searchPinyin(req.Name)
+		query += ", name = ?, name_pinyin = ?, name_initials = ?"
+		args = append(args, req.Name, namePinyin, nameInitials)
 	}
 	if req.Code != "" {
 		// 验证客户编号唯一性（排除当前客户）
@@ -2134,8 +2599,9 @@ func updateCustomer(c *gin.Context) {
 		args = append(args, req.Address)
 	}
 	if req.Company != "" {
-		query += ", company = ?"
-		args = append(args, req.Company)
+		companyPinyin, companyInitials := searchPinyin(req.Company)
+		query += ", company = ?, company_pinyin = ?, company_initials = ?"
+		args = append(args, req.Company, companyPinyin, companyInitials)
 	}
 	if req.Status == 0 || req.Status == 1 {
 		query += ", status = ?"
@@ -2149,12 +2615,41 @@ func updateCustomer(c *gin.Context) {
 	query += " WHERE id = ?"
 	args = append(args, id)
 
+	// 开始事务，操作日志与数据一起提交
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction: " + err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	before, err := snapshotEntity(tx, auditCustomer, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch customer"})
+		return
+	}
+
 	// 执行更新
-	_, err = database.DB.Exec(query, args...)
+	_, err = tx.Exec(query, args...)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update customer"})
 		return
 	}
+	if err := recordAudit(tx, c, auditCustomer, id, auditActionUpdate, before); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write audit log: " + err.Error()})
+		return
+	}
+
+	// 提交事务
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction: " + err.Error()})
+		return
+	}
+
+	// 对帐单分录上冗余了客户编号和名称，修改后在后台刷新
+	if req.Name != "" || req.Code != "" {
+		requestSync(syncJobCustomerStatement, id)
+	}
 
 	// 获取更新后的客户
 	var customer Customer
@@ -2186,12 +2681,36 @@ func deleteCustomer(c *gin.Context) {
 		return
 	}
 
+	// 开始事务，操作日志与数据一起提交
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction: " + err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	before, err := snapshotEntity(tx, auditCustomer, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch customer"})
+		return
+	}
+
 	// 执行删除
-	_, err = database.DB.Exec("DELETE FROM customers WHERE id = ?", id)
+	_, err = tx.Exec("DELETE FROM customers WHERE id = ?", id)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete customer"})
 		return
 	}
+	if err := recordAudit(tx, c, auditCustomer, id, auditActionDelete, before); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write audit log: " + err.Error()})
+		return
+	}
+
+	// 提交事务
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction: " + err.Error()})
+		return
+	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Customer deleted successfully"})
 }
@@ -2221,12 +2740,36 @@ func batchDeleteCustomers(c *gin.Context) {
 	}
 	query += ")"
 
+	// 开始事务，操作日志与数据一起提交
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction: " + err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	snapshots, err := snapshotEntities(tx, auditCustomer, req.IDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch customers"})
+		return
+	}
+
 	// 执行批量删除
-	result, err := database.DB.Exec(query, args...)
+	result, err := tx.Exec(query, args...)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete customers"})
 		return
 	}
+	if err := recordAuditDeletes(tx, c, auditCustomer, snapshots); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write audit log: " + err.Error()})
+		return
+	}
+
+	// 提交事务
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction: " + err.Error()})
+		return
+	}
 
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
@@ -2242,6 +2785,73 @@ func batchDeleteCustomers(c *gin.Context) {
 
 // ========== 销售订单 API ==========
 
+// 销售订单类型
+const (
+	orderTypeStore     = "门店销售"
+	orderTypeWholesale = "油管批发"
+	orderTypeRepair    = "挖机维修"
+)
+
+// 开票状态
+const (
+	invoiceStatusNone   = "未开票"
+	invoiceStatusIssued = "已开票"
+)
+
+// 付款状态
+const (
+	paymentStatusPending   = "待付款"
+	paymentStatusPartial   = "未结清"
+	paymentStatusCompleted = "已完成"
+	paymentStatusClosed    = "已关闭"
+)
+
+// saleOrderSelect 查询销售订单主信息的语句
+const saleOrderSelect = "SELECT id, code, create_time, customer_id, customer_name, customer_phone, customer_city, order_type, total_amount, freight, payable_amount, paid_amount, COALESCE(logistics_company, ''), COALESCE(tracking_number, ''), invoice_status, payment_status, COALESCE(closed_at, ''), COALESCE(close_reason, ''), COALESCE(remark, ''), created_at, updated_at FROM sale_orders"
+
+// scanSaleOrder 扫描一行销售订单主信息
+func scanSaleOrder(row interface{ Scan(...interface{}) error }) (SaleOrder, error) {
+	var so SaleOrder
+	err := row.Scan(&so.ID, &so.Code, &so.CreateTime, &so.CustomerID, &so.CustomerName, &so.CustomerPhone, &so.CustomerCity, &so.OrderType,
+		&so.OrderAmount, &so.Freight, &so.PayableAmount, &so.PaymentAmount, &so.LogisticsCompany, &so.TrackingNumber, &so.InvoiceStatus, &so.PaymentStatus,
+		&so.ClosedAt, &so.CloseReason, &so.Remark, &so.CreatedAt, &so.UpdatedAt)
+	so.PayableAmountUppercase = rmbUppercase(so.PayableAmount)
+	return so, err
+}
+
+// saleOrderHeader 销售订单中需要校验取值范围的字段，付款状态由收款分配计算，不接受前端传入
+type saleOrderHeader struct {
+	OrderType     string
+	InvoiceStatus string
+}
+
+// normalize 为空的字段填入默认值，并校验取值是否合法
+func (h *saleOrderHeader) normalize() error {
+	if h.OrderType == "" {
+		h.OrderType = orderTypeStore
+	}
+	if h.InvoiceStatus == "" {
+		h.InvoiceStatus = invoiceStatusNone
+	}
+
+	switch h.OrderType {
+	case orderTypeStore, orderTypeWholesale, orderTypeRepair:
+	default:
+		return fmt.Errorf("订单类型只能是%s、%s或%s", orderTypeStore, orderTypeWholesale, orderTypeRepair)
+	}
+	switch h.InvoiceStatus {
+	case invoiceStatusNone, invoiceStatusIssued:
+	default:
+		return fmt.Errorf("开票状态只能是%s或%s", invoiceStatusNone, invoiceStatusIssued)
+	}
+	return nil
+}
+
+// saleOrderPayableAmount 应付金额 = 商品总价 + 运费，保留两位小数
+func saleOrderPayableAmount(goodsAmount, freight decimal.Decimal) decimal.Decimal {
+	return roundAmount(goodsAmount.Add(freight))
+}
+
 // generateSaleOrderCode 生成销售订单号（S+YYMMDD+4位递增数字）
 func generateSaleOrderCode(db *sql.DB) (string, error) {
 	// 获取当前日期，格式：YYMMDD
@@ -2322,7 +2932,23 @@ func generateSaleOrderCodeAPI(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"code": code})
 }
 
-// getSaleOrders 获取销售订单列表
+// saleOrderListSort 销售订单列表可排序字段
+var saleOrderListSort = listSort{
+	Fields: map[string]string{
+		"createdAt":     "created_at",
+		"createTime":    "create_time",
+		"code":          "code",
+		"customerName":  "customer_name",
+		"customerCity":  "customer_city",
+		"payableAmount": "payable_amount",
+		"paymentAmount": "paid_amount",
+	},
+	Default:    "createdAt",
+	Desc:       true,
+	TieBreaker: "id",
+}
+
+// getSaleOrders 分页获取销售订单列表，支持按编号、客户、城市、订单类型、付款和开票状态、下单日期筛选
 func getSaleOrders(c *gin.Context) {
 	// 检查数据库连接
 	if database.DB == nil {
@@ -2331,45 +2957,70 @@ func getSaleOrders(c *gin.Context) {
 	}
 
 	// 获取销售订单列表
-	rows, err := database.DB.Query("SELECT id, code, create_time, customer_id, customer_name, customer_phone, customer_city, total_amount, paid_amount, COALESCE(remark, ''), created_at, updated_at FROM sale_orders ORDER BY created_at DESC")
+	lq, err := newListQuery(c, saleOrderListSort)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	lq.contains("code", "code")
+	lq.intEq("customerId", "customer_id")
+	lq.contains("customerName", "customer_name")
+	lq.eq("city", "customer_city")
+	lq.eq("orderType", "order_type")
+	// status 为付款状态
+	lq.eq("status", "payment_status")
+	lq.eq("invoiceStatus", "invoice_status")
+	lq.dateRange("create_time")
+	if lq.err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": lq.err.Error()})
+		return
+	}
+
+	total, err := lq.count("sale_orders")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count sale orders: " + err.Error()})
+		return
+	}
+
+	query, args := lq.pageSQL(saleOrderSelect)
+	rows, err := database.DB.Query(query, args...)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sale orders: " + err.Error()})
 		return
 	}
 	defer rows.Close()
 
-	var saleOrders []SaleOrder
+	saleOrders := []SaleOrder{}
+	var ids []int
 	for rows.Next() {
-		var so SaleOrder
-		if err := rows.Scan(&so.ID, &so.Code, &so.CreateTime, &so.CustomerID, &so.CustomerName, &so.CustomerPhone, &so.CustomerCity, &so.OrderAmount, &so.PaymentAmount, &so.Remark, &so.CreatedAt, &so.UpdatedAt); err != nil {
+		so, err := scanSaleOrder(rows)
+		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan sale order: " + err.Error()})
 			return
 		}
 
-		// 获取销售订单商品
-		itemRows, err := database.DB.Query("SELECT id, sale_order_id, product_id, product_code, product_name, quantity, unit, price, discount_amount, total, COALESCE(remark, '') FROM sale_order_items WHERE sale_order_id = ?", so.ID)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sale order items: " + err.Error()})
-			return
-		}
+		saleOrders = append(saleOrders, so)
+		ids = append(ids, so.ID)
+	}
+	rows.Close()
 
-		var items []SaleOrderItem
-		for itemRows.Next() {
-			var item SaleOrderItem
-			if err := itemRows.Scan(&item.ID, &item.SaleOrderID, &item.ProductID, &item.ProductCode, &item.ProductName, &item.Quantity, &item.Unit, &item.Price, &item.DiscountAmount, &item.TotalAmount, &item.Remark); err != nil {
-				itemRows.Close()
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan sale order item: " + err.Error()})
-				return
-			}
-			items = append(items, item)
+	// 一次查询取出本页所有订单的商品，避免逐单查询
+	items, err := loadSaleOrderItems(database.DB, ids)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sale order items: " + err.Error()})
+		return
+	}
+	for i := range saleOrders {
+		saleOrders[i].Items = items[saleOrders[i].ID]
+		if saleOrders[i].Items == nil {
+			saleOrders[i].Items = []SaleOrderItem{}
 		}
-		itemRows.Close()
-
-		so.Items = items
-		saleOrders = append(saleOrders, so)
 	}
 
-	c.JSON(http.StatusOK, saleOrders)
+	c.JSON(http.StatusOK, gin.H{
+		"total":   total,
+		"records": saleOrders,
+	})
 }
 
 // getSaleOrderByID 根据ID获取销售订单
@@ -2382,10 +3033,7 @@ func getSaleOrderByID(c *gin.Context) {
 	}
 
 	// 获取销售订单
-	var so SaleOrder
-	err = database.DB.QueryRow("SELECT id, code, create_time, customer_id, customer_name, customer_phone, customer_city, total_amount, paid_amount, COALESCE(remark, ''), created_at, updated_at FROM sale_orders WHERE id = ?", id).Scan(
-		&so.ID, &so.Code, &so.CreateTime, &so.CustomerID, &so.CustomerName, &so.CustomerPhone, &so.CustomerCity, &so.OrderAmount, &so.PaymentAmount, &so.Remark, &so.CreatedAt, &so.UpdatedAt,
-	)
+	so, err := scanSaleOrder(database.DB.QueryRow(saleOrderSelect+" WHERE id = ?", id))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Sale order not found"})
@@ -2396,32 +3044,16 @@ func getSaleOrderByID(c *gin.Context) {
 	}
 
 	// 获取销售订单商品
-	itemRows, err := database.DB.Query("SELECT id, sale_order_id, product_id, product_code, product_name, quantity, unit, price, discount_amount, total, COALESCE(remark, '') FROM sale_order_items WHERE sale_order_id = ?", id)
+	items, err := loadSaleOrderItems(database.DB, []int{so.ID})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sale order items: " + err.Error()})
 		return
 	}
-	defer itemRows.Close()
-
-	var items []SaleOrderItem
-	for itemRows.Next() {
-		var item SaleOrderItem
-		if err := itemRows.Scan(&item.ID, &item.SaleOrderID, &item.ProductID, &item.ProductCode, &item.ProductName, &item.Quantity, &item.Unit, &item.Price, &item.DiscountAmount, &item.TotalAmount, &item.Remark); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan sale order item: " + err.Error()})
-			return
-		}
-		items = append(items, item)
+	so.Items = items[so.ID]
+	if so.Items == nil {
+		so.Items = []SaleOrderItem{}
 	}
 
-	so.Items = items
-
-	// 异步同步该客户的对帐单
-	go func(customerID int) {
-		if err := syncCustomerStatements(customerID); err != nil {
-			log.Printf("同步客户对帐单失败：%v\n", err)
-		}
-	}(so.CustomerID)
-
 	c.JSON(http.StatusOK, so)
 }
 
@@ -2449,11 +3081,31 @@ func createSaleOrder(c *gin.Context) {
 		return
 	}
 
-	// 计算订单总金额
-	var orderAmount float64
-	for _, item := range req.Items {
-		orderAmount += item.TotalAmount
+	// 订单类型、开票和付款状态
+	header := saleOrderHeader{
+		OrderType:     req.OrderType,
+		InvoiceStatus: req.InvoiceStatus,
+	}
+	if err := header.normalize(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 校验商品明细并计算商品总价，应付金额 = 商品总价 + 运费
+	reqItems := make([]UpdateSaleOrderItemRequest, len(req.Items))
+	for i, item := range req.Items {
+		reqItems[i] = UpdateSaleOrderItemRequest{CreateSaleOrderItemRequest: item}
+	}
+	orderItems, orderAmount, fieldErrs, err := buildSaleOrderItems(tx, header.OrderType, reqItems, nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch products: " + err.Error()})
+		return
+	}
+	if fieldErrs != nil {
+		respondFieldErrors(c, fieldErrs)
+		return
 	}
+	payableAmount := saleOrderPayableAmount(orderAmount, req.Freight)
 
 	// 订单号处理：优先使用前端传递的code，如果为空则自动生成
 	orderCode := req.Code
@@ -2468,8 +3120,8 @@ func createSaleOrder(c *gin.Context) {
 
 	// 创建销售订单
 	result, err := tx.Exec(
-		"INSERT INTO sale_orders (code, create_time, customer_id, customer_name, customer_phone, customer_city, total_amount, paid_amount, remark) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
-		orderCode, req.CreateTime, req.CustomerID, customer.Name, customer.Phone, customer.City, orderAmount, 0, req.Remark,
+		"INSERT INTO sale_orders (code, create_time, customer_id, customer_name, customer_phone, customer_city, order_type, total_amount, freight, payable_amount, paid_amount, logistics_company, tracking_number, invoice_status, payment_status, remark) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		orderCode, req.CreateTime, req.CustomerID, customer.Name, customer.Phone, customer.City, header.OrderType, orderAmount, req.Freight, payableAmount, decimal.Zero, req.LogisticsCompany, req.TrackingNumber, header.InvoiceStatus, deriveSaleOrderPaymentStatus(decimal.Zero, payableAmount, false), req.Remark,
 	)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create sale order: " + err.Error()})
@@ -2483,15 +3135,31 @@ func createSaleOrder(c *gin.Context) {
 	}
 
 	// 创建销售订单商品
-	for _, item := range req.Items {
-		_, err := tx.Exec(
-			"INSERT INTO sale_order_items (sale_order_id, product_id, product_code, product_name, quantity, unit, price, discount_amount, total, remark) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
-			saleOrderID, item.ProductID, item.ProductCode, item.ProductName, item.Quantity, item.Unit, item.Price, item.DiscountAmount, item.TotalAmount, item.Remark,
-		)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create sale order item: " + err.Error()})
-			return
-		}
+	if err := insertSaleOrderItems(tx, saleOrderID, orderItems); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create sale order item: " + err.Error()})
+		return
+	}
+
+	// 销售出库
+	newQuantities, err := saleOrderStockQuantities(tx, int(saleOrderID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sale order items: " + err.Error()})
+		return
+	}
+	if err := applySaleOrderStock(tx, c, int(saleOrderID), nil, newQuantities, movementSaleOut); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update stock: " + err.Error()})
+		return
+	}
+
+	// 记入客户对帐单
+	if err := postStatementEntries(tx, statementSourceSaleOrder, int(saleOrderID)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to post statement entries: " + err.Error()})
+		return
+	}
+
+	if err := recordAudit(tx, c, auditSaleOrder, saleOrderID, auditActionCreate, nil); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write audit log: " + err.Error()})
+		return
 	}
 
 	// 提交事务
@@ -2503,10 +3171,7 @@ func createSaleOrder(c *gin.Context) {
 	// 直接查询并返回创建的销售订单
 	// 切换回普通连接查询
 	// 获取销售订单
-	var so SaleOrder
-	err = database.DB.QueryRow("SELECT id, code, create_time, customer_id, customer_name, customer_phone, customer_city, total_amount, paid_amount, COALESCE(remark, ''), created_at, updated_at FROM sale_orders WHERE id = ?", saleOrderID).Scan(
-		&so.ID, &so.Code, &so.CreateTime, &so.CustomerID, &so.CustomerName, &so.CustomerPhone, &so.CustomerCity, &so.OrderAmount, &so.PaymentAmount, &so.Remark, &so.CreatedAt, &so.UpdatedAt,
-	)
+	so, err := scanSaleOrder(database.DB.QueryRow(saleOrderSelect+" WHERE id = ?", saleOrderID))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Sale order not found"})
@@ -2517,32 +3182,16 @@ func createSaleOrder(c *gin.Context) {
 	}
 
 	// 获取销售订单商品
-	itemRows, err := database.DB.Query("SELECT id, sale_order_id, product_id, product_code, product_name, quantity, unit, price, discount_amount, total, COALESCE(remark, '') FROM sale_order_items WHERE sale_order_id = ?", saleOrderID)
+	items, err := loadSaleOrderItems(database.DB, []int{so.ID})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sale order items: " + err.Error()})
 		return
 	}
-	defer itemRows.Close()
-
-	var items []SaleOrderItem
-	for itemRows.Next() {
-		var item SaleOrderItem
-		if err := itemRows.Scan(&item.ID, &item.SaleOrderID, &item.ProductID, &item.ProductCode, &item.ProductName, &item.Quantity, &item.Unit, &item.Price, &item.DiscountAmount, &item.TotalAmount, &item.Remark); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan sale order item: " + err.Error()})
-			return
-		}
-		items = append(items, item)
+	so.Items = items[so.ID]
+	if so.Items == nil {
+		so.Items = []SaleOrderItem{}
 	}
 
-	so.Items = items
-
-	// 异步同步该客户的对帐单
-	go func(customerID int) {
-		if err := syncCustomerStatements(customerID); err != nil {
-			log.Printf("同步客户对帐单失败：%v\n", err)
-		}
-	}(req.CustomerID)
-
 	c.JSON(http.StatusOK, so)
 }
 
@@ -2575,7 +3224,25 @@ func updateSaleOrder(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction: " + err.Error()})
 		return
 	}
-	defer tx.Rollback()
+	defer tx.Rollback()
+
+	// 已关闭的订单不能修改
+	var oldCustomerID int
+	var closed bool
+	if err := tx.QueryRow("SELECT customer_id, closed_at IS NOT NULL FROM sale_orders WHERE id = ?", id).Scan(&oldCustomerID, &closed); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sale order: " + err.Error()})
+		return
+	}
+	if closed {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "订单已关闭，不能修改"})
+		return
+	}
+
+	before, err := snapshotEntity(tx, auditSaleOrder, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sale order: " + err.Error()})
+		return
+	}
 
 	// 获取客户信息
 	var customer Customer
@@ -2585,22 +3252,49 @@ func updateSaleOrder(c *gin.Context) {
 		return
 	}
 
-	// 计算订单总金额
-	var orderAmount float64
-	for _, item := range req.Items {
-		orderAmount += item.TotalAmount
+	// 订单类型、开票和付款状态
+	header := saleOrderHeader{
+		OrderType:     req.OrderType,
+		InvoiceStatus: req.InvoiceStatus,
+	}
+	if err := header.normalize(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 校验商品明细并计算商品总价，应付金额 = 商品总价 + 运费
+	existingLines, err := loadSaleOrderLines(tx, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sale order items: " + err.Error()})
+		return
+	}
+	items, orderAmount, fieldErrs, err := buildSaleOrderItems(tx, header.OrderType, req.Items, existingLines)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch products: " + err.Error()})
+		return
+	}
+	if fieldErrs != nil {
+		respondFieldErrors(c, fieldErrs)
+		return
 	}
+	payableAmount := saleOrderPayableAmount(orderAmount, req.Freight)
 
 	// 更新销售订单
 	_, err = tx.Exec(
-		"UPDATE sale_orders SET code = ?, create_time = ?, customer_id = ?, customer_name = ?, customer_phone = ?, customer_city = ?, total_amount = ?, remark = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
-		req.Code, req.CreateTime, req.CustomerID, customer.Name, customer.Phone, customer.City, orderAmount, req.Remark, id,
+		"UPDATE sale_orders SET code = ?, create_time = ?, customer_id = ?, customer_name = ?, customer_phone = ?, customer_city = ?, order_type = ?, total_amount = ?, freight = ?, payable_amount = ?, logistics_company = ?, tracking_number = ?, invoice_status = ?, remark = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
+		req.Code, req.CreateTime, req.CustomerID, customer.Name, customer.Phone, customer.City, header.OrderType, orderAmount, req.Freight, payableAmount, req.LogisticsCompany, req.TrackingNumber, header.InvoiceStatus, req.Remark, id,
 	)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update sale order: " + err.Error()})
 		return
 	}
 
+	oldQuantities, err := saleOrderStockQuantities(tx, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sale order items: " + err.Error()})
+		return
+	}
+
 	// 删除旧的销售订单商品
 	_, err = tx.Exec("DELETE FROM sale_order_items WHERE sale_order_id = ?", id)
 	if err != nil {
@@ -2609,17 +3303,45 @@ func updateSaleOrder(c *gin.Context) {
 	}
 
 	// 创建新的销售订单商品
-	for _, item := range req.Items {
-		_, err := tx.Exec(
-			"INSERT INTO sale_order_items (sale_order_id, product_id, product_code, product_name, quantity, unit, price, discount_amount, total, remark) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
-			id, item.ProductID, item.ProductCode, item.ProductName, item.Quantity, item.Unit, item.Price, item.DiscountAmount, item.TotalAmount, item.Remark,
-		)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create sale order item: " + err.Error()})
+	if err := insertSaleOrderItems(tx, int64(id), items); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create sale order item: " + err.Error()})
+		return
+	}
+
+	// 按修改前后的数量差额调整库存
+	newQuantities, err := saleOrderStockQuantities(tx, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sale order items: " + err.Error()})
+		return
+	}
+	if err := applySaleOrderStock(tx, c, id, oldQuantities, newQuantities, movementSaleAdjust); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update stock: " + err.Error()})
+		return
+	}
+
+	// 应付金额或客户变化后重新计算付款状态
+	if err := allocateCustomerPayments(tx, req.CustomerID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update payment status: " + err.Error()})
+		return
+	}
+	if oldCustomerID != req.CustomerID {
+		if err := allocateCustomerPayments(tx, oldCustomerID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update payment status: " + err.Error()})
 			return
 		}
 	}
 
+	// 应付金额、日期或客户变化时冲销原分录并按新内容重新记帐
+	if err := postStatementEntries(tx, statementSourceSaleOrder, id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to post statement entries: " + err.Error()})
+		return
+	}
+
+	if err := recordAudit(tx, c, auditSaleOrder, id, auditActionUpdate, before); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write audit log: " + err.Error()})
+		return
+	}
+
 	// 提交事务
 	if err := tx.Commit(); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction: " + err.Error()})
@@ -2639,7 +3361,7 @@ func deleteSaleOrder(c *gin.Context) {
 		return
 	}
 
-	// 获取客户ID以便后续同步对帐单
+	// 获取客户ID以便后续重新分配收款
 	var customerID int
 	err = database.DB.QueryRow("SELECT customer_id FROM sale_orders WHERE id = ?", id).Scan(&customerID)
 	if err != nil {
@@ -2655,6 +3377,23 @@ func deleteSaleOrder(c *gin.Context) {
 	}
 	defer tx.Rollback()
 
+	before, err := snapshotEntity(tx, auditSaleOrder, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sale order: " + err.Error()})
+		return
+	}
+
+	// 冲回库存
+	oldQuantities, err := saleOrderStockQuantities(tx, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sale order items: " + err.Error()})
+		return
+	}
+	if err := applySaleOrderStock(tx, c, id, oldQuantities, nil, movementSaleReverse); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update stock: " + err.Error()})
+		return
+	}
+
 	// 删除销售订单商品
 	_, err = tx.Exec("DELETE FROM sale_order_items WHERE sale_order_id = ?", id)
 	if err != nil {
@@ -2669,19 +3408,29 @@ func deleteSaleOrder(c *gin.Context) {
 		return
 	}
 
+	// 原先分配到该订单的收款重新分配到同一笔收款关联的其他订单
+	if err := allocateCustomerPayments(tx, customerID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update payment status: " + err.Error()})
+		return
+	}
+
+	// 冲销该订单在对帐单上的分录
+	if err := postStatementEntries(tx, statementSourceSaleOrder, id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to post statement entries: " + err.Error()})
+		return
+	}
+
+	if err := recordAudit(tx, c, auditSaleOrder, id, auditActionDelete, before); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write audit log: " + err.Error()})
+		return
+	}
+
 	// 提交事务
 	if err := tx.Commit(); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction: " + err.Error()})
 		return
 	}
 
-	// 异步同步该客户的对帐单
-	go func(customerID int) {
-		if err := syncCustomerStatements(customerID); err != nil {
-			log.Printf("同步客户对帐单失败：%v\n", err)
-		}
-	}(customerID)
-
 	c.JSON(http.StatusOK, gin.H{"message": "Sale order deleted successfully"})
 }
 
@@ -2746,7 +3495,15 @@ func createInvoice(c *gin.Context) {
 		status = 1
 	}
 
-	result, err := database.DB.Exec(
+	// 开始事务，操作日志与数据一起提交
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction: " + err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(
 		"INSERT INTO invoices (customer_id, company, tax_number, bank, bank_account, branch_address, status) VALUES (?, ?, ?, ?, ?, ?, ?)",
 		req.CustomerID, req.Company, req.TaxNumber, req.Bank, req.BankAccount, req.BranchAddress, status,
 	)
@@ -2760,6 +3517,16 @@ func createInvoice(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get last insert ID"})
 		return
 	}
+	if err := recordAudit(tx, c, auditInvoice, id, auditActionCreate, nil); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write audit log: " + err.Error()})
+		return
+	}
+
+	// 提交事务
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction: " + err.Error()})
+		return
+	}
 
 	// 获取创建的发票
 	var invoice Invoice
@@ -2840,12 +3607,36 @@ func updateInvoice(c *gin.Context) {
 	query += " WHERE id = ?"
 	args = append(args, id)
 
+	// 开始事务，操作日志与数据一起提交
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction: " + err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	before, err := snapshotEntity(tx, auditInvoice, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch invoice"})
+		return
+	}
+
 	// 执行更新
-	_, err = database.DB.Exec(query, args...)
+	_, err = tx.Exec(query, args...)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update invoice"})
 		return
 	}
+	if err := recordAudit(tx, c, auditInvoice, id, auditActionUpdate, before); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write audit log: " + err.Error()})
+		return
+	}
+
+	// 提交事务
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction: " + err.Error()})
+		return
+	}
 
 	// 获取更新后的发票
 	var invoice Invoice
@@ -2877,12 +3668,36 @@ func deleteInvoice(c *gin.Context) {
 		return
 	}
 
+	// 开始事务，操作日志与数据一起提交
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction: " + err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	before, err := snapshotEntity(tx, auditInvoice, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch invoice"})
+		return
+	}
+
 	// 执行删除
-	_, err = database.DB.Exec("DELETE FROM invoices WHERE id = ?", id)
+	_, err = tx.Exec("DELETE FROM invoices WHERE id = ?", id)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete invoice"})
 		return
 	}
+	if err := recordAudit(tx, c, auditInvoice, id, auditActionDelete, before); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write audit log: " + err.Error()})
+		return
+	}
+
+	// 提交事务
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction: " + err.Error()})
+		return
+	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Invoice deleted successfully"})
 }
@@ -2890,10 +3705,11 @@ func deleteInvoice(c *gin.Context) {
 // ========== 收款管理 API ==========
 
 // generatePaymentCode 生成收款编号（D+6位数字递增）
-func generatePaymentCode(db *sql.DB) (string, error) {
+func generatePaymentCode(db dbExecutor) (string, error) {
 	// 获取当前最大的收款编号
 	var maxCode sql.NullString
-	err := db.QueryRow("SELECT MAX(code) FROM payments WHERE code REGEXP '^D[0-9]+$'").Scan(&maxCode)
+	cond, args := database.CurrentDialect().CodeSequence("code", "D")
+	err := db.QueryRow("SELECT MAX(code) FROM payments WHERE "+cond, args...).Scan(&maxCode)
 	if err != nil && err != sql.ErrNoRows {
 		return "", err
 	}
@@ -2919,7 +3735,22 @@ func generatePaymentCode(db *sql.DB) (string, error) {
 	return newCode, nil
 }
 
-// getPayments 获取收款记录列表
+// paymentListSort 收款列表可排序字段
+var paymentListSort = listSort{
+	Fields: map[string]string{
+		"createdAt":     "p.created_at",
+		"paymentDate":   "p.payment_date",
+		"code":          "p.code",
+		"amount":        "p.amount",
+		"customerName":  "c.name",
+		"paymentMethod": "p.payment_method",
+	},
+	Default:    "createdAt",
+	Desc:       true,
+	TieBreaker: "p.id",
+}
+
+// getPayments 分页获取收款记录，支持按编号、客户、付款方式、账户、收款日期和关联订单筛选
 func getPayments(c *gin.Context) {
 	// 检查数据库连接
 	if database.DB == nil {
@@ -2927,19 +3758,53 @@ func getPayments(c *gin.Context) {
 		return
 	}
 
-	rows, err := database.DB.Query(`
-		SELECT p.id, p.code, p.payment_date, p.customer_id, c.name as customer_name, p.sale_order_ids, CAST(p.amount AS FLOAT) as amount, p.payment_method, p.account, COALESCE(p.payer_company, ''), COALESCE(p.remark, ''), p.created_at, p.updated_at 
-		FROM payments p 
-		LEFT JOIN customers c ON p.customer_id = c.id 
-		ORDER BY p.created_at DESC
-	`)
+	lq, err := newListQuery(c, paymentListSort)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	lq.contains("code", "p.code")
+	lq.intEq("customerId", "p.customer_id")
+	lq.contains("customerName", "c.name")
+	lq.eq("paymentMethod", "p.payment_method")
+	lq.eq("account", "p.account")
+	lq.dateRange("p.payment_date")
+	// 关联订单存放在 sale_order_ids JSON 数组中
+	dialect := database.CurrentDialect()
+	if s := strings.TrimSpace(c.Query("saleOrderId")); s != "" {
+		saleOrderID, err := strconv.Atoi(s)
+		if err != nil {
+			lq.fail("Invalid saleOrderId")
+		} else {
+			lq.where(dialect.JSONArrayContains("p.sale_order_ids", "?"), saleOrderID)
+		}
+	}
+	if s := strings.TrimSpace(c.Query("saleOrderCode")); s != "" {
+		lq.where("EXISTS (SELECT 1 FROM sale_orders so WHERE so.code LIKE ? AND "+dialect.JSONArrayContains("p.sale_order_ids", "so.id")+")", "%"+s+"%")
+	}
+	if lq.err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": lq.err.Error()})
+		return
+	}
+
+	total, err := lq.count("payments p LEFT JOIN customers c ON p.customer_id = c.id")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count payments: " + err.Error()})
+		return
+	}
+
+	query, args := lq.pageSQL(`
+		SELECT p.id, p.code, p.payment_date, p.customer_id, c.name as customer_name, p.sale_order_ids, p.amount, p.payment_method, p.account, COALESCE(p.payer_company, ''), COALESCE(p.remark, ''), p.created_at, p.updated_at
+		FROM payments p
+		LEFT JOIN customers c ON p.customer_id = c.id`)
+	rows, err := database.DB.Query(query, args...)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch payments: " + err.Error()})
 		return
 	}
 	defer rows.Close()
 
-	var payments []Payment
+	payments := []Payment{}
 	for rows.Next() {
 		var payment Payment
 		var saleOrderIdsJSON []byte
@@ -2966,11 +3831,15 @@ func getPayments(c *gin.Context) {
 			// 未设置值时，设置为空数组
 			payment.SaleOrderIDs = []int{}
 		}
+		payment.AmountUppercase = rmbUppercase(payment.Amount)
 
 		payments = append(payments, payment)
 	}
 
-	c.JSON(http.StatusOK, payments)
+	c.JSON(http.StatusOK, gin.H{
+		"total":   total,
+		"records": payments,
+	})
 }
 
 // createPayment 创建收款记录
@@ -2981,16 +3850,30 @@ func createPayment(c *gin.Context) {
 		return
 	}
 
+	// 开始事务，收款记录与分配结果一起提交
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction: " + err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
 	// 检查客户是否存在
 	var customerExists bool
-	database.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM customers WHERE id = ?)", req.CustomerID).Scan(&customerExists)
+	tx.QueryRow("SELECT EXISTS(SELECT 1 FROM customers WHERE id = ?)", req.CustomerID).Scan(&customerExists)
 	if !customerExists {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Customer not found"})
 		return
 	}
 
+	// 已关闭的订单不能再分配收款
+	if err := checkSaleOrdersOpen(tx, req.SaleOrderIDs); err != nil {
+		c.JSON(saleOrderOpenErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
 	// 生成收款编号
-	paymentCode, err := generatePaymentCode(database.DB)
+	paymentCode, err := generatePaymentCode(tx)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate payment code"})
 		return
@@ -3003,7 +3886,7 @@ func createPayment(c *gin.Context) {
 		return
 	}
 
-	result, err := database.DB.Exec(
+	result, err := tx.Exec(
 		"INSERT INTO payments (code, payment_date, customer_id, sale_order_ids, amount, payment_method, account, payer_company, remark) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
 		paymentCode, req.PaymentDate, req.CustomerID, saleOrderIdsJSON, req.Amount, req.PaymentMethod, req.Account, req.PayerCompany, req.Remark,
 	)
@@ -3017,12 +3900,30 @@ func createPayment(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get last insert ID"})
 		return
 	}
+	if err := allocateCustomerPayments(tx, req.CustomerID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to allocate payment: " + err.Error()})
+		return
+	}
+	if err := postStatementEntries(tx, statementSourcePayment, int(id)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to post statement entries: " + err.Error()})
+		return
+	}
+	if err := recordAudit(tx, c, auditPayment, id, auditActionCreate, nil); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write audit log: " + err.Error()})
+		return
+	}
+
+	// 提交事务
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction: " + err.Error()})
+		return
+	}
 
 	// 获取创建的收款记录
 	var payment Payment
 	var fetchedSaleOrderIdsJSON []byte
 	err = database.DB.QueryRow(`
-		SELECT p.id, p.code, p.payment_date, p.customer_id, c.name as customer_name, p.sale_order_ids, CAST(p.amount AS FLOAT) as amount, p.payment_method, p.account, COALESCE(p.payer_company, ''), COALESCE(p.remark, ''), p.created_at, p.updated_at 
+		SELECT p.id, p.code, p.payment_date, p.customer_id, c.name as customer_name, p.sale_order_ids, p.amount, p.payment_method, p.account, COALESCE(p.payer_company, ''), COALESCE(p.remark, ''), p.created_at, p.updated_at 
 		FROM payments p 
 		LEFT JOIN customers c ON p.customer_id = c.id 
 		WHERE p.id = ?
@@ -3048,18 +3949,12 @@ func createPayment(c *gin.Context) {
 		// 未设置值时，设置为空数组
 		payment.SaleOrderIDs = []int{}
 	}
+	payment.AmountUppercase = rmbUppercase(payment.Amount)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch created payment"})
 		return
 	}
 
-	// 异步同步该客户的对帐单
-	go func(customerID int) {
-		if err := syncCustomerStatements(customerID); err != nil {
-			log.Printf("同步客户对帐单失败：%v\n", err)
-		}
-	}(req.CustomerID)
-
 	c.JSON(http.StatusCreated, payment)
 }
 
@@ -3088,7 +3983,8 @@ func batchCreatePayments(c *gin.Context) {
 	var paymentCodes []string
 	// 获取当前最大的收款编号
 	var maxCode sql.NullString
-	err = tx.QueryRow("SELECT MAX(code) FROM payments WHERE code REGEXP '^D[0-9]+$'").Scan(&maxCode)
+	cond, condArgs := database.CurrentDialect().CodeSequence("code", "D")
+	err = tx.QueryRow("SELECT MAX(code) FROM payments WHERE "+cond, condArgs...).Scan(&maxCode)
 	if err != nil && err != sql.ErrNoRows {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get max payment code"})
 		return
@@ -3130,6 +4026,10 @@ func batchCreatePayments(c *gin.Context) {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Customer not found for payment"})
 			return
 		}
+		if err := checkSaleOrdersOpen(tx, paymentReq.SaleOrderIDs); err != nil {
+			c.JSON(saleOrderOpenErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
 
 		// 使用预生成的编号
 		paymentCode := paymentCodes[i]
@@ -3157,11 +4057,19 @@ func batchCreatePayments(c *gin.Context) {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get last insert ID"})
 			return
 		}
+		if err := recordAudit(tx, c, auditPayment, id, auditActionCreate, nil); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write audit log: " + err.Error()})
+			return
+		}
+		if err := postStatementEntries(tx, statementSourcePayment, int(id)); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to post statement entries: " + err.Error()})
+			return
+		}
 
 		var payment Payment
 		var fetchedSaleOrderIdsJSON []byte
 		err = tx.QueryRow(`
-			SELECT p.id, p.code, p.payment_date, p.customer_id, c.name as customer_name, p.sale_order_ids, CAST(p.amount AS FLOAT) as amount, p.payment_method, p.account, COALESCE(p.payer_company, ''), COALESCE(p.remark, ''), p.created_at, p.updated_at 
+			SELECT p.id, p.code, p.payment_date, p.customer_id, c.name as customer_name, p.sale_order_ids, p.amount, p.payment_method, p.account, COALESCE(p.payer_company, ''), COALESCE(p.remark, ''), p.created_at, p.updated_at 
 			FROM payments p 
 			LEFT JOIN customers c ON p.customer_id = c.id 
 			WHERE p.id = ?
@@ -3191,10 +4099,24 @@ func batchCreatePayments(c *gin.Context) {
 			// 未设置值时，设置为空数组
 			payment.SaleOrderIDs = []int{}
 		}
+		payment.AmountUppercase = rmbUppercase(payment.Amount)
 
 		payments = append(payments, payment)
 	}
 
+	// 按客户重新分配收款，更新订单付款状态
+	refreshed := make(map[int]bool)
+	for _, payment := range payments {
+		if refreshed[payment.CustomerID] {
+			continue
+		}
+		refreshed[payment.CustomerID] = true
+		if err := allocateCustomerPayments(tx, payment.CustomerID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to allocate payment: " + err.Error()})
+			return
+		}
+	}
+
 	// 提交事务
 	if err := tx.Commit(); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction: " + err.Error()})
@@ -3219,13 +4141,49 @@ func updatePayment(c *gin.Context) {
 		return
 	}
 
+	// 开始事务，收款记录与分配结果一起提交
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction: " + err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
 	// 检查收款记录是否存在
-	var exists bool
-	database.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM payments WHERE id = ?)", id).Scan(&exists)
-	if !exists {
+	var oldCustomerID int
+	var oldSaleOrderIDs []byte
+	var oldAmount decimal.Decimal
+	err = tx.QueryRow("SELECT customer_id, sale_order_ids, amount FROM payments WHERE id = ?", id).Scan(&oldCustomerID, &oldSaleOrderIDs, &oldAmount)
+	if err == sql.ErrNoRows {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Payment not found"})
 		return
 	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch payment"})
+		return
+	}
+
+	// 已关闭的订单不能再分配收款，原先已关联的订单不受影响
+	if err := checkSaleOrdersOpen(tx, addedSaleOrderIDs(parseSaleOrderIDs(oldSaleOrderIDs), req.SaleOrderIDs)); err != nil {
+		c.JSON(saleOrderOpenErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	// 已分配到已关闭订单的金额不能因修改而改变
+	change := paymentChange{CustomerID: oldCustomerID, SaleOrderIDs: parseSaleOrderIDs(oldSaleOrderIDs), Amount: oldAmount}
+	if req.CustomerID > 0 {
+		change.CustomerID = req.CustomerID
+	}
+	if req.SaleOrderIDs != nil {
+		change.SaleOrderIDs = req.SaleOrderIDs
+	}
+	if req.Amount.IsPositive() {
+		change.Amount = req.Amount
+	}
+	if err := checkClosedAllocationsKept(tx, id, &change); err != nil {
+		c.JSON(saleOrderOpenErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
 
 	// 构建更新语句
 	query := "UPDATE payments SET updated_at = CURRENT_TIMESTAMP"
@@ -3238,7 +4196,7 @@ func updatePayment(c *gin.Context) {
 	if req.CustomerID > 0 {
 		// 检查客户是否存在
 		var customerExists bool
-		database.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM customers WHERE id = ?)", req.CustomerID).Scan(&customerExists)
+		tx.QueryRow("SELECT EXISTS(SELECT 1 FROM customers WHERE id = ?)", req.CustomerID).Scan(&customerExists)
 		if !customerExists {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Customer not found"})
 			return
@@ -3256,7 +4214,7 @@ func updatePayment(c *gin.Context) {
 		query += ", sale_order_ids = ?"
 		args = append(args, saleOrderIdsJSON)
 	}
-	if req.Amount > 0 {
+	if req.Amount.IsPositive() {
 		query += ", amount = ?"
 		args = append(args, req.Amount)
 	}
@@ -3280,18 +4238,52 @@ func updatePayment(c *gin.Context) {
 	query += " WHERE id = ?"
 	args = append(args, id)
 
+	before, err := snapshotEntity(tx, auditPayment, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch payment"})
+		return
+	}
+
 	// 执行更新
-	_, err = database.DB.Exec(query, args...)
+	_, err = tx.Exec(query, args...)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update payment"})
 		return
 	}
 
+	// 重新分配收款，更换客户时新旧客户都要更新
+	allocateCustomerIDs := []int{oldCustomerID}
+	if req.CustomerID > 0 && req.CustomerID != oldCustomerID {
+		allocateCustomerIDs = append(allocateCustomerIDs, req.CustomerID)
+	}
+	for _, customerID := range allocateCustomerIDs {
+		if err := allocateCustomerPayments(tx, customerID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to allocate payment: " + err.Error()})
+			return
+		}
+	}
+
+	// 金额、日期或客户变化时冲销原分录并按新内容重新记帐
+	if err := postStatementEntries(tx, statementSourcePayment, id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to post statement entries: " + err.Error()})
+		return
+	}
+	if err := recordAudit(tx, c, auditPayment, id, auditActionUpdate, before); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write audit log: " + err.Error()})
+		return
+	}
+
+	// 提交事务
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction: " + err.Error()})
+		return
+	}
+
 	// 获取更新后的收款记录
 	var payment Payment
 	var fetchedSaleOrderIdsJSON []byte
 	err = database.DB.QueryRow(`
-		SELECT p.id, p.code, p.payment_date, p.customer_id, c.name as customer_name, p.sale_order_ids, CAST(p.amount AS FLOAT) as amount, p.payment_method, p.account, COALESCE(p.payer_company, ''), COALESCE(p.remark, ''), p.created_at, p.updated_at 
+		SELECT p.id, p.code, p.payment_date, p.customer_id, c.name as customer_name, p.sale_order_ids, p.amount, p.payment_method, p.account, COALESCE(p.payer_company, ''), COALESCE(p.remark, ''), p.created_at, p.updated_at 
 		FROM payments p 
 		LEFT JOIN customers c ON p.customer_id = c.id 
 		WHERE p.id = ?
@@ -3321,13 +4313,7 @@ func updatePayment(c *gin.Context) {
 		// 未设置值时，设置为空数组
 		payment.SaleOrderIDs = []int{}
 	}
-
-	// 异步同步该客户的对帐单
-	go func(customerID int) {
-		if err := syncCustomerStatements(customerID); err != nil {
-			log.Printf("同步客户对帐单失败：%v\n", err)
-		}
-	}(payment.CustomerID)
+	payment.AmountUppercase = rmbUppercase(payment.Amount)
 
 	c.JSON(http.StatusOK, payment)
 }
@@ -3341,35 +4327,62 @@ func deletePayment(c *gin.Context) {
 		return
 	}
 
-	// 获取客户ID以便后续同步对帐单
+	// 开始事务，删除收款记录与重新分配一起提交
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction: " + err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	// 获取客户ID以便后续重新分配收款
 	var customerID int
-	err = database.DB.QueryRow("SELECT customer_id FROM payments WHERE id = ?", id).Scan(&customerID)
+	err = tx.QueryRow("SELECT customer_id FROM payments WHERE id = ?", id).Scan(&customerID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Payment not found"})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get customer ID"})
 		return
 	}
 
-	// 检查收款记录是否存在
-	var exists bool
-	database.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM payments WHERE id = ?)", id).Scan(&exists)
-	if !exists {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Payment not found"})
+	// 已分配到已关闭订单的收款不能删除
+	if err := checkClosedAllocationsKept(tx, id, nil); err != nil {
+		c.JSON(saleOrderOpenErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
-	// 执行删除
-	_, err = database.DB.Exec("DELETE FROM payments WHERE id = ?", id)
+	before, err := snapshotEntity(tx, auditPayment, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch payment"})
+		return
+	}
+
+	// 执行删除，分配明细随收款记录级联删除
+	_, err = tx.Exec("DELETE FROM payments WHERE id = ?", id)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete payment"})
 		return
 	}
+	if err := allocateCustomerPayments(tx, customerID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to allocate payment: " + err.Error()})
+		return
+	}
+	if err := postStatementEntries(tx, statementSourcePayment, id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to post statement entries: " + err.Error()})
+		return
+	}
+	if err := recordAudit(tx, c, auditPayment, id, auditActionDelete, before); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write audit log: " + err.Error()})
+		return
+	}
 
-	// 异步同步该客户的对帐单
-	go func(customerID int) {
-		if err := syncCustomerStatements(customerID); err != nil {
-			log.Printf("同步客户对帐单失败：%v\n", err)
-		}
-	}(customerID)
+	// 提交事务
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction: " + err.Error()})
+		return
+	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Payment deleted successfully"})
 }
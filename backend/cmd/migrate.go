@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+
+	"nb2/internal/config"
+	"nb2/pkg/database"
+)
+
+// migrateUsage 迁移命令用法
+const migrateUsage = `用法: nb2 migrate <command> [args]
+
+  up [N]        执行全部（或N个）待执行的迁移
+  down [N]      回滚最近的N个迁移（默认1个）
+  status        查看迁移执行状态
+  force VERSION 人工修复中断的迁移后，将数据库标记为指定版本`
+
+// runMigrateCommand 执行数据库迁移命令
+func runMigrateCommand(cfg *config.DatabaseConfig, args []string) {
+	if len(args) == 0 {
+		log.Fatal(migrateUsage)
+	}
+
+	if err := database.Connect(cfg); err != nil {
+		log.Fatalf("Failed to connect database: %v", err)
+	}
+	defer database.CloseDB()
+
+	// 解析可选的数量参数
+	count := func(defaultValue int) int {
+		if len(args) < 2 {
+			return defaultValue
+		}
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n <= 0 {
+			log.Fatalf("Invalid migration count: %s", args[1])
+		}
+		return n
+	}
+
+	var err error
+	switch args[0] {
+	case "up":
+		err = database.MigrateUp(database.DB, count(0))
+	case "down":
+		err = database.MigrateDown(database.DB, count(1))
+	case "status":
+		err = printMigrationStatus()
+	case "force":
+		if len(args) < 2 {
+			log.Fatal(migrateUsage)
+		}
+		version, convErr := strconv.Atoi(args[1])
+		if convErr != nil || version < 0 {
+			log.Fatalf("Invalid migration version: %s", args[1])
+		}
+		err = database.ForceVersion(database.DB, version)
+	default:
+		log.Fatal(migrateUsage)
+	}
+
+	if err != nil {
+		log.Fatalf("Migration failed: %v", err)
+	}
+}
+
+// printMigrationStatus 打印迁移执行状态
+func printMigrationStatus() error {
+	states, err := database.MigrationStatus(database.DB)
+	if err != nil {
+		return err
+	}
+
+	for _, s := range states {
+		status := "pending"
+		if s.Dirty {
+			status = "dirty"
+		} else if s.Applied {
+			status = "applied " + s.AppliedAt
+		}
+		fmt.Printf("%04d  %-40s %s\n", s.Version, s.Name, status)
+	}
+	fmt.Printf("latest version: %d\n", database.LatestVersion())
+	return nil
+}
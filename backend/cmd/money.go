@@ -0,0 +1,134 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"github.com/shopspring/decimal"
+)
+
+// 金额和数量统一使用定点小数 decimal.Decimal，与数据库 DECIMAL(…, 2) 列精确对应，避免浮点误差累积
+
+// moneyScale 金额和数量保留的小数位数，与数据库列定义一致
+const moneyScale = 2
+
+func init() {
+	// JSON 中以数字输出，保持与前端现有格式一致
+	decimal.MarshalJSONWithoutQuotes = true
+
+	// 让 binding 标签（required、gt=0、gte=0 等）可以校验 decimal 字段
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		v.RegisterCustomTypeFunc(func(field reflect.Value) interface{} {
+			if d, ok := field.Interface().(decimal.Decimal); ok {
+				f, _ := d.Float64()
+				return f
+			}
+			return nil
+		}, decimal.Decimal{})
+	}
+}
+
+// roundAmount 金额保留两位小数
+func roundAmount(v decimal.Decimal) decimal.Decimal {
+	return v.Round(moneyScale)
+}
+
+// roundQuantity 数量保留两位小数
+func roundQuantity(v decimal.Decimal) decimal.Decimal {
+	return v.Round(moneyScale)
+}
+
+// 人民币大写数字和单位
+var (
+	rmbDigits       = []string{"零", "壹", "贰", "叁", "肆", "伍", "陆", "柒", "捌", "玖"}
+	rmbDigitUnits   = []string{"", "拾", "佰", "仟"}
+	rmbSectionUnits = []string{"", "万", "亿", "万亿"}
+)
+
+// rmbUppercase 把金额转换为人民币大写，如 1234.56 → 壹仟贰佰叁拾肆元伍角陆分
+// 金额先四舍五入到分；没有分时以"整"结尾；数字中间连续的零只写一个"零"，每节末尾的零不写
+func rmbUppercase(amount decimal.Decimal) string {
+	amount = roundAmount(amount)
+	if amount.IsZero() {
+		return "零元整"
+	}
+
+	var sb strings.Builder
+	if amount.IsNegative() {
+		sb.WriteString("负")
+		amount = amount.Neg()
+	}
+
+	integer := amount.Truncate(0)
+	cents := amount.Sub(integer).Shift(moneyScale).IntPart()
+	jiao, fen := cents/10, cents%10
+
+	hasInteger := integer.IsPositive()
+	if hasInteger {
+		sb.WriteString(rmbIntegerUppercase(integer.String()))
+		sb.WriteString("元")
+	}
+	if jiao > 0 {
+		sb.WriteString(rmbDigits[jiao])
+		sb.WriteString("角")
+	} else if hasInteger && fen > 0 {
+		sb.WriteString("零")
+	}
+	if fen > 0 {
+		sb.WriteString(rmbDigits[fen])
+		sb.WriteString("分")
+	} else {
+		sb.WriteString("整")
+	}
+	return sb.String()
+}
+
+// rmbIntegerUppercase 转换金额的整数部分，按四位一节从高到低处理
+func rmbIntegerUppercase(digits string) string {
+	// 高位补零到4的整数倍，便于按节切分
+	if pad := len(digits) % 4; pad != 0 {
+		digits = strings.Repeat("0", 4-pad) + digits
+	}
+	sections := len(digits) / 4
+	if sections > len(rmbSectionUnits) {
+		// 超出万亿的部分不再分节，直接返回阿拉伯数字
+		return strings.TrimLeft(digits, "0")
+	}
+
+	var sb strings.Builder
+	pendingZero := false
+	for i := 0; i < sections; i++ {
+		section := digits[i*4 : i*4+4]
+		if section == "0000" {
+			// 整节为零：后面还有非零数字时补一个"零"
+			pendingZero = sb.Len() > 0
+			continue
+		}
+		// 前面已有数字且本节以零开头（或中间隔了整节的零）时补"零"
+		if sb.Len() > 0 && (pendingZero || section[0] == '0') {
+			sb.WriteString("零")
+		}
+		pendingZero = false
+
+		zero := false
+		started := false
+		for j := 0; j < 4; j++ {
+			d := section[j] - '0'
+			if d == 0 {
+				zero = started
+				continue
+			}
+			if zero {
+				sb.WriteString("零")
+				zero = false
+			}
+			sb.WriteString(rmbDigits[d])
+			sb.WriteString(rmbDigitUnits[3-j])
+			started = true
+		}
+		sb.WriteString(rmbSectionUnits[sections-1-i])
+	}
+	return sb.String()
+}
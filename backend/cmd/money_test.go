@@ -0,0 +1,55 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestRmbUppercase(t *testing.T) {
+	tests := []struct {
+		amount string
+		want   string
+	}{
+		{"0", "零元整"},
+		{"0.00", "零元整"},
+		{"-0", "零元整"},
+		{"0.001", "零元整"},
+		{"1234.56", "壹仟贰佰叁拾肆元伍角陆分"},
+		{"100", "壹佰元整"},
+		{"10.00", "壹拾元整"},
+		{"1.50", "壹元伍角整"},
+		{"1.05", "壹元零伍分"},
+		{"0.10", "壹角整"},
+		{"0.05", "伍分"},
+		{"0.55", "伍角伍分"},
+		{"1", "壹元整"},
+		{"1001", "壹仟零壹元整"},
+		{"1001.01", "壹仟零壹元零壹分"},
+		{"1001.10", "壹仟零壹元壹角整"},
+		{"1010", "壹仟零壹拾元整"},
+		{"10000", "壹万元整"},
+		{"10001", "壹万零壹元整"},
+		{"100010", "壹拾万零壹拾元整"},
+		{"100000.10", "壹拾万元壹角整"},
+		{"100000.01", "壹拾万元零壹分"},
+		{"1000000", "壹佰万元整"},
+		{"10100000", "壹仟零壹拾万元整"},
+		{"100000000", "壹亿元整"},
+		{"100000001", "壹亿零壹元整"},
+		{"100010000", "壹亿零壹万元整"},
+		{"120000000.3", "壹亿贰仟万元叁角整"},
+		{"12.345", "壹拾贰元叁角伍分"},
+		{"1.005", "壹元零壹分"},
+		{"-1234.5", "负壹仟贰佰叁拾肆元伍角整"},
+		{"-0.01", "负壹分"},
+		{"-100", "负壹佰元整"},
+		{"-1001.01", "负壹仟零壹元零壹分"},
+	}
+	for _, tt := range tests {
+		got := rmbUppercase(decimal.RequireFromString(tt.amount))
+		if got != tt.want {
+			t.Errorf("rmbUppercase(%s) = %s, want %s", tt.amount, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,346 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+
+	"nb2/pkg/database"
+)
+
+// ========== 收款分配相关模型 ==========
+
+// PaymentAllocation 收款分配明细，记录一笔收款冲抵了哪些订单及金额
+type PaymentAllocation struct {
+	ID            int             `json:"id"`
+	PaymentID     int             `json:"paymentId"`
+	PaymentCode   string          `json:"paymentCode"`
+	PaymentDate   string          `json:"paymentDate"`
+	SaleOrderID   int             `json:"saleOrderId"`
+	SaleOrderCode string          `json:"saleOrderCode"`
+	Amount        decimal.Decimal `json:"amount"`
+}
+
+// allocationOrder 参与收款分配的销售订单
+type allocationOrder struct {
+	ID            int
+	CreateTime    string
+	PayableAmount decimal.Decimal
+}
+
+// allocationPayment 参与分配的收款记录
+type allocationPayment struct {
+	ID           int
+	PaymentDate  string
+	Amount       decimal.Decimal
+	SaleOrderIDs []int
+}
+
+// paymentAllocation 分配引擎计算出的一笔收款分配到某个订单的金额
+type paymentAllocation struct {
+	PaymentID   int
+	SaleOrderID int
+	Amount      decimal.Decimal
+}
+
+// allocatePaymentsFIFO 按收款日期先后把每笔收款分配到其关联的订单上，
+// 关联订单按下单时间从早到晚依次冲抵未付金额，每个订单最多冲抵到应付金额为止，
+// 冲抵完仍有余额时不再分配，作为收款的未分配金额（多付）
+func allocatePaymentsFIFO(orders []allocationOrder, payments []allocationPayment) []paymentAllocation {
+	orderByID := make(map[int]allocationOrder, len(orders))
+	for _, o := range orders {
+		orderByID[o.ID] = o
+	}
+
+	sorted := make([]allocationPayment, len(payments))
+	copy(sorted, payments)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].PaymentDate != sorted[j].PaymentDate {
+			return sorted[i].PaymentDate < sorted[j].PaymentDate
+		}
+		return sorted[i].ID < sorted[j].ID
+	})
+
+	allocated := make(map[int]decimal.Decimal, len(orders))
+	var result []paymentAllocation
+	for _, p := range sorted {
+		// 只分配到仍存在的关联订单，重复的订单ID只算一次
+		var related []allocationOrder
+		seen := make(map[int]bool, len(p.SaleOrderIDs))
+		for _, id := range p.SaleOrderIDs {
+			if o, ok := orderByID[id]; ok && !seen[id] {
+				seen[id] = true
+				related = append(related, o)
+			}
+		}
+		if len(related) == 0 {
+			continue
+		}
+		sort.SliceStable(related, func(i, j int) bool {
+			if related[i].CreateTime != related[j].CreateTime {
+				return related[i].CreateTime < related[j].CreateTime
+			}
+			return related[i].ID < related[j].ID
+		})
+
+		remaining := roundAmount(p.Amount)
+		amounts := make(map[int]decimal.Decimal, len(related))
+		for _, o := range related {
+			if !remaining.IsPositive() {
+				break
+			}
+			due := roundAmount(o.PayableAmount).Sub(allocated[o.ID])
+			if !due.IsPositive() {
+				continue
+			}
+			take := decimal.Min(remaining, due)
+			amounts[o.ID] = amounts[o.ID].Add(take)
+			allocated[o.ID] = allocated[o.ID].Add(take)
+			remaining = remaining.Sub(take)
+		}
+
+		for _, o := range related {
+			if amount := amounts[o.ID]; amount.IsPositive() {
+				result = append(result, paymentAllocation{PaymentID: p.ID, SaleOrderID: o.ID, Amount: amount})
+			}
+		}
+	}
+	return result
+}
+
+// deriveSaleOrderPaymentStatus 根据已收款和应付金额计算付款状态，已关闭的订单保持已关闭
+func deriveSaleOrderPaymentStatus(paidAmount, payableAmount decimal.Decimal, closed bool) string {
+	switch {
+	case closed:
+		return paymentStatusClosed
+	case roundAmount(paidAmount).GreaterThanOrEqual(roundAmount(payableAmount)):
+		return paymentStatusCompleted
+	case !roundAmount(paidAmount).IsPositive():
+		return paymentStatusPending
+	default:
+		return paymentStatusPartial
+	}
+}
+
+// parseSaleOrderIDs 解析收款记录中的sale_order_ids，格式错误时视为未关联订单
+func parseSaleOrderIDs(data []byte) []int {
+	var ids []int
+	if len(data) == 0 || string(data) == "null" {
+		return ids
+	}
+	if err := json.Unmarshal(data, &ids); err != nil {
+		return nil
+	}
+	return ids
+}
+
+// addedSaleOrderIDs 返回修改收款时新增关联的订单ID
+func addedSaleOrderIDs(oldIDs, newIDs []int) []int {
+	existing := make(map[int]bool, len(oldIDs))
+	for _, id := range oldIDs {
+		existing[id] = true
+	}
+	var added []int
+	for _, id := range newIDs {
+		if !existing[id] {
+			added = append(added, id)
+		}
+	}
+	return added
+}
+
+// allocateCustomerPayments 重新分配客户的全部收款：重写payment_allocations，并更新每个订单的已收款和付款状态
+// 已关闭订单上的分配保持不变，收款扣除这部分金额后再分配到未关闭的订单
+// 必须在写入收款/订单的同一事务中调用，保证分配明细与业务数据一致
+func allocateCustomerPayments(q dbExecutor, customerID int) error {
+	rows, err := q.Query("SELECT id, create_time, payable_amount, paid_amount, payment_status FROM sale_orders WHERE customer_id = ? AND closed_at IS NULL", customerID)
+	if err != nil {
+		return fmt.Errorf("failed to fetch sale orders of customer %d: %w", customerID, err)
+	}
+	type orderState struct {
+		paid   decimal.Decimal
+		status string
+	}
+	var orders []allocationOrder
+	states := make(map[int]orderState)
+	for rows.Next() {
+		var o allocationOrder
+		var st orderState
+		if err := rows.Scan(&o.ID, &o.CreateTime, &o.PayableAmount, &st.paid, &st.status); err != nil {
+			rows.Close()
+			return err
+		}
+		orders = append(orders, o)
+		states[o.ID] = st
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	// 各收款已分配到已关闭订单的金额
+	rows, err = q.Query(
+		"SELECT a.payment_id, a.amount FROM payment_allocations a JOIN payments p ON a.payment_id = p.id JOIN sale_orders s ON a.sale_order_id = s.id WHERE p.customer_id = ? AND s.closed_at IS NOT NULL",
+		customerID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to fetch closed order allocations of customer %d: %w", customerID, err)
+	}
+	frozen := make(map[int]decimal.Decimal)
+	for rows.Next() {
+		var paymentID int
+		var amount decimal.Decimal
+		if err := rows.Scan(&paymentID, &amount); err != nil {
+			rows.Close()
+			return err
+		}
+		frozen[paymentID] = frozen[paymentID].Add(amount)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	rows, err = q.Query("SELECT id, payment_date, amount, sale_order_ids FROM payments WHERE customer_id = ?", customerID)
+	if err != nil {
+		return fmt.Errorf("failed to fetch payments of customer %d: %w", customerID, err)
+	}
+	var payments []allocationPayment
+	for rows.Next() {
+		var p allocationPayment
+		var saleOrderIDs []byte
+		if err := rows.Scan(&p.ID, &p.PaymentDate, &p.Amount, &saleOrderIDs); err != nil {
+			rows.Close()
+			return err
+		}
+		p.SaleOrderIDs = parseSaleOrderIDs(saleOrderIDs)
+		p.Amount = p.Amount.Sub(frozen[p.ID])
+		payments = append(payments, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	// 清除该客户收款和订单上的旧分配（包括收款或订单更换客户前留下的分配），已关闭订单上的分配保留
+	if _, err := q.Exec(
+		"DELETE FROM payment_allocations WHERE (payment_id IN (SELECT id FROM payments WHERE customer_id = ?) OR sale_order_id IN (SELECT id FROM sale_orders WHERE customer_id = ?)) AND sale_order_id NOT IN (SELECT id FROM sale_orders WHERE closed_at IS NOT NULL)",
+		customerID, customerID,
+	); err != nil {
+		return fmt.Errorf("failed to clear payment allocations of customer %d: %w", customerID, err)
+	}
+
+	paid := make(map[int]decimal.Decimal, len(orders))
+	for _, a := range allocatePaymentsFIFO(orders, payments) {
+		if _, err := q.Exec("INSERT INTO payment_allocations (payment_id, sale_order_id, amount) VALUES (?, ?, ?)", a.PaymentID, a.SaleOrderID, a.Amount); err != nil {
+			return fmt.Errorf("failed to insert allocation of payment %d: %w", a.PaymentID, err)
+		}
+		paid[a.SaleOrderID] = paid[a.SaleOrderID].Add(a.Amount)
+	}
+
+	for _, o := range orders {
+		st := states[o.ID]
+		newPaid := roundAmount(paid[o.ID])
+		newStatus := deriveSaleOrderPaymentStatus(newPaid, o.PayableAmount, false)
+		if newPaid.Equal(roundAmount(st.paid)) && newStatus == st.status {
+			continue
+		}
+		if _, err := q.Exec("UPDATE sale_orders SET paid_amount = ?, payment_status = ? WHERE id = ?", newPaid, newStatus, o.ID); err != nil {
+			return fmt.Errorf("failed to update payment status of sale order %d: %w", o.ID, err)
+		}
+	}
+	return nil
+}
+
+// reallocateCustomerPayments 在独立事务中重新分配客户的全部收款，用于对帐单同步时回填历史数据
+func reallocateCustomerPayments(customerID int) error {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := allocateCustomerPayments(tx, customerID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// paymentAllocationSelect 查询分配明细的语句
+const paymentAllocationSelect = `
+	SELECT a.id, a.payment_id, p.code, p.payment_date, a.sale_order_id, s.code, a.amount
+	FROM payment_allocations a
+	JOIN payments p ON a.payment_id = p.id
+	JOIN sale_orders s ON a.sale_order_id = s.id`
+
+// queryPaymentAllocations 查询分配明细
+func queryPaymentAllocations(where string, args ...interface{}) ([]PaymentAllocation, error) {
+	rows, err := database.DB.Query(paymentAllocationSelect+" WHERE "+where+" ORDER BY p.payment_date, p.id, s.create_time, s.id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	allocations := []PaymentAllocation{}
+	for rows.Next() {
+		var a PaymentAllocation
+		if err := rows.Scan(&a.ID, &a.PaymentID, &a.PaymentCode, &a.PaymentDate, &a.SaleOrderID, &a.SaleOrderCode, &a.Amount); err != nil {
+			return nil, err
+		}
+		allocations = append(allocations, a)
+	}
+	return allocations, rows.Err()
+}
+
+// getPaymentAllocations 查看一笔收款分配到了哪些订单
+func getPaymentAllocations(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid payment ID"})
+		return
+	}
+
+	var amount decimal.Decimal
+	if err := database.DB.QueryRow("SELECT amount FROM payments WHERE id = ?", id).Scan(&amount); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Payment not found"})
+		return
+	}
+
+	allocations, err := queryPaymentAllocations("a.payment_id = ?", id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch payment allocations: " + err.Error()})
+		return
+	}
+
+	var allocated decimal.Decimal
+	for _, a := range allocations {
+		allocated = allocated.Add(a.Amount)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"amount":      amount,
+		"allocated":   roundAmount(allocated),
+		"unallocated": roundAmount(amount.Sub(allocated)),
+		"allocations": allocations,
+	})
+}
+
+// getSaleOrderAllocations 查看一个订单由哪些收款冲抵
+func getSaleOrderAllocations(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid sale order ID"})
+		return
+	}
+
+	allocations, err := queryPaymentAllocations("a.sale_order_id = ?", id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch payment allocations: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, allocations)
+}
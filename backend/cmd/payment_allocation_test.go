@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+
+	"nb2/pkg/database"
+)
+
+func TestAllocatePaymentsFIFO(t *testing.T) {
+	d := decimal.RequireFromString
+	orders := []allocationOrder{
+		{ID: 1, CreateTime: "2026-03-03 00:00:00", PayableAmount: d("100.00")},
+		{ID: 2, CreateTime: "2026-03-01 00:00:00", PayableAmount: d("50.00")},
+		{ID: 3, CreateTime: "2026-03-02 00:00:00", PayableAmount: d("30.00")},
+	}
+
+	tests := []struct {
+		name     string
+		payments []allocationPayment
+		want     []paymentAllocation
+	}{
+		{
+			name:     "关联订单按下单时间从早到晚冲抵",
+			payments: []allocationPayment{{ID: 1, PaymentDate: "2026-03-10", Amount: d("120.00"), SaleOrderIDs: []int{1, 2, 3}}},
+			want:     []paymentAllocation{{1, 2, d("50.00")}, {1, 3, d("30.00")}, {1, 1, d("40.00")}},
+		},
+		{
+			name: "收款按收款日期先后分配，后收的款接着冲抵未付部分",
+			payments: []allocationPayment{
+				{ID: 2, PaymentDate: "2026-03-12", Amount: d("60.00"), SaleOrderIDs: []int{1, 2}},
+				{ID: 1, PaymentDate: "2026-03-10", Amount: d("20.00"), SaleOrderIDs: []int{1, 2}},
+			},
+			want: []paymentAllocation{{1, 2, d("20.00")}, {2, 2, d("30.00")}, {2, 1, d("30.00")}},
+		},
+		{
+			name:     "部分付款",
+			payments: []allocationPayment{{ID: 1, PaymentDate: "2026-03-10", Amount: d("0.30"), SaleOrderIDs: []int{3}}},
+			want:     []paymentAllocation{{1, 3, d("0.30")}},
+		},
+		{
+			name:     "多付的金额不分配，订单最多冲抵到应付金额",
+			payments: []allocationPayment{{ID: 1, PaymentDate: "2026-03-10", Amount: d("200.00"), SaleOrderIDs: []int{2, 3}}},
+			want:     []paymentAllocation{{1, 2, d("50.00")}, {1, 3, d("30.00")}},
+		},
+		{
+			name: "已付清的订单不再分配后来的收款",
+			payments: []allocationPayment{
+				{ID: 1, PaymentDate: "2026-03-10", Amount: d("50.00"), SaleOrderIDs: []int{2}},
+				{ID: 2, PaymentDate: "2026-03-11", Amount: d("10.00"), SaleOrderIDs: []int{2}},
+			},
+			want: []paymentAllocation{{1, 2, d("50.00")}},
+		},
+		{
+			name: "已关闭或已删除的订单不在分配范围内，重复的订单ID只算一次",
+			payments: []allocationPayment{
+				{ID: 1, PaymentDate: "2026-03-10", Amount: d("80.00"), SaleOrderIDs: []int{9, 3, 3}},
+				{ID: 2, PaymentDate: "2026-03-11", Amount: d("10.00"), SaleOrderIDs: []int{9}},
+			},
+			want: []paymentAllocation{{1, 3, d("30.00")}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := allocatePaymentsFIFO(orders, tt.payments)
+			if len(got) != len(tt.want) {
+				t.Fatalf("allocations = %v, want %v", got, tt.want)
+			}
+			for i := range tt.want {
+				if got[i].PaymentID != tt.want[i].PaymentID || got[i].SaleOrderID != tt.want[i].SaleOrderID || !got[i].Amount.Equal(tt.want[i].Amount) {
+					t.Fatalf("allocations = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+// TestPaymentAllocationLifecycle 新增、修改、删除收款和关闭订单后重新分配的结果
+func TestPaymentAllocationLifecycle(t *testing.T) {
+	openTestDB(t)
+	customerID := mustExec(t, "INSERT INTO customers (code, name, phone) VALUES (?, ?, ?)", "C00001", "张三", "13800000000")
+	newOrder := func(code, createTime, payable string) int {
+		return mustExec(t, "INSERT INTO sale_orders (code, create_time, customer_id, customer_name, customer_phone, customer_city, total_amount, payable_amount) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+			code, createTime, customerID, "张三", "13800000000", "杭州市", payable, payable)
+	}
+	so1 := newOrder("SO000001", "2026-03-01 09:00:00", "100.00")
+	so2 := newOrder("SO000002", "2026-03-02 09:00:00", "50.00")
+	so3 := newOrder("SO000003", "2026-03-03 09:00:00", "30.00")
+
+	idParam := func(id int) gin.Param { return gin.Param{Key: "id", Value: strconv.Itoa(id)} }
+	createPaymentFor := func(date, amount string, orderIDs ...int) int {
+		t.Helper()
+		w := callHandler(t, createPayment, http.MethodPost, CreatePaymentRequest{
+			PaymentDate: date, CustomerID: customerID, SaleOrderIDs: orderIDs, Amount: decimal.RequireFromString(amount),
+		})
+		if w.Code != http.StatusOK && w.Code != http.StatusCreated {
+			t.Fatalf("createPayment: %d %s", w.Code, w.Body.String())
+		}
+		var id int
+		if err := database.DB.QueryRow("SELECT MAX(id) FROM payments").Scan(&id); err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+	// assertOrders 依次校验 so1、so2、so3 的已收款和付款状态
+	assertOrders := func(step string, want ...string) {
+		t.Helper()
+		for i, id := range []int{so1, so2, so3} {
+			var paid decimal.Decimal
+			var status string
+			if err := database.DB.QueryRow("SELECT paid_amount, payment_status FROM sale_orders WHERE id = ?", id).Scan(&paid, &status); err != nil {
+				t.Fatal(err)
+			}
+			if got := fmt.Sprintf("%s %s", paid.StringFixed(moneyScale), status); got != want[i] {
+				t.Errorf("%s: sale order %d = %q, want %q", step, id, got, want[i])
+			}
+		}
+	}
+
+	p1 := createPaymentFor("2026-03-05", "120.00", so1, so2)
+	assertOrders("create overpaying payment",
+		"100.00 "+paymentStatusCompleted, "20.00 "+paymentStatusPartial, "0.00 "+paymentStatusPending)
+
+	p2 := createPaymentFor("2026-03-04", "60.00", so2, so3)
+	assertOrders("create earlier payment",
+		"100.00 "+paymentStatusCompleted, "50.00 "+paymentStatusCompleted, "10.00 "+paymentStatusPartial)
+	var unallocated decimal.Decimal
+	if err := database.DB.QueryRow("SELECT p.amount - COALESCE((SELECT SUM(amount) FROM payment_allocations WHERE payment_id = p.id), 0) FROM payments p WHERE p.id = ?", p1).Scan(&unallocated); err != nil {
+		t.Fatal(err)
+	}
+	if !roundAmount(unallocated).Equal(decimal.RequireFromString("20.00")) {
+		t.Errorf("unallocated amount of payment %d = %s, want 20.00", p1, unallocated)
+	}
+
+	// 修改收款金额和关联订单
+	w := callHandler(t, updatePayment, http.MethodPut, UpdatePaymentRequest{Amount: decimal.RequireFromString("30.00"), SaleOrderIDs: []int{so3}}, idParam(p2))
+	if w.Code != http.StatusOK {
+		t.Fatalf("updatePayment: %d %s", w.Code, w.Body.String())
+	}
+	assertOrders("update payment",
+		"100.00 "+paymentStatusCompleted, "20.00 "+paymentStatusPartial, "30.00 "+paymentStatusCompleted)
+
+	// 关闭订单后其上的分配保持不变，删除收款不影响已关闭订单
+	w = callHandler(t, closeSaleOrder, http.MethodPost, SaleOrderStatusRequest{Reason: "客户退货"}, idParam(so1))
+	if w.Code != http.StatusOK {
+		t.Fatalf("closeSaleOrder: %d %s", w.Code, w.Body.String())
+	}
+	w = callHandler(t, deletePayment, http.MethodDelete, nil, idParam(p2))
+	if w.Code != http.StatusOK {
+		t.Fatalf("deletePayment: %d %s", w.Code, w.Body.String())
+	}
+	assertOrders("delete payment",
+		"100.00 "+paymentStatusClosed, "20.00 "+paymentStatusPartial, "0.00 "+paymentStatusPending)
+
+	// 分配到已关闭订单的收款不能删除
+	w = callHandler(t, deletePayment, http.MethodDelete, nil, idParam(p1))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("deletePayment allocated to closed order: %d %s, want 400", w.Code, w.Body.String())
+	}
+	assertOrders("delete payment allocated to closed order",
+		"100.00 "+paymentStatusClosed, "20.00 "+paymentStatusPartial, "0.00 "+paymentStatusPending)
+}
@@ -0,0 +1,536 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jung-kurt/gofpdf"
+	"github.com/shopspring/decimal"
+
+	"nb2/internal/config"
+	"nb2/pkg/database"
+)
+
+// 服务端生成销售单和客户对帐单PDF，可直接下载，也可供定时任务、邮件发送调用
+// 中文字体由 PDF_FONT_PATH 指定（TrueType），生成时按用到的字符子集嵌入PDF，打开PDF的电脑无需安装字体
+// 字体在启动时读取并校验，PDF_ENABLED=true 而字体不可用时拒绝启动；PDF_ENABLED=false 时PDF接口返回503
+
+const pdfFontFamily = "cjk"
+
+// errPDFDisabled 未启用PDF功能（PDF_ENABLED=false）
+var errPDFDisabled = errors.New("PDF generation is disabled (PDF_ENABLED=false)")
+
+// pdfFontData 启动时读取并校验过的字体文件，为空表示未启用PDF
+var pdfFontData []byte
+
+// initPDF 启用PDF时读取字体并试加载，字体缺失或不是TrueType字体时返回错误
+func initPDF(cfg *config.PDFConfig) error {
+	if !cfg.Enabled {
+		log.Println("PDF功能未启用（PDF_ENABLED=false），销售单、对帐单PDF接口不可用")
+		return nil
+	}
+	if cfg.FontPath == "" {
+		return fmt.Errorf("PDF_ENABLED=true 但未配置 PDF_FONT_PATH（中文TrueType字体，.ttf），请配置字体或设置 PDF_ENABLED=false")
+	}
+	data, err := os.ReadFile(cfg.FontPath)
+	if err != nil {
+		return fmt.Errorf("读取PDF字体失败（PDF_FONT_PATH=%s）：%w", cfg.FontPath, err)
+	}
+	if err := setPDFFont(data); err != nil {
+		return fmt.Errorf("%w（PDF_FONT_PATH=%s）", err, cfg.FontPath)
+	}
+	return nil
+}
+
+// setPDFFont 用字体试生成一页PDF，能正常嵌入后设为生成PDF使用的字体
+func setPDFFont(data []byte) error {
+	f := gofpdf.New("P", "mm", "A4", "")
+	f.AddUTF8FontFromBytes(pdfFontFamily, "", data)
+	f.AddPage()
+	f.SetFont(pdfFontFamily, "", 10)
+	f.CellFormat(0, pdfLineH, "销售单 0123456789", "", 0, "L", false, 0, "")
+	if err := f.Output(io.Discard); err != nil {
+		return fmt.Errorf("加载PDF字体失败（须为TrueType字体）：%w", err)
+	}
+	pdfFontData = data
+	return nil
+}
+
+// pdfDoc A4纵向文档，左右边距10mm，内容宽190mm
+type pdfDoc struct {
+	*gofpdf.Fpdf
+}
+
+const (
+	pdfMargin      = 10.0
+	pdfContentW    = 190.0
+	pdfLineH       = 5.0
+	pdfFooterSpace = 15.0
+)
+
+// newPDFDoc 创建嵌入中文字体的文档，页脚显示页码
+func newPDFDoc() (*pdfDoc, error) {
+	if pdfFontData == nil {
+		return nil, errPDFDisabled
+	}
+	f := gofpdf.New("P", "mm", "A4", "")
+	f.SetMargins(pdfMargin, pdfMargin, pdfMargin)
+	f.SetAutoPageBreak(false, 0)
+	f.AddUTF8FontFromBytes(pdfFontFamily, "", pdfFontData)
+	if err := f.Error(); err != nil {
+		return nil, err
+	}
+	f.AliasNbPages("{nb}")
+	f.SetFooterFunc(func() {
+		f.SetY(-12)
+		f.SetFont(pdfFontFamily, "", 8)
+		f.CellFormat(0, 5, fmt.Sprintf("第 %d 页 / 共 {nb} 页", f.PageNo()), "", 0, "C", false, 0, "")
+	})
+	return &pdfDoc{f}, nil
+}
+
+// bytes 输出PDF内容
+func (d *pdfDoc) bytes() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := d.Output(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// pdfText 去掉字体不支持的字符（基本多文种平面以外，如表情符号）
+func pdfText(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r > 0xFFFF {
+			return '?'
+		}
+		return r
+	}, s)
+}
+
+// wrap 按列宽折行；gofpdf 的 SplitText 在中文处断行时会丢字，这里逐字计算宽度
+func (d *pdfDoc) wrap(s string, w float64) []string {
+	w -= 2 * d.GetCellMargin()
+	var lines []string
+	for _, para := range strings.Split(pdfText(s), "\n") {
+		line := ""
+		for _, r := range para {
+			if line != "" && d.GetStringWidth(line+string(r)) > w {
+				lines = append(lines, line)
+				line = ""
+			}
+			line += string(r)
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// text 输出一行文字
+func (d *pdfDoc) text(w float64, s, align string, size float64) {
+	d.SetFont(pdfFontFamily, "", size)
+	d.CellFormat(w, pdfLineH+1, pdfText(s), "", 0, align, false, 0, "")
+}
+
+// pdfColumn 表格列
+type pdfColumn struct {
+	Title string
+	Width float64
+	Align string
+}
+
+// pdfTable 自动分页的表格，换页时重复表头
+type pdfTable struct {
+	doc     *pdfDoc
+	columns []pdfColumn
+	header  func() // 每页表格上方的内容（抬头）
+}
+
+// drawHeader 输出表头
+func (t *pdfTable) drawHeader() {
+	t.doc.SetFont(pdfFontFamily, "", 9)
+	t.doc.SetFillColor(240, 240, 240)
+	for _, col := range t.columns {
+		t.doc.CellFormat(col.Width, pdfLineH+2, col.Title, "1", 0, "C", true, 0, "")
+	}
+	t.doc.Ln(-1)
+}
+
+// newPage 新起一页并输出抬头和表头
+func (t *pdfTable) newPage() {
+	t.doc.AddPage()
+	if t.header != nil {
+		t.header()
+	}
+	t.drawHeader()
+}
+
+// row 输出一行，内容过长时在单元格内折行，本页放不下时换页
+func (t *pdfTable) row(values ...string) {
+	t.doc.SetFont(pdfFontFamily, "", 9)
+	cells := make([][]string, len(t.columns))
+	lines := 1
+	for i, col := range t.columns {
+		cells[i] = t.doc.wrap(values[i], col.Width)
+		if len(cells[i]) > lines {
+			lines = len(cells[i])
+		}
+	}
+	h := float64(lines)*pdfLineH + 1
+	_, pageH := t.doc.GetPageSize()
+	if t.doc.GetY()+h > pageH-pdfFooterSpace {
+		t.newPage()
+		t.doc.SetFont(pdfFontFamily, "", 9)
+	}
+
+	x, y := t.doc.GetX(), t.doc.GetY()
+	for i, col := range t.columns {
+		t.doc.Rect(x, y, col.Width, h, "D")
+		for j, line := range cells[i] {
+			t.doc.SetXY(x, y+0.5+float64(j)*pdfLineH)
+			t.doc.CellFormat(col.Width, pdfLineH, line, "", 0, col.Align, false, 0, "")
+		}
+		x += col.Width
+	}
+	t.doc.SetXY(pdfMargin, y+h)
+}
+
+// ensureSpace 表格之后的内容本页放不下时换页
+func (d *pdfDoc) ensureSpace(h float64) {
+	_, pageH := d.GetPageSize()
+	if d.GetY()+h > pageH-pdfFooterSpace {
+		d.AddPage()
+	}
+}
+
+// pdfAmount 金额显示为千分位两位小数，如 1,234.50
+func pdfAmount(v decimal.Decimal) string {
+	s := roundAmount(v).StringFixed(moneyScale)
+	sign := ""
+	if strings.HasPrefix(s, "-") {
+		sign, s = "-", s[1:]
+	}
+	intPart, frac := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		intPart, frac = s[:i], s[i:]
+	}
+	var b strings.Builder
+	for i, r := range intPart {
+		if i > 0 && (len(intPart)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(r)
+	}
+	return sign + b.String() + frac
+}
+
+// documentCompanyName 单据抬头的公司名称（系统设置 company_name）
+func documentCompanyName() string {
+	var name string
+	if err := database.DB.QueryRow("SELECT value FROM settings WHERE `key` = ?", "company_name").Scan(&name); err != nil && err != sql.ErrNoRows {
+		log.Printf("读取公司名称失败：%v\n", err)
+	}
+	return name
+}
+
+// writePDF 返回PDF，浏览器中直接预览
+func writePDF(c *gin.Context, filename string, data []byte) {
+	c.Header("Content-Disposition", "inline; filename*=UTF-8''"+url.PathEscape(filename))
+	c.Data(http.StatusOK, "application/pdf", data)
+}
+
+// ========== 销售单 ==========
+
+// saleOrderPDFCustomer 销售单上的客户资料及开票信息
+type saleOrderPDFCustomer struct {
+	Code    string
+	Address string
+	Invoice *Invoice
+}
+
+// loadSaleOrderPDFCustomer 读取客户编号、详细地址和启用的开票资料（有多条时取最新一条）
+func loadSaleOrderPDFCustomer(customerID int) (*saleOrderPDFCustomer, error) {
+	customer := &saleOrderPDFCustomer{}
+	var province, city, district, address string
+	err := database.DB.QueryRow("SELECT COALESCE(code, ''), COALESCE(province, ''), COALESCE(city, ''), COALESCE(district, ''), COALESCE(address, '') FROM customers WHERE id = ?", customerID).Scan(
+		&customer.Code, &province, &city, &district, &address,
+	)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	customer.Address = province + city + district + address
+
+	var inv Invoice
+	err = database.DB.QueryRow("SELECT id, customer_id, company, tax_number, COALESCE(bank, ''), COALESCE(bank_account, ''), COALESCE(branch_address, ''), status FROM invoices WHERE customer_id = ? AND status = 1 ORDER BY created_at DESC, id DESC LIMIT 1", customerID).Scan(
+		&inv.ID, &inv.CustomerID, &inv.Company, &inv.TaxNumber, &inv.Bank, &inv.BankAccount, &inv.BranchAddress, &inv.Status,
+	)
+	if err == nil {
+		customer.Invoice = &inv
+	} else if err != sql.ErrNoRows {
+		return nil, err
+	}
+	return customer, nil
+}
+
+// renderSaleOrderPDF 生成销售单PDF：抬头、客户及开票信息、商品明细、运费、应付金额及大写
+func renderSaleOrderPDF(id int) ([]byte, *SaleOrder, error) {
+	so, err := scanSaleOrder(database.DB.QueryRow(saleOrderSelect+" WHERE id = ?", id))
+	if err != nil {
+		return nil, nil, err
+	}
+	items, err := loadSaleOrderItems(database.DB, []int{so.ID})
+	if err != nil {
+		return nil, nil, err
+	}
+	so.Items = items[so.ID]
+	customer, err := loadSaleOrderPDFCustomer(so.CustomerID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	doc, err := newPDFDoc()
+	if err != nil {
+		return nil, nil, err
+	}
+	doc.SetTitle("销售单 "+so.Code, true)
+	company := documentCompanyName()
+	half := pdfContentW / 2
+
+	header := func() {
+		doc.text(pdfContentW, company+"销售单", "C", 16)
+		doc.Ln(9)
+		doc.text(half, "单号："+so.Code, "L", 10)
+		doc.text(half, "销售日期："+formatDocumentDate(so.CreateTime), "R", 10)
+		doc.Ln(-1)
+		doc.text(half, fmt.Sprintf("客户：%s %s", customer.Code, so.CustomerName), "L", 10)
+		doc.text(half, "电话："+so.CustomerPhone, "R", 10)
+		doc.Ln(-1)
+		address := customer.Address
+		if address == "" {
+			address = so.CustomerCity
+		}
+		doc.text(half, "地址："+address, "L", 10)
+		doc.text(half, "订单类型："+so.OrderType, "R", 10)
+		doc.Ln(-1)
+		if inv := customer.Invoice; inv != nil {
+			doc.text(half, "开票单位："+inv.Company, "L", 9)
+			doc.text(half, "税号："+inv.TaxNumber, "R", 9)
+			doc.Ln(-1)
+			doc.text(half, "开户行："+inv.Bank+" "+inv.BranchAddress, "L", 9)
+			doc.text(half, "账号："+inv.BankAccount, "R", 9)
+			doc.Ln(-1)
+		}
+		doc.Ln(2)
+	}
+
+	table := &pdfTable{doc: doc, header: header, columns: []pdfColumn{
+		{"序号", 8, "C"}, {"产品编号", 18, "L"}, {"名称及规格", 38, "L"}, {"件数", 10, "C"}, {"发货明细", 26, "L"},
+		{"单位", 10, "C"}, {"数量", 16, "R"}, {"单价", 16, "R"}, {"优惠", 12, "R"}, {"金额", 20, "R"}, {"备注", 16, "L"},
+	}}
+	table.newPage()
+	pieces := 0
+	for i, item := range so.Items {
+		pieceCount := ""
+		if item.PieceCount > 0 {
+			pieceCount = strconv.Itoa(item.PieceCount)
+			pieces += item.PieceCount
+		}
+		discount := ""
+		if !item.DiscountAmount.IsZero() {
+			discount = pdfAmount(item.DiscountAmount)
+		}
+		table.row(strconv.Itoa(i+1), item.ProductCode, item.ProductName, pieceCount, item.QuantityDetail,
+			item.Unit, item.Quantity.StringFixed(moneyScale), pdfAmount(item.Price), discount, pdfAmount(item.TotalAmount), item.Remark)
+	}
+
+	// 合计
+	doc.ensureSpace(45)
+	doc.Ln(2)
+	third := pdfContentW / 3
+	if pieces > 0 {
+		doc.text(third, fmt.Sprintf("共 %d 件", pieces), "L", 10)
+	} else {
+		doc.text(third, "", "L", 10)
+	}
+	doc.text(third, "商品金额："+pdfAmount(so.OrderAmount), "L", 10)
+	doc.text(third, "运费："+pdfAmount(so.Freight), "R", 10)
+	doc.Ln(-1)
+	doc.text(half, "应付金额："+pdfAmount(so.PayableAmount), "L", 11)
+	doc.text(half, "已付金额："+pdfAmount(so.PaymentAmount), "R", 10)
+	doc.Ln(-1)
+	doc.text(pdfContentW, "应付金额（大写）："+so.PayableAmountUppercase, "L", 11)
+	doc.Ln(-1)
+	if so.LogisticsCompany != "" || so.TrackingNumber != "" {
+		doc.text(pdfContentW, "物流："+strings.TrimSpace(so.LogisticsCompany+" "+so.TrackingNumber), "L", 10)
+		doc.Ln(-1)
+	}
+	if so.Remark != "" {
+		for _, line := range doc.wrap("备注："+so.Remark, pdfContentW) {
+			doc.text(pdfContentW, line, "L", 10)
+			doc.Ln(-1)
+		}
+	}
+	doc.Ln(6)
+	doc.text(half, "制单：", "L", 10)
+	doc.text(half, "客户签收：______________", "R", 10)
+
+	data, err := doc.bytes()
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, &so, nil
+}
+
+// formatDocumentDate 单据上只显示日期部分
+func formatDocumentDate(s string) string {
+	for _, layout := range []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.Format("2006-01-02")
+		}
+	}
+	if len(s) > 10 {
+		return s[:10]
+	}
+	return s
+}
+
+// getSaleOrderPDF 下载销售单PDF
+func getSaleOrderPDF(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid sale order ID"})
+		return
+	}
+
+	data, so, err := renderSaleOrderPDF(id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Sale order not found"})
+			return
+		}
+		if err == errPDFDisabled {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to render sale order PDF: " + err.Error()})
+		return
+	}
+	writePDF(c, fmt.Sprintf("销售单_%s.pdf", so.Code), data)
+}
+
+// ========== 客户对帐单 ==========
+
+// renderStatementPDF 生成客户在对帐期间内的对帐单PDF：期初余额、逐笔明细及余额、本期合计、期末余额及大写
+func renderStatementPDF(customerID int, startTime, endTime string) ([]byte, *statementExportSheet, error) {
+	sheet, err := loadStatementExportSheet(customerID, startTime, endTime)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	doc, err := newPDFDoc()
+	if err != nil {
+		return nil, nil, err
+	}
+	doc.SetTitle("客户对帐单 "+sheet.CustomerName, true)
+	company := documentCompanyName()
+	half := pdfContentW / 2
+
+	header := func() {
+		doc.text(pdfContentW, company+"客户对帐单", "C", 16)
+		doc.Ln(9)
+		doc.text(half, fmt.Sprintf("客户：%s %s", sheet.CustomerCode, sheet.CustomerName), "L", 10)
+		doc.text(half, "对帐期间："+statementPeriodText(startTime, endTime), "R", 10)
+		doc.Ln(-1)
+		doc.Ln(2)
+	}
+	table := &pdfTable{doc: doc, header: header, columns: []pdfColumn{
+		{"日期", 22, "C"}, {"类型", 14, "C"}, {"单号", 32, "L"}, {"销售金额", 28, "R"}, {"收款金额", 28, "R"}, {"余额", 28, "R"}, {"备注", 38, "L"},
+	}}
+	table.newPage()
+
+	table.row(startTime, "期初余额", "", "", "", pdfAmount(sheet.Opening), "")
+	balance := sheet.Opening
+	var saleTotal, paymentTotal decimal.Decimal
+	for _, l := range sheet.Lines {
+		balance = balance.Add(l.SaleAmount).Sub(l.PaymentAmount)
+		saleTotal = saleTotal.Add(l.SaleAmount)
+		paymentTotal = paymentTotal.Add(l.PaymentAmount)
+		typeName := statementSourceTypeNames[l.SourceType]
+		if typeName == "" {
+			typeName = l.SourceType
+		}
+		var sale, payment string
+		if !l.SaleAmount.IsZero() {
+			sale = pdfAmount(l.SaleAmount)
+		}
+		if !l.PaymentAmount.IsZero() {
+			payment = pdfAmount(l.PaymentAmount)
+		}
+		table.row(l.Date, typeName, l.SourceCode, sale, payment, pdfAmount(balance), l.Remark)
+	}
+	table.row("", "本期合计", "", pdfAmount(saleTotal), pdfAmount(paymentTotal), "", "")
+	table.row("", "期末余额", "", "", "", pdfAmount(balance), "")
+
+	doc.ensureSpace(20)
+	doc.Ln(2)
+	doc.text(pdfContentW, "期末余额（大写）："+rmbUppercase(roundAmount(balance)), "L", 11)
+	doc.Ln(10)
+	doc.text(half, "对帐单位（盖章）：", "L", 10)
+	doc.text(half, "客户确认（盖章）：", "R", 10)
+
+	data, err := doc.bytes()
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, sheet, nil
+}
+
+// getStatementPDF 下载客户对帐单PDF，参数：customerId（必填）、startTime、endTime（YYYY-MM-DD）
+func getStatementPDF(c *gin.Context) {
+	customerID, err := strconv.Atoi(c.Query("customerId"))
+	if err != nil || customerID <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "customerId is required"})
+		return
+	}
+	startTime := strings.TrimSpace(c.Query("startTime"))
+	endTime := strings.TrimSpace(c.Query("endTime"))
+	for _, d := range []string{startTime, endTime} {
+		if d == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", d); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date, expected YYYY-MM-DD"})
+			return
+		}
+	}
+
+	data, sheet, err := renderStatementPDF(customerID, startTime, endTime)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Customer not found"})
+			return
+		}
+		if err == errPDFDisabled {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to render statement PDF: " + err.Error()})
+		return
+	}
+	filename := "对帐单_" + sheet.CustomerName
+	if startTime != "" || endTime != "" {
+		filename += "_" + startTime + "_" + endTime
+	}
+	writePDF(c, filename+".pdf", data)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+
+	"nb2/internal/config"
+)
+
+func TestInitPDF(t *testing.T) {
+	defer func() { pdfFontData = nil }()
+
+	if err := initPDF(&config.PDFConfig{Enabled: false}); err != nil {
+		t.Fatalf("disabled: %v", err)
+	}
+	if _, err := newPDFDoc(); err != errPDFDisabled {
+		t.Fatalf("newPDFDoc while disabled: err = %v, want errPDFDisabled", err)
+	}
+
+	// 启用PDF时字体缺失或不是TrueType字体都拒绝启动
+	for _, path := range []string{"", "testdata/missing.ttf", "pdf.go"} {
+		if err := initPDF(&config.PDFConfig{Enabled: true, FontPath: path}); err == nil {
+			t.Errorf("initPDF(%q) succeeded, want error", path)
+		}
+	}
+	if err := initPDF(&config.PDFConfig{Enabled: true, FontPath: "testdata/calligra.ttf"}); err != nil {
+		t.Fatalf("initPDF with TrueType font: %v", err)
+	}
+}
+
+func TestRenderSaleOrderPDF(t *testing.T) {
+	openTestDB(t)
+	// 测试字体不含中文字形，只校验能完整生成PDF
+	font, err := os.ReadFile("testdata/calligra.ttf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := setPDFFont(font); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { pdfFontData = nil }()
+
+	customerID := mustExec(t, "INSERT INTO customers (code, name, phone, province, city, address) VALUES (?, ?, ?, ?, ?, ?)",
+		"C00001", "张三", "13800000000", "浙江省", "杭州市", "文一路1号")
+	mustExec(t, "INSERT INTO invoices (customer_id, company, tax_number, bank, bank_account) VALUES (?, ?, ?, ?, ?)",
+		customerID, "杭州某某贸易有限公司", "91330100MA2XXXXX0X", "工商银行", "6222000000000000")
+	productID := mustExec(t, "INSERT INTO products (name, code, unit, price) VALUES (?, ?, ?, ?)", "液压油管 DN10", "P00001", "米", "12.50")
+
+	items := make([]CreateSaleOrderItemRequest, 60)
+	for i := range items {
+		items[i] = CreateSaleOrderItemRequest{
+			ProductID: productID, ProductCode: "P00001", ProductName: "液压油管 DN10", Unit: "米",
+			Quantity: decimal.NewFromInt(int64(i + 1)), Price: decimal.RequireFromString("12.50"), Remark: "第" + strconv.Itoa(i+1) + "行",
+		}
+	}
+	id := createTestSaleOrder(t, CreateSaleOrderRequest{
+		Code: "SO000001", CreateTime: "2026-03-01 10:00:00", CustomerID: customerID,
+		Freight: decimal.RequireFromString("20.00"), Items: items, Remark: "送货上门",
+	})
+
+	data, so, err := renderSaleOrderPDF(id)
+	if err != nil {
+		t.Fatalf("renderSaleOrderPDF: %v", err)
+	}
+	if so.Code != "SO000001" || len(so.Items) != len(items) {
+		t.Fatalf("sale order = %s with %d items, want SO000001 with %d items", so.Code, len(so.Items), len(items))
+	}
+	if !bytes.HasPrefix(data, []byte("%PDF-")) {
+		t.Fatalf("output is not a PDF: %q", data[:min(len(data), 16)])
+	}
+	// 60行明细需要分页
+	if n := bytes.Count(data, []byte("/Type /Page\n")); n < 2 {
+		t.Errorf("pages = %d, want at least 2", n)
+	}
+
+	w := callHandler(t, getSaleOrderPDF, http.MethodGet, nil, gin.Param{Key: "id", Value: strconv.Itoa(id)})
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/pdf" {
+		t.Fatalf("getSaleOrderPDF: %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+	w = callHandler(t, getSaleOrderPDF, http.MethodGet, nil, gin.Param{Key: "id", Value: strconv.Itoa(id + 1)})
+	if w.Code != http.StatusNotFound {
+		t.Errorf("getSaleOrderPDF for missing order: %d, want 404", w.Code)
+	}
+}
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mozillazg/go-pinyin"
+
+	"nb2/pkg/database"
+)
+
+// 拼音检索：客户名称/公司、产品名称/品牌各自保存全拼和首字母两列，
+// 输入 "zs"、"zhangsan" 或 "张s" 都能找到 "张三"，编号完全匹配的排在最前
+// 客户的检索条件和排序由 matchCustomers 统一生成，客户列表的单框搜索和 /customers/search 共用
+
+// pinyinArgs 汉字取常用读音；字母和数字原样保留（转为小写），其他字符忽略
+var pinyinArgs = func() pinyin.Args {
+	a := pinyin.NewArgs()
+	a.Fallback = func(r rune, _ pinyin.Args) []string {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			return []string{string(unicode.ToLower(r))}
+		}
+		return nil
+	}
+	return a
+}()
+
+// searchPinyin 把文本转换为全拼和首字母，如 "张三" → "zhangsan"、"zs"
+func searchPinyin(s string) (full, initials string) {
+	var fb, ib strings.Builder
+	for _, py := range pinyin.LazyPinyin(s, pinyinArgs) {
+		// 输入法中 ü 用 v 输入
+		py = strings.ReplaceAll(py, "ü", "v")
+		if py == "" {
+			continue
+		}
+		fb.WriteString(py)
+		ib.WriteString(py[:1])
+	}
+	return fb.String(), ib.String()
+}
+
+// brandSearchPinyin 产品品牌保存的是字典项编码（如 D02001），拼音按字典项名称生成；
+// 找不到对应的字典项时（品牌直接填写了名称）按原值生成
+func brandSearchPinyin(q dbExecutor, brand string) (full, initials string, err error) {
+	name := brand
+	if brand != "" {
+		err = q.QueryRow("SELECT name FROM dictionary_items WHERE code = ?", brand).Scan(&name)
+		if err != nil && err != sql.ErrNoRows {
+			return "", "", err
+		}
+	}
+	full, initials = searchPinyin(name)
+	return full, initials, nil
+}
+
+// refreshBrandPinyin 品牌字典项改名后重新生成使用该品牌的产品的品牌拼音
+func refreshBrandPinyin(q dbExecutor, code, name string) error {
+	full, initials := searchPinyin(name)
+	_, err := q.Exec("UPDATE products SET brand_pinyin = ?, brand_initials = ? WHERE brand = ?", full, initials, code)
+	return err
+}
+
+// pinyinSearchTable 需要拼音检索的数据表
+type pinyinSearchTable struct {
+	Table   string
+	Sources []string          // 生成拼音的列，第一列为名称；对应的拼音列为 <列名>_pinyin 和 <列名>_initials
+	Exprs   map[string]string // 生成拼音时取值的SQL表达式，结果为NULL时取列值；未设置的列直接取列值
+}
+
+var (
+	customerPinyinTable = pinyinSearchTable{Table: "customers", Sources: []string{"name", "company"}}
+	productPinyinTable  = pinyinSearchTable{Table: "products", Sources: []string{"name", "brand"}, Exprs: map[string]string{
+		"brand": "(SELECT d.name FROM dictionary_items d WHERE d.code = products.brand)",
+	}}
+)
+
+// columns 拼音列名
+func (t pinyinSearchTable) columns() []string {
+	var columns []string
+	for _, source := range t.Sources {
+		columns = append(columns, source+"_pinyin", source+"_initials")
+	}
+	return columns
+}
+
+// backfill 为拼音列为空的历史数据补齐拼音
+func (t pinyinSearchTable) backfill() error {
+	var conds []string
+	for _, source := range t.Sources {
+		conds = append(conds, "(COALESCE("+source+", '') <> '' AND "+source+"_pinyin = '')")
+	}
+	values := make([]string, len(t.Sources))
+	for i, source := range t.Sources {
+		if expr, ok := t.Exprs[source]; ok {
+			values[i] = "COALESCE(" + expr + ", " + source + ", '')"
+		} else {
+			values[i] = "COALESCE(" + source + ", '')"
+		}
+	}
+	rows, err := database.DB.Query("SELECT id, " + strings.Join(values, ", ") + " FROM " + t.Table + " WHERE " + strings.Join(conds, " OR "))
+	if err != nil {
+		return err
+	}
+	type pending struct {
+		id     int
+		values []string
+	}
+	var list []pending
+	for rows.Next() {
+		p := pending{values: make([]string, len(t.Sources))}
+		dest := []interface{}{&p.id}
+		for i := range p.values {
+			dest = append(dest, &p.values[i])
+		}
+		if err := rows.Scan(dest...); err != nil {
+			rows.Close()
+			return err
+		}
+		list = append(list, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(list) == 0 {
+		return nil
+	}
+
+	sets := make([]string, 0, len(t.Sources)*2)
+	for _, column := range t.columns() {
+		sets = append(sets, column+" = ?")
+	}
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, p := range list {
+		args := make([]interface{}, 0, len(t.Sources)*2+1)
+		for _, v := range p.values {
+			full, initials := searchPinyin(v)
+			args = append(args, full, initials)
+		}
+		args = append(args, p.id)
+		if _, err := tx.Exec("UPDATE "+t.Table+" SET "+strings.Join(sets, ", ")+" WHERE id = ?", args...); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// backfillSearchPinyin 启动时为升级前的客户和产品补齐拼音检索列
+func backfillSearchPinyin() error {
+	for _, t := range []pinyinSearchTable{customerPinyinTable, productPinyinTable} {
+		if err := t.backfill(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// searchSQL 生成检索条件和排序：编号完全匹配 > 编号前缀 > 名称完全匹配 > 名称或拼音前缀 > 其他包含匹配
+func (t pinyinSearchTable) searchSQL(keyword string) (where, orderBy string, args, orderArgs []interface{}) {
+	full, _ := searchPinyin(keyword)
+	like := "%" + keyword + "%"
+	prefix := keyword + "%"
+
+	conds := []string{"code LIKE ?"}
+	args = []interface{}{like}
+	for _, source := range t.Sources {
+		conds = append(conds, source+" LIKE ?")
+		args = append(args, like)
+	}
+	// 拼音可能是全拼也可能是首字母，两列都匹配
+	if full != "" {
+		pinyinLike := "%" + full + "%"
+		for _, column := range t.columns() {
+			conds = append(conds, column+" LIKE ?")
+			args = append(args, pinyinLike)
+		}
+	}
+	where = " WHERE (" + strings.Join(conds, " OR ") + ")"
+
+	name := t.Sources[0]
+	namePrefix := name + " LIKE ?"
+	orderArgs = []interface{}{strings.ToUpper(keyword), prefix, keyword, prefix}
+	if full != "" {
+		namePrefix += " OR " + name + "_pinyin LIKE ? OR " + name + "_initials LIKE ?"
+		orderArgs = append(orderArgs, full+"%", full+"%")
+	}
+	orderBy = " ORDER BY CASE WHEN UPPER(code) = ? THEN 0 WHEN code LIKE ? THEN 1 WHEN " + name + " = ? THEN 2 WHEN " + namePrefix + " THEN 3 ELSE 4 END, status DESC, code"
+	return where, orderBy, args, orderArgs
+}
+
+// customerMatch 客户关键字检索的条件和相关度排序
+type customerMatch struct {
+	Cond     string // WHERE 条件，不含 WHERE
+	Args     []interface{}
+	Rank     string // ORDER BY 表达式，不含 ORDER BY
+	RankArgs []interface{}
+}
+
+// customerSearchColumns 客户全文索引 ft_customers_search 中的列
+var customerSearchColumns = []string{"name", "phone", "province", "city", "district", "address", "company", "remark"}
+
+// matchCustomers 客户关键字检索，每一路都能走索引，用 UNION 合并命中的客户：
+// 编号、名称和公司的拼音以及开票资料中的税号、银行账号按开头匹配，其余字段走全文索引；
+// 排序：编号完全匹配 > 编号前缀 > 名称完全匹配 > 名称或名称拼音前缀 > 其他
+func matchCustomers(keyword string) customerMatch {
+	full, _ := searchPinyin(keyword)
+	prefix := keyword + "%"
+
+	branches := []string{"SELECT id FROM customers WHERE code LIKE ?"}
+	args := []interface{}{prefix}
+	if full != "" {
+		// 拼音可能是全拼也可能是首字母，两列都匹配
+		for _, column := range customerPinyinTable.columns() {
+			branches = append(branches, "SELECT id FROM customers WHERE "+column+" LIKE ?")
+			args = append(args, full+"%")
+		}
+	}
+	match, matchArgs := database.CurrentDialect().FullTextMatch(customerSearchColumns, keyword)
+	branches = append(branches,
+		"SELECT id FROM customers WHERE "+match,
+		"SELECT customer_id FROM invoices WHERE tax_number LIKE ?",
+		"SELECT customer_id FROM invoices WHERE bank_account LIKE ?",
+	)
+	args = append(args, matchArgs...)
+	args = append(args, prefix, prefix)
+
+	namePrefix := "name LIKE ?"
+	rankArgs := []interface{}{strings.ToUpper(keyword), prefix, keyword, prefix}
+	if full != "" {
+		namePrefix += " OR name_pinyin LIKE ? OR name_initials LIKE ?"
+		rankArgs = append(rankArgs, full+"%", full+"%")
+	}
+	return customerMatch{
+		Cond:     "id IN (" + strings.Join(branches, " UNION ") + ")",
+		Args:     args,
+		Rank:     "CASE WHEN UPPER(code) = ? THEN 0 WHEN code LIKE ? THEN 1 WHEN name = ? THEN 2 WHEN " + namePrefix + " THEN 3 ELSE 4 END",
+		RankArgs: rankArgs,
+	}
+}
+
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+)
+
+// parseSearchParams 解析检索关键字和返回条数
+func parseSearchParams(c *gin.Context) (string, int, bool) {
+	keyword := strings.TrimSpace(c.Query("q"))
+	if keyword == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请输入检索关键字"})
+		return "", 0, false
+	}
+	limit := defaultSearchLimit
+	if s := c.Query("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > maxSearchLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+			return "", 0, false
+		}
+		limit = n
+	}
+	return keyword, limit, true
+}
+
+// searchCustomers 按编号、名称、公司及其拼音、电话、地址和开票资料检索客户，条件与客户列表的单框搜索相同
+func searchCustomers(c *gin.Context) {
+	keyword, limit, ok := parseSearchParams(c)
+	if !ok {
+		return
+	}
+
+	m := matchCustomers(keyword)
+	args := append(append(append([]interface{}{}, m.Args...), m.RankArgs...), limit)
+	rows, err := database.DB.Query(customerSelect+" WHERE "+m.Cond+" ORDER BY "+m.Rank+", status DESC, code LIMIT ?", args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search customers: " + err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	customers := []Customer{}
+	for rows.Next() {
+		customer, err := scanCustomer(rows)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan customer: " + err.Error()})
+			return
+		}
+		customers = append(customers, customer)
+	}
+
+	c.JSON(http.StatusOK, customers)
+}
+
+// searchProducts 按编号、名称、品牌及其拼音检索产品
+func searchProducts(c *gin.Context) {
+	keyword, limit, ok := parseSearchParams(c)
+	if !ok {
+		return
+	}
+
+	where, orderBy, args, orderArgs := productPinyinTable.searchSQL(keyword)
+	args = append(append(args, orderArgs...), limit)
+	rows, err := database.DB.Query(productSelect+where+orderBy+" LIMIT ?", args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search products: " + err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	products := []Product{}
+	for rows.Next() {
+		p, err := scanProduct(rows)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan product: " + err.Error()})
+			return
+		}
+		products = append(products, p)
+	}
+
+	c.JSON(http.StatusOK, products)
+}
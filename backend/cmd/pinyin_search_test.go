@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+
+	"nb2/pkg/database"
+)
+
+// TestProductBrandPinyin 品牌拼音按字典项名称生成，字典项改名后跟着更新，可以用品牌拼音检索产品
+func TestProductBrandPinyin(t *testing.T) {
+	openTestDB(t)
+	itemID := mustExec(t, "INSERT INTO dictionary_items (code, name, dict_type_code, status) VALUES (?, ?, ?, 1)", "D02101", "恒力", "D02")
+
+	w := callHandler(t, createProduct, http.MethodPost, CreateProductRequest{
+		Name: "液压油管", Brand: "D02101", Price: decimal.RequireFromString("12.50"),
+	})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("createProduct: %d %s", w.Code, w.Body.String())
+	}
+	var p Product
+	if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+		t.Fatal(err)
+	}
+	assertBrandPinyin := func(step, wantFull, wantInitials string) {
+		t.Helper()
+		var full, initials string
+		if err := database.DB.QueryRow("SELECT brand_pinyin, brand_initials FROM products WHERE id = ?", p.ID).Scan(&full, &initials); err != nil {
+			t.Fatal(err)
+		}
+		if full != wantFull || initials != wantInitials {
+			t.Errorf("%s: brand pinyin = %q, %q, want %q, %q", step, full, initials, wantFull, wantInitials)
+		}
+	}
+	assertBrandPinyin("create", "hengli", "hl")
+
+	w = httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/products/search?q=hl", nil)
+	searchProducts(c)
+	var found []Product
+	if err := json.Unmarshal(w.Body.Bytes(), &found); err != nil || len(found) != 1 || found[0].ID != p.ID {
+		t.Errorf("search by brand initials: %d %s", w.Code, w.Body.String())
+	}
+
+	w = callHandler(t, updateDictionaryItem, http.MethodPut, UpdateDictionaryItemRequest{Name: "力士乐", Status: 1}, gin.Param{Key: "id", Value: strconv.Itoa(itemID)})
+	if w.Code != http.StatusOK {
+		t.Fatalf("updateDictionaryItem: %d %s", w.Code, w.Body.String())
+	}
+	assertBrandPinyin("rename brand", "lishile", "lsl")
+
+	// 历史数据清空后由启动时的补齐按品牌名称重新生成
+	if _, err := database.DB.Exec("UPDATE products SET brand_pinyin = '', brand_initials = ''"); err != nil {
+		t.Fatal(err)
+	}
+	if err := backfillSearchPinyin(); err != nil {
+		t.Fatal(err)
+	}
+	assertBrandPinyin("backfill", "lishile", "lsl")
+
+	// 品牌不是字典项编码时按原值生成
+	w = callHandler(t, updateProduct, http.MethodPut, UpdateProductRequest{Brand: "Parker", Status: 1}, gin.Param{Key: "id", Value: strconv.Itoa(p.ID)})
+	if w.Code != http.StatusOK {
+		t.Fatalf("updateProduct: %d %s", w.Code, w.Body.String())
+	}
+	assertBrandPinyin("free-text brand", "parker", "parker")
+}
+
+// TestCustomerSearchMatchesList 客户列表单框搜索和 /customers/search 命中同样的客户，编号完全匹配的排在最前
+func TestCustomerSearchMatchesList(t *testing.T) {
+	openTestDB(t)
+	newCustomer := func(code, name, company string) int {
+		full, initials := searchPinyin(name)
+		companyFull, companyInitials := searchPinyin(company)
+		return mustExec(t, "INSERT INTO customers (code, name, phone, company, name_pinyin, name_initials, company_pinyin, company_initials) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+			code, name, "13800000000", company, full, initials, companyFull, companyInitials)
+	}
+	other := newCustomer("C0003", "C0012配件行", "")
+	prefix := newCustomer("C00120", "李四", "")
+	exact := newCustomer("C0012", "王五", "")
+	zhang := newCustomer("C0004", "张三", "")
+	hengli := newCustomer("C0005", "赵六", "恒力液压")
+
+	search := func(keyword string) []int {
+		t.Helper()
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/customers/search?q="+keyword, nil)
+		searchCustomers(c)
+		var customers []Customer
+		if err := json.Unmarshal(w.Body.Bytes(), &customers); err != nil {
+			t.Fatalf("searchCustomers(%q): %d %s", keyword, w.Code, w.Body.String())
+		}
+		ids := []int{}
+		for _, customer := range customers {
+			ids = append(ids, customer.ID)
+		}
+		return ids
+	}
+	list := func(keyword string) []int {
+		t.Helper()
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/customers?q="+keyword, nil)
+		getCustomers(c)
+		var page struct {
+			Total   int        `json:"total"`
+			Records []Customer `json:"records"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil || page.Total != len(page.Records) {
+			t.Fatalf("getCustomers(%q): %d %s", keyword, w.Code, w.Body.String())
+		}
+		ids := []int{}
+		for _, customer := range page.Records {
+			ids = append(ids, customer.ID)
+		}
+		return ids
+	}
+
+	tests := []struct {
+		keyword string
+		want    []int
+	}{
+		{"C0012", []int{exact, prefix, other}},
+		{"c0012", []int{exact, prefix, other}},
+		{"zs", []int{zhang}},
+		{"张s", []int{zhang}},
+		{"hl", []int{hengli}},
+		{"恒力", []int{hengli}},
+	}
+	for _, tt := range tests {
+		for name, fn := range map[string]func(string) []int{"search": search, "list": list} {
+			if got := fn(tt.keyword); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("%s(%q) = %v, want %v", name, tt.keyword, got, tt.want)
+			}
+		}
+	}
+}
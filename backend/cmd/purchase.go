@@ -0,0 +1,898 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+
+	"nb2/pkg/database"
+)
+
+// ========== 进货单相关模型 ==========
+
+// PurchaseOrder 进货单模型
+type PurchaseOrder struct {
+	ID             int                 `json:"id"`
+	Code           string              `json:"code"`
+	OrderDate      string              `json:"orderDate"`
+	SupplierID     int                 `json:"supplierId"`
+	SupplierName   string              `json:"supplierName"`
+	Status         string              `json:"status"`
+	TotalAmount    decimal.Decimal     `json:"totalAmount"`
+	ReceivedAmount decimal.Decimal     `json:"receivedAmount"`
+	Remark         string              `json:"remark"`
+	Items          []PurchaseOrderItem `json:"items"`
+	Receipts       []PurchaseReceipt   `json:"receipts,omitempty"`
+	CreatedAt      string              `json:"createdAt"`
+	UpdatedAt      string              `json:"updatedAt"`
+}
+
+// PurchaseOrderItem 进货单商品模型
+type PurchaseOrderItem struct {
+	ID               int             `json:"id"`
+	PurchaseOrderID  int             `json:"purchaseOrderId"`
+	ProductID        int             `json:"productId"`
+	ProductCode      string          `json:"productCode"`
+	ProductName      string          `json:"productName"`
+	Quantity         decimal.Decimal `json:"quantity"`
+	ReceivedQuantity decimal.Decimal `json:"receivedQuantity"`
+	Unit             string          `json:"unit"`
+	Price            decimal.Decimal `json:"price"`
+	TotalAmount      decimal.Decimal `json:"totalAmount"`
+	Remark           string          `json:"remark"`
+}
+
+// PurchaseReceipt 收货记录模型
+type PurchaseReceipt struct {
+	ID              int                   `json:"id"`
+	PurchaseOrderID int                   `json:"purchaseOrderId"`
+	SupplierID      int                   `json:"supplierId"`
+	ReceiptDate     string                `json:"receiptDate"`
+	Amount          decimal.Decimal       `json:"amount"`
+	Remark          string                `json:"remark"`
+	Username        string                `json:"username"`
+	Items           []PurchaseReceiptItem `json:"items"`
+	CreatedAt       string                `json:"createdAt"`
+}
+
+// PurchaseReceiptItem 收货记录明细模型
+type PurchaseReceiptItem struct {
+	ID                  int             `json:"id"`
+	ReceiptID           int             `json:"receiptId"`
+	PurchaseOrderItemID int             `json:"purchaseOrderItemId"`
+	ProductID           int             `json:"productId"`
+	Quantity            decimal.Decimal `json:"quantity"`
+	Price               decimal.Decimal `json:"price"`
+	Amount              decimal.Decimal `json:"amount"`
+}
+
+// PurchaseOrderRequest 创建/更新进货单请求，商品名称、编号和单位以产品资料为准
+type PurchaseOrderRequest struct {
+	Code       string                     `json:"code"`
+	OrderDate  string                     `json:"orderDate" binding:"required"`
+	SupplierID int                        `json:"supplierId" binding:"required"`
+	Status     string                     `json:"status"`
+	Items      []PurchaseOrderItemRequest `json:"items" binding:"required,min=1,dive"`
+	Remark     string                     `json:"remark"`
+}
+
+// PurchaseOrderItemRequest 进货单商品请求
+type PurchaseOrderItemRequest struct {
+	ProductID int             `json:"productId" binding:"required"`
+	Quantity  decimal.Decimal `json:"quantity" binding:"required,gt=0"`
+	Price     decimal.Decimal `json:"price" binding:"gte=0"`
+	Remark    string          `json:"remark"`
+}
+
+// ReceivePurchaseOrderRequest 收货请求
+type ReceivePurchaseOrderRequest struct {
+	ReceiptDate string                       `json:"receiptDate" binding:"required"`
+	Items       []ReceivePurchaseItemRequest `json:"items" binding:"required,min=1,dive"`
+	Remark      string                       `json:"remark"`
+}
+
+// ReceivePurchaseItemRequest 收货明细请求
+type ReceivePurchaseItemRequest struct {
+	ItemID   int             `json:"itemId" binding:"required"`
+	Quantity decimal.Decimal `json:"quantity" binding:"required,gt=0"`
+}
+
+// 进货单状态
+const (
+	purchaseStatusDraft             = "draft"              // 草稿
+	purchaseStatusOrdered           = "ordered"            // 已下单
+	purchaseStatusPartiallyReceived = "partially_received" // 部分收货
+	purchaseStatusReceived          = "received"           // 已收货
+)
+
+// defaultPurchaseOrderCodePrefix 未配置 purchase_order_code_prefix 时使用的进货单编号前缀
+const defaultPurchaseOrderCodePrefix = "CG"
+
+// purchaseOrderSelect 查询进货单的语句
+const purchaseOrderSelect = "SELECT id, code, order_date, supplier_id, supplier_name, status, total_amount, received_amount, COALESCE(remark, ''), created_at, updated_at FROM purchase_orders"
+
+// scanPurchaseOrder 扫描一行进货单数据
+func scanPurchaseOrder(row interface{ Scan(...interface{}) error }) (PurchaseOrder, error) {
+	var po PurchaseOrder
+	err := row.Scan(&po.ID, &po.Code, &po.OrderDate, &po.SupplierID, &po.SupplierName, &po.Status, &po.TotalAmount, &po.ReceivedAmount, &po.Remark, &po.CreatedAt, &po.UpdatedAt)
+	return po, err
+}
+
+// purchaseOrderCodePrefix 读取进货单编号前缀设置
+func purchaseOrderCodePrefix(q dbExecutor) (string, error) {
+	var prefix string
+	err := q.QueryRow("SELECT value FROM settings WHERE `key` = ?", "purchase_order_code_prefix").Scan(&prefix)
+	if err == sql.ErrNoRows || (err == nil && strings.TrimSpace(prefix) == "") {
+		return defaultPurchaseOrderCodePrefix, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(prefix), nil
+}
+
+// generatePurchaseOrderCode 生成进货单号（前缀+YYMMDD+4位递增数字），前缀可在系统设置中配置
+func generatePurchaseOrderCode(q dbExecutor) (string, error) {
+	codePrefix, err := purchaseOrderCodePrefix(q)
+	if err != nil {
+		return "", err
+	}
+	prefix := codePrefix + time.Now().Format("060102")
+
+	// 获取当天最大的进货单号
+	var maxCode sql.NullString
+	err = q.QueryRow("SELECT MAX(code) FROM purchase_orders WHERE code LIKE ?", prefix+"%").Scan(&maxCode)
+	if err != nil && err != sql.ErrNoRows {
+		return "", err
+	}
+
+	nextNum := 1
+	if maxCode.Valid && len(maxCode.String) > len(prefix) {
+		if currentNum, err := strconv.Atoi(maxCode.String[len(prefix):]); err == nil {
+			nextNum = currentNum + 1
+		}
+	}
+	return fmt.Sprintf("%s%04d", prefix, nextNum), nil
+}
+
+// generatePurchaseOrderCodeAPI 生成进货单号API
+func generatePurchaseOrderCodeAPI(c *gin.Context) {
+	code, err := generatePurchaseOrderCode(database.DB)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate purchase order code"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": code})
+}
+
+// loadPurchaseOrderItems 批量获取进货单商品，key为进货单ID
+func loadPurchaseOrderItems(q dbExecutor, orderIDs []int) (map[int][]PurchaseOrderItem, error) {
+	result := make(map[int][]PurchaseOrderItem, len(orderIDs))
+	if len(orderIDs) == 0 {
+		return result, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(orderIDs)), ",")
+	args := make([]interface{}, len(orderIDs))
+	for i, id := range orderIDs {
+		args[i] = id
+	}
+
+	rows, err := q.Query("SELECT id, purchase_order_id, product_id, COALESCE(product_code, ''), product_name, quantity, received_quantity, unit, price, total, COALESCE(remark, '') FROM purchase_order_items WHERE purchase_order_id IN ("+placeholders+") ORDER BY id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item PurchaseOrderItem
+		if err := rows.Scan(&item.ID, &item.PurchaseOrderID, &item.ProductID, &item.ProductCode, &item.ProductName, &item.Quantity, &item.ReceivedQuantity, &item.Unit, &item.Price, &item.TotalAmount, &item.Remark); err != nil {
+			return nil, err
+		}
+		result[item.PurchaseOrderID] = append(result[item.PurchaseOrderID], item)
+	}
+	return result, rows.Err()
+}
+
+// loadPurchaseReceipts 获取进货单的收货记录
+func loadPurchaseReceipts(orderID int) ([]PurchaseReceipt, error) {
+	rows, err := database.DB.Query("SELECT id, purchase_order_id, supplier_id, receipt_date, amount, COALESCE(remark, ''), COALESCE(username, ''), created_at FROM purchase_receipts WHERE purchase_order_id = ? ORDER BY id", orderID)
+	if err != nil {
+		return nil, err
+	}
+	receipts := []PurchaseReceipt{}
+	index := make(map[int]int)
+	for rows.Next() {
+		var r PurchaseReceipt
+		if err := rows.Scan(&r.ID, &r.PurchaseOrderID, &r.SupplierID, &r.ReceiptDate, &r.Amount, &r.Remark, &r.Username, &r.CreatedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		r.Items = []PurchaseReceiptItem{}
+		index[r.ID] = len(receipts)
+		receipts = append(receipts, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	itemRows, err := database.DB.Query(`
+		SELECT ri.id, ri.receipt_id, ri.purchase_order_item_id, ri.product_id, ri.quantity, ri.price, ri.amount
+		FROM purchase_receipt_items ri JOIN purchase_receipts r ON ri.receipt_id = r.id
+		WHERE r.purchase_order_id = ? ORDER BY ri.id`, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer itemRows.Close()
+	for itemRows.Next() {
+		var item PurchaseReceiptItem
+		if err := itemRows.Scan(&item.ID, &item.ReceiptID, &item.PurchaseOrderItemID, &item.ProductID, &item.Quantity, &item.Price, &item.Amount); err != nil {
+			return nil, err
+		}
+		if i, ok := index[item.ReceiptID]; ok {
+			receipts[i].Items = append(receipts[i].Items, item)
+		}
+	}
+	return receipts, itemRows.Err()
+}
+
+// purchaseOrderListSort 进货单列表可排序字段
+var purchaseOrderListSort = listSort{
+	Fields: map[string]string{
+		"orderDate":   "order_date",
+		"createdAt":   "created_at",
+		"code":        "code",
+		"totalAmount": "total_amount",
+	},
+	Default:    "orderDate",
+	Desc:       true,
+	TieBreaker: "id",
+}
+
+// getPurchaseOrders 分页获取进货单列表，支持按编号、供应商、状态和日期筛选
+func getPurchaseOrders(c *gin.Context) {
+	lq, err := newListQuery(c, purchaseOrderListSort)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	lq.contains("code", "code")
+	lq.intEq("supplierId", "supplier_id")
+	lq.eq("status", "status")
+	lq.dateRange("order_date")
+	if lq.err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": lq.err.Error()})
+		return
+	}
+
+	total, err := lq.count("purchase_orders")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count purchase orders: " + err.Error()})
+		return
+	}
+
+	query, args := lq.pageSQL(purchaseOrderSelect)
+	rows, err := database.DB.Query(query, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch purchase orders: " + err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	orders := []PurchaseOrder{}
+	var ids []int
+	for rows.Next() {
+		po, err := scanPurchaseOrder(rows)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan purchase order: " + err.Error()})
+			return
+		}
+		orders = append(orders, po)
+		ids = append(ids, po.ID)
+	}
+	rows.Close()
+
+	items, err := loadPurchaseOrderItems(database.DB, ids)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch purchase order items: " + err.Error()})
+		return
+	}
+	for i := range orders {
+		orders[i].Items = items[orders[i].ID]
+		if orders[i].Items == nil {
+			orders[i].Items = []PurchaseOrderItem{}
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"total":   total,
+		"records": orders,
+	})
+}
+
+// fetchPurchaseOrder 获取进货单详情（含商品和收货记录）
+func fetchPurchaseOrder(id int) (PurchaseOrder, error) {
+	po, err := scanPurchaseOrder(database.DB.QueryRow(purchaseOrderSelect+" WHERE id = ?", id))
+	if err != nil {
+		return po, err
+	}
+
+	items, err := loadPurchaseOrderItems(database.DB, []int{id})
+	if err != nil {
+		return po, err
+	}
+	po.Items = items[id]
+	if po.Items == nil {
+		po.Items = []PurchaseOrderItem{}
+	}
+
+	po.Receipts, err = loadPurchaseReceipts(id)
+	return po, err
+}
+
+// getPurchaseOrderByID 根据ID获取进货单
+func getPurchaseOrderByID(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid purchase order ID"})
+		return
+	}
+
+	po, err := fetchPurchaseOrder(id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Purchase order not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch purchase order: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, po)
+}
+
+// buildPurchaseOrderItems 根据产品资料生成进货单商品并计算总金额
+func buildPurchaseOrderItems(tx *sql.Tx, reqItems []PurchaseOrderItemRequest) ([]PurchaseOrderItem, decimal.Decimal, error) {
+	items := make([]PurchaseOrderItem, 0, len(reqItems))
+	var total decimal.Decimal
+	for i, r := range reqItems {
+		item := PurchaseOrderItem{
+			ProductID: r.ProductID,
+			Quantity:  roundQuantity(r.Quantity),
+			Price:     roundAmount(r.Price),
+			Remark:    r.Remark,
+		}
+		err := tx.QueryRow("SELECT COALESCE(code, ''), name, COALESCE(unit, '') FROM products WHERE id = ?", r.ProductID).Scan(&item.ProductCode, &item.ProductName, &item.Unit)
+		if err == sql.ErrNoRows {
+			return nil, decimal.Zero, fmt.Errorf("第%d行产品不存在", i+1)
+		}
+		if err != nil {
+			return nil, decimal.Zero, err
+		}
+		item.TotalAmount = roundAmount(item.Quantity.Mul(item.Price))
+		total = total.Add(item.TotalAmount)
+		items = append(items, item)
+	}
+	return items, roundAmount(total), nil
+}
+
+// insertPurchaseOrderItems 在事务中写入进货单商品
+func insertPurchaseOrderItems(tx *sql.Tx, orderID int, items []PurchaseOrderItem) error {
+	for _, item := range items {
+		_, err := tx.Exec(
+			"INSERT INTO purchase_order_items (purchase_order_id, product_id, product_code, product_name, quantity, received_quantity, unit, price, total, remark) VALUES (?, ?, ?, ?, ?, 0, ?, ?, ?, ?)",
+			orderID, item.ProductID, item.ProductCode, item.ProductName, item.Quantity, item.Unit, item.Price, item.TotalAmount, item.Remark,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// purchaseSupplierName 获取启用状态的供应商名称
+func purchaseSupplierName(tx *sql.Tx, supplierID int) (string, error) {
+	var name string
+	var status int
+	if err := tx.QueryRow("SELECT name, status FROM suppliers WHERE id = ?", supplierID).Scan(&name, &status); err != nil {
+		return "", err
+	}
+	if status != 1 {
+		return "", fmt.Errorf("供应商已停用")
+	}
+	return name, nil
+}
+
+// createPurchaseOrder 创建进货单，status 可为 draft（默认）或 ordered
+func createPurchaseOrder(c *gin.Context) {
+	var req PurchaseOrderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	status := req.Status
+	if status == "" {
+		status = purchaseStatusDraft
+	}
+	if status != purchaseStatusDraft && status != purchaseStatusOrdered {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid purchase order status"})
+		return
+	}
+
+	// 开始事务
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction: " + err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	supplierName, err := purchaseSupplierName(tx, req.SupplierID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Supplier not found"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	items, total, err := buildPurchaseOrderItems(tx, req.Items)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 进货单号：优先使用前端传递的code，为空时自动生成
+	orderCode := req.Code
+	if orderCode == "" {
+		orderCode, err = generatePurchaseOrderCode(tx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate purchase order code: " + err.Error()})
+			return
+		}
+	} else {
+		var exists bool
+		if err := tx.QueryRow("SELECT EXISTS(SELECT 1 FROM purchase_orders WHERE code = ?)", orderCode).Scan(&exists); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "检查进货单号失败"})
+			return
+		}
+		if exists {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "进货单号已存在"})
+			return
+		}
+	}
+
+	result, err := tx.Exec(
+		"INSERT INTO purchase_orders (code, order_date, supplier_id, supplier_name, status, total_amount, received_amount, remark) VALUES (?, ?, ?, ?, ?, ?, 0, ?)",
+		orderCode, req.OrderDate, req.SupplierID, supplierName, status, total, req.Remark,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create purchase order: " + err.Error()})
+		return
+	}
+	orderID, err := result.LastInsertId()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get last insert ID"})
+		return
+	}
+
+	if err := insertPurchaseOrderItems(tx, int(orderID), items); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create purchase order item: " + err.Error()})
+		return
+	}
+	if err := recordAudit(tx, c, auditPurchaseOrder, orderID, auditActionCreate, nil); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write audit log: " + err.Error()})
+		return
+	}
+
+	// 提交事务
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction: " + err.Error()})
+		return
+	}
+
+	po, err := fetchPurchaseOrder(int(orderID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch purchase order: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, po)
+}
+
+// purchaseOrderStatus 读取进货单状态，返回是否存在
+func purchaseOrderStatus(tx *sql.Tx, id int) (string, bool, error) {
+	var status string
+	err := tx.QueryRow("SELECT status FROM purchase_orders WHERE id = ?", id).Scan(&status)
+	if err == sql.ErrNoRows {
+		return "", false, nil
+	}
+	return status, err == nil, err
+}
+
+// updatePurchaseOrder 更新进货单，只有草稿和已下单（未收货）的进货单可以修改
+func updatePurchaseOrder(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid purchase order ID"})
+		return
+	}
+
+	var req PurchaseOrderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 开始事务
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction: " + err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	status, found, err := purchaseOrderStatus(tx, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch purchase order: " + err.Error()})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Purchase order not found"})
+		return
+	}
+	if status != purchaseStatusDraft && status != purchaseStatusOrdered {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "已收货的进货单不能修改"})
+		return
+	}
+	if req.Status != "" {
+		if req.Status != purchaseStatusDraft && req.Status != purchaseStatusOrdered {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid purchase order status"})
+			return
+		}
+		status = req.Status
+	}
+
+	before, err := snapshotEntity(tx, auditPurchaseOrder, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch purchase order: " + err.Error()})
+		return
+	}
+
+	supplierName, err := purchaseSupplierName(tx, req.SupplierID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Supplier not found"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	items, total, err := buildPurchaseOrderItems(tx, req.Items)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	query := "UPDATE purchase_orders SET order_date = ?, supplier_id = ?, supplier_name = ?, status = ?, total_amount = ?, remark = ?, updated_at = CURRENT_TIMESTAMP"
+	args := []interface{}{req.OrderDate, req.SupplierID, supplierName, status, total, req.Remark}
+	if req.Code != "" {
+		var exists bool
+		if err := tx.QueryRow("SELECT EXISTS(SELECT 1 FROM purchase_orders WHERE code = ? AND id != ?)", req.Code, id).Scan(&exists); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "检查进货单号失败"})
+			return
+		}
+		if exists {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "进货单号已存在"})
+			return
+		}
+		query += ", code = ?"
+		args = append(args, req.Code)
+	}
+	query += " WHERE id = ?"
+	args = append(args, id)
+
+	if _, err := tx.Exec(query, args...); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update purchase order: " + err.Error()})
+		return
+	}
+
+	// 删除旧的商品后重新写入
+	if _, err := tx.Exec("DELETE FROM purchase_order_items WHERE purchase_order_id = ?", id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete old purchase order items: " + err.Error()})
+		return
+	}
+	if err := insertPurchaseOrderItems(tx, id, items); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create purchase order item: " + err.Error()})
+		return
+	}
+	if err := recordAudit(tx, c, auditPurchaseOrder, id, auditActionUpdate, before); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write audit log: " + err.Error()})
+		return
+	}
+
+	// 提交事务
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction: " + err.Error()})
+		return
+	}
+
+	po, err := fetchPurchaseOrder(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch purchase order: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, po)
+}
+
+// orderPurchaseOrder 将草稿进货单标记为已下单
+func orderPurchaseOrder(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid purchase order ID"})
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction: " + err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	before, err := snapshotEntity(tx, auditPurchaseOrder, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch purchase order: " + err.Error()})
+		return
+	}
+	if before == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Purchase order not found"})
+		return
+	}
+
+	result, err := tx.Exec("UPDATE purchase_orders SET status = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ? AND status = ?", purchaseStatusOrdered, id, purchaseStatusDraft)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update purchase order: " + err.Error()})
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "只有草稿状态的进货单可以下单"})
+		return
+	}
+	if err := recordAudit(tx, c, auditPurchaseOrder, id, auditActionUpdate, before); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write audit log: " + err.Error()})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction: " + err.Error()})
+		return
+	}
+
+	po, err := fetchPurchaseOrder(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch purchase order: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, po)
+}
+
+// receivePurchaseOrder 按行登记收货数量，写入收货记录并增加库存
+func receivePurchaseOrder(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid purchase order ID"})
+		return
+	}
+
+	var req ReceivePurchaseOrderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 开始事务
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction: " + err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	// 锁定进货单，同一进货单的收货串行执行，累计收货数量和金额在Go中计算
+	var supplierID int
+	var status string
+	var receivedAmount decimal.Decimal
+	err = tx.QueryRow("SELECT supplier_id, status, received_amount FROM purchase_orders WHERE id = ?"+database.CurrentDialect().ForUpdate(), id).Scan(&supplierID, &status, &receivedAmount)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Purchase order not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch purchase order: " + err.Error()})
+		return
+	}
+	if status != purchaseStatusOrdered && status != purchaseStatusPartiallyReceived {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "只有已下单或部分收货的进货单可以收货"})
+		return
+	}
+
+	before, err := snapshotEntity(tx, auditPurchaseOrder, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch purchase order: " + err.Error()})
+		return
+	}
+
+	items, err := loadPurchaseOrderItems(tx, []int{id})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch purchase order items: " + err.Error()})
+		return
+	}
+	itemByID := make(map[int]PurchaseOrderItem, len(items[id]))
+	for _, item := range items[id] {
+		itemByID[item.ID] = item
+	}
+
+	result, err := tx.Exec(
+		"INSERT INTO purchase_receipts (purchase_order_id, supplier_id, receipt_date, amount, remark, user_id, username) VALUES (?, ?, ?, 0, ?, ?, ?)",
+		id, supplierID, req.ReceiptDate, req.Remark, c.GetInt(ctxUserIDKey), c.GetString(ctxUsernameKey),
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create purchase receipt: " + err.Error()})
+		return
+	}
+	receiptID, err := result.LastInsertId()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get last insert ID"})
+		return
+	}
+
+	var receiptAmount decimal.Decimal
+	for i, r := range req.Items {
+		item, ok := itemByID[r.ItemID]
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("第%d行商品不属于该进货单", i+1)})
+			return
+		}
+		quantity := roundQuantity(r.Quantity)
+
+		// 进货单已锁定，累计收货数量不会超过订货数量；同一商品分多行收货时按累计后的数量校验
+		received := roundQuantity(item.ReceivedQuantity.Add(quantity))
+		if received.GreaterThan(item.Quantity) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s 收货数量超过未收数量", item.ProductName)})
+			return
+		}
+		if _, err := tx.Exec("UPDATE purchase_order_items SET received_quantity = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?", received, item.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update received quantity: " + err.Error()})
+			return
+		}
+		item.ReceivedQuantity = received
+		itemByID[item.ID] = item
+
+		amount := roundAmount(quantity.Mul(item.Price))
+		receiptAmount = receiptAmount.Add(amount)
+		if _, err := tx.Exec(
+			"INSERT INTO purchase_receipt_items (receipt_id, purchase_order_item_id, product_id, quantity, price, amount) VALUES (?, ?, ?, ?, ?, ?)",
+			receiptID, item.ID, item.ProductID, quantity, item.Price, amount,
+		); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create purchase receipt item: " + err.Error()})
+			return
+		}
+
+		if err := applyStockMovement(tx, c, item.ProductID, quantity, movementPurchaseIn, "purchase_order", id, ""); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update stock: " + err.Error()})
+			return
+		}
+	}
+	receiptAmount = roundAmount(receiptAmount)
+
+	if _, err := tx.Exec("UPDATE purchase_receipts SET amount = ? WHERE id = ?", receiptAmount, receiptID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update purchase receipt: " + err.Error()})
+		return
+	}
+
+	// 全部商品收齐时为已收货，否则为部分收货
+	newStatus := purchaseStatusReceived
+	for _, item := range itemByID {
+		if item.ReceivedQuantity.LessThan(item.Quantity) {
+			newStatus = purchaseStatusPartiallyReceived
+			break
+		}
+	}
+	if _, err := tx.Exec(
+		"UPDATE purchase_orders SET status = ?, received_amount = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
+		newStatus, roundAmount(receivedAmount.Add(receiptAmount)), id,
+	); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update purchase order: " + err.Error()})
+		return
+	}
+	if err := recordAudit(tx, c, auditPurchaseOrder, id, auditActionUpdate, before); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write audit log: " + err.Error()})
+		return
+	}
+	// 同步该供应商对帐单的任务随收货一起提交
+	if err := enqueueSyncJob(tx, syncJobSupplierStatement, supplierID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to queue supplier statement sync: " + err.Error()})
+		return
+	}
+
+	// 提交事务
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction: " + err.Error()})
+		return
+	}
+	notifySyncWorkers()
+
+	po, err := fetchPurchaseOrder(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch purchase order: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, po)
+}
+
+// deletePurchaseOrder 删除进货单，已收货的进货单不能删除
+func deletePurchaseOrder(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid purchase order ID"})
+		return
+	}
+
+	// 开始事务
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction: " + err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	status, found, err := purchaseOrderStatus(tx, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch purchase order: " + err.Error()})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Purchase order not found"})
+		return
+	}
+	if status != purchaseStatusDraft && status != purchaseStatusOrdered {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "已收货的进货单不能删除"})
+		return
+	}
+
+	before, err := snapshotEntity(tx, auditPurchaseOrder, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch purchase order: " + err.Error()})
+		return
+	}
+
+	if _, err := tx.Exec("DELETE FROM purchase_order_items WHERE purchase_order_id = ?", id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete purchase order items: " + err.Error()})
+		return
+	}
+	if _, err := tx.Exec("DELETE FROM purchase_orders WHERE id = ?", id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete purchase order: " + err.Error()})
+		return
+	}
+	if err := recordAudit(tx, c, auditPurchaseOrder, id, auditActionDelete, before); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write audit log: " + err.Error()})
+		return
+	}
+
+	// 提交事务
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Purchase order deleted successfully"})
+}
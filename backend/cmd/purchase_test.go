@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+
+	"nb2/pkg/database"
+)
+
+// TestReceivePurchaseOrderExactOnSQLite 多次收货累计的数量、金额和库存精确到分，
+// 0.1 + 0.2 + 0.3 恰好收齐 0.6，不会因浮点误差被判为超收
+func TestReceivePurchaseOrderExactOnSQLite(t *testing.T) {
+	openTestDB(t)
+	supplierID := mustExec(t, "INSERT INTO suppliers (code, name) VALUES (?, ?)", "S00001", "宁波某某液压")
+	productID := mustExec(t, "INSERT INTO products (name, code, unit, price) VALUES (?, ?, ?, ?)", "液压油管 DN10", "P00001", "米", "12.50")
+
+	w := callHandler(t, createPurchaseOrder, http.MethodPost, PurchaseOrderRequest{
+		OrderDate: "2026-03-01", SupplierID: supplierID, Status: purchaseStatusOrdered,
+		Items: []PurchaseOrderItemRequest{{ProductID: productID, Quantity: decimal.RequireFromString("0.6"), Price: decimal.RequireFromString("1.10")}},
+	})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("createPurchaseOrder: %d %s", w.Code, w.Body.String())
+	}
+	var po PurchaseOrder
+	if err := json.Unmarshal(w.Body.Bytes(), &po); err != nil {
+		t.Fatal(err)
+	}
+	itemID := po.Items[0].ID
+	orderParam := gin.Param{Key: "id", Value: strconv.Itoa(po.ID)}
+
+	receive := func(quantities ...string) *PurchaseOrder {
+		t.Helper()
+		req := ReceivePurchaseOrderRequest{ReceiptDate: "2026-03-05"}
+		for _, q := range quantities {
+			req.Items = append(req.Items, ReceivePurchaseItemRequest{ItemID: itemID, Quantity: decimal.RequireFromString(q)})
+		}
+		w := callHandler(t, receivePurchaseOrder, http.MethodPost, req, orderParam)
+		if w.Code != http.StatusOK {
+			return nil
+		}
+		var po PurchaseOrder
+		if err := json.Unmarshal(w.Body.Bytes(), &po); err != nil {
+			t.Fatal(err)
+		}
+		return &po
+	}
+
+	if got := receive("0.1", "0.2"); got == nil || got.Status != purchaseStatusPartiallyReceived ||
+		!got.Items[0].ReceivedQuantity.Equal(decimal.RequireFromString("0.3")) || !got.ReceivedAmount.Equal(decimal.RequireFromString("0.33")) {
+		t.Fatalf("after receiving 0.1 + 0.2: %+v", got)
+	}
+	if got := receive("0.31"); got != nil {
+		t.Fatalf("receiving more than ordered succeeded: %+v", got)
+	}
+	got := receive("0.3")
+	if got == nil || got.Status != purchaseStatusReceived {
+		t.Fatalf("receiving the remaining 0.3: %+v", got)
+	}
+	if !got.Items[0].ReceivedQuantity.Equal(decimal.RequireFromString("0.6")) || !got.ReceivedAmount.Equal(decimal.RequireFromString("0.66")) {
+		t.Fatalf("received quantity = %s, amount = %s, want 0.6 and 0.66", got.Items[0].ReceivedQuantity, got.ReceivedAmount)
+	}
+
+	var stock decimal.Decimal
+	if err := database.DB.QueryRow("SELECT stock_quantity FROM products WHERE id = ?", productID).Scan(&stock); err != nil {
+		t.Fatal(err)
+	}
+	if !stock.Equal(decimal.RequireFromString("0.6")) {
+		t.Fatalf("stock = %s, want 0.6", stock)
+	}
+}
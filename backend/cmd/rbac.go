@@ -0,0 +1,873 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+
+	"nb2/pkg/database"
+)
+
+// ========== 角色和权限相关模型 ==========
+
+// Permission 权限定义，编码格式为“资源:操作”
+type Permission struct {
+	Code  string `json:"code"`
+	Name  string `json:"name"`
+	Group string `json:"group"`
+}
+
+// Role 角色模型
+type Role struct {
+	ID          int      `json:"id"`
+	Code        string   `json:"code"`
+	Name        string   `json:"name"`
+	Remark      string   `json:"remark"`
+	Permissions []string `json:"permissions"`
+	CreatedAt   string   `json:"createdAt"`
+	UpdatedAt   string   `json:"updatedAt"`
+}
+
+// RoleRequest 创建/更新角色请求
+type RoleRequest struct {
+	Code        string   `json:"code"`
+	Name        string   `json:"name"`
+	Remark      string   `json:"remark"`
+	Permissions []string `json:"permissions"`
+}
+
+// UserWithRoles 带角色信息的用户
+type UserWithRoles struct {
+	User
+	Roles []Role `json:"roles"`
+}
+
+// UserRequest 创建/更新用户请求
+type UserRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Name     string `json:"name"`
+	Status   *int   `json:"status"`
+	RoleIDs  []int  `json:"roleIds"`
+}
+
+// UserRolesRequest 分配用户角色请求
+type UserRolesRequest struct {
+	RoleIDs []int `json:"roleIds"`
+}
+
+// permissionAll 拥有全部权限
+const permissionAll = "*"
+
+// permissionCatalog 系统内置的全部权限，路由注册时使用的权限编码必须在此列出
+var permissionCatalog = []Permission{
+	{"product:read", "查看产品", "产品"},
+	{"product:create", "新增产品", "产品"},
+	{"product:update", "编辑产品", "产品"},
+	{"product:delete", "删除产品", "产品"},
+	{"dictionary:read", "查看字典", "字典"},
+	{"dictionary:create", "新增字典", "字典"},
+	{"dictionary:update", "编辑字典", "字典"},
+	{"dictionary:delete", "删除字典", "字典"},
+	{"settings:read", "查看系统设置", "系统设置"},
+	{"settings:update", "修改系统设置", "系统设置"},
+	{"customer:read", "查看客户", "客户"},
+	{"customer:create", "新增客户", "客户"},
+	{"customer:update", "编辑客户", "客户"},
+	{"customer:delete", "删除客户", "客户"},
+	{"invoice:create", "新增开票信息", "开票信息"},
+	{"invoice:update", "编辑开票信息", "开票信息"},
+	{"invoice:delete", "删除开票信息", "开票信息"},
+	{"payment:read", "查看收款", "收款"},
+	{"payment:create", "新增收款", "收款"},
+	{"payment:update", "编辑收款", "收款"},
+	{"payment:delete", "删除收款", "收款"},
+	{"sale_order:read", "查看销售单", "销售单"},
+	{"sale_order:create", "新增销售单", "销售单"},
+	{"sale_order:update", "编辑销售单", "销售单"},
+	{"sale_order:delete", "删除销售单", "销售单"},
+	{"sale_order:close", "关闭/重新打开销售单", "销售单"},
+	{"inventory:read", "查看库存", "库存"},
+	{"inventory:adjust", "调整库存", "库存"},
+	{"supplier:read", "查看供应商", "供应商"},
+	{"supplier:create", "新增供应商", "供应商"},
+	{"supplier:update", "编辑供应商", "供应商"},
+	{"supplier:delete", "删除供应商", "供应商"},
+	{"purchase_order:read", "查看进货单", "进货单"},
+	{"purchase_order:create", "新增进货单", "进货单"},
+	{"purchase_order:update", "编辑进货单", "进货单"},
+	{"purchase_order:delete", "删除进货单", "进货单"},
+	{"purchase_order:receive", "进货收货", "进货单"},
+	{"supplier_payment:read", "查看供应商付款", "供应商付款"},
+	{"supplier_payment:create", "新增供应商付款", "供应商付款"},
+	{"supplier_payment:update", "编辑供应商付款", "供应商付款"},
+	{"supplier_payment:delete", "删除供应商付款", "供应商付款"},
+	{"supplier_statement:read", "查看供应商对帐单", "供应商对帐单"},
+	{"supplier_statement:sync", "同步供应商对帐单", "供应商对帐单"},
+	{"statement:read", "查看对账单", "对账单"},
+	{"statement:sync", "同步对账单", "对账单"},
+	{"sync_job:read", "查看同步任务", "同步任务"},
+	{"sync_job:retry", "重试同步任务", "同步任务"},
+	{"user:manage", "管理用户", "用户与权限"},
+	{"role:manage", "管理角色", "用户与权限"},
+	{"audit_log:read", "查看操作日志", "用户与权限"},
+}
+
+// knownPermissions 权限编码集合，用于校验
+var knownPermissions = func() map[string]bool {
+	m := map[string]bool{permissionAll: true}
+	for _, p := range permissionCatalog {
+		m[p.Code] = true
+	}
+	return m
+}()
+
+// requirePermission 权限校验中间件，必须挂在authMiddleware之后
+func requirePermission(permission string) gin.HandlerFunc {
+	if !knownPermissions[permission] {
+		log.Fatalf("unknown permission %q used in route registration", permission)
+	}
+	return func(c *gin.Context) {
+		allowed, err := userHasPermission(c.GetInt(ctxUserIDKey), permission)
+		if err != nil {
+			log.Printf("查询用户权限失败：%v\n", err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permission"})
+			return
+		}
+		if !allowed {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Forbidden", "permission": permission})
+			return
+		}
+		c.Next()
+	}
+}
+
+// userHasPermission 判断用户是否拥有指定权限
+func userHasPermission(userID int, permission string) (bool, error) {
+	var allowed bool
+	err := database.DB.QueryRow(`
+		SELECT EXISTS(
+			SELECT 1 FROM user_roles ur
+			JOIN role_permissions rp ON rp.role_id = ur.role_id
+			WHERE ur.user_id = ? AND (rp.permission = ? OR rp.permission = ?)
+		)`, userID, permission, permissionAll).Scan(&allowed)
+	return allowed, err
+}
+
+// getUserPermissions 获取用户拥有的全部权限编码
+func getUserPermissions(userID int) ([]string, error) {
+	rows, err := database.DB.Query(`
+		SELECT DISTINCT rp.permission FROM user_roles ur
+		JOIN role_permissions rp ON rp.role_id = ur.role_id
+		WHERE ur.user_id = ?
+		ORDER BY rp.permission`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	permissions := []string{}
+	for rows.Next() {
+		var p string
+		if err := rows.Scan(&p); err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, p)
+	}
+	return permissions, rows.Err()
+}
+
+// getPermissions 获取权限列表
+func getPermissions(c *gin.Context) {
+	c.JSON(http.StatusOK, permissionCatalog)
+}
+
+// ========== 角色管理 ==========
+
+// loadRolePermissions 为角色列表填充权限编码
+func loadRolePermissions(roles []Role) error {
+	if len(roles) == 0 {
+		return nil
+	}
+	index := make(map[int]int, len(roles))
+	for i := range roles {
+		roles[i].Permissions = []string{}
+		index[roles[i].ID] = i
+	}
+
+	rows, err := database.DB.Query("SELECT role_id, permission FROM role_permissions ORDER BY permission")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var roleID int
+		var permission string
+		if err := rows.Scan(&roleID, &permission); err != nil {
+			return err
+		}
+		if i, ok := index[roleID]; ok {
+			roles[i].Permissions = append(roles[i].Permissions, permission)
+		}
+	}
+	return rows.Err()
+}
+
+// getRoles 获取角色列表
+func getRoles(c *gin.Context) {
+	rows, err := database.DB.Query("SELECT id, code, name, COALESCE(remark, ''), created_at, updated_at FROM roles ORDER BY id")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch roles"})
+		return
+	}
+	defer rows.Close()
+
+	roles := []Role{}
+	for rows.Next() {
+		var r Role
+		if err := rows.Scan(&r.ID, &r.Code, &r.Name, &r.Remark, &r.CreatedAt, &r.UpdatedAt); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan role"})
+			return
+		}
+		roles = append(roles, r)
+	}
+
+	if err := loadRolePermissions(roles); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch role permissions"})
+		return
+	}
+	c.JSON(http.StatusOK, roles)
+}
+
+// validatePermissions 校验权限编码是否都已定义
+func validatePermissions(permissions []string) (string, bool) {
+	for _, p := range permissions {
+		if !knownPermissions[p] {
+			return p, false
+		}
+	}
+	return "", true
+}
+
+// saveRolePermissions 在事务中覆盖角色的权限
+func saveRolePermissions(tx *sql.Tx, roleID int, permissions []string) error {
+	if _, err := tx.Exec("DELETE FROM role_permissions WHERE role_id = ?", roleID); err != nil {
+		return err
+	}
+	seen := make(map[string]bool, len(permissions))
+	for _, p := range permissions {
+		if seen[p] {
+			continue
+		}
+		seen[p] = true
+		if _, err := tx.Exec("INSERT INTO role_permissions (role_id, permission) VALUES (?, ?)", roleID, p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createRole 创建角色
+func createRole(c *gin.Context) {
+	var req RoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Code == "" || req.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Role code and name are required"})
+		return
+	}
+	if p, ok := validatePermissions(req.Permissions); !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown permission: " + p})
+		return
+	}
+
+	var exists bool
+	if err := database.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM roles WHERE code = ?)", req.Code).Scan(&exists); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check role code"})
+		return
+	}
+	if exists {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Role code already exists"})
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("INSERT INTO roles (code, name, remark) VALUES (?, ?, ?)", req.Code, req.Name, req.Remark)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create role"})
+		return
+	}
+	id, _ := result.LastInsertId()
+
+	if err := saveRolePermissions(tx, int(id), req.Permissions); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save role permissions"})
+		return
+	}
+	if err := recordAudit(tx, c, auditRole, id, auditActionCreate, nil); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write audit log"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"id": id, "message": "Role created successfully"})
+}
+
+// updateRole 更新角色，permissions 不为nil时覆盖角色的全部权限
+func updateRole(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role ID"})
+		return
+	}
+
+	var req RoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if p, ok := validatePermissions(req.Permissions); !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown permission: " + p})
+		return
+	}
+
+	var code string
+	if err := database.DB.QueryRow("SELECT code FROM roles WHERE id = ?", id).Scan(&code); err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Role not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch role"})
+		return
+	}
+	// 内置管理员角色的编码和权限不允许修改，避免系统失去管理入口
+	if code == "admin" && ((req.Code != "" && req.Code != code) || req.Permissions != nil) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot modify code or permissions of the admin role"})
+		return
+	}
+
+	if req.Code != "" && req.Code != code {
+		var exists bool
+		if err := database.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM roles WHERE code = ? AND id != ?)", req.Code, id).Scan(&exists); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check role code"})
+			return
+		}
+		if exists {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Role code already exists"})
+			return
+		}
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	before, err := snapshotEntity(tx, auditRole, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch role"})
+		return
+	}
+
+	query := "UPDATE roles SET updated_at = CURRENT_TIMESTAMP"
+	args := []interface{}{}
+	if req.Code != "" {
+		query += ", code = ?"
+		args = append(args, req.Code)
+	}
+	if req.Name != "" {
+		query += ", name = ?"
+		args = append(args, req.Name)
+	}
+	if req.Remark != "" {
+		query += ", remark = ?"
+		args = append(args, req.Remark)
+	}
+	query += " WHERE id = ?"
+	args = append(args, id)
+
+	if _, err := tx.Exec(query, args...); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update role"})
+		return
+	}
+	if req.Permissions != nil {
+		if err := saveRolePermissions(tx, id, req.Permissions); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save role permissions"})
+			return
+		}
+	}
+	if err := recordAudit(tx, c, auditRole, id, auditActionUpdate, before); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write audit log"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Role updated successfully"})
+}
+
+// deleteRole 删除角色，已分配给用户的角色不能删除
+func deleteRole(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role ID"})
+		return
+	}
+
+	var code string
+	if err := database.DB.QueryRow("SELECT code FROM roles WHERE id = ?", id).Scan(&code); err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Role not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch role"})
+		return
+	}
+	if code == "admin" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot delete the admin role"})
+		return
+	}
+
+	var inUse bool
+	if err := database.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM user_roles WHERE role_id = ?)", id).Scan(&inUse); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check role usage"})
+		return
+	}
+	if inUse {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot delete role assigned to users"})
+		return
+	}
+
+	// 开始事务，操作日志与数据一起提交
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction: " + err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	before, err := snapshotEntity(tx, auditRole, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch role"})
+		return
+	}
+	if _, err := tx.Exec("DELETE FROM roles WHERE id = ?", id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete role"})
+		return
+	}
+	if err := recordAudit(tx, c, auditRole, id, auditActionDelete, before); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write audit log: " + err.Error()})
+		return
+	}
+
+	// 提交事务
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Role deleted successfully"})
+}
+
+// ========== 用户管理 ==========
+
+// getUserRoles 获取用户的角色（不含权限明细）
+func getUserRoles(userID int) ([]Role, error) {
+	rows, err := database.DB.Query(`
+		SELECT r.id, r.code, r.name, COALESCE(r.remark, ''), r.created_at, r.updated_at
+		FROM user_roles ur JOIN roles r ON ur.role_id = r.id
+		WHERE ur.user_id = ?
+		ORDER BY r.id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := []Role{}
+	for rows.Next() {
+		var r Role
+		if err := rows.Scan(&r.ID, &r.Code, &r.Name, &r.Remark, &r.CreatedAt, &r.UpdatedAt); err != nil {
+			return nil, err
+		}
+		roles = append(roles, r)
+	}
+	return roles, rows.Err()
+}
+
+// getUsers 获取用户列表
+func getUsers(c *gin.Context) {
+	rows, err := database.DB.Query("SELECT id, username, COALESCE(name, ''), status, COALESCE(last_login_at, ''), created_at, updated_at FROM users ORDER BY id")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch users"})
+		return
+	}
+	defer rows.Close()
+
+	users := []UserWithRoles{}
+	for rows.Next() {
+		var u UserWithRoles
+		if err := rows.Scan(&u.ID, &u.Username, &u.Name, &u.Status, &u.LastLoginAt, &u.CreatedAt, &u.UpdatedAt); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan user"})
+			return
+		}
+		users = append(users, u)
+	}
+	rows.Close()
+
+	for i := range users {
+		roles, err := getUserRoles(users[i].ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user roles"})
+			return
+		}
+		users[i].Roles = roles
+	}
+	c.JSON(http.StatusOK, users)
+}
+
+// saveUserRoles 在事务中覆盖用户的角色
+func saveUserRoles(tx *sql.Tx, userID int, roleIDs []int) error {
+	if _, err := tx.Exec("DELETE FROM user_roles WHERE user_id = ?", userID); err != nil {
+		return err
+	}
+	seen := make(map[int]bool, len(roleIDs))
+	for _, roleID := range roleIDs {
+		if seen[roleID] {
+			continue
+		}
+		seen[roleID] = true
+		if _, err := tx.Exec("INSERT INTO user_roles (user_id, role_id) VALUES (?, ?)", userID, roleID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateRoleIDs 校验角色ID是否都存在
+func validateRoleIDs(roleIDs []int) (int, bool, error) {
+	for _, roleID := range roleIDs {
+		var exists bool
+		if err := database.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM roles WHERE id = ?)", roleID).Scan(&exists); err != nil {
+			return 0, false, err
+		}
+		if !exists {
+			return roleID, false, nil
+		}
+	}
+	return 0, true, nil
+}
+
+// countOtherAdmins 统计除指定用户外仍可登录的管理员数量
+func countOtherAdmins(userID int) (int, error) {
+	var count int
+	err := database.DB.QueryRow(`
+		SELECT COUNT(DISTINCT u.id) FROM users u
+		JOIN user_roles ur ON ur.user_id = u.id
+		JOIN roles r ON ur.role_id = r.id
+		WHERE r.code = 'admin' AND u.status = 1 AND u.id != ?`, userID).Scan(&count)
+	return count, err
+}
+
+// createUser 创建用户
+func createUser(c *gin.Context) {
+	var req UserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Username == "" || req.Password == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Username and password are required"})
+		return
+	}
+	if roleID, ok, err := validateRoleIDs(req.RoleIDs); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check roles"})
+		return
+	} else if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Role not found: " + strconv.Itoa(roleID)})
+		return
+	}
+
+	var exists bool
+	if err := database.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE username = ?)", req.Username).Scan(&exists); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check username"})
+		return
+	}
+	if exists {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Username already exists"})
+		return
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+		return
+	}
+	status := 1
+	if req.Status != nil {
+		status = *req.Status
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(
+		"INSERT INTO users (username, password_hash, name, status) VALUES (?, ?, ?, ?)",
+		req.Username, string(hash), req.Name, status,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
+		return
+	}
+	id, _ := result.LastInsertId()
+
+	if err := saveUserRoles(tx, int(id), req.RoleIDs); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save user roles"})
+		return
+	}
+	if err := recordAudit(tx, c, auditUser, id, auditActionCreate, nil); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write audit log"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"id": id, "message": "User created successfully"})
+}
+
+// updateUser 更新用户信息，修改密码或禁用用户时使其全部登录会话失效
+func updateUser(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var req UserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var exists bool
+	if err := database.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE id = ?)", id).Scan(&exists); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check user"})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if req.Status != nil && *req.Status != 1 {
+		if id == c.GetInt(ctxUserIDKey) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot disable yourself"})
+			return
+		}
+		count, err := countOtherAdmins(id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check admin users"})
+			return
+		}
+		isAdmin, err := userHasRole(id, "admin")
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check user roles"})
+			return
+		}
+		if isAdmin && count == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot disable the last admin user"})
+			return
+		}
+	}
+
+	if req.Username != "" {
+		var taken bool
+		if err := database.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE username = ? AND id != ?)", req.Username, id).Scan(&taken); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check username"})
+			return
+		}
+		if taken {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Username already exists"})
+			return
+		}
+	}
+
+	query := "UPDATE users SET updated_at = CURRENT_TIMESTAMP"
+	args := []interface{}{}
+	if req.Username != "" {
+		query += ", username = ?"
+		args = append(args, req.Username)
+	}
+	if req.Name != "" {
+		query += ", name = ?"
+		args = append(args, req.Name)
+	}
+	if req.Status != nil {
+		query += ", status = ?"
+		args = append(args, *req.Status)
+	}
+	if req.Password != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+			return
+		}
+		query += ", password_hash = ?"
+		args = append(args, string(hash))
+	}
+	query += " WHERE id = ?"
+	args = append(args, id)
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	before, err := snapshotEntity(tx, auditUser, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user"})
+		return
+	}
+	if _, err := tx.Exec(query, args...); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
+		return
+	}
+	if req.Password != "" || (req.Status != nil && *req.Status != 1) {
+		if _, err := tx.Exec("DELETE FROM user_sessions WHERE user_id = ?", id); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke sessions"})
+			return
+		}
+	}
+	if err := recordAudit(tx, c, auditUser, id, auditActionUpdate, before); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write audit log"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "User updated successfully"})
+}
+
+// userHasRole 判断用户是否拥有指定编码的角色
+func userHasRole(userID int, roleCode string) (bool, error) {
+	var has bool
+	err := database.DB.QueryRow(
+		"SELECT EXISTS(SELECT 1 FROM user_roles ur JOIN roles r ON ur.role_id = r.id WHERE ur.user_id = ? AND r.code = ?)",
+		userID, roleCode,
+	).Scan(&has)
+	return has, err
+}
+
+// updateUserRoles 覆盖分配用户的角色
+func updateUserRoles(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var req UserRolesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var exists bool
+	if err := database.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE id = ?)", id).Scan(&exists); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check user"})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if roleID, ok, err := validateRoleIDs(req.RoleIDs); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check roles"})
+		return
+	} else if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Role not found: " + strconv.Itoa(roleID)})
+		return
+	}
+
+	// 移除管理员角色前确认系统中仍有其他管理员
+	isAdmin, err := userHasRole(id, "admin")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check user roles"})
+		return
+	}
+	if isAdmin {
+		keepsAdmin := false
+		for _, roleID := range req.RoleIDs {
+			var code string
+			if err := database.DB.QueryRow("SELECT code FROM roles WHERE id = ?", roleID).Scan(&code); err == nil && code == "admin" {
+				keepsAdmin = true
+				break
+			}
+		}
+		if !keepsAdmin {
+			count, err := countOtherAdmins(id)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check admin users"})
+				return
+			}
+			if count == 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot remove the admin role from the last admin user"})
+				return
+			}
+		}
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	before, err := snapshotEntity(tx, auditUser, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user"})
+		return
+	}
+	if err := saveUserRoles(tx, id, req.RoleIDs); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save user roles"})
+		return
+	}
+	if err := recordAudit(tx, c, auditUser, id, auditActionUpdate, before); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write audit log"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "User roles updated successfully"})
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+)
+
+// fieldErrors 字段级校验错误，键为请求中的字段路径（如 items[0].totalAmount），值为错误说明
+type fieldErrors map[string]string
+
+// add 记录第 index 行商品某个字段的错误，同一字段只保留第一条
+func (e fieldErrors) add(index int, field, format string, args ...interface{}) {
+	key := fmt.Sprintf("items[%d].%s", index, field)
+	if _, ok := e[key]; !ok {
+		e[key] = fmt.Sprintf(format, args...)
+	}
+}
+
+// respondFieldErrors 返回 400 和字段级错误
+func respondFieldErrors(c *gin.Context, errs fieldErrors) {
+	c.JSON(http.StatusBadRequest, gin.H{"error": "商品明细校验失败", "fields": errs})
+}
+
+// saleOrderProduct 校验销售订单商品时用到的产品资料
+type saleOrderProduct struct {
+	Code   string
+	Name   string
+	Status int
+}
+
+// saleOrderLine 修改订单前已保存的商品行
+type saleOrderLine struct {
+	ProductID   int
+	ProductCode string
+	ProductName string
+}
+
+// maxQuantityDetailLength 数量明细的最大长度，与 sale_order_items.quantity_detail 列一致
+const maxQuantityDetailLength = 100
+
+// quantityDetailNumber 数量明细中的单个数值：正数，最多两位小数
+var quantityDetailNumber = regexp.MustCompile(`^\d+(\.\d{1,2})?$`)
+
+// parseQuantityDetail 解析数量明细（如 "12.5+13 14.2"），数值之间用加号或空白分隔
+// 返回数量合计和规范化后的明细（统一用加号连接）
+func parseQuantityDetail(detail string) (decimal.Decimal, string, error) {
+	// 兼容中文输入法的全角加号
+	detail = strings.TrimSpace(strings.ReplaceAll(detail, "＋", "+"))
+	if detail == "" {
+		return decimal.Zero, "", fmt.Errorf("数量明细不能为空")
+	}
+
+	var numbers []string
+	for _, part := range strings.Split(detail, "+") {
+		fields := strings.FieldsFunc(part, unicode.IsSpace)
+		if len(fields) == 0 {
+			return decimal.Zero, "", fmt.Errorf("数量明细「%s」格式错误：加号前后必须是数值", detail)
+		}
+		numbers = append(numbers, fields...)
+	}
+
+	var total decimal.Decimal
+	for _, n := range numbers {
+		if !quantityDetailNumber.MatchString(n) {
+			return decimal.Zero, "", fmt.Errorf("数量明细中的「%s」不是有效数值，只能填写最多两位小数的正数", n)
+		}
+		v, err := decimal.NewFromString(n)
+		if err != nil || !v.IsPositive() {
+			return decimal.Zero, "", fmt.Errorf("数量明细中的「%s」必须大于0", n)
+		}
+		total = total.Add(v)
+	}
+
+	normalized := strings.Join(numbers, "+")
+	if len([]rune(normalized)) > maxQuantityDetailLength {
+		return decimal.Zero, "", fmt.Errorf("数量明细不能超过%d个字符", maxQuantityDetailLength)
+	}
+	return total, normalized, nil
+}
+
+// saleOrderLineTotal 商品小计 = 数量 × 单价 − 优惠金额，保留两位小数
+func saleOrderLineTotal(quantity, price, discount decimal.Decimal) decimal.Decimal {
+	return roundAmount(quantity.Mul(price).Sub(discount))
+}
+
+// loadSaleOrderProducts 批量读取产品资料
+func loadSaleOrderProducts(q dbExecutor, productIDs []int) (map[int]saleOrderProduct, error) {
+	products := make(map[int]saleOrderProduct, len(productIDs))
+	if len(productIDs) == 0 {
+		return products, nil
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(productIDs)), ",")
+	args := make([]interface{}, len(productIDs))
+	for i, id := range productIDs {
+		args[i] = id
+	}
+
+	rows, err := q.Query("SELECT id, COALESCE(code, ''), name, COALESCE(status, 1) FROM products WHERE id IN ("+placeholders+")", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int
+		var p saleOrderProduct
+		if err := rows.Scan(&id, &p.Code, &p.Name, &p.Status); err != nil {
+			return nil, err
+		}
+		products[id] = p
+	}
+	return products, rows.Err()
+}
+
+// loadSaleOrderLines 读取订单已保存的商品行
+func loadSaleOrderLines(q dbExecutor, saleOrderID int) (map[int]saleOrderLine, error) {
+	rows, err := q.Query("SELECT id, product_id, product_code, product_name FROM sale_order_items WHERE sale_order_id = ?", saleOrderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lines := make(map[int]saleOrderLine)
+	for rows.Next() {
+		var id int
+		var l saleOrderLine
+		if err := rows.Scan(&id, &l.ProductID, &l.ProductCode, &l.ProductName); err != nil {
+			return nil, err
+		}
+		lines[id] = l
+	}
+	return lines, rows.Err()
+}
+
+// buildSaleOrderItems 按产品资料校验商品明细，并由服务端计算每行小计和商品总价
+// 产品必须存在且为启用状态，编号和名称必须与产品资料一致；前端提交的小计与服务端计算结果不一致时拒绝
+// existing 为修改前已保存的商品行，未改动产品的原有行沿用下单时的产品信息，不受之后产品改名、停用或删除的影响
+// 件数和数量明细只用于油管批发订单，填写了数量明细时数量由明细合计得出
+func buildSaleOrderItems(q dbExecutor, orderType string, reqItems []UpdateSaleOrderItemRequest, existing map[int]saleOrderLine) ([]SaleOrderItem, decimal.Decimal, fieldErrors, error) {
+	productIDs := make([]int, 0, len(reqItems))
+	for _, r := range reqItems {
+		productIDs = append(productIDs, r.ProductID)
+	}
+	products, err := loadSaleOrderProducts(q, productIDs)
+	if err != nil {
+		return nil, decimal.Zero, nil, err
+	}
+
+	errs := fieldErrors{}
+	items := make([]SaleOrderItem, 0, len(reqItems))
+	var total decimal.Decimal
+	for i, r := range reqItems {
+		item := SaleOrderItem{
+			ProductID:      r.ProductID,
+			ProductCode:    strings.TrimSpace(r.ProductCode),
+			ProductName:    strings.TrimSpace(r.ProductName),
+			Quantity:       roundQuantity(r.Quantity),
+			PieceCount:     r.PieceCount,
+			Unit:           r.Unit,
+			Price:          roundAmount(r.Price),
+			DiscountAmount: roundAmount(r.DiscountAmount),
+			Remark:         r.Remark,
+		}
+
+		line, kept := existing[r.ID]
+		kept = kept && line.ProductID == item.ProductID && line.ProductCode == item.ProductCode && line.ProductName == item.ProductName
+		if !kept {
+			product, ok := products[item.ProductID]
+			switch {
+			case !ok:
+				errs.add(i, "productId", "产品不存在或已删除")
+			case product.Status != 1:
+				errs.add(i, "productId", "产品「%s」已停用", product.Name)
+			default:
+				if item.ProductCode != product.Code {
+					errs.add(i, "productCode", "产品编号与产品资料不一致，应为 %s", product.Code)
+				}
+				if item.ProductName != product.Name {
+					errs.add(i, "productName", "产品名称与产品资料不一致，应为 %s", product.Name)
+				}
+			}
+		}
+
+		detailInvalid := false
+		if orderType == orderTypeWholesale {
+			if item.PieceCount < 0 {
+				errs.add(i, "pieceCount", "件数不能为负数")
+			}
+			if strings.TrimSpace(r.QuantityDetail) != "" {
+				quantity, detail, err := parseQuantityDetail(r.QuantityDetail)
+				if err != nil {
+					errs.add(i, "quantityDetail", "%s", err.Error())
+					detailInvalid = true
+				} else if !r.Quantity.IsZero() && !item.Quantity.Equal(quantity) {
+					errs.add(i, "quantity", "数量应为数量明细的合计 %s", quantity.StringFixed(moneyScale))
+				} else {
+					item.Quantity = quantity
+					item.QuantityDetail = detail
+				}
+			}
+		} else {
+			if item.PieceCount != 0 {
+				errs.add(i, "pieceCount", "只有%s订单可以填写件数", orderTypeWholesale)
+			}
+			if strings.TrimSpace(r.QuantityDetail) != "" {
+				errs.add(i, "quantityDetail", "只有%s订单可以填写数量明细", orderTypeWholesale)
+			}
+		}
+
+		if !detailInvalid && !item.Quantity.IsPositive() {
+			errs.add(i, "quantity", "数量必须大于0")
+		}
+		if !item.Price.IsPositive() {
+			errs.add(i, "price", "单价必须大于0")
+		}
+		if item.DiscountAmount.IsNegative() {
+			errs.add(i, "discountAmount", "优惠金额不能为负数")
+		}
+
+		item.TotalAmount = saleOrderLineTotal(item.Quantity, item.Price, item.DiscountAmount)
+		if item.TotalAmount.IsNegative() {
+			errs.add(i, "discountAmount", "优惠金额不能超过商品金额")
+		} else if r.TotalAmount != nil && !roundAmount(*r.TotalAmount).Equal(item.TotalAmount) {
+			errs.add(i, "totalAmount", "小计应为 %s（数量 × 单价 − 优惠金额）", item.TotalAmount.StringFixed(moneyScale))
+		}
+
+		total = total.Add(item.TotalAmount)
+		items = append(items, item)
+	}
+	if len(errs) > 0 {
+		return nil, decimal.Zero, errs, nil
+	}
+	return items, roundAmount(total), nil, nil
+}
+
+// loadSaleOrderItems 批量读取多个销售订单的商品，按订单ID分组
+// 列表页只需一次查询即可取出整页订单的商品，查询次数不随订单数量增长
+func loadSaleOrderItems(q dbExecutor, orderIDs []int) (map[int][]SaleOrderItem, error) {
+	result := make(map[int][]SaleOrderItem, len(orderIDs))
+	if len(orderIDs) == 0 {
+		return result, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(orderIDs)), ",")
+	args := make([]interface{}, len(orderIDs))
+	for i, id := range orderIDs {
+		args[i] = id
+	}
+
+	rows, err := q.Query("SELECT id, sale_order_id, product_id, product_code, product_name, quantity, piece_count, quantity_detail, unit, price, discount_amount, total, COALESCE(remark, '') FROM sale_order_items WHERE sale_order_id IN ("+placeholders+") ORDER BY id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item SaleOrderItem
+		if err := rows.Scan(&item.ID, &item.SaleOrderID, &item.ProductID, &item.ProductCode, &item.ProductName, &item.Quantity, &item.PieceCount, &item.QuantityDetail, &item.Unit, &item.Price, &item.DiscountAmount, &item.TotalAmount, &item.Remark); err != nil {
+			return nil, err
+		}
+		result[item.SaleOrderID] = append(result[item.SaleOrderID], item)
+	}
+	return result, rows.Err()
+}
+
+// insertSaleOrderItems 在事务中写入销售订单商品
+func insertSaleOrderItems(q dbExecutor, saleOrderID int64, items []SaleOrderItem) error {
+	for _, item := range items {
+		_, err := q.Exec(
+			"INSERT INTO sale_order_items (sale_order_id, product_id, product_code, product_name, quantity, piece_count, quantity_detail, unit, price, discount_amount, total, remark) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+			saleOrderID, item.ProductID, item.ProductCode, item.ProductName, item.Quantity, item.PieceCount, item.QuantityDetail, item.Unit, item.Price, item.DiscountAmount, item.TotalAmount, item.Remark,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
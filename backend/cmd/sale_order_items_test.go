@@ -0,0 +1,71 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseQuantityDetail(t *testing.T) {
+	tests := []struct {
+		detail     string
+		total      string
+		normalized string
+		wantErr    bool
+	}{
+		{detail: "12.5+13 14.2", total: "39.7", normalized: "12.5+13+14.2"},
+		{detail: "3", total: "3", normalized: "3"},
+		{detail: "  3  ", total: "3", normalized: "3"},
+		{detail: "1＋2", total: "3", normalized: "1+2"},
+		{detail: "1 + 2", total: "3", normalized: "1+2"},
+		{detail: "1.5\t2\n0.25", total: "3.75", normalized: "1.5+2+0.25"},
+		{detail: "1\u30002", total: "3", normalized: "1+2"},
+		{detail: "0.01", total: "0.01", normalized: "0.01"},
+		{detail: "", wantErr: true},
+		{detail: "   ", wantErr: true},
+		{detail: "1++2", wantErr: true},
+		{detail: "+1", wantErr: true},
+		{detail: "1+", wantErr: true},
+		{detail: "1+ +2", wantErr: true},
+		{detail: "＋", wantErr: true},
+		{detail: "1＋＋2", wantErr: true},
+		{detail: "1,2", wantErr: true},
+		{detail: "1，2", wantErr: true},
+		{detail: "1、2", wantErr: true},
+		{detail: "1；2", wantErr: true},
+		{detail: "１＋２", wantErr: true},
+		{detail: "1．5", wantErr: true},
+		{detail: "1*2", wantErr: true},
+		{detail: "abc", wantErr: true},
+		{detail: "1+abc", wantErr: true},
+		{detail: "1e2", wantErr: true},
+		{detail: "0x10", wantErr: true},
+		{detail: "NaN", wantErr: true},
+		{detail: "1.234", wantErr: true},
+		{detail: ".5", wantErr: true},
+		{detail: "1.", wantErr: true},
+		{detail: "0", wantErr: true},
+		{detail: "0.00", wantErr: true},
+		{detail: "-1", wantErr: true},
+		{detail: "1+-1", wantErr: true},
+		{detail: "-1.5+2", wantErr: true},
+		{detail: "1 -2", wantErr: true},
+		{detail: "－1", wantErr: true},
+		{detail: strings.TrimSuffix(strings.Repeat("1+", 51), "+"), wantErr: true},
+	}
+	for _, tt := range tests {
+		total, normalized, err := parseQuantityDetail(tt.detail)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseQuantityDetail(%q) = %s, %q, want error", tt.detail, total, normalized)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseQuantityDetail(%q) error: %v", tt.detail, err)
+			continue
+		}
+		if total.String() != tt.total || normalized != tt.normalized {
+			t.Errorf("parseQuantityDetail(%q) = %s, %q, want %s, %q", tt.detail, total, normalized, tt.total, tt.normalized)
+		}
+	}
+}
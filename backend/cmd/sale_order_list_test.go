@@ -0,0 +1,186 @@
+package main
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"nb2/pkg/database"
+)
+
+// countingDriver 只用于测试的数据库驱动：按语句返回固定的销售订单数据，并统计查询次数
+type countingDriver struct {
+	orders        int
+	itemsPerOrder int
+	queries       atomic.Int64
+}
+
+func (d *countingDriver) Open(string) (driver.Conn, error) { return &countingConn{d: d}, nil }
+
+type countingConn struct{ d *countingDriver }
+
+func (c *countingConn) Prepare(query string) (driver.Stmt, error) {
+	return &countingStmt{d: c.d, query: query}, nil
+}
+func (c *countingConn) Close() error { return nil }
+func (c *countingConn) Begin() (driver.Tx, error) {
+	return nil, fmt.Errorf("transactions not supported")
+}
+
+type countingStmt struct {
+	d     *countingDriver
+	query string
+}
+
+func (s *countingStmt) Close() error  { return nil }
+func (s *countingStmt) NumInput() int { return -1 }
+func (s *countingStmt) Exec([]driver.Value) (driver.Result, error) {
+	return nil, fmt.Errorf("exec not supported")
+}
+
+func (s *countingStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.d.queries.Add(1)
+	switch {
+	case strings.HasPrefix(s.query, "SELECT COUNT(*) FROM sale_orders"):
+		return &countingRows{cols: 1, values: [][]driver.Value{{int64(s.d.orders)}}}, nil
+	case strings.Contains(s.query, "FROM sale_order_items"):
+		// 参数为订单ID
+		var values [][]driver.Value
+		for _, arg := range args {
+			orderID := arg.(int64)
+			for j := 0; j < s.d.itemsPerOrder; j++ {
+				values = append(values, []driver.Value{
+					orderID*100 + int64(j), orderID, int64(1), "P00001", "油管", "2.00", int64(0), "", "米", "10.00", "0.00", "20.00", "",
+				})
+			}
+		}
+		return &countingRows{cols: 13, values: values}, nil
+	case strings.HasPrefix(s.query, saleOrderSelect):
+		// 最后两个参数为 LIMIT 和 OFFSET
+		limit, offset := args[len(args)-2].(int64), args[len(args)-1].(int64)
+		var values [][]driver.Value
+		for id := offset + 1; id <= offset+limit && id <= int64(s.d.orders); id++ {
+			values = append(values, []driver.Value{
+				id, fmt.Sprintf("SO%06d", id), "2026-01-01 00:00:00", int64(1), "客户", "13800000000", "杭州", orderTypeWholesale,
+				"20.00", "0.00", "20.00", "0.00", "", "", invoiceStatusNone, paymentStatusPending, "", "", "", "2026-01-01 00:00:00", "2026-01-01 00:00:00",
+			})
+		}
+		return &countingRows{cols: 21, values: values}, nil
+	}
+	return nil, fmt.Errorf("unexpected query: %s", s.query)
+}
+
+type countingRows struct {
+	cols   int
+	values [][]driver.Value
+}
+
+func (r *countingRows) Columns() []string {
+	cols := make([]string, r.cols)
+	for i := range cols {
+		cols[i] = fmt.Sprintf("c%d", i)
+	}
+	return cols
+}
+func (r *countingRows) Close() error { return nil }
+func (r *countingRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+var countingDriverSeq atomic.Int64
+
+// useCountingDB 把 database.DB 替换为计数驱动，测试结束后恢复
+func useCountingDB(tb testing.TB, orders, itemsPerOrder int) *countingDriver {
+	tb.Helper()
+	d := &countingDriver{orders: orders, itemsPerOrder: itemsPerOrder}
+	name := fmt.Sprintf("counting-%d", countingDriverSeq.Add(1))
+	sql.Register(name, d)
+	db, err := sql.Open(name, "")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	old := database.DB
+	database.DB = db
+	tb.Cleanup(func() {
+		database.DB = old
+		db.Close()
+	})
+	return d
+}
+
+// listSaleOrders 调用销售订单列表接口，返回本页订单
+func listSaleOrders(tb testing.TB, pageSize int) []SaleOrder {
+	tb.Helper()
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/sale-orders?pageSize=%d", pageSize), nil)
+	getSaleOrders(c)
+	if w.Code != http.StatusOK {
+		tb.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Total   int         `json:"total"`
+		Records []SaleOrder `json:"records"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		tb.Fatal(err)
+	}
+	return resp.Records
+}
+
+func TestGetSaleOrdersQueryCountIsConstant(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	for _, n := range []int{1, 10, 100, 1000} {
+		d := useCountingDB(t, n, 3)
+		orders := listSaleOrders(t, n)
+
+		if len(orders) != n {
+			t.Fatalf("%d orders: got %d records", n, len(orders))
+		}
+		for _, so := range orders {
+			if len(so.Items) != 3 {
+				t.Fatalf("%d orders: order %d has %d items, want 3", n, so.ID, len(so.Items))
+			}
+			for _, item := range so.Items {
+				if item.SaleOrderID != so.ID {
+					t.Fatalf("%d orders: item %d assigned to order %d, want %d", n, item.ID, so.ID, item.SaleOrderID)
+				}
+			}
+		}
+
+		// 计数、订单分页、商品批量查询各一次，与订单数量无关
+		if got := d.queries.Load(); got != 3 {
+			t.Fatalf("%d orders: %d queries, want 3", n, got)
+		}
+	}
+}
+
+func BenchmarkGetSaleOrders(b *testing.B) {
+	gin.SetMode(gin.TestMode)
+
+	for _, n := range []int{10, 100, 1000} {
+		b.Run(fmt.Sprintf("orders=%d", n), func(b *testing.B) {
+			d := useCountingDB(b, n, 3)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				listSaleOrders(b, n)
+			}
+			b.ReportMetric(float64(d.queries.Load())/float64(b.N), "queries/op")
+		})
+	}
+}
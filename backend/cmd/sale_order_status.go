@@ -0,0 +1,283 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+
+	"nb2/pkg/database"
+)
+
+// ========== 销售订单付款状态相关模型 ==========
+
+// SaleOrderStatusRequest 关闭/重新打开销售订单请求
+type SaleOrderStatusRequest struct {
+	Reason string `json:"reason" binding:"required"`
+}
+
+// SaleOrderStatusLog 销售订单关闭/重新打开记录
+type SaleOrderStatusLog struct {
+	ID          int    `json:"id"`
+	SaleOrderID int    `json:"saleOrderId"`
+	Action      string `json:"action"`
+	Reason      string `json:"reason"`
+	Username    string `json:"username"`
+	CreatedAt   string `json:"createdAt"`
+}
+
+// 关闭/重新打开操作
+const (
+	saleOrderActionClose  = "close"
+	saleOrderActionReopen = "reopen"
+)
+
+// checkSaleOrdersOpen 检查收款关联的订单中是否有已关闭的订单，已关闭的订单不能再分配收款
+func checkSaleOrdersOpen(q dbExecutor, saleOrderIDs []int) error {
+	if len(saleOrderIDs) == 0 {
+		return nil
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(saleOrderIDs)), ",")
+	args := make([]interface{}, len(saleOrderIDs))
+	for i, id := range saleOrderIDs {
+		args[i] = id
+	}
+
+	rows, err := q.Query("SELECT code FROM sale_orders WHERE closed_at IS NOT NULL AND id IN ("+placeholders+") ORDER BY code", args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var codes []string
+	for rows.Next() {
+		var code string
+		if err := rows.Scan(&code); err != nil {
+			return err
+		}
+		codes = append(codes, code)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(codes) > 0 {
+		return &closedSaleOrderError{Message: "订单已关闭，不能再分配收款", Codes: codes}
+	}
+	return nil
+}
+
+// paymentChange 修改后的收款客户、关联订单和金额
+type paymentChange struct {
+	CustomerID   int
+	SaleOrderIDs []int
+	Amount       decimal.Decimal
+}
+
+// checkClosedAllocationsKept 检查修改或删除收款是否会改变它在已关闭订单上的分配，change 为 nil 表示删除收款。
+// 已关闭订单上的分配保持不变，因此收款不能删除、不能改到其他客户、不能取消关联这些订单，金额也不能少于这部分分配的合计
+func checkClosedAllocationsKept(q dbExecutor, paymentID int, change *paymentChange) error {
+	rows, err := q.Query(
+		"SELECT s.id, s.code, s.customer_id, a.amount FROM payment_allocations a JOIN sale_orders s ON a.sale_order_id = s.id WHERE a.payment_id = ? AND s.closed_at IS NOT NULL ORDER BY s.code",
+		paymentID,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var codes []string
+	var total decimal.Decimal
+	changed := change == nil
+	for rows.Next() {
+		var orderID, customerID int
+		var code string
+		var amount decimal.Decimal
+		if err := rows.Scan(&orderID, &code, &customerID, &amount); err != nil {
+			return err
+		}
+		codes = append(codes, code)
+		total = total.Add(amount)
+		if change != nil && (customerID != change.CustomerID || !containsInt(change.SaleOrderIDs, orderID)) {
+			changed = true
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(codes) == 0 {
+		return nil
+	}
+	if change == nil {
+		return &closedSaleOrderError{Message: "收款已分配到已关闭的订单，不能删除", Codes: codes}
+	}
+	if changed || roundAmount(change.Amount).LessThan(roundAmount(total)) {
+		return &closedSaleOrderError{Message: "收款已分配到已关闭的订单，不能更换客户、取消关联或减少到已分配金额以下", Codes: codes}
+	}
+	return nil
+}
+
+// containsInt 判断切片中是否包含指定ID
+func containsInt(ids []int, id int) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
+
+// closedSaleOrderError 收款关联或分配到了已关闭的订单
+type closedSaleOrderError struct {
+	Message string
+	Codes   []string
+}
+
+func (e *closedSaleOrderError) Error() string {
+	return e.Message + "：" + strings.Join(e.Codes, "、")
+}
+
+// saleOrderOpenErrorStatus 区分已关闭订单（400）和查询失败（500）
+func saleOrderOpenErrorStatus(err error) int {
+	if _, ok := err.(*closedSaleOrderError); ok {
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// changeSaleOrderClosed 关闭或重新打开销售订单，并记录原因
+func changeSaleOrderClosed(c *gin.Context, action string) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid sale order ID"})
+		return
+	}
+
+	var req SaleOrderStatusRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	reason := strings.TrimSpace(req.Reason)
+	if reason == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请填写原因"})
+		return
+	}
+
+	// 开始事务
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction: " + err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	var customerID int
+	var closed bool
+	err = tx.QueryRow("SELECT customer_id, closed_at IS NOT NULL FROM sale_orders WHERE id = ?", id).Scan(&customerID, &closed)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Sale order not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sale order: " + err.Error()})
+		return
+	}
+	if action == saleOrderActionClose && closed {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "订单已关闭"})
+		return
+	}
+	if action == saleOrderActionReopen && !closed {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "订单未关闭，无需重新打开"})
+		return
+	}
+
+	before, err := snapshotEntity(tx, auditSaleOrder, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sale order: " + err.Error()})
+		return
+	}
+
+	if action == saleOrderActionClose {
+		_, err = tx.Exec("UPDATE sale_orders SET closed_at = CURRENT_TIMESTAMP, close_reason = ?, payment_status = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?", reason, paymentStatusClosed, id)
+	} else {
+		_, err = tx.Exec("UPDATE sale_orders SET closed_at = NULL, close_reason = NULL, updated_at = CURRENT_TIMESTAMP WHERE id = ?", id)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update sale order: " + err.Error()})
+		return
+	}
+
+	var userID interface{}
+	if uid := c.GetInt(ctxUserIDKey); uid > 0 {
+		userID = uid
+	}
+	if _, err := tx.Exec(
+		"INSERT INTO sale_order_status_logs (sale_order_id, action, reason, user_id, username) VALUES (?, ?, ?, ?, ?)",
+		id, action, reason, userID, c.GetString(ctxUsernameKey),
+	); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write status log: " + err.Error()})
+		return
+	}
+
+	// 重新打开后按收款情况恢复付款状态
+	if action == saleOrderActionReopen {
+		if err := allocateCustomerPayments(tx, customerID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update payment status: " + err.Error()})
+			return
+		}
+	}
+
+	if err := recordAudit(tx, c, auditSaleOrder, id, auditActionUpdate, before); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write audit log: " + err.Error()})
+		return
+	}
+
+	// 提交事务
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction: " + err.Error()})
+		return
+	}
+
+	getSaleOrderByID(c)
+}
+
+// closeSaleOrder 关闭销售订单，关闭后不能再修改或分配收款
+func closeSaleOrder(c *gin.Context) {
+	changeSaleOrderClosed(c, saleOrderActionClose)
+}
+
+// reopenSaleOrder 重新打开已关闭的销售订单
+func reopenSaleOrder(c *gin.Context) {
+	changeSaleOrderClosed(c, saleOrderActionReopen)
+}
+
+// getSaleOrderStatusLogs 获取销售订单的关闭/重新打开记录
+func getSaleOrderStatusLogs(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid sale order ID"})
+		return
+	}
+
+	rows, err := database.DB.Query("SELECT id, sale_order_id, action, reason, COALESCE(username, ''), created_at FROM sale_order_status_logs WHERE sale_order_id = ? ORDER BY id DESC", id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch status logs"})
+		return
+	}
+	defer rows.Close()
+
+	logs := []SaleOrderStatusLog{}
+	for rows.Next() {
+		var l SaleOrderStatusLog
+		if err := rows.Scan(&l.ID, &l.SaleOrderID, &l.Action, &l.Reason, &l.Username, &l.CreatedAt); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan status log"})
+			return
+		}
+		logs = append(logs, l)
+	}
+
+	c.JSON(http.StatusOK, logs)
+}
@@ -0,0 +1,391 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+	"github.com/xuri/excelize/v2"
+
+	"nb2/pkg/database"
+)
+
+// 对帐单导出：每个客户一个工作表，包含抬头（客户编号、名称、对帐期间）、期初余额、
+// 逐笔销售和收款及滚动余额、本期合计、期末余额及其大写
+
+// statementExportColumns 明细表头
+var statementExportColumns = []string{"日期", "类型", "单号", "销售金额", "收款金额", "余额", "备注"}
+
+// statementExportLine 导出的一行明细
+type statementExportLine struct {
+	Date          string
+	SourceType    string
+	SourceCode    string
+	SaleAmount    decimal.Decimal
+	PaymentAmount decimal.Decimal
+	Remark        string
+}
+
+// statementExportSheet 一个客户的对帐单
+type statementExportSheet struct {
+	CustomerID   int
+	CustomerCode string
+	CustomerName string
+	Opening      decimal.Decimal
+	Lines        []statementExportLine
+}
+
+// statementSourceTypeNames 对帐单来源类型的中文名称
+var statementSourceTypeNames = map[string]string{
+	"sale_order": "销售",
+	"payment":    "收款",
+}
+
+// parseStatementExportCustomers 解析 customerIds（逗号分隔）和 customerId 参数
+func parseStatementExportCustomers(c *gin.Context) ([]int, error) {
+	var ids []int
+	seen := map[int]bool{}
+	raw := strings.Split(c.Query("customerIds"), ",")
+	raw = append(raw, c.Query("customerId"))
+	for _, s := range raw {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		id, err := strconv.Atoi(s)
+		if err != nil || id <= 0 {
+			return nil, fmt.Errorf("Invalid customerId: %s", s)
+		}
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// loadStatementExportSheet 读取一个客户在对帐期间内的对帐单
+// 期初余额按开始日期之前的全部发生额累计，期间内逐笔累加得到滚动余额
+func loadStatementExportSheet(customerID int, startTime, endTime string) (*statementExportSheet, error) {
+	sheet := &statementExportSheet{CustomerID: customerID}
+	err := database.DB.QueryRow("SELECT COALESCE(code, ''), name FROM customers WHERE id = ?", customerID).Scan(&sheet.CustomerCode, &sheet.CustomerName)
+	if err != nil {
+		return nil, err
+	}
+
+	if startTime != "" {
+		err := database.DB.QueryRow("SELECT COALESCE(SUM(sale_amount - payment_amount), 0) FROM statement_records WHERE customer_id = ? AND date < ?", customerID, startTime).Scan(&sheet.Opening)
+		if err != nil {
+			return nil, err
+		}
+		sheet.Opening = roundAmount(sheet.Opening)
+	}
+
+	query := `SELECT r.date, r.source_type, COALESCE(so.code, p.code, ''), r.sale_amount, r.payment_amount, COALESCE(r.remark, '')
+		FROM statement_records r
+		LEFT JOIN sale_orders so ON r.source_type = 'sale_order' AND so.id = r.source_id
+		LEFT JOIN payments p ON r.source_type = 'payment' AND p.id = r.source_id
+		WHERE r.customer_id = ?`
+	args := []interface{}{customerID}
+	if startTime != "" {
+		query += " AND r.date >= ?"
+		args = append(args, startTime)
+	}
+	if endTime != "" {
+		query += " AND r.date <= ?"
+		args = append(args, endTime)
+	}
+	rows, err := database.DB.Query(query+" ORDER BY r.date, r.id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var l statementExportLine
+		if err := rows.Scan(&l.Date, &l.SourceType, &l.SourceCode, &l.SaleAmount, &l.PaymentAmount, &l.Remark); err != nil {
+			return nil, err
+		}
+		if len(l.Date) > 10 {
+			l.Date = l.Date[:10]
+		}
+		sheet.Lines = append(sheet.Lines, l)
+	}
+	return sheet, rows.Err()
+}
+
+// statementExportStyles 导出用到的单元格样式
+type statementExportStyles struct {
+	Title, Info, Header, Text, Amount, Total, TotalAmount int
+}
+
+func newStatementExportStyles(f *excelize.File) (statementExportStyles, error) {
+	border := []excelize.Border{
+		{Type: "left", Color: "000000", Style: 1},
+		{Type: "top", Color: "000000", Style: 1},
+		{Type: "right", Color: "000000", Style: 1},
+		{Type: "bottom", Color: "000000", Style: 1},
+	}
+	amountFormat := "#,##0.00"
+	defs := []*excelize.Style{
+		{Font: &excelize.Font{Bold: true, Size: 16}, Alignment: &excelize.Alignment{Horizontal: "center", Vertical: "center"}},
+		{Font: &excelize.Font{Size: 11}, Alignment: &excelize.Alignment{Vertical: "center"}},
+		{Font: &excelize.Font{Bold: true}, Border: border, Alignment: &excelize.Alignment{Horizontal: "center", Vertical: "center"}, Fill: excelize.Fill{Type: "pattern", Pattern: 1, Color: []string{"D9E1F2"}}},
+		{Border: border, Alignment: &excelize.Alignment{Vertical: "center"}},
+		{Border: border, CustomNumFmt: &amountFormat},
+		{Font: &excelize.Font{Bold: true}, Border: border, Alignment: &excelize.Alignment{Vertical: "center"}},
+		{Font: &excelize.Font{Bold: true}, Border: border, CustomNumFmt: &amountFormat},
+	}
+	ids := make([]int, len(defs))
+	for i, def := range defs {
+		id, err := f.NewStyle(def)
+		if err != nil {
+			return statementExportStyles{}, err
+		}
+		ids[i] = id
+	}
+	return statementExportStyles{Title: ids[0], Info: ids[1], Header: ids[2], Text: ids[3], Amount: ids[4], Total: ids[5], TotalAmount: ids[6]}, nil
+}
+
+// statementSheetName 生成工作表名称：客户编号+名称，去掉 Excel 不允许的字符，最长31个字符，重名时追加序号
+func statementSheetName(sheet *statementExportSheet, used map[string]bool) string {
+	name := strings.TrimSpace(sheet.CustomerCode + " " + sheet.CustomerName)
+	name = strings.NewReplacer(":", "", "\\", "", "/", "", "?", "", "*", "", "[", "", "]", "").Replace(name)
+	if name == "" {
+		name = fmt.Sprintf("客户%d", sheet.CustomerID)
+	}
+	base := []rune(name)
+	if len(base) > 31 {
+		base = base[:31]
+	}
+	name = string(base)
+	for i := 2; used[name]; i++ {
+		suffix := fmt.Sprintf("(%d)", i)
+		n := base
+		if len(n)+len(suffix) > 31 {
+			n = n[:31-len(suffix)]
+		}
+		name = string(n) + suffix
+	}
+	used[name] = true
+	return name
+}
+
+// statementPeriodText 对帐期间的显示文字
+func statementPeriodText(startTime, endTime string) string {
+	switch {
+	case startTime == "" && endTime == "":
+		return "全部"
+	case startTime == "":
+		return "截至 " + endTime
+	case endTime == "":
+		return startTime + " 至今"
+	}
+	return startTime + " 至 " + endTime
+}
+
+// writeStatementSheet 把一个客户的对帐单写入工作表
+func writeStatementSheet(f *excelize.File, name string, sheet *statementExportSheet, startTime, endTime string, styles statementExportStyles) error {
+	lastCol := string(rune('A' + len(statementExportColumns) - 1))
+	cell := func(col string, row int) string { return col + strconv.Itoa(row) }
+	amount := func(v decimal.Decimal) float64 { return roundAmount(v).InexactFloat64() }
+
+	// 抬头
+	f.SetCellValue(name, "A1", "客户对帐单")
+	f.MergeCell(name, "A1", cell(lastCol, 1))
+	f.SetCellStyle(name, "A1", cell(lastCol, 1), styles.Title)
+	f.SetRowHeight(name, 1, 30)
+
+	f.SetCellValue(name, "A2", "客户编号："+sheet.CustomerCode)
+	f.MergeCell(name, "A2", "C2")
+	f.SetCellValue(name, "D2", "客户名称："+sheet.CustomerName)
+	f.MergeCell(name, "D2", cell(lastCol, 2))
+	f.SetCellValue(name, "A3", "对帐期间："+statementPeriodText(startTime, endTime))
+	f.MergeCell(name, "A3", cell(lastCol, 3))
+	f.SetCellStyle(name, "A2", cell(lastCol, 3), styles.Info)
+
+	// 表头
+	header := make([]interface{}, len(statementExportColumns))
+	for i, title := range statementExportColumns {
+		header[i] = title
+	}
+	f.SetSheetRow(name, "A4", &header)
+	f.SetCellStyle(name, "A4", cell(lastCol, 4), styles.Header)
+
+	// 期初余额
+	row := 5
+	f.SetSheetRow(name, cell("A", row), &[]interface{}{startTime, "期初余额", "", nil, nil, amount(sheet.Opening), ""})
+	f.SetCellStyle(name, cell("A", row), cell("C", row), styles.Text)
+	f.SetCellStyle(name, cell("D", row), cell("F", row), styles.Amount)
+	f.SetCellStyle(name, cell("G", row), cell("G", row), styles.Text)
+
+	// 逐笔明细及滚动余额
+	balance := sheet.Opening
+	var saleTotal, paymentTotal decimal.Decimal
+	for _, l := range sheet.Lines {
+		row++
+		balance = balance.Add(l.SaleAmount).Sub(l.PaymentAmount)
+		saleTotal = saleTotal.Add(l.SaleAmount)
+		paymentTotal = paymentTotal.Add(l.PaymentAmount)
+
+		typeName := statementSourceTypeNames[l.SourceType]
+		if typeName == "" {
+			typeName = l.SourceType
+		}
+		var sale, payment interface{}
+		if !l.SaleAmount.IsZero() {
+			sale = amount(l.SaleAmount)
+		}
+		if !l.PaymentAmount.IsZero() {
+			payment = amount(l.PaymentAmount)
+		}
+		f.SetSheetRow(name, cell("A", row), &[]interface{}{l.Date, typeName, l.SourceCode, sale, payment, amount(balance), l.Remark})
+		f.SetCellStyle(name, cell("A", row), cell("C", row), styles.Text)
+		f.SetCellStyle(name, cell("D", row), cell("F", row), styles.Amount)
+		f.SetCellStyle(name, cell("G", row), cell("G", row), styles.Text)
+	}
+
+	// 本期合计和期末余额
+	row++
+	f.SetSheetRow(name, cell("A", row), &[]interface{}{"本期合计", "", "", amount(saleTotal), amount(paymentTotal), nil, ""})
+	f.MergeCell(name, cell("A", row), cell("C", row))
+	f.SetCellStyle(name, cell("A", row), cell("C", row), styles.Total)
+	f.SetCellStyle(name, cell("D", row), cell("F", row), styles.TotalAmount)
+	f.SetCellStyle(name, cell("G", row), cell("G", row), styles.Total)
+
+	row++
+	f.SetSheetRow(name, cell("A", row), &[]interface{}{"期末余额", "", "", nil, nil, amount(balance), ""})
+	f.MergeCell(name, cell("A", row), cell("C", row))
+	f.SetCellStyle(name, cell("A", row), cell("C", row), styles.Total)
+	f.SetCellStyle(name, cell("D", row), cell("F", row), styles.TotalAmount)
+	f.SetCellStyle(name, cell("G", row), cell("G", row), styles.Total)
+
+	row++
+	f.SetCellValue(name, cell("A", row), "期末余额（大写）："+rmbUppercase(balance))
+	f.MergeCell(name, cell("A", row), cell(lastCol, row))
+	f.SetCellStyle(name, cell("A", row), cell(lastCol, row), styles.Total)
+
+	// 列宽
+	for col, width := range map[string]float64{"A": 12, "B": 10, "C": 18, "D": 14, "E": 14, "F": 14, "G": 30} {
+		f.SetColWidth(name, col, col, width)
+	}
+	return nil
+}
+
+// exportStatements 导出客户对帐单为 Excel，每个客户一个工作表
+// 参数：customerIds（逗号分隔，可多个）或 customerId，startTime、endTime（YYYY-MM-DD）；
+// 不指定客户时导出对帐期间内有发生额的全部客户
+func exportStatements(c *gin.Context) {
+	customerIDs, err := parseStatementExportCustomers(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	startTime := strings.TrimSpace(c.Query("startTime"))
+	endTime := strings.TrimSpace(c.Query("endTime"))
+	for _, d := range []string{startTime, endTime} {
+		if d == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", d); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date, expected YYYY-MM-DD"})
+			return
+		}
+	}
+	if startTime != "" && endTime != "" && startTime > endTime {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "开始日期不能晚于结束日期"})
+		return
+	}
+
+	if len(customerIDs) == 0 {
+		query := "SELECT DISTINCT customer_id, customer_code FROM statement_records WHERE 1=1"
+		args := []interface{}{}
+		if startTime != "" {
+			query += " AND date >= ?"
+			args = append(args, startTime)
+		}
+		if endTime != "" {
+			query += " AND date <= ?"
+			args = append(args, endTime)
+		}
+		rows, err := database.DB.Query(query+" ORDER BY customer_code, customer_id", args...)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch statements: " + err.Error()})
+			return
+		}
+		for rows.Next() {
+			var id int
+			var code string
+			if err := rows.Scan(&id, &code); err != nil {
+				rows.Close()
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan statement record: " + err.Error()})
+				return
+			}
+			customerIDs = append(customerIDs, id)
+		}
+		rows.Close()
+		if len(customerIDs) == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "对帐期间内没有对帐记录"})
+			return
+		}
+	}
+
+	sheets := make([]*statementExportSheet, 0, len(customerIDs))
+	for _, id := range customerIDs {
+		sheet, err := loadStatementExportSheet(id, startTime, endTime)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("客户 %d 不存在", id)})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch statements: " + err.Error()})
+			return
+		}
+		sheets = append(sheets, sheet)
+	}
+
+	f := excelize.NewFile()
+	defer f.Close()
+	styles, err := newStatementExportStyles(f)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create workbook: " + err.Error()})
+		return
+	}
+	used := map[string]bool{}
+	for i, sheet := range sheets {
+		name := statementSheetName(sheet, used)
+		if i == 0 {
+			err = f.SetSheetName("Sheet1", name)
+		} else {
+			_, err = f.NewSheet(name)
+		}
+		if err == nil {
+			err = writeStatementSheet(f, name, sheet, startTime, endTime, styles)
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write workbook: " + err.Error()})
+			return
+		}
+	}
+	f.SetActiveSheet(0)
+
+	filename := "对帐单"
+	if len(sheets) == 1 {
+		filename += "_" + sheets[0].CustomerName
+	}
+	if startTime != "" || endTime != "" {
+		filename += "_" + startTime + "_" + endTime
+	}
+	filename += ".xlsx"
+	c.Header("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+	c.Header("Content-Disposition", "attachment; filename*=UTF-8''"+url.PathEscape(filename))
+	if err := f.Write(c.Writer); err != nil {
+		c.Error(err)
+	}
+}
@@ -0,0 +1,404 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"nb2/pkg/database"
+)
+
+// ========== 供应商相关模型 ==========
+
+// Supplier 供应商模型
+type Supplier struct {
+	ID          int    `json:"id"`
+	Code        string `json:"code"`
+	Name        string `json:"name"`
+	Contact     string `json:"contact"`
+	Phone       string `json:"phone"`
+	Province    string `json:"province"`
+	City        string `json:"city"`
+	District    string `json:"district"`
+	Address     string `json:"address"`
+	Bank        string `json:"bank"`
+	BankAccount string `json:"bankAccount"`
+	TaxNumber   string `json:"taxNumber"`
+	Status      int    `json:"status"`
+	Remark      string `json:"remark"`
+	CreatedAt   string `json:"createdAt"`
+	UpdatedAt   string `json:"updatedAt"`
+}
+
+// SupplierRequest 创建/更新供应商请求
+type SupplierRequest struct {
+	Code        string `json:"code"`
+	Name        string `json:"name"`
+	Contact     string `json:"contact"`
+	Phone       string `json:"phone"`
+	Province    string `json:"province"`
+	City        string `json:"city"`
+	District    string `json:"district"`
+	Address     string `json:"address"`
+	Bank        string `json:"bank"`
+	BankAccount string `json:"bankAccount"`
+	TaxNumber   string `json:"taxNumber"`
+	Status      *int   `json:"status"`
+	Remark      string `json:"remark"`
+}
+
+// supplierSelect 查询供应商的语句
+const supplierSelect = "SELECT id, COALESCE(code, ''), name, COALESCE(contact, ''), COALESCE(phone, ''), COALESCE(province, ''), COALESCE(city, ''), COALESCE(district, ''), COALESCE(address, ''), COALESCE(bank, ''), COALESCE(bank_account, ''), COALESCE(tax_number, ''), status, COALESCE(remark, ''), created_at, updated_at FROM suppliers"
+
+// scanSupplier 扫描一行供应商数据
+func scanSupplier(row interface{ Scan(...interface{}) error }) (Supplier, error) {
+	var s Supplier
+	err := row.Scan(&s.ID, &s.Code, &s.Name, &s.Contact, &s.Phone, &s.Province, &s.City, &s.District, &s.Address, &s.Bank, &s.BankAccount, &s.TaxNumber, &s.Status, &s.Remark, &s.CreatedAt, &s.UpdatedAt)
+	return s, err
+}
+
+// generateSupplierCode 生成供应商编号（G+4位数字递增）
+func generateSupplierCode(q dbExecutor) (string, error) {
+	var maxCode sql.NullString
+	cond, args := database.CurrentDialect().CodeSequence("code", "G")
+	err := q.QueryRow("SELECT MAX(code) FROM suppliers WHERE "+cond, args...).Scan(&maxCode)
+	if err != nil && err != sql.ErrNoRows {
+		return "", err
+	}
+
+	nextNum := 1
+	if maxCode.Valid && maxCode.String != "" {
+		if currentNum, err := strconv.Atoi(maxCode.String[1:]); err == nil {
+			nextNum = currentNum + 1
+		}
+	}
+	return fmt.Sprintf("G%04d", nextNum), nil
+}
+
+// generateSupplierCodeAPI 生成供应商编号API
+func generateSupplierCodeAPI(c *gin.Context) {
+	code, err := generateSupplierCode(database.DB)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate supplier code"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": code})
+}
+
+// supplierListSort 供应商列表可排序字段
+var supplierListSort = listSort{
+	Fields: map[string]string{
+		"createdAt": "created_at",
+		"code":      "code",
+		"name":      "name",
+		"city":      "city",
+	},
+	Default:    "createdAt",
+	Desc:       true,
+	TieBreaker: "id",
+}
+
+// getSuppliers 分页获取供应商列表，支持按关键字、城市和状态筛选
+func getSuppliers(c *gin.Context) {
+	lq, err := newListQuery(c, supplierListSort)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	lq.contains("keyword", "code", "name", "contact", "phone")
+	lq.eq("city", "city")
+	lq.eq("status", "status")
+	if lq.err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": lq.err.Error()})
+		return
+	}
+
+	total, err := lq.count("suppliers")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count suppliers: " + err.Error()})
+		return
+	}
+
+	query, args := lq.pageSQL(supplierSelect)
+	rows, err := database.DB.Query(query, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch suppliers: " + err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	suppliers := []Supplier{}
+	for rows.Next() {
+		s, err := scanSupplier(rows)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan supplier: " + err.Error()})
+			return
+		}
+		suppliers = append(suppliers, s)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"total":   total,
+		"records": suppliers,
+	})
+}
+
+// getSupplierByID 根据ID获取供应商
+func getSupplierByID(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid supplier ID"})
+		return
+	}
+
+	s, err := scanSupplier(database.DB.QueryRow(supplierSelect+" WHERE id = ?", id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Supplier not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch supplier"})
+		return
+	}
+
+	c.JSON(http.StatusOK, s)
+}
+
+// createSupplier 创建供应商
+func createSupplier(c *gin.Context) {
+	var req SupplierRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Supplier name is required"})
+		return
+	}
+
+	// 开始事务
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction: " + err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	// 生成或使用提供的供应商编号
+	supplierCode := req.Code
+	if supplierCode == "" {
+		supplierCode, err = generateSupplierCode(tx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate supplier code"})
+			return
+		}
+	} else {
+		var exists bool
+		if err := tx.QueryRow("SELECT EXISTS(SELECT 1 FROM suppliers WHERE code = ?)", supplierCode).Scan(&exists); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "检查供应商编号失败"})
+			return
+		}
+		if exists {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "供应商编号已存在"})
+			return
+		}
+	}
+
+	status := 1
+	if req.Status != nil {
+		status = *req.Status
+	}
+
+	result, err := tx.Exec(
+		"INSERT INTO suppliers (code, name, contact, phone, province, city, district, address, bank, bank_account, tax_number, status, remark) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		supplierCode, req.Name, req.Contact, req.Phone, req.Province, req.City, req.District, req.Address, req.Bank, req.BankAccount, req.TaxNumber, status, req.Remark,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create supplier"})
+		return
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get last insert ID"})
+		return
+	}
+	if err := recordAudit(tx, c, auditSupplier, id, auditActionCreate, nil); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write audit log: " + err.Error()})
+		return
+	}
+
+	// 提交事务
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction: " + err.Error()})
+		return
+	}
+
+	s, err := scanSupplier(database.DB.QueryRow(supplierSelect+" WHERE id = ?", id))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch created supplier"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, s)
+}
+
+// updateSupplier 更新供应商
+func updateSupplier(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid supplier ID"})
+		return
+	}
+
+	var req SupplierRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 开始事务
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction: " + err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	before, err := snapshotEntity(tx, auditSupplier, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch supplier"})
+		return
+	}
+	if before == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Supplier not found"})
+		return
+	}
+
+	// 构建更新语句
+	query := "UPDATE suppliers SET updated_at = CURRENT_TIMESTAMP"
+	args := []interface{}{}
+
+	if req.Code != "" {
+		var codeExists bool
+		if err := tx.QueryRow("SELECT EXISTS(SELECT 1 FROM suppliers WHERE code = ? AND id != ?)", req.Code, id).Scan(&codeExists); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "检查供应商编号失败"})
+			return
+		}
+		if codeExists {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "供应商编号已存在"})
+			return
+		}
+		query += ", code = ?"
+		args = append(args, req.Code)
+	}
+	fields := []struct {
+		column string
+		value  string
+	}{
+		{"name", req.Name},
+		{"contact", req.Contact},
+		{"phone", req.Phone},
+		{"province", req.Province},
+		{"city", req.City},
+		{"district", req.District},
+		{"address", req.Address},
+		{"bank", req.Bank},
+		{"bank_account", req.BankAccount},
+		{"tax_number", req.TaxNumber},
+		{"remark", req.Remark},
+	}
+	for _, f := range fields {
+		if f.value != "" {
+			query += ", " + f.column + " = ?"
+			args = append(args, f.value)
+		}
+	}
+	if req.Status != nil {
+		query += ", status = ?"
+		args = append(args, *req.Status)
+	}
+
+	query += " WHERE id = ?"
+	args = append(args, id)
+
+	if _, err := tx.Exec(query, args...); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update supplier"})
+		return
+	}
+	if err := recordAudit(tx, c, auditSupplier, id, auditActionUpdate, before); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write audit log: " + err.Error()})
+		return
+	}
+
+	// 提交事务
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction: " + err.Error()})
+		return
+	}
+
+	s, err := scanSupplier(database.DB.QueryRow(supplierSelect+" WHERE id = ?", id))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch updated supplier"})
+		return
+	}
+
+	c.JSON(http.StatusOK, s)
+}
+
+// deleteSupplier 删除供应商，已有进货单或付款记录的供应商不能删除（可改为停用）
+func deleteSupplier(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid supplier ID"})
+		return
+	}
+
+	// 开始事务
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction: " + err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	before, err := snapshotEntity(tx, auditSupplier, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch supplier"})
+		return
+	}
+	if before == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Supplier not found"})
+		return
+	}
+
+	var inUse bool
+	if err := tx.QueryRow("SELECT EXISTS(SELECT 1 FROM purchase_orders WHERE supplier_id = ?) OR EXISTS(SELECT 1 FROM supplier_payments WHERE supplier_id = ?)", id, id).Scan(&inUse); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check supplier usage"})
+		return
+	}
+	if inUse {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "供应商已有进货单或付款记录，不能删除"})
+		return
+	}
+
+	if _, err := tx.Exec("DELETE FROM suppliers WHERE id = ?", id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete supplier"})
+		return
+	}
+	if err := recordAudit(tx, c, auditSupplier, id, auditActionDelete, before); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write audit log: " + err.Error()})
+		return
+	}
+
+	// 提交事务
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Supplier deleted successfully"})
+}
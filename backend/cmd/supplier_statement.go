@@ -0,0 +1,600 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+
+	"nb2/pkg/database"
+)
+
+// ========== 供应商付款及应付对帐单相关模型 ==========
+
+// SupplierPayment 供应商付款记录模型
+type SupplierPayment struct {
+	ID            int             `json:"id"`
+	Code          string          `json:"code"`
+	PaymentDate   string          `json:"paymentDate"`
+	SupplierID    int             `json:"supplierId"`
+	SupplierName  string          `json:"supplierName"`
+	Amount        decimal.Decimal `json:"amount"`
+	PaymentMethod string          `json:"paymentMethod"`
+	Account       string          `json:"account"`
+	Remark        string          `json:"remark"`
+	CreatedAt     string          `json:"createdAt"`
+	UpdatedAt     string          `json:"updatedAt"`
+}
+
+// CreateSupplierPaymentRequest 创建供应商付款请求
+type CreateSupplierPaymentRequest struct {
+	PaymentDate   string          `json:"paymentDate" binding:"required"`
+	SupplierID    int             `json:"supplierId" binding:"required"`
+	Amount        decimal.Decimal `json:"amount" binding:"required,gt=0"`
+	PaymentMethod string          `json:"paymentMethod"`
+	Account       string          `json:"account"`
+	Remark        string          `json:"remark"`
+}
+
+// UpdateSupplierPaymentRequest 更新供应商付款请求
+type UpdateSupplierPaymentRequest struct {
+	PaymentDate   string          `json:"paymentDate"`
+	SupplierID    int             `json:"supplierId"`
+	Amount        decimal.Decimal `json:"amount"`
+	PaymentMethod string          `json:"paymentMethod"`
+	Account       string          `json:"account"`
+	Remark        string          `json:"remark"`
+}
+
+// SupplierStatementRecord 供应商对帐单记录模型
+type SupplierStatementRecord struct {
+	ID             int             `json:"id"`
+	SupplierID     int             `json:"supplierId"`
+	SupplierCode   string          `json:"supplierCode"`
+	SupplierName   string          `json:"supplierName"`
+	Date           string          `json:"date"`
+	PurchaseAmount decimal.Decimal `json:"purchaseAmount"`
+	PaymentAmount  decimal.Decimal `json:"paymentAmount"`
+	Balance        decimal.Decimal `json:"balance"`
+	Remark         string          `json:"remark"`
+	SourceType     string          `json:"sourceType"`
+	SourceID       int             `json:"sourceId"`
+	CreatedAt      string          `json:"createdAt"`
+	UpdatedAt      string          `json:"updatedAt"`
+}
+
+// supplierPaymentSelect 查询供应商付款记录的语句
+const supplierPaymentSelect = `
+	SELECT p.id, p.code, p.payment_date, p.supplier_id, COALESCE(s.name, ''), p.amount, COALESCE(p.payment_method, ''), COALESCE(p.account, ''), COALESCE(p.remark, ''), p.created_at, p.updated_at
+	FROM supplier_payments p
+	LEFT JOIN suppliers s ON p.supplier_id = s.id`
+
+// scanSupplierPayment 扫描一行供应商付款数据
+func scanSupplierPayment(row interface{ Scan(...interface{}) error }) (SupplierPayment, error) {
+	var p SupplierPayment
+	err := row.Scan(&p.ID, &p.Code, &p.PaymentDate, &p.SupplierID, &p.SupplierName, &p.Amount, &p.PaymentMethod, &p.Account, &p.Remark, &p.CreatedAt, &p.UpdatedAt)
+	return p, err
+}
+
+// generateSupplierPaymentCode 生成供应商付款编号（F+6位数字递增）
+func generateSupplierPaymentCode(q dbExecutor) (string, error) {
+	var maxCode sql.NullString
+	cond, args := database.CurrentDialect().CodeSequence("code", "F")
+	err := q.QueryRow("SELECT MAX(code) FROM supplier_payments WHERE "+cond, args...).Scan(&maxCode)
+	if err != nil && err != sql.ErrNoRows {
+		return "", err
+	}
+
+	nextNum := 1
+	if maxCode.Valid && maxCode.String != "" {
+		if currentNum, err := strconv.Atoi(maxCode.String[1:]); err == nil {
+			nextNum = currentNum + 1
+		}
+	}
+	return fmt.Sprintf("F%06d", nextNum), nil
+}
+
+// supplierPaymentListSort 供应商付款列表可排序字段
+var supplierPaymentListSort = listSort{
+	Fields: map[string]string{
+		"paymentDate": "p.payment_date",
+		"createdAt":   "p.created_at",
+		"code":        "p.code",
+		"amount":      "p.amount",
+	},
+	Default:    "paymentDate",
+	Desc:       true,
+	TieBreaker: "p.id",
+}
+
+// getSupplierPayments 分页获取供应商付款记录列表，支持按编号、供应商、付款方式和日期筛选
+func getSupplierPayments(c *gin.Context) {
+	lq, err := newListQuery(c, supplierPaymentListSort)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	lq.contains("code", "p.code")
+	lq.intEq("supplierId", "p.supplier_id")
+	lq.eq("paymentMethod", "p.payment_method")
+	lq.dateRange("p.payment_date")
+	if lq.err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": lq.err.Error()})
+		return
+	}
+
+	total, err := lq.count("supplier_payments p")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count supplier payments: " + err.Error()})
+		return
+	}
+
+	query, args := lq.pageSQL(supplierPaymentSelect)
+	rows, err := database.DB.Query(query, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch supplier payments: " + err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	payments := []SupplierPayment{}
+	for rows.Next() {
+		p, err := scanSupplierPayment(rows)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan supplier payment: " + err.Error()})
+			return
+		}
+		payments = append(payments, p)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"total":   total,
+		"records": payments,
+	})
+}
+
+// createSupplierPayment 创建供应商付款记录
+func createSupplierPayment(c *gin.Context) {
+	var req CreateSupplierPaymentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 开始事务
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction: " + err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	// 检查供应商是否存在
+	var supplierID int
+	if err := tx.QueryRow("SELECT id FROM suppliers WHERE id = ?", req.SupplierID).Scan(&supplierID); err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Supplier not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch supplier: " + err.Error()})
+		return
+	}
+
+	code, err := generateSupplierPaymentCode(tx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate supplier payment code"})
+		return
+	}
+
+	result, err := tx.Exec(
+		"INSERT INTO supplier_payments (code, payment_date, supplier_id, amount, payment_method, account, remark) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		code, req.PaymentDate, req.SupplierID, req.Amount, req.PaymentMethod, req.Account, req.Remark,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create supplier payment"})
+		return
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get last insert ID"})
+		return
+	}
+	if err := recordAudit(tx, c, auditSupplierPayment, id, auditActionCreate, nil); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write audit log: " + err.Error()})
+		return
+	}
+	// 同步任务随付款记录一起提交
+	if err := enqueueSyncJob(tx, syncJobSupplierStatement, req.SupplierID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to queue supplier statement sync: " + err.Error()})
+		return
+	}
+
+	// 提交事务
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction: " + err.Error()})
+		return
+	}
+	notifySyncWorkers()
+
+	payment, err := scanSupplierPayment(database.DB.QueryRow(supplierPaymentSelect+" WHERE p.id = ?", id))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch created supplier payment"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, payment)
+}
+
+// updateSupplierPayment 更新供应商付款记录
+func updateSupplierPayment(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid supplier payment ID"})
+		return
+	}
+
+	var req UpdateSupplierPaymentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 开始事务
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction: " + err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	var oldSupplierID int
+	if err := tx.QueryRow("SELECT supplier_id FROM supplier_payments WHERE id = ?", id).Scan(&oldSupplierID); err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Supplier payment not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch supplier payment"})
+		return
+	}
+
+	before, err := snapshotEntity(tx, auditSupplierPayment, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch supplier payment"})
+		return
+	}
+
+	// 构建更新语句
+	query := "UPDATE supplier_payments SET updated_at = CURRENT_TIMESTAMP"
+	args := []interface{}{}
+	newSupplierID := oldSupplierID
+
+	if req.PaymentDate != "" {
+		query += ", payment_date = ?"
+		args = append(args, req.PaymentDate)
+	}
+	if req.SupplierID > 0 {
+		var supplierID int
+		if err := tx.QueryRow("SELECT id FROM suppliers WHERE id = ?", req.SupplierID).Scan(&supplierID); err != nil {
+			if err == sql.ErrNoRows {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Supplier not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch supplier: " + err.Error()})
+			return
+		}
+		query += ", supplier_id = ?"
+		args = append(args, req.SupplierID)
+		newSupplierID = req.SupplierID
+	}
+	if req.Amount.IsPositive() {
+		query += ", amount = ?"
+		args = append(args, req.Amount)
+	}
+	if req.PaymentMethod != "" {
+		query += ", payment_method = ?"
+		args = append(args, req.PaymentMethod)
+	}
+	if req.Account != "" {
+		query += ", account = ?"
+		args = append(args, req.Account)
+	}
+	if req.Remark != "" {
+		query += ", remark = ?"
+		args = append(args, req.Remark)
+	}
+
+	query += " WHERE id = ?"
+	args = append(args, id)
+
+	if _, err := tx.Exec(query, args...); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update supplier payment"})
+		return
+	}
+	if err := recordAudit(tx, c, auditSupplierPayment, id, auditActionUpdate, before); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write audit log: " + err.Error()})
+		return
+	}
+
+	// 同步相关供应商的对帐单（更换供应商时新旧两边都要同步），任务随付款记录一起提交
+	supplierIDs := []int{newSupplierID}
+	if oldSupplierID != newSupplierID {
+		supplierIDs = append(supplierIDs, oldSupplierID)
+	}
+	for _, supplierID := range supplierIDs {
+		if err := enqueueSyncJob(tx, syncJobSupplierStatement, supplierID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to queue supplier statement sync: " + err.Error()})
+			return
+		}
+	}
+
+	// 提交事务
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction: " + err.Error()})
+		return
+	}
+	notifySyncWorkers()
+
+	payment, err := scanSupplierPayment(database.DB.QueryRow(supplierPaymentSelect+" WHERE p.id = ?", id))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch updated supplier payment"})
+		return
+	}
+
+	c.JSON(http.StatusOK, payment)
+}
+
+// deleteSupplierPayment 删除供应商付款记录
+func deleteSupplierPayment(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid supplier payment ID"})
+		return
+	}
+
+	// 开始事务
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction: " + err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	var supplierID int
+	err = tx.QueryRow("SELECT supplier_id FROM supplier_payments WHERE id = ?", id).Scan(&supplierID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Supplier payment not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch supplier payment"})
+		return
+	}
+
+	before, err := snapshotEntity(tx, auditSupplierPayment, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch supplier payment"})
+		return
+	}
+
+	if _, err := tx.Exec("DELETE FROM supplier_payments WHERE id = ?", id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete supplier payment"})
+		return
+	}
+	if err := recordAudit(tx, c, auditSupplierPayment, id, auditActionDelete, before); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write audit log: " + err.Error()})
+		return
+	}
+	// 同步任务随删除一起提交
+	if err := enqueueSyncJob(tx, syncJobSupplierStatement, supplierID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to queue supplier statement sync: " + err.Error()})
+		return
+	}
+
+	// 提交事务
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction: " + err.Error()})
+		return
+	}
+	notifySyncWorkers()
+
+	c.JSON(http.StatusOK, gin.H{"message": "Supplier payment deleted successfully"})
+}
+
+// calculateSupplierStatementBalance 计算供应商对帐单记录的结余（应付）金额
+func calculateSupplierStatementBalance(records []SupplierStatementRecord) []SupplierStatementRecord {
+	// 每条记录的差额 = 收货金额 - 付款金额
+	return calculateRunningBalance(records,
+		func(r *SupplierStatementRecord) string { return r.Date },
+		func(r *SupplierStatementRecord) decimal.Decimal { return r.PurchaseAmount.Sub(r.PaymentAmount) },
+		func(r *SupplierStatementRecord, balance decimal.Decimal) { r.Balance = balance },
+	)
+}
+
+// saveSupplierStatementRecords 保存供应商对帐单记录，先清空该供应商的旧记录
+func saveSupplierStatementRecords(supplierID int, records []SupplierStatementRecord) error {
+	// 开始事务
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM supplier_statement_records WHERE supplier_id = ?", supplierID); err != nil {
+		return err
+	}
+
+	stmt, err := tx.Prepare("INSERT INTO supplier_statement_records (supplier_id, supplier_code, supplier_name, date, purchase_amount, payment_amount, balance, remark, source_type, source_id) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, r := range records {
+		if _, err := stmt.Exec(r.SupplierID, r.SupplierCode, r.SupplierName, r.Date, r.PurchaseAmount, r.PaymentAmount, r.Balance, r.Remark, r.SourceType, r.SourceID); err != nil {
+			return err
+		}
+	}
+
+	// 提交事务
+	return tx.Commit()
+}
+
+// syncSupplierStatements 同步单个供应商的对帐单数据，来源为收货记录和付款记录
+func syncSupplierStatements(supplierID int) error {
+	var code, name string
+	if err := database.DB.QueryRow("SELECT COALESCE(code, ''), name FROM suppliers WHERE id = ?", supplierID).Scan(&code, &name); err != nil {
+		return fmt.Errorf("获取供应商 %d 信息失败：%w", supplierID, err)
+	}
+
+	var records []SupplierStatementRecord
+
+	// 收货记录：按收货日期计入应付
+	rows, err := database.DB.Query(`
+		SELECT r.id, r.receipt_date, r.amount, COALESCE(r.remark, ''), o.code
+		FROM purchase_receipts r JOIN purchase_orders o ON r.purchase_order_id = o.id
+		WHERE r.supplier_id = ?`, supplierID)
+	if err != nil {
+		return fmt.Errorf("获取供应商 %d 收货记录失败：%w", supplierID, err)
+	}
+	for rows.Next() {
+		var id int
+		var date, remark, orderCode string
+		var amount decimal.Decimal
+		if err := rows.Scan(&id, &date, &amount, &remark, &orderCode); err != nil {
+			rows.Close()
+			return err
+		}
+		if remark == "" {
+			remark = "进货单 " + orderCode
+		}
+		records = append(records, SupplierStatementRecord{
+			SupplierID:     supplierID,
+			SupplierCode:   code,
+			SupplierName:   name,
+			Date:           date,
+			PurchaseAmount: amount,
+			Remark:         remark,
+			SourceType:     "purchase_receipt",
+			SourceID:       id,
+		})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	// 付款记录：冲减应付
+	rows, err = database.DB.Query("SELECT id, payment_date, amount, COALESCE(remark, '') FROM supplier_payments WHERE supplier_id = ?", supplierID)
+	if err != nil {
+		return fmt.Errorf("获取供应商 %d 付款记录失败：%w", supplierID, err)
+	}
+	for rows.Next() {
+		var r SupplierStatementRecord
+		if err := rows.Scan(&r.SourceID, &r.Date, &r.PaymentAmount, &r.Remark); err != nil {
+			rows.Close()
+			return err
+		}
+		r.SupplierID = supplierID
+		r.SupplierCode = code
+		r.SupplierName = name
+		r.SourceType = "supplier_payment"
+		records = append(records, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	records = calculateSupplierStatementBalance(records)
+	return saveSupplierStatementRecords(supplierID, records)
+}
+
+// getSupplierStatements 获取供应商对帐单列表，支持按供应商和日期范围筛选
+func getSupplierStatements(c *gin.Context) {
+	startTime := c.Query("startTime")
+	endTime := c.Query("endTime")
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("pageSize", "100"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 {
+		pageSize = 100
+	}
+
+	where := " WHERE 1=1"
+	args := []interface{}{}
+	var supplierID int
+	if supplierIDStr := c.Query("supplierId"); supplierIDStr != "" {
+		var err error
+		supplierID, err = strconv.Atoi(supplierIDStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid supplierId"})
+			return
+		}
+		where += " AND supplier_id = ?"
+		args = append(args, supplierID)
+	}
+	if startTime != "" {
+		where += " AND date >= ?"
+		args = append(args, startTime)
+	}
+	if endTime != "" {
+		where += " AND date <= ?"
+		args = append(args, endTime)
+	}
+
+	var total int
+	if err := database.DB.QueryRow("SELECT COUNT(*) FROM supplier_statement_records"+where, args...).Scan(&total); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count supplier statements"})
+		return
+	}
+
+	query := "SELECT id, supplier_id, supplier_code, supplier_name, date, purchase_amount, payment_amount, balance, COALESCE(remark, ''), source_type, source_id, created_at, updated_at FROM supplier_statement_records" +
+		where + " ORDER BY date DESC, id DESC LIMIT ? OFFSET ?"
+	rows, err := database.DB.Query(query, append(args, pageSize, (page-1)*pageSize)...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch supplier statements"})
+		return
+	}
+	defer rows.Close()
+
+	records := []SupplierStatementRecord{}
+	for rows.Next() {
+		var r SupplierStatementRecord
+		if err := rows.Scan(&r.ID, &r.SupplierID, &r.SupplierCode, &r.SupplierName, &r.Date, &r.PurchaseAmount, &r.PaymentAmount, &r.Balance, &r.Remark, &r.SourceType, &r.SourceID, &r.CreatedAt, &r.UpdatedAt); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan supplier statement record"})
+			return
+		}
+		records = append(records, r)
+	}
+
+	// 合计及大写金额
+	summary, err := supplierStatementTable.summary(where, args, supplierID, endTime)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to summarize supplier statements: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"total":   total,
+		"records": records,
+		"summary": summary,
+	})
+}
+
+// syncSupplierStatementsAPI 手动触发供应商对帐单同步的API，为全部供应商提交同步任务，由后台队列执行
+func syncSupplierStatementsAPI(c *gin.Context) {
+	count, err := requestSyncAll(syncJobSupplierStatement, "SELECT id FROM suppliers")
+	if err != nil {
+		log.Printf("提交供应商对帐单同步任务失败：%v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to sync supplier statements", "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"message": "供应商对帐单同步任务已提交", "queued": count})
+}
@@ -0,0 +1,365 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"nb2/internal/config"
+	"nb2/pkg/database"
+)
+
+// ========== 后台同步任务队列 ==========
+//
+// 对帐单同步请求写入 sync_jobs 表，由固定数量的后台协程执行：
+// 同一任务类型、同一对象只有一条任务，等待执行期间的重复请求合并为一次；执行中又有新请求时标记 rerun，执行完再跑一次；
+// 失败后按指数退避重试，超过最大次数标记为失败，可通过任务列表查看错误并手动重试。
+// 任务保存在数据库中，进程重启后未完成的任务继续执行。
+
+const (
+	syncJobCustomerStatement = "customer_statement" // 校对客户对帐单
+	syncJobSupplierStatement = "supplier_statement" // 同步供应商对帐单
+
+	syncJobPending = "pending"
+	syncJobRunning = "running"
+	syncJobDone    = "done"
+	syncJobFailed  = "failed"
+)
+
+// syncJobHandlers 各任务类型的执行函数，参数为客户/供应商ID
+var syncJobHandlers = map[string]func(targetID int) error{
+	syncJobCustomerStatement: syncCustomerStatements,
+	syncJobSupplierStatement: syncSupplierStatements,
+}
+
+// SyncJob 同步任务
+type SyncJob struct {
+	ID         int     `json:"id"`
+	JobType    string  `json:"jobType"`
+	TargetID   int     `json:"targetId"`
+	TargetName string  `json:"targetName"`
+	Status     string  `json:"status"`
+	Attempts   int     `json:"attempts"`
+	LastError  string  `json:"lastError"`
+	RunAfter   string  `json:"runAfter"`
+	StartedAt  *string `json:"startedAt"`
+	FinishedAt *string `json:"finishedAt"`
+	CreatedAt  string  `json:"createdAt"`
+	UpdatedAt  string  `json:"updatedAt"`
+}
+
+// syncQueue 队列配置和唤醒信号
+var syncQueue = struct {
+	workers     int
+	maxAttempts int
+	debounce    time.Duration
+	wake        chan struct{}
+}{workers: 2, maxAttempts: 5, debounce: 2 * time.Second, wake: make(chan struct{}, 1)}
+
+const (
+	syncPollInterval = 5 * time.Second  // 没有新请求时检查到期任务的间隔
+	syncRetryBase    = 10 * time.Second // 第一次失败后的重试间隔，之后每次翻倍
+	syncRetryMax     = 30 * time.Minute
+)
+
+// startSyncQueue 启动后台同步协程，上次进程退出时仍在执行的任务重新排队
+func startSyncQueue(cfg *config.SyncConfig) {
+	if cfg.Workers > 0 {
+		syncQueue.workers = cfg.Workers
+	}
+	if cfg.MaxAttempts > 0 {
+		syncQueue.maxAttempts = cfg.MaxAttempts
+	}
+	if cfg.Debounce >= 0 {
+		syncQueue.debounce = cfg.Debounce
+	}
+
+	if _, err := database.DB.Exec("UPDATE sync_jobs SET status = ?, run_after = ?, updated_at = CURRENT_TIMESTAMP WHERE status = ?", syncJobPending, time.Now(), syncJobRunning); err != nil {
+		log.Printf("恢复未完成的同步任务失败：%v\n", err)
+	}
+	for i := 0; i < syncQueue.workers; i++ {
+		go syncWorker()
+	}
+	log.Printf("后台同步任务已启动，协程数 %d\n", syncQueue.workers)
+}
+
+// enqueueSyncJob 请求同步，等待执行的任务合并为一条并重新计时，执行中的任务执行完后再跑一次
+func enqueueSyncJob(q dbExecutor, jobType string, targetID int) error {
+	if _, ok := syncJobHandlers[jobType]; !ok {
+		return fmt.Errorf("unknown sync job type: %s", jobType)
+	}
+	// 更新表达式只引用原有的 status，MySQL 按顺序赋值，status 放在最后
+	upsertSQL := database.CurrentDialect().Upsert("sync_jobs",
+		[]string{"job_type", "target_id", "status", "run_after"},
+		[]string{"job_type", "target_id"},
+		[]string{
+			"rerun = CASE WHEN status = 'running' THEN 1 ELSE 0 END",
+			"attempts = CASE WHEN status = 'running' THEN attempts ELSE 0 END",
+			"run_after",
+			"updated_at = CURRENT_TIMESTAMP",
+			"status = CASE WHEN status = 'running' THEN status ELSE 'pending' END",
+		},
+	)
+	_, err := q.Exec(upsertSQL, jobType, targetID, syncJobPending, time.Now().Add(syncQueue.debounce))
+	return err
+}
+
+// requestSync 单据保存后请求同步，入队失败只记录日志，不影响已保存的单据
+func requestSync(jobType string, targetID int) {
+	if err := enqueueSyncJob(database.DB, jobType, targetID); err != nil {
+		log.Printf("提交同步任务 %s/%d 失败：%v\n", jobType, targetID, err)
+		return
+	}
+	notifySyncWorkers()
+}
+
+// requestSyncAll 为查询出的全部对象请求同步，返回提交的任务数
+func requestSyncAll(jobType, idQuery string) (int, error) {
+	rows, err := database.DB.Query(idQuery)
+	if err != nil {
+		return 0, err
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, id := range ids {
+		if err := enqueueSyncJob(database.DB, jobType, id); err != nil {
+			return 0, err
+		}
+	}
+	notifySyncWorkers()
+	return len(ids), nil
+}
+
+// notifySyncWorkers 唤醒空闲的后台协程，已有未处理的唤醒信号时不重复发送
+func notifySyncWorkers() {
+	select {
+	case syncQueue.wake <- struct{}{}:
+	default:
+	}
+}
+
+// syncWorker 循环领取到期任务执行，没有任务时等待唤醒或定时检查
+func syncWorker() {
+	for {
+		job, err := claimSyncJob()
+		if err != nil {
+			log.Printf("领取同步任务失败：%v\n", err)
+		}
+		if job == nil {
+			select {
+			case <-syncQueue.wake:
+			case <-time.After(syncPollInterval):
+			}
+			continue
+		}
+		runSyncJob(job)
+	}
+}
+
+// claimSyncJob 领取一条到期的等待任务并标记为执行中，多个协程抢同一条任务时只有一个能更新成功
+func claimSyncJob() (*SyncJob, error) {
+	for {
+		var job SyncJob
+		err := database.DB.QueryRow(
+			"SELECT id, job_type, target_id, attempts FROM sync_jobs WHERE status = ? AND run_after <= ? ORDER BY run_after, id LIMIT 1",
+			syncJobPending, time.Now(),
+		).Scan(&job.ID, &job.JobType, &job.TargetID, &job.Attempts)
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		result, err := database.DB.Exec(
+			"UPDATE sync_jobs SET status = ?, attempts = attempts + 1, started_at = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ? AND status = ?",
+			syncJobRunning, time.Now(), job.ID, syncJobPending,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if n, _ := result.RowsAffected(); n == 1 {
+			job.Attempts++
+			return &job, nil
+		}
+	}
+}
+
+// runSyncJob 执行任务并记录结果，panic 按失败处理
+func runSyncJob(job *SyncJob) {
+	err := func() (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("panic: %v", r)
+			}
+		}()
+		handler, ok := syncJobHandlers[job.JobType]
+		if !ok {
+			return fmt.Errorf("unknown sync job type: %s", job.JobType)
+		}
+		return handler(job.TargetID)
+	}()
+
+	now := time.Now()
+	if err == nil {
+		// 执行期间有新请求时重新排队
+		_, err = database.DB.Exec(
+			"UPDATE sync_jobs SET status = CASE WHEN rerun = 1 THEN ? ELSE ? END, attempts = CASE WHEN rerun = 1 THEN 0 ELSE attempts END, rerun = 0, last_error = NULL, run_after = ?, finished_at = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
+			syncJobPending, syncJobDone, now, now, job.ID,
+		)
+		if err != nil {
+			log.Printf("记录同步任务 %d 结果失败：%v\n", job.ID, err)
+		}
+		return
+	}
+
+	log.Printf("同步任务 %s/%d 第 %d 次执行失败：%v\n", job.JobType, job.TargetID, job.Attempts, err)
+	// 未超过最大次数或执行期间有新请求时退避后重试，否则标记为失败
+	_, dbErr := database.DB.Exec(
+		"UPDATE sync_jobs SET status = CASE WHEN rerun = 1 OR attempts < ? THEN ? ELSE ? END, attempts = CASE WHEN rerun = 1 THEN 0 ELSE attempts END, rerun = 0, last_error = ?, run_after = ?, finished_at = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
+		syncQueue.maxAttempts, syncJobPending, syncJobFailed, err.Error(), now.Add(syncRetryDelay(job.Attempts)), now, job.ID,
+	)
+	if dbErr != nil {
+		log.Printf("记录同步任务 %d 结果失败：%v\n", job.ID, dbErr)
+	}
+}
+
+// syncRetryDelay 第 attempts 次失败后的重试间隔
+func syncRetryDelay(attempts int) time.Duration {
+	delay := syncRetryBase
+	for i := 1; i < attempts && delay < syncRetryMax; i++ {
+		delay *= 2
+	}
+	if delay > syncRetryMax {
+		delay = syncRetryMax
+	}
+	return delay
+}
+
+// ========== 同步任务 API ==========
+
+var syncJobListSort = listSort{
+	Fields: map[string]string{
+		"id":         "j.id",
+		"runAfter":   "j.run_after",
+		"finishedAt": "j.finished_at",
+		"attempts":   "j.attempts",
+		"updatedAt":  "j.updated_at",
+	},
+	Default:    "updatedAt",
+	Desc:       true,
+	TieBreaker: "j.id",
+}
+
+const syncJobFrom = `sync_jobs j
+	LEFT JOIN customers c ON j.job_type = 'customer_statement' AND c.id = j.target_id
+	LEFT JOIN suppliers s ON j.job_type = 'supplier_statement' AND s.id = j.target_id`
+
+// getSyncJobs 同步任务列表，可按任务类型、状态、客户/供应商筛选，并返回各状态的任务数
+func getSyncJobs(c *gin.Context) {
+	lq, err := newListQuery(c, syncJobListSort)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	lq.eq("jobType", "j.job_type")
+	lq.eq("status", "j.status")
+	lq.intEq("targetId", "j.target_id")
+	if lq.err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": lq.err.Error()})
+		return
+	}
+
+	total, err := lq.count(syncJobFrom)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count sync jobs: " + err.Error()})
+		return
+	}
+
+	query, args := lq.pageSQL("SELECT j.id, j.job_type, j.target_id, COALESCE(c.name, s.name, ''), j.status, j.attempts, COALESCE(j.last_error, ''), j.run_after, j.started_at, j.finished_at, j.created_at, j.updated_at FROM " + syncJobFrom)
+	rows, err := database.DB.Query(query, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sync jobs: " + err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	jobs := []SyncJob{}
+	for rows.Next() {
+		var j SyncJob
+		if err := rows.Scan(&j.ID, &j.JobType, &j.TargetID, &j.TargetName, &j.Status, &j.Attempts, &j.LastError, &j.RunAfter, &j.StartedAt, &j.FinishedAt, &j.CreatedAt, &j.UpdatedAt); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan sync job: " + err.Error()})
+			return
+		}
+		jobs = append(jobs, j)
+	}
+
+	// 各状态的任务数，不受筛选条件影响
+	summary := gin.H{syncJobPending: 0, syncJobRunning: 0, syncJobDone: 0, syncJobFailed: 0}
+	statusRows, err := database.DB.Query("SELECT status, COUNT(*) FROM sync_jobs GROUP BY status")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count sync jobs: " + err.Error()})
+		return
+	}
+	defer statusRows.Close()
+	for statusRows.Next() {
+		var status string
+		var count int
+		if err := statusRows.Scan(&status, &count); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count sync jobs: " + err.Error()})
+			return
+		}
+		summary[status] = count
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"total":   total,
+		"records": jobs,
+		"summary": summary,
+	})
+}
+
+// retrySyncJob 手动重试同步任务，重新计数并立即排队
+func retrySyncJob(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid sync job ID"})
+		return
+	}
+
+	var jobType string
+	var targetID int
+	err = database.DB.QueryRow("SELECT job_type, target_id FROM sync_jobs WHERE id = ?", id).Scan(&jobType, &targetID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Sync job not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sync job: " + err.Error()})
+		return
+	}
+
+	if err := enqueueSyncJob(database.DB, jobType, targetID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enqueue sync job: " + err.Error()})
+		return
+	}
+	notifySyncWorkers()
+	c.JSON(http.StatusOK, gin.H{"message": "同步任务已重新排队"})
+}
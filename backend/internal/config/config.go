@@ -2,6 +2,7 @@ package config
 
 import (
 	"log"
+	"time"
 
 	"github.com/spf13/viper"
 )
@@ -9,6 +10,9 @@ import (
 type Config struct {
 	Server   ServerConfig
 	Database DatabaseConfig
+	Auth     AuthConfig
+	PDF      PDFConfig
+	Sync     SyncConfig
 }
 
 type ServerConfig struct {
@@ -16,12 +20,43 @@ type ServerConfig struct {
 }
 
 type DatabaseConfig struct {
+	// Driver 数据库类型：mysql（默认）或 sqlite
+	Driver   string
 	Host     string
 	Port     string
 	User     string
 	Password string
 	DBName   string
 	Charset  string
+	// Path SQLite 数据库文件路径
+	Path string
+	// AutoMigrate 启动时是否自动执行待执行的迁移，默认关闭：生产环境先执行 migrate up 再启动，
+	// 启动时只校验结构版本；SQLite 单机部署和开发环境可以打开
+	AutoMigrate bool
+}
+
+type AuthConfig struct {
+	// SessionTTL 登录令牌有效期
+	SessionTTL time.Duration
+	// AdminUsername/AdminPassword 系统中没有任何用户时自动创建的管理员账号
+	AdminUsername string
+	AdminPassword string
+}
+
+type PDFConfig struct {
+	// Enabled 启用销售单、对帐单PDF；启用时 FontPath 必须指向可用的字体，否则拒绝启动
+	Enabled bool
+	// FontPath 生成PDF使用的中文TrueType字体（.ttf），字体会嵌入生成的PDF中
+	FontPath string
+}
+
+type SyncConfig struct {
+	// Workers 同时执行同步任务的后台协程数
+	Workers int
+	// MaxAttempts 同一任务连续失败的最大尝试次数，超过后标记为失败，等待重新请求或手动重试
+	MaxAttempts int
+	// Debounce 请求同步后等待的时间，期间同一对象的重复请求合并为一次
+	Debounce time.Duration
 }
 
 func LoadConfig() *Config {
@@ -35,12 +70,22 @@ func LoadConfig() *Config {
 
 	// 设置默认值
 	viper.SetDefault("SERVER_PORT", "8080")
+	viper.SetDefault("DB_DRIVER", "mysql")
 	viper.SetDefault("DB_HOST", "localhost")
 	viper.SetDefault("DB_PORT", "3306")
 	viper.SetDefault("DB_USER", "root")
 	viper.SetDefault("DB_PASSWORD", "Mengmeng0429.")
 	viper.SetDefault("DB_NAME", "nb2")
 	viper.SetDefault("DB_CHARSET", "utf8mb4")
+	viper.SetDefault("DB_PATH", "nb2.db")
+	viper.SetDefault("DB_AUTO_MIGRATE", false)
+	viper.SetDefault("AUTH_SESSION_TTL", "168h")
+	viper.SetDefault("AUTH_ADMIN_USERNAME", "admin")
+	viper.SetDefault("PDF_ENABLED", true)
+	viper.SetDefault("PDF_FONT_PATH", "")
+	viper.SetDefault("SYNC_WORKERS", 2)
+	viper.SetDefault("SYNC_MAX_ATTEMPTS", 5)
+	viper.SetDefault("SYNC_DEBOUNCE", "2s")
 
 	if err := viper.ReadInConfig(); err != nil {
 		log.Printf("Warning: Could not find config file: %v", err)
@@ -51,12 +96,30 @@ func LoadConfig() *Config {
 			Port: viper.GetString("SERVER_PORT"),
 		},
 		Database: DatabaseConfig{
+			Driver:   viper.GetString("DB_DRIVER"),
 			Host:     viper.GetString("DB_HOST"),
 			Port:     viper.GetString("DB_PORT"),
 			User:     viper.GetString("DB_USER"),
 			Password: viper.GetString("DB_PASSWORD"),
 			DBName:   viper.GetString("DB_NAME"),
 			Charset:  viper.GetString("DB_CHARSET"),
+			Path:     viper.GetString("DB_PATH"),
+
+			AutoMigrate: viper.GetBool("DB_AUTO_MIGRATE"),
+		},
+		Auth: AuthConfig{
+			SessionTTL:    viper.GetDuration("AUTH_SESSION_TTL"),
+			AdminUsername: viper.GetString("AUTH_ADMIN_USERNAME"),
+			AdminPassword: viper.GetString("AUTH_ADMIN_PASSWORD"),
+		},
+		PDF: PDFConfig{
+			Enabled:  viper.GetBool("PDF_ENABLED"),
+			FontPath: viper.GetString("PDF_FONT_PATH"),
+		},
+		Sync: SyncConfig{
+			Workers:     viper.GetInt("SYNC_WORKERS"),
+			MaxAttempts: viper.GetInt("SYNC_MAX_ATTEMPTS"),
+			Debounce:    viper.GetDuration("SYNC_DEBOUNCE"),
 		},
 	}
 
@@ -0,0 +1,55 @@
+package database
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"nb2/internal/config"
+)
+
+func TestInitDBSchemaCheck(t *testing.T) {
+	cfg := &config.DatabaseConfig{Driver: "sqlite", Path: filepath.Join(t.TempDir(), "nb2.db")}
+	defer CloseDB()
+
+	// 新数据库有待执行的迁移，未开启自动迁移时拒绝启动
+	if err := InitDB(cfg); err == nil || !strings.Contains(err.Error(), "migrate up") {
+		t.Fatalf("InitDB without auto-migrate on empty database: err = %v, want pending migrations error", err)
+	}
+	CloseDB()
+
+	cfg.AutoMigrate = true
+	if err := InitDB(cfg); err != nil {
+		t.Fatalf("InitDB with auto-migrate: %v", err)
+	}
+	if version, dirty, err := SchemaVersion(DB); err != nil || dirty || version != LatestVersion() {
+		t.Fatalf("SchemaVersion = %d, %v, %v, want %d", version, dirty, err, LatestVersion())
+	}
+	CloseDB()
+
+	// 已是最新版本，不开启自动迁移也能启动
+	cfg.AutoMigrate = false
+	if err := InitDB(cfg); err != nil {
+		t.Fatalf("InitDB on up-to-date database: %v", err)
+	}
+
+	// 版本高于程序或迁移中断时，即使开启自动迁移也拒绝启动
+	if _, err := DB.Exec("INSERT INTO schema_migrations (version, name) VALUES (?, ?)", LatestVersion()+1, "from_newer_binary"); err != nil {
+		t.Fatal(err)
+	}
+	CloseDB()
+	cfg.AutoMigrate = true
+	if err := InitDB(cfg); err == nil || !strings.Contains(err.Error(), "newer than this binary") {
+		t.Fatalf("InitDB on newer schema: err = %v, want newer schema error", err)
+	}
+	if _, err := DB.Exec("DELETE FROM schema_migrations WHERE version = ?", LatestVersion()+1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DB.Exec("UPDATE schema_migrations SET dirty = 1 WHERE version = ?", LatestVersion()); err != nil {
+		t.Fatal(err)
+	}
+	CloseDB()
+	if err := InitDB(cfg); err == nil || !strings.Contains(err.Error(), "dirty") {
+		t.Fatalf("InitDB on dirty schema: err = %v, want dirty schema error", err)
+	}
+}
@@ -0,0 +1,206 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"nb2/internal/config"
+)
+
+// Dialect 屏蔽不同数据库之间的SQL差异
+// 迁移和业务查询统一以MySQL语法书写，需要差异化的地方通过Dialect生成
+type Dialect interface {
+	// Name 方言名称，与 DB_DRIVER 配置一致
+	Name() string
+	// DriverName database/sql 注册的驱动名
+	DriverName() string
+	// DSN 根据配置生成连接串
+	DSN(config *config.DatabaseConfig) string
+	// TranslateDDL 将MySQL语法的DDL转换为本方言
+	TranslateDDL(stmt string) string
+	// CodeSequence 返回匹配“前缀+纯数字”编码的查询条件及参数，用于生成递增编号
+	CodeSequence(column, prefix string) (string, []interface{})
+	// Upsert 返回按唯一键插入或更新的语句，updateColumns 中包含“=”的项按原样作为赋值表达式
+	Upsert(table string, columns, conflictColumns, updateColumns []string) string
+	// ColumnExists 检查表中是否存在指定字段
+	ColumnExists(db *sql.DB, table, column string) (bool, error)
+	// ForUpdate 返回追加在 SELECT 末尾的行锁子句，读取到的是最新提交的数据
+	ForUpdate() string
+	// JSONArrayContains 返回判断JSON数组列包含某个整数的条件，value 为SQL表达式或占位符
+	JSONArrayContains(column, value string) string
+	// FullTextMatch 返回在多个文本列中查找关键字（子串）的条件及参数，columns 需与全文索引的列一致
+	FullTextMatch(columns []string, keyword string) (string, []interface{})
+}
+
+var dialect Dialect = mysqlDialect{}
+
+// CurrentDialect 当前连接使用的方言
+func CurrentDialect() Dialect {
+	return dialect
+}
+
+// dialectFor 根据驱动名获取方言
+func dialectFor(driver string) (Dialect, error) {
+	switch strings.ToLower(driver) {
+	case "", "mysql":
+		return mysqlDialect{}, nil
+	case "sqlite", "sqlite3":
+		return sqliteDialect{}, nil
+	default:
+		return nil, fmt.Errorf("unsupported database driver: %s", driver)
+	}
+}
+
+// ========== MySQL ==========
+
+type mysqlDialect struct{}
+
+func (mysqlDialect) Name() string { return "mysql" }
+
+func (mysqlDialect) DriverName() string { return "mysql" }
+
+func (mysqlDialect) DSN(config *config.DatabaseConfig) string {
+	return fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=%s&parseTime=True&loc=Local",
+		config.User,
+		config.Password,
+		config.Host,
+		config.Port,
+		config.DBName,
+		config.Charset,
+	)
+}
+
+func (mysqlDialect) TranslateDDL(stmt string) string { return stmt }
+
+func (mysqlDialect) CodeSequence(column, prefix string) (string, []interface{}) {
+	return column + " REGEXP ?", []interface{}{"^" + regexp.QuoteMeta(prefix) + "[0-9]+$"}
+}
+
+func (mysqlDialect) Upsert(table string, columns, conflictColumns, updateColumns []string) string {
+	var sets []string
+	for _, col := range updateColumns {
+		if strings.Contains(col, "=") {
+			sets = append(sets, col)
+			continue
+		}
+		sets = append(sets, fmt.Sprintf("%s = VALUES(%s)", col, col))
+	}
+	return insertSQL(table, columns) + " ON DUPLICATE KEY UPDATE " + strings.Join(sets, ", ")
+}
+
+func (mysqlDialect) ForUpdate() string { return " FOR UPDATE" }
+
+func (mysqlDialect) JSONArrayContains(column, value string) string {
+	return fmt.Sprintf("JSON_CONTAINS(%s, CAST(%s AS JSON))", column, value)
+}
+
+// mysqlNgramTokenSize 全文索引 ngram 分词的词长（ngram_token_size 默认值）
+const mysqlNgramTokenSize = 2
+
+// 全文索引使用 ngram 分词，整个关键字作为短语检索即子串匹配；短语中的布尔运算符按普通字符处理，
+// 只需去掉会提前结束短语的双引号。关键字短于一个分词时索引中查不到，退回对这些列模糊匹配
+func (mysqlDialect) FullTextMatch(columns []string, keyword string) (string, []interface{}) {
+	phrase := strings.TrimSpace(strings.ReplaceAll(keyword, `"`, " "))
+	if utf8.RuneCountInString(phrase) < mysqlNgramTokenSize {
+		return likeAnyColumn(columns, keyword)
+	}
+	return "MATCH(" + strings.Join(columns, ", ") + ") AGAINST (? IN BOOLEAN MODE)", []interface{}{`"` + phrase + `"`}
+}
+
+func (mysqlDialect) ColumnExists(db *sql.DB, table, column string) (bool, error) {
+	var exists bool
+	err := db.QueryRow(
+		"SELECT EXISTS(SELECT 1 FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND COLUMN_NAME = ?)",
+		table, column,
+	).Scan(&exists)
+	return exists, err
+}
+
+// ========== SQLite ==========
+
+type sqliteDialect struct{}
+
+func (sqliteDialect) Name() string { return "sqlite" }
+
+func (sqliteDialect) DriverName() string { return "sqlite" }
+
+func (sqliteDialect) DSN(config *config.DatabaseConfig) string {
+	// 开启外键约束，WAL模式下读写互不阻塞
+	return fmt.Sprintf("file:%s?_pragma=foreign_keys(1)&_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)", config.Path)
+}
+
+var sqliteDDLReplacements = []struct {
+	pattern *regexp.Regexp
+	replace string
+}{
+	{regexp.MustCompile(`(?i)\bINT\s+AUTO_INCREMENT\s+PRIMARY\s+KEY`), "INTEGER PRIMARY KEY AUTOINCREMENT"},
+	{regexp.MustCompile(`(?i)\s*ENGINE\s*=\s*\w+(\s+DEFAULT\s+CHARSET\s*=\s*\w+)?\s*;?\s*$`), ""},
+	{regexp.MustCompile(`(?i)\s+ON\s+UPDATE\s+CURRENT_TIMESTAMP`), ""},
+	{regexp.MustCompile(`(?i)\bUNIQUE\s+KEY\s+\w+\s*\(`), "UNIQUE ("},
+	{regexp.MustCompile(`(?i)\bJSON\b`), "TEXT"},
+	{regexp.MustCompile(`(?i)\bDROP\s+INDEX\s+(\w+)\s+ON\s+\w+`), "DROP INDEX IF EXISTS $1"},
+}
+
+func (sqliteDialect) TranslateDDL(stmt string) string {
+	stmt = strings.TrimSpace(stmt)
+	for _, r := range sqliteDDLReplacements {
+		stmt = r.pattern.ReplaceAllString(stmt, r.replace)
+	}
+	return stmt
+}
+
+func (sqliteDialect) CodeSequence(column, prefix string) (string, []interface{}) {
+	// SQLite 默认没有 REGEXP，用 GLOB 判断前缀且剩余部分全为数字
+	cond := fmt.Sprintf("%s GLOB ? AND substr(%s, ?) NOT GLOB '*[^0-9]*'", column, column)
+	return cond, []interface{}{prefix + "[0-9]*", len(prefix) + 1}
+}
+
+func (sqliteDialect) Upsert(table string, columns, conflictColumns, updateColumns []string) string {
+	var sets []string
+	for _, col := range updateColumns {
+		if strings.Contains(col, "=") {
+			sets = append(sets, col)
+			continue
+		}
+		sets = append(sets, fmt.Sprintf("%s = excluded.%s", col, col))
+	}
+	return insertSQL(table, columns) + " ON CONFLICT(" + strings.Join(conflictColumns, ", ") + ") DO UPDATE SET " + strings.Join(sets, ", ")
+}
+
+// SQLite 同一时间只有一个写事务，不支持也不需要行锁
+func (sqliteDialect) ForUpdate() string { return "" }
+
+func (sqliteDialect) JSONArrayContains(column, value string) string {
+	return fmt.Sprintf("EXISTS (SELECT 1 FROM json_each(%s) WHERE json_each.value = %s)", column, value)
+}
+
+// SQLite 没有中文分词，单机数据量小，直接模糊匹配
+func (sqliteDialect) FullTextMatch(columns []string, keyword string) (string, []interface{}) {
+	return likeAnyColumn(columns, keyword)
+}
+
+func (sqliteDialect) ColumnExists(db *sql.DB, table, column string) (bool, error) {
+	var exists bool
+	err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM pragma_table_info(?) WHERE name = ?)", table, column).Scan(&exists)
+	return exists, err
+}
+
+// insertSQL 生成 INSERT INTO table (cols) VALUES (?, ...) 语句
+func insertSQL(table string, columns []string) string {
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ")
+	return fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", table, strings.Join(columns, ", "), placeholders)
+}
+
+// likeAnyColumn 生成任一列包含关键字的模糊匹配条件
+func likeAnyColumn(columns []string, keyword string) (string, []interface{}) {
+	conds := make([]string, len(columns))
+	args := make([]interface{}, len(columns))
+	for i, column := range columns {
+		conds[i] = column + " LIKE ?"
+		args[i] = "%" + keyword + "%"
+	}
+	return "(" + strings.Join(conds, " OR ") + ")", args
+}
@@ -0,0 +1,48 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMySQLFullTextMatch(t *testing.T) {
+	columns := []string{"name", "phone"}
+	matchSQL := "MATCH(name, phone) AGAINST (? IN BOOLEAN MODE)"
+	likeSQL := "(name LIKE ? OR phone LIKE ?)"
+	tests := []struct {
+		keyword  string
+		wantSQL  string
+		wantArgs []interface{}
+	}{
+		{"张三", matchSQL, []interface{}{`"张三"`}},
+		{"138", matchSQL, []interface{}{`"138"`}},
+		// 布尔运算符出现在短语内按普通字符处理
+		{"c++", matchSQL, []interface{}{`"c++"`}},
+		{"-5", matchSQL, []interface{}{`"-5"`}},
+		{"a*b", matchSQL, []interface{}{`"a*b"`}},
+		{"(1)", matchSQL, []interface{}{`"(1)"`}},
+		{"~@<>", matchSQL, []interface{}{`"~@<>"`}},
+		{`张"三`, matchSQL, []interface{}{`"张 三"`}},
+		{`"张三"`, matchSQL, []interface{}{`"张三"`}},
+		// 短于一个分词时索引中查不到，退回模糊匹配
+		{"张", likeSQL, []interface{}{"%张%", "%张%"}},
+		{"a", likeSQL, []interface{}{"%a%", "%a%"}},
+		{"+", likeSQL, []interface{}{"%+%", "%+%"}},
+		{"-", likeSQL, []interface{}{"%-%", "%-%"}},
+		{">", likeSQL, []interface{}{"%>%", "%>%"}},
+		{"<", likeSQL, []interface{}{"%<%", "%<%"}},
+		{"(", likeSQL, []interface{}{"%(%", "%(%"}},
+		{")", likeSQL, []interface{}{"%)%", "%)%"}},
+		{"~", likeSQL, []interface{}{"%~%", "%~%"}},
+		{"*", likeSQL, []interface{}{"%*%", "%*%"}},
+		{"@", likeSQL, []interface{}{"%@%", "%@%"}},
+		{`"`, likeSQL, []interface{}{`%"%`, `%"%`}},
+		{`"张"`, likeSQL, []interface{}{`%"张"%`, `%"张"%`}},
+	}
+	for _, tt := range tests {
+		gotSQL, gotArgs := mysqlDialect{}.FullTextMatch(columns, tt.keyword)
+		if gotSQL != tt.wantSQL || !reflect.DeepEqual(gotArgs, tt.wantArgs) {
+			t.Errorf("FullTextMatch(%q) = %s %v, want %s %v", tt.keyword, gotSQL, gotArgs, tt.wantSQL, tt.wantArgs)
+		}
+	}
+}
@@ -0,0 +1,304 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"sort"
+)
+
+// MigrationState 单个迁移的执行状态
+type MigrationState struct {
+	Version   int
+	Name      string
+	Applied   bool
+	Dirty     bool
+	AppliedAt string
+}
+
+// columnDefinition 待补齐的字段定义
+type columnDefinition struct {
+	Table      string
+	Column     string
+	Definition string
+}
+
+// LatestVersion 当前程序内置的最新迁移版本
+func LatestVersion() int {
+	if len(migrations) == 0 {
+		return 0
+	}
+	return migrations[len(migrations)-1].Version
+}
+
+// ensureMigrationsTable 创建schema_migrations表（如果不存在）
+func ensureMigrationsTable(db *sql.DB) error {
+	createSQL := `
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INT NOT NULL PRIMARY KEY,
+		name VARCHAR(100) NOT NULL,
+		dirty TINYINT NOT NULL DEFAULT 0,
+		applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+	`
+	if _, err := db.Exec(dialect.TranslateDDL(createSQL)); err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+	return nil
+}
+
+// appliedMigrations 获取已执行的迁移记录，key为版本号
+func appliedMigrations(db *sql.DB) (map[int]MigrationState, error) {
+	rows, err := db.Query("SELECT version, name, dirty, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query schema_migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int]MigrationState)
+	for rows.Next() {
+		var s MigrationState
+		if err := rows.Scan(&s.Version, &s.Name, &s.Dirty, &s.AppliedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan schema_migrations: %w", err)
+		}
+		s.Applied = true
+		applied[s.Version] = s
+	}
+	return applied, rows.Err()
+}
+
+// SchemaVersion 返回数据库当前的结构版本，以及是否存在执行中断（dirty）的迁移
+func SchemaVersion(db *sql.DB) (int, bool, error) {
+	if err := ensureMigrationsTable(db); err != nil {
+		return 0, false, err
+	}
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return 0, false, err
+	}
+
+	version, dirty := 0, false
+	for v, s := range applied {
+		if v > version {
+			version = v
+		}
+		if s.Dirty {
+			dirty = true
+		}
+	}
+	return version, dirty, nil
+}
+
+// MigrationStatus 返回所有迁移（含数据库中存在但程序未知的版本）的执行状态
+func MigrationStatus(db *sql.DB) ([]MigrationState, error) {
+	if err := ensureMigrationsTable(db); err != nil {
+		return nil, err
+	}
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var states []MigrationState
+	for _, m := range migrations {
+		s, ok := applied[m.Version]
+		if !ok {
+			s = MigrationState{Version: m.Version, Name: m.Name}
+		}
+		delete(applied, m.Version)
+		states = append(states, s)
+	}
+	// 数据库中存在但程序不认识的版本（由更新的程序执行）
+	for _, s := range applied {
+		states = append(states, s)
+	}
+	sort.Slice(states, func(i, j int) bool {
+		return states[i].Version < states[j].Version
+	})
+	return states, nil
+}
+
+// CheckSchema 校验数据库结构是否可以被当前程序使用，返回待执行的迁移数量
+func CheckSchema(db *sql.DB) (int, error) {
+	states, err := MigrationStatus(db)
+	if err != nil {
+		return 0, err
+	}
+
+	known := make(map[int]bool, len(migrations))
+	for _, m := range migrations {
+		known[m.Version] = true
+	}
+
+	pending := 0
+	for _, s := range states {
+		if s.Dirty {
+			return 0, fmt.Errorf("database schema is dirty at version %d (%s), fix it manually and run `migrate force %d`", s.Version, s.Name, s.Version)
+		}
+		if s.Applied && !known[s.Version] {
+			return 0, fmt.Errorf("database schema version %d is newer than this binary (latest %d)", s.Version, LatestVersion())
+		}
+		if !s.Applied {
+			pending++
+		}
+	}
+	return pending, nil
+}
+
+// MigrateUp 按顺序执行未执行的迁移，steps<=0 表示全部执行
+func MigrateUp(db *sql.DB, steps int) error {
+	if _, err := CheckSchema(db); err != nil {
+		return err
+	}
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return err
+	}
+
+	count := 0
+	for _, m := range migrations {
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+		if steps > 0 && count >= steps {
+			break
+		}
+		if err := runMigration(db, m, true); err != nil {
+			return err
+		}
+		count++
+	}
+
+	if count == 0 {
+		log.Println("Database schema is up to date")
+	}
+	return nil
+}
+
+// MigrateDown 按倒序回滚最近执行的 steps 个迁移
+func MigrateDown(db *sql.DB, steps int) error {
+	if steps <= 0 {
+		return fmt.Errorf("rollback steps must be greater than 0")
+	}
+	if _, err := CheckSchema(db); err != nil {
+		return err
+	}
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return err
+	}
+
+	count := 0
+	for i := len(migrations) - 1; i >= 0 && count < steps; i-- {
+		m := migrations[i]
+		if _, ok := applied[m.Version]; !ok {
+			continue
+		}
+		if err := runMigration(db, m, false); err != nil {
+			return err
+		}
+		count++
+	}
+	return nil
+}
+
+// ForceVersion 人工修复中断的迁移后，将数据库标记为处于指定版本（清除dirty标记）
+func ForceVersion(db *sql.DB, version int) error {
+	if err := ensureMigrationsTable(db); err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM schema_migrations"); err != nil {
+		return fmt.Errorf("failed to clear schema_migrations: %w", err)
+	}
+	for _, m := range migrations {
+		if m.Version > version {
+			break
+		}
+		if _, err := tx.Exec("INSERT INTO schema_migrations (version, name, dirty) VALUES (?, ?, 0)", m.Version, m.Name); err != nil {
+			return fmt.Errorf("failed to record migration %d: %w", m.Version, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	log.Printf("Database schema forced to version %d", version)
+	return nil
+}
+
+// runMigration 执行单个迁移
+// MySQL 的 DDL 会隐式提交事务，因此先写入 dirty 标记，全部语句成功后再清除
+func runMigration(db *sql.DB, m Migration, up bool) error {
+	direction := "up"
+	statements, overrides := m.Up, m.SQLiteUp
+	if !up {
+		direction = "down"
+		statements, overrides = m.Down, m.SQLiteDown
+	}
+	if dialect.Name() == "sqlite" && overrides != nil {
+		statements = overrides
+	}
+
+	if up {
+		_, err := db.Exec("INSERT INTO schema_migrations (version, name, dirty) VALUES (?, ?, 1)", m.Version, m.Name)
+		if err != nil {
+			return fmt.Errorf("failed to mark migration %d as dirty: %w", m.Version, err)
+		}
+	} else {
+		_, err := db.Exec("UPDATE schema_migrations SET dirty = 1 WHERE version = ?", m.Version)
+		if err != nil {
+			return fmt.Errorf("failed to mark migration %d as dirty: %w", m.Version, err)
+		}
+	}
+
+	for _, stmt := range statements {
+		if _, err := db.Exec(dialect.TranslateDDL(stmt)); err != nil {
+			return fmt.Errorf("migration %d_%s %s failed: %w", m.Version, m.Name, direction, err)
+		}
+	}
+	if up && m.UpFunc != nil {
+		if err := m.UpFunc(db); err != nil {
+			return fmt.Errorf("migration %d_%s %s failed: %w", m.Version, m.Name, direction, err)
+		}
+	}
+
+	var err error
+	if up {
+		_, err = db.Exec("UPDATE schema_migrations SET dirty = 0, applied_at = CURRENT_TIMESTAMP WHERE version = ?", m.Version)
+	} else {
+		_, err = db.Exec("DELETE FROM schema_migrations WHERE version = ?", m.Version)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to record migration %d: %w", m.Version, err)
+	}
+
+	log.Printf("Migration %d_%s %s applied successfully", m.Version, m.Name, direction)
+	return nil
+}
+
+// addMissingColumns 为已存在的表补齐缺失的字段
+func addMissingColumns(db *sql.DB, columns []columnDefinition) error {
+	for _, col := range columns {
+		exists, err := dialect.ColumnExists(db, col.Table, col.Column)
+		if err != nil {
+			return fmt.Errorf("failed to inspect column %s.%s: %w", col.Table, col.Column, err)
+		}
+		if exists {
+			continue
+		}
+
+		alterSQL := fmt.Sprintf("ALTER TABLE %s ADD COLUMN `%s` %s", col.Table, col.Column, col.Definition)
+		if _, err := db.Exec(dialect.TranslateDDL(alterSQL)); err != nil {
+			return fmt.Errorf("failed to add column %s.%s: %w", col.Table, col.Column, err)
+		}
+		log.Printf("Added missing column %s.%s", col.Table, col.Column)
+	}
+	return nil
+}
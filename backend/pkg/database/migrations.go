@@ -0,0 +1,726 @@
+package database
+
+import "database/sql"
+
+// Migration 数据库结构迁移，Version 必须严格递增且发布后不可修改
+type Migration struct {
+	Version int
+	Name    string
+	Up      []string
+	Down    []string
+	// SQLiteUp/SQLiteDown 无法自动转换为SQLite语法时使用（可选）
+	SQLiteUp   []string
+	SQLiteDown []string
+	// UpFunc 在 Up 语句之后执行，用于无法用固定SQL表达的迁移（可选）
+	UpFunc func(db *sql.DB) error
+}
+
+// migrations 按版本号升序排列的全部迁移
+// 新增表或字段时只能追加新的迁移，不能修改已发布的迁移
+var migrations = []Migration{
+	{
+		// 基线迁移：使用 IF NOT EXISTS，已有数据库执行后结构保持不变
+		Version: 1,
+		Name:    "init_schema",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS products (
+				id INT AUTO_INCREMENT PRIMARY KEY,
+				name VARCHAR(255) NOT NULL,
+				code VARCHAR(50) UNIQUE,
+				category VARCHAR(100),
+				brand VARCHAR(100),
+				unit VARCHAR(50),
+				price DECIMAL(10, 2) NOT NULL,
+				status TINYINT DEFAULT 1,
+				remark TEXT,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+			) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+			`CREATE TABLE IF NOT EXISTS dictionary_types (
+				id INT AUTO_INCREMENT PRIMARY KEY,
+				code VARCHAR(20) NOT NULL UNIQUE,
+				name VARCHAR(50) NOT NULL,
+				status TINYINT DEFAULT 1,
+				sort INT DEFAULT 0,
+				remark TEXT,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+			) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+			`CREATE TABLE IF NOT EXISTS dictionary_items (
+				id INT AUTO_INCREMENT PRIMARY KEY,
+				code VARCHAR(20) NOT NULL UNIQUE,
+				name VARCHAR(50) NOT NULL,
+				dict_type_code VARCHAR(20) NOT NULL,
+				status TINYINT DEFAULT 1,
+				sort INT DEFAULT 0,
+				remark TEXT,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+				FOREIGN KEY (dict_type_code) REFERENCES dictionary_types(code) ON DELETE CASCADE
+			) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+			"CREATE TABLE IF NOT EXISTS settings (" +
+				"id INT AUTO_INCREMENT PRIMARY KEY," +
+				"`key` VARCHAR(50) NOT NULL UNIQUE," +
+				"value VARCHAR(255) NOT NULL," +
+				"description TEXT," +
+				"created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP," +
+				"updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP" +
+				") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4",
+			`CREATE TABLE IF NOT EXISTS customers (
+				id INT AUTO_INCREMENT PRIMARY KEY,
+				code VARCHAR(20) UNIQUE,
+				name VARCHAR(100) NOT NULL,
+				phone VARCHAR(20) NOT NULL,
+				province VARCHAR(50),
+				city VARCHAR(50),
+				district VARCHAR(50),
+				address VARCHAR(200),
+				company VARCHAR(100),
+				status TINYINT DEFAULT 1,
+				remark TEXT,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+			) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+			`CREATE TABLE IF NOT EXISTS invoices (
+				id INT AUTO_INCREMENT PRIMARY KEY,
+				customer_id INT NOT NULL,
+				company VARCHAR(100) NOT NULL,
+				tax_number VARCHAR(20) NOT NULL UNIQUE,
+				bank VARCHAR(100) NOT NULL,
+				bank_account VARCHAR(30) NOT NULL,
+				branch_address VARCHAR(200),
+				status TINYINT DEFAULT 1,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+				FOREIGN KEY (customer_id) REFERENCES customers(id) ON DELETE CASCADE
+			) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+			`CREATE TABLE IF NOT EXISTS payments (
+				id INT AUTO_INCREMENT PRIMARY KEY,
+				code VARCHAR(20) UNIQUE,
+				payment_date DATE NOT NULL,
+				customer_id INT NOT NULL,
+				sale_order_ids JSON,
+				amount DECIMAL(12, 2) NOT NULL,
+				payment_method VARCHAR(50),
+				account VARCHAR(50),
+				payer_company VARCHAR(100),
+				remark TEXT,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+				FOREIGN KEY (customer_id) REFERENCES customers(id) ON DELETE CASCADE
+			) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+			`CREATE TABLE IF NOT EXISTS sale_orders (
+				id INT AUTO_INCREMENT PRIMARY KEY,
+				code VARCHAR(20) UNIQUE,
+				total_amount DECIMAL(12, 2) NOT NULL,
+				paid_amount DECIMAL(12, 2) NOT NULL DEFAULT 0,
+				create_time TIMESTAMP NOT NULL,
+				customer_id INT NOT NULL,
+				customer_name VARCHAR(100) NOT NULL,
+				customer_phone VARCHAR(20) NOT NULL,
+				customer_city VARCHAR(50),
+				remark TEXT,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+				FOREIGN KEY (customer_id) REFERENCES customers(id) ON DELETE CASCADE
+			) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+			`CREATE TABLE IF NOT EXISTS sale_order_items (
+				id INT AUTO_INCREMENT PRIMARY KEY,
+				sale_order_id INT NOT NULL,
+				product_id INT NOT NULL,
+				product_code VARCHAR(50),
+				product_name VARCHAR(255) NOT NULL,
+				quantity DECIMAL(10, 2) NOT NULL,
+				unit VARCHAR(50) NOT NULL,
+				price DECIMAL(10, 2) NOT NULL,
+				total DECIMAL(12, 2) NOT NULL,
+				discount_amount DECIMAL(10, 2) NOT NULL DEFAULT 0,
+				remark TEXT,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+				FOREIGN KEY (sale_order_id) REFERENCES sale_orders(id) ON DELETE CASCADE
+			) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+			`CREATE TABLE IF NOT EXISTS statement_records (
+				id INT AUTO_INCREMENT PRIMARY KEY,
+				customer_id INT NOT NULL,
+				customer_code VARCHAR(20) NOT NULL,
+				customer_name VARCHAR(100) NOT NULL,
+				date DATE NOT NULL,
+				sale_amount DECIMAL(12, 2) DEFAULT 0,
+				payment_amount DECIMAL(12, 2) DEFAULT 0,
+				balance DECIMAL(12, 2) NOT NULL,
+				remark TEXT,
+				source_type VARCHAR(20) NOT NULL,
+				source_id INT NOT NULL,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+				FOREIGN KEY (customer_id) REFERENCES customers(id) ON DELETE CASCADE,
+				UNIQUE KEY unique_source (source_type, source_id)
+			) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+		},
+		Down: []string{
+			"DROP TABLE IF EXISTS statement_records",
+			"DROP TABLE IF EXISTS sale_order_items",
+			"DROP TABLE IF EXISTS sale_orders",
+			"DROP TABLE IF EXISTS payments",
+			"DROP TABLE IF EXISTS invoices",
+			"DROP TABLE IF EXISTS customers",
+			"DROP TABLE IF EXISTS settings",
+			"DROP TABLE IF EXISTS dictionary_items",
+			"DROP TABLE IF EXISTS dictionary_types",
+			"DROP TABLE IF EXISTS products",
+		},
+	}, {
+		// 线上库的表由早期版本创建，CREATE TABLE IF NOT EXISTS 不会补齐后来加的字段
+		Version: 2,
+		Name:    "reconcile_baseline_columns",
+		UpFunc: func(db *sql.DB) error {
+			return addMissingColumns(db, []columnDefinition{
+				{"products", "category", "VARCHAR(100)"},
+				{"products", "brand", "VARCHAR(100)"},
+				{"products", "unit", "VARCHAR(50)"},
+				{"products", "status", "TINYINT DEFAULT 1"},
+				{"products", "remark", "TEXT"},
+				{"dictionary_types", "status", "TINYINT DEFAULT 1"},
+				{"dictionary_types", "sort", "INT DEFAULT 0"},
+				{"dictionary_types", "remark", "TEXT"},
+				{"dictionary_items", "status", "TINYINT DEFAULT 1"},
+				{"dictionary_items", "sort", "INT DEFAULT 0"},
+				{"dictionary_items", "remark", "TEXT"},
+				{"settings", "description", "TEXT"},
+				{"customers", "province", "VARCHAR(50)"},
+				{"customers", "city", "VARCHAR(50)"},
+				{"customers", "district", "VARCHAR(50)"},
+				{"customers", "address", "VARCHAR(200)"},
+				{"customers", "company", "VARCHAR(100)"},
+				{"customers", "status", "TINYINT DEFAULT 1"},
+				{"customers", "remark", "TEXT"},
+				{"invoices", "branch_address", "VARCHAR(200)"},
+				{"invoices", "status", "TINYINT DEFAULT 1"},
+				{"payments", "sale_order_ids", "JSON"},
+				{"payments", "payment_method", "VARCHAR(50)"},
+				{"payments", "account", "VARCHAR(50)"},
+				{"payments", "payer_company", "VARCHAR(100)"},
+				{"payments", "remark", "TEXT"},
+				{"sale_orders", "paid_amount", "DECIMAL(12, 2) NOT NULL DEFAULT 0"},
+				{"sale_orders", "customer_city", "VARCHAR(50)"},
+				{"sale_orders", "remark", "TEXT"},
+				{"sale_order_items", "product_code", "VARCHAR(50)"},
+				{"sale_order_items", "discount_amount", "DECIMAL(10, 2) NOT NULL DEFAULT 0"},
+				{"sale_order_items", "remark", "TEXT"},
+				{"statement_records", "remark", "TEXT"},
+			})
+		},
+	},
+	{
+		Version: 3,
+		Name:    "create_seed_versions",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS seed_versions (
+				version INT NOT NULL PRIMARY KEY,
+				name VARCHAR(100) NOT NULL,
+				applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+		},
+		Down: []string{
+			"DROP TABLE IF EXISTS seed_versions",
+		},
+	},
+	{
+		Version: 4,
+		Name:    "create_users_and_sessions",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS users (
+				id INT AUTO_INCREMENT PRIMARY KEY,
+				username VARCHAR(50) NOT NULL UNIQUE,
+				password_hash VARCHAR(100) NOT NULL,
+				name VARCHAR(50),
+				status TINYINT DEFAULT 1,
+				last_login_at TIMESTAMP NULL,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+			) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+			`CREATE TABLE IF NOT EXISTS user_sessions (
+				id INT AUTO_INCREMENT PRIMARY KEY,
+				token_hash CHAR(64) NOT NULL UNIQUE,
+				user_id INT NOT NULL,
+				expires_at TIMESTAMP NOT NULL,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+			) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+		},
+		Down: []string{
+			"DROP TABLE IF EXISTS user_sessions",
+			"DROP TABLE IF EXISTS users",
+		},
+	},
+	{
+		Version: 5,
+		Name:    "create_roles_and_permissions",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS roles (
+				id INT AUTO_INCREMENT PRIMARY KEY,
+				code VARCHAR(50) NOT NULL UNIQUE,
+				name VARCHAR(50) NOT NULL,
+				remark TEXT,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+			) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+			`CREATE TABLE IF NOT EXISTS role_permissions (
+				id INT AUTO_INCREMENT PRIMARY KEY,
+				role_id INT NOT NULL,
+				permission VARCHAR(50) NOT NULL,
+				FOREIGN KEY (role_id) REFERENCES roles(id) ON DELETE CASCADE,
+				UNIQUE KEY unique_role_permission (role_id, permission)
+			) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+			`CREATE TABLE IF NOT EXISTS user_roles (
+				id INT AUTO_INCREMENT PRIMARY KEY,
+				user_id INT NOT NULL,
+				role_id INT NOT NULL,
+				FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+				FOREIGN KEY (role_id) REFERENCES roles(id) ON DELETE CASCADE,
+				UNIQUE KEY unique_user_role (user_id, role_id)
+			) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+		},
+		Down: []string{
+			"DROP TABLE IF EXISTS user_roles",
+			"DROP TABLE IF EXISTS role_permissions",
+			"DROP TABLE IF EXISTS roles",
+		},
+	},
+	{
+		Version: 6,
+		Name:    "create_audit_logs",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS audit_logs (
+				id INT AUTO_INCREMENT PRIMARY KEY,
+				entity_type VARCHAR(50) NOT NULL,
+				entity_id VARCHAR(50) NOT NULL,
+				action VARCHAR(20) NOT NULL,
+				user_id INT,
+				username VARCHAR(50),
+				ip VARCHAR(50),
+				before_data JSON,
+				after_data JSON,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+			"CREATE INDEX idx_audit_logs_entity ON audit_logs (entity_type, entity_id)",
+			"CREATE INDEX idx_audit_logs_user ON audit_logs (user_id)",
+			"CREATE INDEX idx_audit_logs_created_at ON audit_logs (created_at)",
+		},
+		Down: []string{
+			"DROP TABLE IF EXISTS audit_logs",
+		},
+	},
+	{
+		Version: 7,
+		Name:    "create_inventory",
+		Up: []string{
+			"ALTER TABLE products ADD COLUMN stock_quantity DECIMAL(12, 2) NOT NULL DEFAULT 0",
+			"ALTER TABLE products ADD COLUMN low_stock_threshold DECIMAL(12, 2) NOT NULL DEFAULT 0",
+			`CREATE TABLE IF NOT EXISTS stock_movements (
+				id INT AUTO_INCREMENT PRIMARY KEY,
+				product_id INT NOT NULL,
+				movement_type VARCHAR(20) NOT NULL,
+				quantity DECIMAL(12, 2) NOT NULL,
+				balance DECIMAL(12, 2) NOT NULL,
+				source_type VARCHAR(20),
+				source_id INT,
+				reason TEXT,
+				user_id INT,
+				username VARCHAR(50),
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				FOREIGN KEY (product_id) REFERENCES products(id) ON DELETE CASCADE
+			) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+			"CREATE INDEX idx_stock_movements_product ON stock_movements (product_id, id)",
+			"CREATE INDEX idx_stock_movements_source ON stock_movements (source_type, source_id)",
+		},
+		Down: []string{
+			"DROP TABLE IF EXISTS stock_movements",
+			"ALTER TABLE products DROP COLUMN low_stock_threshold",
+			"ALTER TABLE products DROP COLUMN stock_quantity",
+		},
+	},
+	{
+		Version: 8,
+		Name:    "create_suppliers_and_purchase_orders",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS suppliers (
+				id INT AUTO_INCREMENT PRIMARY KEY,
+				code VARCHAR(20) UNIQUE,
+				name VARCHAR(100) NOT NULL,
+				contact VARCHAR(50),
+				phone VARCHAR(20),
+				province VARCHAR(50),
+				city VARCHAR(50),
+				district VARCHAR(50),
+				address VARCHAR(200),
+				bank VARCHAR(100),
+				bank_account VARCHAR(30),
+				tax_number VARCHAR(20),
+				status TINYINT DEFAULT 1,
+				remark TEXT,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+			) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+			`CREATE TABLE IF NOT EXISTS purchase_orders (
+				id INT AUTO_INCREMENT PRIMARY KEY,
+				code VARCHAR(30) UNIQUE,
+				order_date DATE NOT NULL,
+				supplier_id INT NOT NULL,
+				supplier_name VARCHAR(100) NOT NULL,
+				status VARCHAR(20) NOT NULL DEFAULT 'draft',
+				total_amount DECIMAL(12, 2) NOT NULL,
+				received_amount DECIMAL(12, 2) NOT NULL DEFAULT 0,
+				remark TEXT,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+				FOREIGN KEY (supplier_id) REFERENCES suppliers(id)
+			) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+			`CREATE TABLE IF NOT EXISTS purchase_order_items (
+				id INT AUTO_INCREMENT PRIMARY KEY,
+				purchase_order_id INT NOT NULL,
+				product_id INT NOT NULL,
+				product_code VARCHAR(50),
+				product_name VARCHAR(255) NOT NULL,
+				quantity DECIMAL(10, 2) NOT NULL,
+				received_quantity DECIMAL(10, 2) NOT NULL DEFAULT 0,
+				unit VARCHAR(50) NOT NULL,
+				price DECIMAL(10, 2) NOT NULL,
+				total DECIMAL(12, 2) NOT NULL,
+				remark TEXT,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+				FOREIGN KEY (purchase_order_id) REFERENCES purchase_orders(id) ON DELETE CASCADE
+			) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+			`CREATE TABLE IF NOT EXISTS purchase_receipts (
+				id INT AUTO_INCREMENT PRIMARY KEY,
+				purchase_order_id INT NOT NULL,
+				supplier_id INT NOT NULL,
+				receipt_date DATE NOT NULL,
+				amount DECIMAL(12, 2) NOT NULL,
+				remark TEXT,
+				user_id INT,
+				username VARCHAR(50),
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				FOREIGN KEY (purchase_order_id) REFERENCES purchase_orders(id),
+				FOREIGN KEY (supplier_id) REFERENCES suppliers(id)
+			) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+			`CREATE TABLE IF NOT EXISTS purchase_receipt_items (
+				id INT AUTO_INCREMENT PRIMARY KEY,
+				receipt_id INT NOT NULL,
+				purchase_order_item_id INT NOT NULL,
+				product_id INT NOT NULL,
+				quantity DECIMAL(10, 2) NOT NULL,
+				price DECIMAL(10, 2) NOT NULL,
+				amount DECIMAL(12, 2) NOT NULL,
+				FOREIGN KEY (receipt_id) REFERENCES purchase_receipts(id) ON DELETE CASCADE,
+				FOREIGN KEY (purchase_order_item_id) REFERENCES purchase_order_items(id)
+			) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+			"CREATE INDEX idx_purchase_orders_supplier ON purchase_orders (supplier_id, order_date)",
+			"CREATE INDEX idx_purchase_receipts_order ON purchase_receipts (purchase_order_id)",
+			"CREATE INDEX idx_purchase_receipts_supplier ON purchase_receipts (supplier_id, receipt_date)",
+		},
+		Down: []string{
+			"DROP TABLE IF EXISTS purchase_receipt_items",
+			"DROP TABLE IF EXISTS purchase_receipts",
+			"DROP TABLE IF EXISTS purchase_order_items",
+			"DROP TABLE IF EXISTS purchase_orders",
+			"DROP TABLE IF EXISTS suppliers",
+		},
+	},
+	{
+		Version: 9,
+		Name:    "create_supplier_payments_and_statements",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS supplier_payments (
+				id INT AUTO_INCREMENT PRIMARY KEY,
+				code VARCHAR(20) UNIQUE,
+				payment_date DATE NOT NULL,
+				supplier_id INT NOT NULL,
+				amount DECIMAL(12, 2) NOT NULL,
+				payment_method VARCHAR(50),
+				account VARCHAR(50),
+				remark TEXT,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+				FOREIGN KEY (supplier_id) REFERENCES suppliers(id)
+			) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+			`CREATE TABLE IF NOT EXISTS supplier_statement_records (
+				id INT AUTO_INCREMENT PRIMARY KEY,
+				supplier_id INT NOT NULL,
+				supplier_code VARCHAR(20) NOT NULL,
+				supplier_name VARCHAR(100) NOT NULL,
+				date DATE NOT NULL,
+				purchase_amount DECIMAL(12, 2) DEFAULT 0,
+				payment_amount DECIMAL(12, 2) DEFAULT 0,
+				balance DECIMAL(12, 2) NOT NULL,
+				remark TEXT,
+				source_type VARCHAR(20) NOT NULL,
+				source_id INT NOT NULL,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+				FOREIGN KEY (supplier_id) REFERENCES suppliers(id) ON DELETE CASCADE,
+				UNIQUE KEY unique_supplier_source (source_type, source_id)
+			) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+			"CREATE INDEX idx_supplier_payments_supplier ON supplier_payments (supplier_id, payment_date)",
+			"CREATE INDEX idx_supplier_statement_records_supplier ON supplier_statement_records (supplier_id, date)",
+		},
+		Down: []string{
+			"DROP TABLE IF EXISTS supplier_statement_records",
+			"DROP TABLE IF EXISTS supplier_payments",
+		},
+	},
+	{
+		Version: 10,
+		Name:    "add_sale_order_header_fields",
+		Up: []string{
+			"ALTER TABLE sale_orders ADD COLUMN order_type VARCHAR(20) NOT NULL DEFAULT '门店销售'",
+			"ALTER TABLE sale_orders ADD COLUMN freight DECIMAL(10, 2) NOT NULL DEFAULT 0",
+			"ALTER TABLE sale_orders ADD COLUMN logistics_company VARCHAR(100)",
+			"ALTER TABLE sale_orders ADD COLUMN tracking_number VARCHAR(50)",
+			"ALTER TABLE sale_orders ADD COLUMN payable_amount DECIMAL(12, 2) NOT NULL DEFAULT 0",
+			"ALTER TABLE sale_orders ADD COLUMN invoice_status VARCHAR(20) NOT NULL DEFAULT '未开票'",
+			"ALTER TABLE sale_orders ADD COLUMN payment_status VARCHAR(20) NOT NULL DEFAULT '待付款'",
+			// 历史订单没有运费，应付金额即商品总价
+			"UPDATE sale_orders SET payable_amount = total_amount + freight",
+		},
+		Down: []string{
+			"ALTER TABLE sale_orders DROP COLUMN payment_status",
+			"ALTER TABLE sale_orders DROP COLUMN invoice_status",
+			"ALTER TABLE sale_orders DROP COLUMN payable_amount",
+			"ALTER TABLE sale_orders DROP COLUMN tracking_number",
+			"ALTER TABLE sale_orders DROP COLUMN logistics_company",
+			"ALTER TABLE sale_orders DROP COLUMN freight",
+			"ALTER TABLE sale_orders DROP COLUMN order_type",
+		},
+	},
+	{
+		Version: 11,
+		Name:    "create_sale_order_status_logs",
+		Up: []string{
+			"ALTER TABLE sale_orders ADD COLUMN closed_at TIMESTAMP NULL",
+			"ALTER TABLE sale_orders ADD COLUMN close_reason VARCHAR(255)",
+			`CREATE TABLE IF NOT EXISTS sale_order_status_logs (
+				id INT AUTO_INCREMENT PRIMARY KEY,
+				sale_order_id INT NOT NULL,
+				action VARCHAR(20) NOT NULL,
+				reason VARCHAR(255) NOT NULL,
+				user_id INT,
+				username VARCHAR(50),
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				FOREIGN KEY (sale_order_id) REFERENCES sale_orders(id) ON DELETE CASCADE
+			) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+			"CREATE INDEX idx_sale_order_status_logs_order ON sale_order_status_logs (sale_order_id, id)",
+			"CREATE INDEX idx_sale_orders_payment_status ON sale_orders (payment_status)",
+		},
+		Down: []string{
+			"DROP INDEX idx_sale_orders_payment_status ON sale_orders",
+			"DROP TABLE IF EXISTS sale_order_status_logs",
+			"ALTER TABLE sale_orders DROP COLUMN close_reason",
+			"ALTER TABLE sale_orders DROP COLUMN closed_at",
+		},
+	},
+	{
+		Version: 12,
+		Name:    "create_payment_allocations",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS payment_allocations (
+				id INT AUTO_INCREMENT PRIMARY KEY,
+				payment_id INT NOT NULL,
+				sale_order_id INT NOT NULL,
+				amount DECIMAL(12, 2) NOT NULL,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				UNIQUE KEY unique_payment_allocation (payment_id, sale_order_id),
+				FOREIGN KEY (payment_id) REFERENCES payments(id) ON DELETE CASCADE,
+				FOREIGN KEY (sale_order_id) REFERENCES sale_orders(id) ON DELETE CASCADE
+			) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+			"CREATE INDEX idx_payment_allocations_sale_order ON payment_allocations (sale_order_id)",
+		},
+		Down: []string{
+			"DROP TABLE IF EXISTS payment_allocations",
+		},
+	},
+	{
+		Version: 13,
+		Name:    "add_sale_order_item_quantity_detail",
+		Up: []string{
+			"ALTER TABLE sale_order_items ADD COLUMN piece_count INT NOT NULL DEFAULT 0",
+			"ALTER TABLE sale_order_items ADD COLUMN quantity_detail VARCHAR(100) NOT NULL DEFAULT ''",
+		},
+		Down: []string{
+			"ALTER TABLE sale_order_items DROP COLUMN quantity_detail",
+			"ALTER TABLE sale_order_items DROP COLUMN piece_count",
+		},
+	},
+	{
+		Version: 14,
+		Name:    "add_pinyin_search_columns",
+		Up: []string{
+			"ALTER TABLE customers ADD COLUMN name_pinyin VARCHAR(255) NOT NULL DEFAULT ''",
+			"ALTER TABLE customers ADD COLUMN name_initials VARCHAR(100) NOT NULL DEFAULT ''",
+			"ALTER TABLE customers ADD COLUMN company_pinyin VARCHAR(255) NOT NULL DEFAULT ''",
+			"ALTER TABLE customers ADD COLUMN company_initials VARCHAR(100) NOT NULL DEFAULT ''",
+			"ALTER TABLE products ADD COLUMN name_pinyin VARCHAR(255) NOT NULL DEFAULT ''",
+			"ALTER TABLE products ADD COLUMN name_initials VARCHAR(100) NOT NULL DEFAULT ''",
+			"ALTER TABLE products ADD COLUMN brand_pinyin VARCHAR(255) NOT NULL DEFAULT ''",
+			"ALTER TABLE products ADD COLUMN brand_initials VARCHAR(100) NOT NULL DEFAULT ''",
+			"CREATE INDEX idx_customers_name_pinyin ON customers (name_pinyin)",
+			"CREATE INDEX idx_customers_name_initials ON customers (name_initials)",
+			"CREATE INDEX idx_products_name_pinyin ON products (name_pinyin)",
+			"CREATE INDEX idx_products_name_initials ON products (name_initials)",
+		},
+		Down: []string{
+			"DROP INDEX idx_products_name_initials ON products",
+			"DROP INDEX idx_products_name_pinyin ON products",
+			"DROP INDEX idx_customers_name_initials ON customers",
+			"DROP INDEX idx_customers_name_pinyin ON customers",
+			"ALTER TABLE products DROP COLUMN brand_initials",
+			"ALTER TABLE products DROP COLUMN brand_pinyin",
+			"ALTER TABLE products DROP COLUMN name_initials",
+			"ALTER TABLE products DROP COLUMN name_pinyin",
+			"ALTER TABLE customers DROP COLUMN company_initials",
+			"ALTER TABLE customers DROP COLUMN company_pinyin",
+			"ALTER TABLE customers DROP COLUMN name_initials",
+			"ALTER TABLE customers DROP COLUMN name_pinyin",
+		},
+	},
+	{
+		// 客户单框搜索：文本字段（含手机号）走 ngram 全文索引，编号、税号和银行账号按开头匹配走普通索引
+		// SQLite 没有 ngram 分词，搜索退回模糊匹配，只建普通索引
+		Version: 15,
+		Name:    "add_customer_search_indexes",
+		Up: []string{
+			"CREATE INDEX idx_customers_status ON customers (status)",
+			"ALTER TABLE customers ADD FULLTEXT INDEX ft_customers_search (name, phone, province, city, district, address, company, remark) WITH PARSER ngram",
+			"CREATE INDEX idx_invoices_customer ON invoices (customer_id)",
+			"CREATE INDEX idx_invoices_bank_account ON invoices (bank_account)",
+		},
+		Down: []string{
+			"DROP INDEX idx_invoices_bank_account ON invoices",
+			"DROP INDEX idx_invoices_customer ON invoices",
+			"ALTER TABLE customers DROP INDEX ft_customers_search",
+			"DROP INDEX idx_customers_status ON customers",
+		},
+		SQLiteUp: []string{
+			"CREATE INDEX idx_customers_status ON customers (status)",
+			"CREATE INDEX idx_invoices_customer ON invoices (customer_id)",
+			"CREATE INDEX idx_invoices_bank_account ON invoices (bank_account)",
+		},
+		SQLiteDown: []string{
+			"DROP INDEX idx_invoices_bank_account ON invoices",
+			"DROP INDEX idx_invoices_customer ON invoices",
+			"DROP INDEX idx_customers_status ON customers",
+		},
+	},
+	{
+		// 对帐单改为按单据追加分录，同一单据修改后会有原分录、冲销分录和新分录
+		Version: 16,
+		Name:    "statement_records_ledger",
+		Up: []string{
+			"ALTER TABLE statement_records DROP INDEX unique_source",
+			"ALTER TABLE statement_records ADD COLUMN entry_type VARCHAR(20) NOT NULL DEFAULT 'entry'",
+			"ALTER TABLE statement_records ADD COLUMN reversal_of INT NULL",
+			"CREATE INDEX idx_statement_records_customer_date ON statement_records (customer_id, date, id)",
+			"CREATE INDEX idx_statement_records_customer_source ON statement_records (customer_id, source_type, source_id)",
+		},
+		// SQLite 不能删除建表时的唯一约束，需要重建表
+		SQLiteUp: []string{
+			`CREATE TABLE statement_records_ledger (
+				id INT AUTO_INCREMENT PRIMARY KEY,
+				customer_id INT NOT NULL,
+				customer_code VARCHAR(20) NOT NULL,
+				customer_name VARCHAR(100) NOT NULL,
+				date DATE NOT NULL,
+				sale_amount DECIMAL(12, 2) DEFAULT 0,
+				payment_amount DECIMAL(12, 2) DEFAULT 0,
+				balance DECIMAL(12, 2) NOT NULL,
+				remark TEXT,
+				source_type VARCHAR(20) NOT NULL,
+				source_id INT NOT NULL,
+				entry_type VARCHAR(20) NOT NULL DEFAULT 'entry',
+				reversal_of INT NULL,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				FOREIGN KEY (customer_id) REFERENCES customers(id) ON DELETE CASCADE
+			)`,
+			`INSERT INTO statement_records_ledger (id, customer_id, customer_code, customer_name, date, sale_amount, payment_amount, balance, remark, source_type, source_id, created_at, updated_at)
+				SELECT id, customer_id, customer_code, customer_name, date, sale_amount, payment_amount, balance, remark, source_type, source_id, created_at, updated_at FROM statement_records`,
+			"DROP TABLE statement_records",
+			"ALTER TABLE statement_records_ledger RENAME TO statement_records",
+			"CREATE INDEX idx_statement_records_customer_date ON statement_records (customer_id, date, id)",
+			"CREATE INDEX idx_statement_records_customer_source ON statement_records (customer_id, source_type, source_id)",
+		},
+		// 回滚后每个单据只能保留一条记录，清空后由旧版本的同步任务重新生成
+		Down: []string{
+			"DELETE FROM statement_records",
+			// MySQL 建复合索引时会删掉外键自动创建的索引，先补一个才能删除复合索引
+			"CREATE INDEX idx_statement_records_customer ON statement_records (customer_id)",
+			"DROP INDEX idx_statement_records_customer_source ON statement_records",
+			"DROP INDEX idx_statement_records_customer_date ON statement_records",
+			"ALTER TABLE statement_records DROP COLUMN reversal_of",
+			"ALTER TABLE statement_records DROP COLUMN entry_type",
+			"CREATE UNIQUE INDEX unique_source ON statement_records (source_type, source_id)",
+		},
+	},
+	{
+		// 后台同步任务队列，同一对象只保留一条任务，重复请求合并
+		Version: 17,
+		Name:    "create_sync_jobs",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS sync_jobs (
+				id INT AUTO_INCREMENT PRIMARY KEY,
+				job_type VARCHAR(30) NOT NULL,
+				target_id INT NOT NULL,
+				status VARCHAR(20) NOT NULL DEFAULT 'pending',
+				rerun TINYINT NOT NULL DEFAULT 0,
+				attempts INT NOT NULL DEFAULT 0,
+				last_error TEXT,
+				run_after TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				started_at TIMESTAMP NULL,
+				finished_at TIMESTAMP NULL,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+				UNIQUE KEY unique_sync_job (job_type, target_id)
+			) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+			"CREATE INDEX idx_sync_jobs_status ON sync_jobs (status, run_after)",
+		},
+		Down: []string{
+			"DROP TABLE IF EXISTS sync_jobs",
+		},
+	},
+	{
+		// 客户对帐单改为随单据记帐后，为全部客户提交一次校对任务，补记升级前未入帐的历史单据
+		// 任务由后台同步队列执行；之后需要全量校对时通过 GET /api/statements/sync 手动提交
+		Version: 18,
+		Name:    "backfill_customer_statement_jobs",
+		Up: []string{
+			"UPDATE sync_jobs SET status = 'pending', attempts = 0, run_after = CURRENT_TIMESTAMP WHERE job_type = 'customer_statement' AND status <> 'running'",
+			"INSERT INTO sync_jobs (job_type, target_id) SELECT 'customer_statement', id FROM customers WHERE id NOT IN (SELECT target_id FROM sync_jobs WHERE job_type = 'customer_statement')",
+		},
+		// 已执行的校对无法撤销，回滚时不做处理
+		Down: []string{},
+	},
+	{
+		// 早先的品牌拼音按字典项编码（如 D02001）生成，清空后由启动时的拼音补齐按品牌名称重新生成
+		Version: 19,
+		Name:    "reset_product_brand_pinyin",
+		Up: []string{
+			"UPDATE products SET brand_pinyin = '', brand_initials = '' WHERE COALESCE(brand, '') <> ''",
+		},
+		Down: []string{},
+	},
+	{
+		// 客户检索的公司拼音按开头匹配，与名称拼音一样走索引
+		Version: 20,
+		Name:    "add_customer_company_pinyin_indexes",
+		Up: []string{
+			"CREATE INDEX idx_customers_company_pinyin ON customers (company_pinyin)",
+			"CREATE INDEX idx_customers_company_initials ON customers (company_initials)",
+		},
+		Down: []string{
+			"DROP INDEX idx_customers_company_initials ON customers",
+			"DROP INDEX idx_customers_company_pinyin ON customers",
+		},
+	},
+}
@@ -0,0 +1,210 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+)
+
+// Seed 初始化数据，每个版本只执行一次，执行记录保存在seed_versions表
+// 已发布的Seed不可修改，新增默认数据只能追加新的版本
+type Seed struct {
+	Version int
+	Name    string
+	Run     func(tx *sql.Tx) error
+}
+
+// seeds 按版本号升序排列的全部初始化数据
+var seeds = []Seed{
+	{
+		Version: 1,
+		Name:    "default_dictionaries_and_settings",
+		Run: func(tx *sql.Tx) error {
+			// 字典类型
+			dictTypes := [][2]string{
+				{"D01", "产品分类"},
+				{"D02", "产品品牌"},
+				{"D03", "产品单位"},
+				{"D04", "付款方式"},
+				{"D05", "收款账户"},
+			}
+			for _, t := range dictTypes {
+				err := insertIfNotExists(tx, "dictionary_types", "code", t[0],
+					"INSERT INTO dictionary_types (code, name) VALUES (?, ?)", t[0], t[1])
+				if err != nil {
+					return err
+				}
+			}
+
+			// 字典项 - 每个字典类型一个默认值
+			for _, t := range dictTypes {
+				code := t[0] + "001"
+				err := insertIfNotExists(tx, "dictionary_items", "code", code,
+					"INSERT INTO dictionary_items (code, name, dict_type_code, status) VALUES (?, ?, ?, 1)", code, "字典默认值", t[0])
+				if err != nil {
+					return err
+				}
+			}
+
+			// 系统设置
+			settings := [][3]string{
+				{"product_category_dict", "D01", "产品分类字典"},
+				{"product_brand_dict", "D02", "品牌字典"},
+				{"product_unit_dict", "D03", "单位字典"},
+				{"payment_method_dict", "D04", "付款方式字典"},
+				{"payment_account_dict", "D05", "收款账户字典"},
+			}
+			for _, st := range settings {
+				err := insertIfNotExists(tx, "settings", "`key`", st[0],
+					"INSERT INTO settings (`key`, value, description) VALUES (?, ?, ?)", st[0], st[1], st[2])
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Version: 2,
+		Name:    "default_roles",
+		Run: func(tx *sql.Tx) error {
+			roles := []struct {
+				Code        string
+				Name        string
+				Permissions []string
+			}{
+				{"admin", "管理员", []string{"*"}},
+				{"cashier", "收银员", []string{
+					"product:read", "customer:read", "sale_order:read", "sale_order:create",
+					"payment:read", "payment:create", "payment:update", "statement:read",
+				}},
+				{"warehouse", "仓管", []string{"product:read", "dictionary:read"}},
+			}
+			for _, r := range roles {
+				err := insertIfNotExists(tx, "roles", "code", r.Code,
+					"INSERT INTO roles (code, name) VALUES (?, ?)", r.Code, r.Name)
+				if err != nil {
+					return err
+				}
+				if err := grantRolePermissions(tx, r.Code, r.Permissions...); err != nil {
+					return err
+				}
+			}
+
+			// 升级前创建的用户没有任何角色，将最早创建的用户设为管理员，避免无人可以管理权限
+			var assigned bool
+			if err := tx.QueryRow("SELECT EXISTS(SELECT 1 FROM user_roles)").Scan(&assigned); err != nil {
+				return fmt.Errorf("failed to check user roles: %w", err)
+			}
+			if !assigned {
+				_, err := tx.Exec("INSERT INTO user_roles (user_id, role_id) SELECT MIN(u.id), r.id FROM users u, roles r WHERE r.code = 'admin' GROUP BY r.id HAVING MIN(u.id) IS NOT NULL")
+				if err != nil {
+					return fmt.Errorf("failed to assign admin role: %w", err)
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Version: 3,
+		Name:    "grant_inventory_permissions",
+		Run: func(tx *sql.Tx) error {
+			return grantRolePermissions(tx, "warehouse", "inventory:read", "inventory:adjust")
+		},
+	},
+	{
+		Version: 4,
+		Name:    "purchase_settings_and_permissions",
+		Run: func(tx *sql.Tx) error {
+			err := insertIfNotExists(tx, "settings", "`key`", "purchase_order_code_prefix",
+				"INSERT INTO settings (`key`, value, description) VALUES (?, ?, ?)", "purchase_order_code_prefix", "CG", "进货单编号前缀")
+			if err != nil {
+				return err
+			}
+			return grantRolePermissions(tx, "warehouse", "supplier:read", "purchase_order:read", "purchase_order:receive")
+		},
+	},
+	{
+		Version: 5,
+		Name:    "document_company_name",
+		Run: func(tx *sql.Tx) error {
+			return insertIfNotExists(tx, "settings", "`key`", "company_name",
+				"INSERT INTO settings (`key`, value, description) VALUES (?, ?, ?)", "company_name", "宁波世航液压科技有限公司", "单据抬头公司名称")
+		},
+	},
+}
+
+// ApplySeeds 执行尚未执行过的初始化数据，已存在的数据（包括用户修改过的）不会被覆盖或删除
+func ApplySeeds(db *sql.DB) error {
+	for _, s := range seeds {
+		var applied bool
+		err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM seed_versions WHERE version = ?)", s.Version).Scan(&applied)
+		if err != nil {
+			return fmt.Errorf("failed to check seed version %d: %w", s.Version, err)
+		}
+		if applied {
+			continue
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			return fmt.Errorf("failed to begin transaction: %w", err)
+		}
+		if err := s.Run(tx); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("seed %d_%s failed: %w", s.Version, s.Name, err)
+		}
+		if _, err := tx.Exec("INSERT INTO seed_versions (version, name) VALUES (?, ?)", s.Version, s.Name); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to record seed version %d: %w", s.Version, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("failed to commit seed %d: %w", s.Version, err)
+		}
+
+		log.Printf("Seed %d_%s applied successfully", s.Version, s.Name)
+	}
+	return nil
+}
+
+// insertIfNotExists 当 table.column = value 的记录不存在时执行插入
+func insertIfNotExists(tx *sql.Tx, table, column string, value interface{}, insertSQL string, args ...interface{}) error {
+	var exists bool
+	err := tx.QueryRow(fmt.Sprintf("SELECT EXISTS(SELECT 1 FROM %s WHERE %s = ?)", table, column), value).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("failed to check %s %v: %w", table, value, err)
+	}
+	if exists {
+		return nil
+	}
+	if _, err := tx.Exec(insertSQL, args...); err != nil {
+		return fmt.Errorf("failed to insert %s %v: %w", table, value, err)
+	}
+	return nil
+}
+
+// grantRolePermissions 为指定角色追加权限，角色已被删除或已有该权限时跳过
+func grantRolePermissions(tx *sql.Tx, roleCode string, permissions ...string) error {
+	var roleID int
+	err := tx.QueryRow("SELECT id FROM roles WHERE code = ?", roleCode).Scan(&roleID)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to fetch role %s: %w", roleCode, err)
+	}
+
+	for _, perm := range permissions {
+		var exists bool
+		if err := tx.QueryRow("SELECT EXISTS(SELECT 1 FROM role_permissions WHERE role_id = ? AND permission = ?)", roleID, perm).Scan(&exists); err != nil {
+			return fmt.Errorf("failed to check permission %s for role %s: %w", perm, roleCode, err)
+		}
+		if exists {
+			continue
+		}
+		if _, err := tx.Exec("INSERT INTO role_permissions (role_id, permission) VALUES (?, ?)", roleID, perm); err != nil {
+			return fmt.Errorf("failed to insert permission %s for role %s: %w", perm, roleCode, err)
+		}
+	}
+	return nil
+}
@@ -1,10 +1,12 @@
 'use client';
 import React, { useState, useEffect } from 'react';
-import { Table, Button, Drawer, message, Input, Space, Spin, Switch, Dropdown, MenuProps, Modal, Upload, Popconfirm } from 'antd';
+import { Table, Button, Drawer, message, Input, Select, Space, Spin, Switch, Dropdown, MenuProps, Popconfirm } from 'antd';
 import { PlusOutlined, EditOutlined, DeleteOutlined, SearchOutlined, EllipsisOutlined, UploadOutlined, DownloadOutlined } from '@ant-design/icons';
 import CustomerForm from '@/ui/forms/CustomerForm';
+import ImportModal from '@/ui/components/ImportModal';
 import { customerService } from '@/lib/services/customerService';
-import { Customer, CreateCustomerDto, UpdateCustomerDto } from '@/lib/types/customer-types';
+import { ListParams, sorterToParams, columnSortOrder } from '@/lib/services/pagination';
+import { Customer, CreateCustomerDto, UpdateCustomerDto, CustomerListQuery } from '@/lib/types/customer-types';
 import * as XLSX from 'xlsx';
 
 const { Search } = Input;
@@ -16,51 +18,39 @@ const CustomersPage = () => {
   const [isEditing, setIsEditing] = useState(false);
   const [currentCustomer, setCurrentCustomer] = useState<Customer | null>(null);
   const [selectedRowKeys, setSelectedRowKeys] = useState<React.Key[]>([]);
-  const [searchParams, setSearchParams] = useState({
-    code: '',
-    name: '',
-    phone: '',
-    company: ''
-  });
+  const [selectedRows, setSelectedRows] = useState<Customer[]>([]);
+  const [searchParams, setSearchParams] = useState<CustomerListQuery>({});
   const [currentPage, setCurrentPage] = useState(1);
   const [pageSize, setPageSize] = useState(10);
-  const [localSearchParams, setLocalSearchParams] = useState({
-    code: '',
-    name: '',
-    phone: '',
-    company: ''
-  });
+  const [total, setTotal] = useState(0);
+  const [sortParams, setSortParams] = useState<Pick<ListParams, 'sort' | 'order'>>({});
+  const [localSearchParams, setLocalSearchParams] = useState<CustomerListQuery>({});
   // 导入导出相关状态
   const [isImportModalVisible, setIsImportModalVisible] = useState(false);
-  const [importLoading, setImportLoading] = useState(false);
   // 使用useMessage hook获取message实例
   const [messageApi, contextHolder] = message.useMessage();
 
   // 加载客户数据
   useEffect(() => {
-    const loadData = async () => {
-      try {
-        setLoading(true);
-        const customersData = await customerService.getCustomers();
-        setCustomers(Array.isArray(customersData) ? customersData : []);
-      } catch (error) {
-        console.error('Failed to load data:', error);
-        setCustomers([]);
-      } finally {
-        setLoading(false);
-      }
-    };
-    loadData();
+    fetchCustomers();
   }, []);
 
-  const fetchCustomers = async () => {
+  // 按搜索条件、页码和排序从后端查询一页客户，未传入的参数沿用当前状态
+  const fetchCustomers = async (
+    query: CustomerListQuery = searchParams,
+    page: number = currentPage,
+    size: number = pageSize,
+    sorter: Pick<ListParams, 'sort' | 'order'> = sortParams,
+  ) => {
     try {
       setLoading(true);
-      const data = await customerService.getCustomers();
-      setCustomers(Array.isArray(data) ? data : []);
+      const result = await customerService.listCustomers(query, { page, pageSize: size, ...sorter });
+      setCustomers(result.records);
+      setTotal(result.total);
     } catch (error) {
       console.error('获取客户列表失败:', error);
       setCustomers([]);
+      setTotal(0);
     } finally {
       setLoading(false);
     }
@@ -113,6 +103,7 @@ const CustomersPage = () => {
       await customerService.batchDeleteCustomers(selectedRowKeys.map(key => Number(key)));
       console.log('批量删除成功');
       setSelectedRowKeys([]);
+      setSelectedRows([]);
       fetchCustomers();
     } catch (error) {
       console.error('批量删除失败');
@@ -121,27 +112,25 @@ const CustomersPage = () => {
   };
 
   // 表格行选择处理
-  const onSelectChange = (newSelectedRowKeys: React.Key[]) => {
+  const onSelectChange = (newSelectedRowKeys: React.Key[], newSelectedRows: Customer[]) => {
     setSelectedRowKeys(newSelectedRowKeys);
+    setSelectedRows(newSelectedRows);
   };
 
-  // 搜索处理
+  // 搜索处理，条件变化后回到第一页
   const handleSearch = () => {
-    setSearchParams(localSearchParams);
-    fetchCustomers();
+    const query = { ...localSearchParams, q: localSearchParams.q?.trim() };
+    setSearchParams(query);
+    setCurrentPage(1);
+    fetchCustomers(query, 1);
   };
 
   // 重置搜索条件
   const handleReset = () => {
-    const resetParams = {
-      code: '',
-      name: '',
-      phone: '',
-      company: ''
-    };
-    setLocalSearchParams(resetParams);
-    setSearchParams(resetParams);
-    fetchCustomers();
+    setLocalSearchParams({});
+    setSearchParams({});
+    setCurrentPage(1);
+    fetchCustomers({}, 1);
   };
 
   // 处理启用状态切换
@@ -168,57 +157,30 @@ const CustomersPage = () => {
     setIsDrawerVisible(true);
   };
 
-  // 导入相关函数
-  const handleImport = async (file: File) => {
-    setImportLoading(true);
-    try {
-      const data = await file.arrayBuffer();
-      const workbook = XLSX.read(data, { type: 'array' });
-      const firstSheetName = workbook.SheetNames[0];
-      const worksheet = workbook.Sheets[firstSheetName];
-      const jsonData = XLSX.utils.sheet_to_json(worksheet);
-      
-      // 转换数据格式
-      const customersToImport = jsonData.map((item: any) => ({
-        name: item['客户姓名'],
-        code: item['客户编号'],
-        phone: item['手机号'],
-        company: item['公司名'],
-        province: item['省份'],
-        city: item['城市'],
-        district: item['区县'],
-        address: item['地址'],
-        remark: item['备注'],
-        status: item['状态'] === '启用' ? 1 : 0
-      }));
-      
-      // 批量导入客户
-      for (const customer of customersToImport) {
-        await customerService.createCustomer(customer as CreateCustomerDto);
-      }
-      
-      messageApi.success('导入成功');
-      setIsImportModalVisible(false);
-      fetchCustomers();
-    } catch (error) {
-      console.error('导入失败:', error);
-      messageApi.error('导入失败，请检查文件格式');
-    } finally {
-      setImportLoading(false);
-    }
-  };
-
   // 导出相关函数
-  const handleExport = (type: 'all' | 'filter' | 'selected') => {
+  const handleExport = async (type: 'all' | 'filter' | 'selected') => {
     let dataToExport: Customer[] = [];
     
     if (type === 'all') {
-      dataToExport = customers;
+      // 列表只有当前页，导出全部时重新查询
+      try {
+        dataToExport = await customerService.getCustomers();
+      } catch (error) {
+        console.error('导出失败:', error);
+        messageApi.error('导出失败');
+        return;
+      }
     } else if (type === 'filter') {
-      dataToExport = filteredCustomers;
+      // 列表只有当前页，按搜索条件重新查询全部结果
+      try {
+        dataToExport = await customerService.getCustomers(searchParams);
+      } catch (error) {
+        console.error('导出失败:', error);
+        messageApi.error('导出失败');
+        return;
+      }
     } else if (type === 'selected') {
-      const selectedIds = selectedRowKeys.map(key => Number(key));
-      dataToExport = customers.filter(customer => selectedIds.includes(customer.id));
+      dataToExport = selectedRows;
     }
     
     // 转换为导出格式
@@ -276,6 +238,8 @@ const CustomersPage = () => {
       key: 'code',
       width: '8%',
       ellipsis: true,
+      sorter: true,
+      sortOrder: columnSortOrder(sortParams, 'code'),
     },
     {
       title: '客户姓名',
@@ -283,6 +247,8 @@ const CustomersPage = () => {
       key: 'name',
       width: '10%',
       ellipsis: true,
+      sorter: true,
+      sortOrder: columnSortOrder(sortParams, 'name'),
     },
     {
       title: '公司名',
@@ -362,15 +328,6 @@ const CustomersPage = () => {
     },
   ];
 
-  // 过滤客户列表
-  const filteredCustomers = customers.filter(customer => {
-    const matchesCode = !searchParams.code || customer.code.includes(searchParams.code);
-    const matchesName = !searchParams.name || customer.name.includes(searchParams.name);
-    const matchesPhone = !searchParams.phone || customer.phone.includes(searchParams.phone);
-    const matchesCompany = !searchParams.company || customer.company.includes(searchParams.company);
-    return matchesCode && matchesName && matchesPhone && matchesCompany;
-  });
-
   return (
     <Spin spinning={loading} style={{ minHeight: '60vh', display: 'flex', alignItems: 'center', justifyContent: 'center' }}>
       {contextHolder}
@@ -384,37 +341,25 @@ const CustomersPage = () => {
         <div style={{ marginBottom: 16 }}>
           <div style={{ display: 'flex', gap: 12, flexWrap: 'wrap', marginBottom: 12 }}>
             <Input
-              placeholder="客户编号"
-              allowClear
-              size="middle"
-              style={{ width: 150 }}
-              value={localSearchParams.code}
-              onChange={(e) => setLocalSearchParams({ ...localSearchParams, code: e.target.value })}
-            />
-            <Input
-              placeholder="客户姓名"
+              placeholder="编号、姓名、拼音、手机号、地址、公司、备注、税号、银行账号"
               allowClear
               size="middle"
-              style={{ width: 150 }}
-              value={localSearchParams.name}
-              onChange={(e) => setLocalSearchParams({ ...localSearchParams, name: e.target.value })}
+              style={{ width: 420 }}
+              value={localSearchParams.q}
+              onChange={(e) => setLocalSearchParams({ ...localSearchParams, q: e.target.value })}
+              onPressEnter={handleSearch}
             />
-            <Input
-              placeholder="公司名"
-              allowClear
-              size="middle"
-              style={{ width: 200 }}
-              value={localSearchParams.company}
-              onChange={(e) => setLocalSearchParams({ ...localSearchParams, company: e.target.value })}
-            />
-            <Input
-              placeholder="手机号"
+            <Select
+              placeholder="状态"
               allowClear
               size="middle"
-              style={{ width: 150 }}
-              value={localSearchParams.phone}
-              onChange={(e) => setLocalSearchParams({ ...localSearchParams, phone: e.target.value })}
-            />
+              style={{ width: 120 }}
+              value={localSearchParams.status}
+              onChange={(value) => setLocalSearchParams({ ...localSearchParams, status: value })}
+            >
+              <Select.Option value={1}>启用</Select.Option>
+              <Select.Option value={0}>禁用</Select.Option>
+            </Select>
             <Button type="primary" icon={<SearchOutlined />} onClick={handleSearch}>
               搜索
             </Button>
@@ -477,13 +422,14 @@ const CustomersPage = () => {
         <div style={{ overflowX: 'auto', marginBottom: 16, maxWidth: '100%', boxSizing: 'border-box' }}>
           <Table
             columns={columns}
-            dataSource={filteredCustomers}
+            dataSource={customers}
             rowKey="id"
             loading={loading}
             scroll={{ x: '1440px' }}
             pagination={{
               current: currentPage,
               pageSize: pageSize,
+              total,
               showSizeChanger: true,
               pageSizeOptions: ['10', '20', '50', '100'],
               showTotal: (total) => `共 ${total} 条数据`,
@@ -497,16 +443,19 @@ const CustomersPage = () => {
                 next_page: '下一页',
                 page: '页',
               },
-              onChange: (page, size) => {
-                setCurrentPage(page);
-                setPageSize(size);
-              },
-              onShowSizeChange: (current, size) => {
-                setCurrentPage(1);
-                setPageSize(size);
-              }
             }}
-            rowSelection={{ selectedRowKeys, onChange: onSelectChange }}
+            // 翻页、切换每页条数和排序都交给后端处理
+            onChange={(pagination, _filters, sorter) => {
+              const nextSort = sorterToParams(sorter);
+              const sortChanged = nextSort.sort !== sortParams.sort || nextSort.order !== sortParams.order;
+              const size = pagination.pageSize || pageSize;
+              const page = sortChanged || size !== pageSize ? 1 : pagination.current || 1;
+              setCurrentPage(page);
+              setPageSize(size);
+              setSortParams(nextSort);
+              fetchCustomers(searchParams, page, size, nextSort);
+            }}
+            rowSelection={{ selectedRowKeys, onChange: onSelectChange, preserveSelectedRowKeys: true }}
             // 禁用表格拖动功能
             onRow={() => ({
               draggable: false,
@@ -537,36 +486,17 @@ const CustomersPage = () => {
         </Drawer>
 
         {/* 导入弹窗 */}
-        <Modal
+        <ImportModal
           title="导入客户"
           open={isImportModalVisible}
           onCancel={() => setIsImportModalVisible(false)}
-          footer={null}
-          width={600}
-        >
-          <div style={{ padding: '20px 0' }}>
-            <div style={{ marginBottom: 16 }}>
-              <Button type="default" onClick={handleDownloadTemplate}>
-                下载导入模板
-              </Button>
-            </div>
-            <div style={{ marginBottom: 16 }}>
-              <Upload
-                beforeUpload={handleImport}
-                showUploadList={false}
-                accept=".xlsx, .xls"
-              >
-                <Button type="primary" loading={importLoading}>
-                  点击上传文件
-                </Button>
-              </Upload>
-            </div>
-            <div style={{ color: '#666', fontSize: '12px' }}>
-              <p>支持格式：.xlsx, .xls</p>
-              <p>请按照模板格式填写数据，确保字段完整</p>
-            </div>
-          </div>
-        </Modal>
+          onDownloadTemplate={handleDownloadTemplate}
+          onImport={customerService.importCustomers}
+          onImported={() => {
+            setIsImportModalVisible(false);
+            fetchCustomers();
+          }}
+        />
       </div>
     </Spin>
   );
@@ -1,12 +1,14 @@
 'use client';
 import React, { useState, useEffect } from 'react';
-import { Table, Button, Drawer, message, Input, Select, Space, Card, Spin, Switch, Dropdown, MenuProps, Modal, Upload, Popconfirm } from 'antd';
+import { Table, Button, Drawer, message, Input, Select, Space, Card, Spin, Switch, Dropdown, MenuProps, Popconfirm } from 'antd';
 import { PlusOutlined, EditOutlined, DeleteOutlined, SearchOutlined, EllipsisOutlined, UploadOutlined, DownloadOutlined } from '@ant-design/icons';
 import ProductForm from '@/ui/forms/ProductForm';
+import ImportModal from '@/ui/components/ImportModal';
 import { productService } from '@/lib/services/productService';
+import { ListParams, sorterToParams, columnSortOrder } from '@/lib/services/pagination';
 import { settingService } from '@/lib/services/settingService';
 import { dictionaryService } from '@/lib/services/dictionaryService';
-import { Product, CreateProductDto, UpdateProductDto } from '@/lib/types/product-types';
+import { Product, CreateProductDto, UpdateProductDto, ProductListQuery } from '@/lib/types/product-types';
 import { Setting } from '@/lib/types/setting-types';
 import { DictionaryItem } from '@/lib/types/dictionary-types';
 import { formatPrice, formatDate } from '@/lib/utils/format';
@@ -22,27 +24,19 @@ const ProductsPage = () => {
   const [isEditing, setIsEditing] = useState(false);
   const [currentProduct, setCurrentProduct] = useState<Product | null>(null);
   const [selectedRowKeys, setSelectedRowKeys] = useState<React.Key[]>([]);
-  const [searchParams, setSearchParams] = useState({
-    code: '',
-    name: '',
-    category: '',
-    status: undefined as number | undefined
-  });
+  const [selectedRows, setSelectedRows] = useState<Product[]>([]);
+  const [searchParams, setSearchParams] = useState<ProductListQuery>({});
   const [currentPage, setCurrentPage] = useState(1);
   const [pageSize, setPageSize] = useState(10);
-  const [localSearchParams, setLocalSearchParams] = useState({
-    code: '',
-    name: '',
-    category: '',
-    status: undefined as number | undefined
-  });
+  const [total, setTotal] = useState(0);
+  const [sortParams, setSortParams] = useState<Pick<ListParams, 'sort' | 'order'>>({});
+  const [localSearchParams, setLocalSearchParams] = useState<ProductListQuery>({});
   const [categoryOptions, setCategoryOptions] = useState<DictionaryItem[]>([]);
   const [brandOptions, setBrandOptions] = useState<DictionaryItem[]>([]);
   const [unitOptions, setUnitOptions] = useState<DictionaryItem[]>([]);
   const [settings, setSettings] = useState<Setting[]>([]);
   // 导入导出相关状态
   const [isImportModalVisible, setIsImportModalVisible] = useState(false);
-  const [importLoading, setImportLoading] = useState(false);
   // 使用useMessage hook获取message实例
   const [messageApi, contextHolder] = message.useMessage();
 
@@ -51,11 +45,7 @@ const ProductsPage = () => {
     const loadData = async () => {
       try {
         setLoading(true);
-        const [productsData, settingsData] = await Promise.all([
-          productService.getProducts(),
-          settingService.getSettings()
-        ]);
-        setProducts(Array.isArray(productsData) ? productsData : []);
+        const settingsData = await settingService.getSettings();
         setSettings(settingsData);
         
         // 获取字典映射关系
@@ -77,24 +67,30 @@ const ProductsPage = () => {
         
       } catch (error) {
         console.error('Failed to load data:', error);
-        setProducts([]);
       } finally {
         setLoading(false);
       }
     };
     loadData();
+    fetchProducts();
   }, []);
 
-  const fetchProducts = async () => {
+  // 按搜索条件、页码和排序从后端查询一页产品，未传入的参数沿用当前状态
+  const fetchProducts = async (
+    query: ProductListQuery = searchParams,
+    page: number = currentPage,
+    size: number = pageSize,
+    sorter: Pick<ListParams, 'sort' | 'order'> = sortParams,
+  ) => {
     try {
       setLoading(true);
-      const data = await productService.getProducts();
-      // 确保products始终是数组，防止null导致的filter错误
-      setProducts(Array.isArray(data) ? data : []);
+      const result = await productService.listProducts(query, { page, pageSize: size, ...sorter });
+      setProducts(result.records);
+      setTotal(result.total);
     } catch (error) {
       console.error('获取产品列表失败:', error);
-      // 发生错误时，将products设置为空数组
       setProducts([]);
+      setTotal(0);
     } finally {
       setLoading(false);
     }
@@ -149,6 +145,7 @@ const ProductsPage = () => {
       await productService.batchDeleteProducts(selectedRowKeys.map(key => Number(key)));
       console.log('批量删除成功');
       setSelectedRowKeys([]);
+      setSelectedRows([]);
       fetchProducts();
     } catch (error) {
       console.error('批量删除失败');
@@ -157,27 +154,25 @@ const ProductsPage = () => {
   };
 
   // 表格行选择处理
-  const onSelectChange = (newSelectedRowKeys: React.Key[]) => {
+  const onSelectChange = (newSelectedRowKeys: React.Key[], newSelectedRows: Product[]) => {
     setSelectedRowKeys(newSelectedRowKeys);
+    setSelectedRows(newSelectedRows);
   };
 
-  // 搜索处理
+  // 搜索处理，条件变化后回到第一页
   const handleSearch = () => {
-    setSearchParams(localSearchParams);
-    fetchProducts();
+    const query = { ...localSearchParams, code: localSearchParams.code?.trim(), name: localSearchParams.name?.trim() };
+    setSearchParams(query);
+    setCurrentPage(1);
+    fetchProducts(query, 1);
   };
 
   // 重置搜索条件
   const handleReset = () => {
-    const resetParams = {
-      code: '',
-      name: '',
-      category: '',
-      status: undefined
-    };
-    setLocalSearchParams(resetParams);
-    setSearchParams(resetParams);
-    fetchProducts();
+    setLocalSearchParams({});
+    setSearchParams({});
+    setCurrentPage(1);
+    fetchProducts({}, 1);
   };
 
   // 处理启用状态切换
@@ -192,55 +187,21 @@ const ProductsPage = () => {
     }
   };
 
-  // 导入相关函数
-  const handleImport = async (file: File) => {
-    setImportLoading(true);
-    try {
-      const data = await file.arrayBuffer();
-      const workbook = XLSX.read(data, { type: 'array' });
-      const firstSheetName = workbook.SheetNames[0];
-      const worksheet = workbook.Sheets[firstSheetName];
-      const jsonData = XLSX.utils.sheet_to_json(worksheet);
-      
-      // 转换数据格式
-      const productsToImport = jsonData.map((item: any) => ({
-        name: item['产品名称'],
-        code: item['产品编码'],
-        category: item['产品分类'],
-        brand: item['品牌'],
-        unit: item['单位'],
-        price: parseFloat(item['价格']) || 0,
-        status: item['状态'] === '启用' ? 1 : 0,
-        remark: item['备注']
-      }));
-      
-      // 批量导入产品
-      for (const product of productsToImport) {
-        await productService.createProduct(product as CreateProductDto);
-      }
-      
-      messageApi.success('导入成功');
-      setIsImportModalVisible(false);
-      fetchProducts();
-    } catch (error) {
-      console.error('导入失败:', error);
-      messageApi.error('导入失败，请检查文件格式');
-    } finally {
-      setImportLoading(false);
-    }
-  };
-
   // 导出相关函数
-  const handleExport = (type: 'all' | 'filter' | 'selected') => {
+  const handleExport = async (type: 'all' | 'filter' | 'selected') => {
     let dataToExport: Product[] = [];
     
-    if (type === 'all') {
-      dataToExport = products;
-    } else if (type === 'filter') {
-      dataToExport = filteredProducts;
-    } else if (type === 'selected') {
-      const selectedIds = selectedRowKeys.map(key => Number(key));
-      dataToExport = products.filter(product => selectedIds.includes(product.id));
+    if (type === 'selected') {
+      dataToExport = selectedRows;
+    } else {
+      // 列表只有当前页，导出时按条件重新查询全部结果
+      try {
+        dataToExport = await productService.getProducts(type === 'filter' ? searchParams : undefined);
+      } catch (error) {
+        console.error('导出失败:', error);
+        messageApi.error('导出失败');
+        return;
+      }
     }
     
     // 转换为导出格式
@@ -315,6 +276,8 @@ const ProductsPage = () => {
       key: 'code',
       width: '10%',
       ellipsis: true,
+      sorter: true,
+      sortOrder: columnSortOrder(sortParams, 'code'),
     },
     {
       title: '产品名称',
@@ -322,6 +285,8 @@ const ProductsPage = () => {
       key: 'name',
       width: '20%',
       ellipsis: true,
+      sorter: true,
+      sortOrder: columnSortOrder(sortParams, 'name'),
     },
     {
       title: '产品分类',
@@ -329,6 +294,8 @@ const ProductsPage = () => {
       key: 'category',
       width: '15%',
       ellipsis: true,
+      sorter: true,
+      sortOrder: columnSortOrder(sortParams, 'category'),
       render: (category: string) => {
         const categoryMap = createDictItemMap(categoryOptions);
         return categoryMap[category] || category;
@@ -340,6 +307,8 @@ const ProductsPage = () => {
       key: 'brand',
       width: '15%',
       ellipsis: true,
+      sorter: true,
+      sortOrder: columnSortOrder(sortParams, 'brand'),
       render: (brand: string) => {
         const brandMap = createDictItemMap(brandOptions);
         return brandMap[brand] || brand;
@@ -409,15 +378,6 @@ const ProductsPage = () => {
     },
   ];
 
-  // 过滤产品列表
-  const filteredProducts = products.filter(product => {
-    const matchesCode = !searchParams.code || product.code.includes(searchParams.code);
-    const matchesName = !searchParams.name || product.name.includes(searchParams.name);
-    const matchesCategory = !searchParams.category || product.category.includes(searchParams.category);
-    const matchesStatus = searchParams.status === undefined || product.status === searchParams.status;
-    return matchesCode && matchesName && matchesCategory && matchesStatus;
-  });
-
   return (
     <Spin spinning={loading} style={{ minHeight: '60vh', display: 'flex', alignItems: 'center', justifyContent: 'center' }}>
       {contextHolder}
@@ -533,13 +493,14 @@ const ProductsPage = () => {
         <div style={{ overflowX: 'auto', marginBottom: 16, maxWidth: '100%', boxSizing: 'border-box' }}>
           <Table
             columns={columns}
-            dataSource={filteredProducts}
+            dataSource={products}
             rowKey="id"
             loading={loading}
             scroll={{ x: '1440px' }}
             pagination={{
               current: currentPage,
               pageSize: pageSize,
+              total,
               showSizeChanger: true,
               pageSizeOptions: ['10', '20', '50', '100'],
               showTotal: (total) => `共 ${total} 条数据`,
@@ -553,16 +514,19 @@ const ProductsPage = () => {
                 next_page: '下一页',
                 page: '页',
               },
-              onChange: (page, size) => {
-                setCurrentPage(page);
-                setPageSize(size);
-              },
-              onShowSizeChange: (current, size) => {
-                setCurrentPage(1);
-                setPageSize(size);
-              }
             }}
-            rowSelection={{ selectedRowKeys, onChange: onSelectChange }}
+            // 翻页、切换每页条数和排序都交给后端处理
+            onChange={(pagination, _filters, sorter) => {
+              const nextSort = sorterToParams(sorter);
+              const sortChanged = nextSort.sort !== sortParams.sort || nextSort.order !== sortParams.order;
+              const size = pagination.pageSize || pageSize;
+              const page = sortChanged || size !== pageSize ? 1 : pagination.current || 1;
+              setCurrentPage(page);
+              setPageSize(size);
+              setSortParams(nextSort);
+              fetchProducts(searchParams, page, size, nextSort);
+            }}
+            rowSelection={{ selectedRowKeys, onChange: onSelectChange, preserveSelectedRowKeys: true }}
             // 禁用表格拖动功能
             onRow={() => ({
               draggable: false,
@@ -594,36 +558,17 @@ const ProductsPage = () => {
         </Drawer>
 
         {/* 导入弹窗 */}
-        <Modal
+        <ImportModal
           title="导入产品"
           open={isImportModalVisible}
           onCancel={() => setIsImportModalVisible(false)}
-          footer={null}
-          width={600}
-        >
-          <div style={{ padding: '20px 0' }}>
-            <div style={{ marginBottom: 16 }}>
-              <Button type="default" onClick={handleDownloadTemplate}>
-                下载导入模板
-              </Button>
-            </div>
-            <div style={{ marginBottom: 16 }}>
-              <Upload
-                beforeUpload={handleImport}
-                showUploadList={false}
-                accept=".xlsx, .xls"
-              >
-                <Button type="primary" loading={importLoading}>
-                  点击上传文件
-                </Button>
-              </Upload>
-            </div>
-            <div style={{ color: '#666', fontSize: '12px' }}>
-              <p>支持格式：.xlsx, .xls</p>
-              <p>请按照模板格式填写数据，确保字段完整</p>
-            </div>
-          </div>
-        </Modal>
+          onDownloadTemplate={handleDownloadTemplate}
+          onImport={productService.importProducts}
+          onImported={() => {
+            setIsImportModalVisible(false);
+            fetchProducts();
+          }}
+        />
       </div>
     </Spin>
   );
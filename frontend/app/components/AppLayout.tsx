@@ -1,6 +1,6 @@
 'use client';
 import { useState, Suspense, useEffect } from "react";
-import { Layout, Menu, Skeleton } from "antd";
+import { Layout, Menu, Skeleton, Space, Button } from "antd";
 import {
   MenuFoldOutlined,
   MenuUnfoldOutlined,
@@ -13,10 +13,14 @@ import {
   SettingOutlined,
   DatabaseOutlined,
   BookOutlined,
-  DollarOutlined
+  DollarOutlined,
+  LogoutOutlined
 } from "@ant-design/icons";
 import Link from "next/link";
 import { usePathname } from 'next/navigation';
+import { authService } from '../../lib/services/authService';
+import { getToken, redirectToLogin, LOGIN_PATH } from '../../lib/services/apiClient';
+import { User } from '../../lib/types/auth-types';
 
 const { Header, Sider, Content } = Layout;
 
@@ -37,7 +41,33 @@ const AppLayout: React.FC<AppLayoutProps> = ({ children }) => {
   const [collapsed, setCollapsed] = useState(false);
   const [selectedKeys, setSelectedKeys] = useState<string[]>(['sales']);
   const [openKeys, setOpenKeys] = useState<string[]>([]);
+  const [currentUser, setCurrentUser] = useState<User | null>(null);
+  const [authChecked, setAuthChecked] = useState(false);
   const pathname = usePathname();
+  const isLoginPage = pathname === LOGIN_PATH;
+
+  // 未登录时跳转登录页，已登录时读取当前用户；令牌失效时 apiFetch 会跳转登录页
+  useEffect(() => {
+    if (isLoginPage) return;
+    if (!getToken()) {
+      redirectToLogin();
+      return;
+    }
+    setAuthChecked(true);
+    authService.getCurrentUser()
+      .then(data => setCurrentUser(data.user))
+      .catch(error => console.error('Failed to fetch current user:', error));
+  }, [isLoginPage]);
+
+  // 退出登录
+  const handleLogout = async () => {
+    try {
+      await authService.logout();
+    } catch (error) {
+      console.error('Failed to logout:', error);
+    }
+    window.location.href = LOGIN_PATH;
+  };
 
   // 根据当前路由设置选中的菜单
   useEffect(() => {
@@ -74,6 +104,11 @@ const AppLayout: React.FC<AppLayoutProps> = ({ children }) => {
     setOpenKeys(newOpenKeys);
   }, [pathname]);
 
+  // 登录页不显示导航
+  if (isLoginPage) {
+    return <>{children}</>;
+  }
+
   return (
     <Layout style={{ minHeight: '100vh', display: 'flex', flexDirection: 'column' }}>
       {/* 顶部导航栏 */}
@@ -104,7 +139,15 @@ const AppLayout: React.FC<AppLayoutProps> = ({ children }) => {
           销售系统
         </div>
         <div style={{ paddingRight: 24 }}>
-          {/* 顶部右侧内容，如用户信息等，暂时为空 */}
+          {currentUser && (
+            <Space>
+              <UserOutlined />
+              <span>{currentUser.name || currentUser.username}</span>
+              <Button type="link" icon={<LogoutOutlined />} onClick={handleLogout}>
+                退出
+              </Button>
+            </Space>
+          )}
         </div>
       </Header>
       
@@ -245,8 +288,9 @@ const AppLayout: React.FC<AppLayoutProps> = ({ children }) => {
             }}
           >
             {/* 使用Suspense包裹内容，实现加载状态 */}
+            {/* 确认已登录后再渲染页面，避免未带令牌的请求 */}
             <Suspense fallback={<ContentSkeleton />}>
-              {children}
+              {authChecked ? children : <ContentSkeleton />}
             </Suspense>
           </Content>
         </Layout>
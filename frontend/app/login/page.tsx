@@ -0,0 +1,62 @@
+'use client';
+import React, { useState } from 'react';
+import { Card, Form, Input, Button, Typography, App } from 'antd';
+import { UserOutlined, LockOutlined, BookOutlined } from '@ant-design/icons';
+import { authService } from '../../lib/services/authService';
+import { LoginDto } from '../../lib/types/auth-types';
+
+const { Title } = Typography;
+
+// 登录后跳转的页面，只接受站内路径
+const getRedirectPath = (): string => {
+  const redirect = new URLSearchParams(window.location.search).get('redirect');
+  if (redirect && redirect.startsWith('/') && !redirect.startsWith('//') && !redirect.startsWith('/login')) {
+    return redirect;
+  }
+  return '/';
+};
+
+const LoginPage = () => {
+  const { message } = App.useApp();
+  const [form] = Form.useForm<LoginDto>();
+  const [loading, setLoading] = useState(false);
+
+  const handleLogin = async (values: LoginDto) => {
+    try {
+      setLoading(true);
+      await authService.login(values);
+      // 整页跳转，让布局重新读取登录状态
+      window.location.href = getRedirectPath();
+    } catch (error) {
+      console.error('Failed to login:', error);
+      message.error(error instanceof Error ? error.message : '登录失败');
+      setLoading(false);
+    }
+  };
+
+  return (
+    <div style={{ minHeight: '100vh', display: 'flex', alignItems: 'center', justifyContent: 'center' }}>
+      <Card style={{ width: 360, boxShadow: '0 2px 8px rgba(0, 0, 0, 0.1)' }}>
+        <Title level={4} style={{ textAlign: 'center', marginBottom: 24 }}>
+          <BookOutlined style={{ marginRight: 8 }} />
+          销售系统
+        </Title>
+        <Form form={form} onFinish={handleLogin} autoComplete="on">
+          <Form.Item name="username" rules={[{ required: true, message: '请输入用户名' }]}>
+            <Input prefix={<UserOutlined />} placeholder="用户名" autoComplete="username" autoFocus />
+          </Form.Item>
+          <Form.Item name="password" rules={[{ required: true, message: '请输入密码' }]}>
+            <Input.Password prefix={<LockOutlined />} placeholder="密码" autoComplete="current-password" />
+          </Form.Item>
+          <Form.Item style={{ marginBottom: 0 }}>
+            <Button type="primary" htmlType="submit" loading={loading} block>
+              登录
+            </Button>
+          </Form.Item>
+        </Form>
+      </Card>
+    </div>
+  );
+};
+
+export default LoginPage;
@@ -7,7 +7,8 @@ import BatchPaymentForm from '@/ui/forms/BatchPaymentForm';
 import { paymentService } from '@/lib/services/paymentService';
 import { customerService } from '@/lib/services/customerService';
 import { saleOrderService } from '@/lib/services/saleOrderService';
-import { Payment, CreatePaymentDto, UpdatePaymentDto } from '@/lib/types/payment-types';
+import { ListParams, sorterToParams, columnSortOrder } from '@/lib/services/pagination';
+import { Payment, CreatePaymentDto, UpdatePaymentDto, PaymentListQuery } from '@/lib/types/payment-types';
 import { Customer } from '@/lib/types/customer-types';
 import { SaleOrder } from '@/lib/types/sale-order-types';
 import { formatPrice, formatDate, formatDateOnly } from '@/lib/utils/format';
@@ -26,22 +27,13 @@ const PaymentsPage = () => {
   const [isEditing, setIsEditing] = useState(false);
   const [currentPayment, setCurrentPayment] = useState<Payment | null>(null);
   const [selectedRowKeys, setSelectedRowKeys] = useState<React.Key[]>([]);
-  const [searchParams, setSearchParams] = useState({
-    customerId: undefined as number | undefined,
-    paymentDateRange: undefined as [Date, Date] | undefined,
-    paymentMethod: '',
-    account: '',
-    saleOrderCode: ''
-  });
+  const [selectedRows, setSelectedRows] = useState<Payment[]>([]);
+  const [searchParams, setSearchParams] = useState<PaymentListQuery>({});
   const [currentPage, setCurrentPage] = useState(1);
   const [pageSize, setPageSize] = useState(10);
-  const [localSearchParams, setLocalSearchParams] = useState({
-    customerId: undefined as number | undefined,
-    paymentDateRange: undefined as [Date, Date] | undefined,
-    paymentMethod: '',
-    account: '',
-    saleOrderCode: ''
-  });
+  const [total, setTotal] = useState(0);
+  const [sortParams, setSortParams] = useState<Pick<ListParams, 'sort' | 'order'>>({});
+  const [localSearchParams, setLocalSearchParams] = useState<PaymentListQuery>({});
   // 导入导出相关状态
   const [isImportModalVisible, setIsImportModalVisible] = useState(false);
   const [importLoading, setImportLoading] = useState(false);
@@ -53,17 +45,14 @@ const PaymentsPage = () => {
     const loadData = async () => {
       try {
         setLoading(true);
-        const [paymentsData, customersData, saleOrdersData] = await Promise.all([
-          paymentService.getPayments(),
+        const [customersData, saleOrdersData] = await Promise.all([
           customerService.getCustomers(),
           saleOrderService.getSaleOrders()
         ]);
-        setPayments(Array.isArray(paymentsData) ? paymentsData : []);
         setCustomers(Array.isArray(customersData) ? customersData : []);
         setSaleOrders(Array.isArray(saleOrdersData) ? saleOrdersData : []);
       } catch (error) {
         console.error('Failed to load data:', error);
-        setPayments([]);
         setCustomers([]);
         setSaleOrders([]);
       } finally {
@@ -71,16 +60,25 @@ const PaymentsPage = () => {
       }
     };
     loadData();
+    fetchPayments();
   }, []);
 
-  const fetchPayments = async () => {
+  // 按搜索条件、页码和排序从后端查询一页收款记录，未传入的参数沿用当前状态
+  const fetchPayments = async (
+    query: PaymentListQuery = searchParams,
+    page: number = currentPage,
+    size: number = pageSize,
+    sorter: Pick<ListParams, 'sort' | 'order'> = sortParams,
+  ) => {
     try {
       setLoading(true);
-      const data = await paymentService.getPayments();
-      setPayments(Array.isArray(data) ? data : []);
+      const result = await paymentService.listPayments(query, { page, pageSize: size, ...sorter });
+      setPayments(result.records);
+      setTotal(result.total);
     } catch (error) {
       console.error('获取收款记录失败:', error);
       setPayments([]);
+      setTotal(0);
     } finally {
       setLoading(false);
     }
@@ -153,6 +151,7 @@ const PaymentsPage = () => {
       messageApi.success(`成功删除 ${selectedRowKeys.length} 条收款记录`);
       fetchPayments();
       setSelectedRowKeys([]); // 清空选中状态
+      setSelectedRows([]);
     } catch (error) {
       console.error('批量删除收款记录失败:', error);
       messageApi.error('批量删除收款记录失败');
@@ -160,28 +159,30 @@ const PaymentsPage = () => {
   };
 
   // 表格行选择处理
-  const onSelectChange = (newSelectedRowKeys: React.Key[]) => {
+  const onSelectChange = (newSelectedRowKeys: React.Key[], newSelectedRows: Payment[]) => {
     setSelectedRowKeys(newSelectedRowKeys);
+    setSelectedRows(newSelectedRows);
   };
 
-  // 搜索处理
+  // 搜索处理，条件变化后回到第一页
   const handleSearch = () => {
-    setSearchParams(localSearchParams);
-    fetchPayments();
+    const query = {
+      ...localSearchParams,
+      paymentMethod: localSearchParams.paymentMethod?.trim(),
+      account: localSearchParams.account?.trim(),
+      saleOrderCode: localSearchParams.saleOrderCode?.trim(),
+    };
+    setSearchParams(query);
+    setCurrentPage(1);
+    fetchPayments(query, 1);
   };
 
   // 重置搜索条件
   const handleReset = () => {
-    const resetParams = {
-      customerId: undefined,
-      paymentDateRange: undefined,
-      paymentMethod: '',
-      account: '',
-      saleOrderCode: ''
-    };
-    setLocalSearchParams(resetParams);
-    setSearchParams(resetParams);
-    fetchPayments();
+    setLocalSearchParams({});
+    setSearchParams({});
+    setCurrentPage(1);
+    fetchPayments({}, 1);
   };
 
   const showCreateModal = () => {
@@ -272,16 +273,20 @@ const PaymentsPage = () => {
   };
 
   // 导出相关函数
-  const handleExport = (type: 'all' | 'filter' | 'selected') => {
+  const handleExport = async (type: 'all' | 'filter' | 'selected') => {
     let dataToExport: Payment[] = [];
     
-    if (type === 'all') {
-      dataToExport = payments;
-    } else if (type === 'filter') {
-      dataToExport = filteredPayments;
-    } else if (type === 'selected') {
-      const selectedIds = selectedRowKeys.map(key => Number(key));
-      dataToExport = payments.filter(payment => selectedIds.includes(payment.id));
+    if (type === 'selected') {
+      dataToExport = selectedRows;
+    } else {
+      // 列表只有当前页，导出时按条件重新查询全部结果
+      try {
+        dataToExport = await paymentService.getPayments(type === 'filter' ? searchParams : undefined);
+      } catch (error) {
+        console.error('导出失败:', error);
+        messageApi.error('导出失败');
+        return;
+      }
     }
     
     // 转换为导出格式
@@ -348,6 +353,8 @@ const PaymentsPage = () => {
       key: 'code',
       width: '7%',
       ellipsis: true,
+      sorter: true,
+      sortOrder: columnSortOrder(sortParams, 'code'),
     },
     {
       title: '收款日期',
@@ -355,6 +362,8 @@ const PaymentsPage = () => {
       key: 'paymentDate',
       width: '11%',
       ellipsis: true,
+      sorter: true,
+      sortOrder: columnSortOrder(sortParams, 'paymentDate'),
       render: (date: string) => formatDateOnly(date),
     },
     {
@@ -363,6 +372,8 @@ const PaymentsPage = () => {
       key: 'customerName',
       width: '11%',
       ellipsis: true,
+      sorter: true,
+      sortOrder: columnSortOrder(sortParams, 'customerName'),
     },
     {
       title: '付款金额',
@@ -370,6 +381,8 @@ const PaymentsPage = () => {
       key: 'amount',
       width: '8%',
       ellipsis: true,
+      sorter: true,
+      sortOrder: columnSortOrder(sortParams, 'amount'),
       render: (amount: number) => formatPrice(amount),
       align: 'right',
     },
@@ -379,6 +392,8 @@ const PaymentsPage = () => {
       key: 'paymentMethod',
       width: '10%',
       ellipsis: true,
+      sorter: true,
+      sortOrder: columnSortOrder(sortParams, 'paymentMethod'),
     },
     {
       title: '收款账户',
@@ -423,6 +438,8 @@ const PaymentsPage = () => {
       key: 'createdAt',
       width: '12%',
       ellipsis: true,
+      sorter: true,
+      sortOrder: columnSortOrder(sortParams, 'createdAt'),
       render: (date: string) => formatDate(date),
     },
     {
@@ -459,28 +476,6 @@ const PaymentsPage = () => {
     },
   ];
 
-  // 过滤收款记录列表
-  const filteredPayments = payments.filter(payment => {
-    const matchesCustomer = !searchParams.customerId || payment.customerId === searchParams.customerId;
-    const matchesPaymentMethod = !searchParams.paymentMethod || payment.paymentMethod.includes(searchParams.paymentMethod);
-    const matchesAccount = !searchParams.account || payment.account.includes(searchParams.account);
-    const matchesSaleOrderCode = !searchParams.saleOrderCode || 
-      (Array.isArray(payment.saleOrderIds) && payment.saleOrderIds.some(orderId => {
-        const order = saleOrders.find(o => o.id === orderId);
-        return order && order.code.includes(searchParams.saleOrderCode);
-      }));
-    
-    // 日期范围过滤
-    let matchesDateRange = true;
-    if (searchParams.paymentDateRange) {
-      const [startDate, endDate] = searchParams.paymentDateRange;
-      const paymentDate = new Date(payment.paymentDate);
-      matchesDateRange = paymentDate >= startDate && paymentDate <= endDate;
-    }
-    
-    return matchesCustomer && matchesPaymentMethod && matchesAccount && matchesDateRange && matchesSaleOrderCode;
-  });
-
   return (
     <Spin spinning={loading} style={{ minHeight: '60vh', display: 'flex', alignItems: 'center', justifyContent: 'center' }}>
       {contextHolder}
@@ -618,13 +613,14 @@ const PaymentsPage = () => {
         <div style={{ overflowX: 'auto', marginBottom: 16, maxWidth: '100%', boxSizing: 'border-box' }}>
           <Table
             columns={columns}
-            dataSource={filteredPayments}
+            dataSource={payments}
             rowKey="id"
             loading={loading}
             scroll={{ x: '1440px' }}
             pagination={{
               current: currentPage,
               pageSize: pageSize,
+              total,
               showSizeChanger: true,
               pageSizeOptions: ['10', '20', '50', '100'],
               showTotal: (total) => `共 ${total} 条数据`,
@@ -638,16 +634,19 @@ const PaymentsPage = () => {
                 next_page: '下一页',
                 page: '页',
               },
-              onChange: (page, size) => {
-                setCurrentPage(page);
-                setPageSize(size);
-              },
-              onShowSizeChange: (current, size) => {
-                setCurrentPage(1);
-                setPageSize(size);
-              }
             }}
-            rowSelection={{ selectedRowKeys, onChange: onSelectChange }}
+            // 翻页、切换每页条数和排序都交给后端处理
+            onChange={(pagination, _filters, sorter) => {
+              const nextSort = sorterToParams(sorter);
+              const sortChanged = nextSort.sort !== sortParams.sort || nextSort.order !== sortParams.order;
+              const size = pagination.pageSize || pageSize;
+              const page = sortChanged || size !== pageSize ? 1 : pagination.current || 1;
+              setCurrentPage(page);
+              setPageSize(size);
+              setSortParams(nextSort);
+              fetchPayments(searchParams, page, size, nextSort);
+            }}
+            rowSelection={{ selectedRowKeys, onChange: onSelectChange, preserveSelectedRowKeys: true }}
             // 禁用表格拖动功能
             onRow={() => ({
               draggable: false,
@@ -28,6 +28,7 @@ import {
   DollarOutlined,
   EllipsisOutlined,
   PrinterOutlined,
+  FilePdfOutlined,
   UploadOutlined,
   DownloadOutlined,
 } from '@ant-design/icons';
@@ -39,8 +40,8 @@ import { Product } from '@/lib/types/product-types';
 import { productService } from '@/lib/services/productService';
 import { Payment, CreatePaymentDto } from '@/lib/types/payment-types';
 import { paymentService } from '@/lib/services/paymentService';
+import { ListParams, sorterToParams, columnSortOrder } from '@/lib/services/pagination';
 import { formatPrice, formatDate, formatDateOnly } from '@/lib/utils/format';
-import { calculateOrderPaymentAmounts, getRelatedOrdersForMultiple, calculateAllOrderPaymentAmounts } from '@/lib/utils/payment-allocation';
 import SaleOrderForm from '@/ui/forms/SaleOrderForm';
 import PaymentForm from '@/ui/forms/PaymentForm';
 import PaymentListModal from '@/ui/modals/PaymentListModal';
@@ -51,22 +52,17 @@ const { Option } = Select;
 const { RangePicker } = DatePicker;
 const { Panel } = Collapse;
 
-// 订单状态常量定义
+// 订单状态常量定义，value 为后端的付款状态
 const ORDER_STATUS = {
-  PENDING: { text: '待付款', value: 'pending', color: 'default' },
-  UNSETTLED: { text: '未结清', value: 'unsettled', color: 'warning' },
-  SETTLED: { text: '已结清', value: 'settled', color: 'success' }
+  PENDING: { text: '待付款', value: '待付款', color: 'default' },
+  UNSETTLED: { text: '未结清', value: '未结清', color: 'warning' },
+  SETTLED: { text: '已结清', value: '已完成', color: 'success' },
+  CLOSED: { text: '已关闭', value: '已关闭', color: 'default' }
 };
 
-// 获取订单状态
+// 获取订单状态，付款状态由后端随收款分配一起维护
 const getOrderStatus = (order: SaleOrder) => {
-  if (order.paymentAmount === 0) {
-    return ORDER_STATUS.PENDING;
-  } else if (order.paymentAmount < order.orderAmount) {
-    return ORDER_STATUS.UNSETTLED;
-  } else {
-    return ORDER_STATUS.SETTLED;
-  }
+  return Object.values(ORDER_STATUS).find(status => status.value === order.paymentStatus) || ORDER_STATUS.PENDING;
 };
 
 const SalesPage = () => {
@@ -85,24 +81,15 @@ const SalesPage = () => {
   // 新增：控制收款列表弹窗
   const [isPaymentListModalVisible, setIsPaymentListModalVisible] = useState(false);
   const [currentOrderForPayment, setCurrentOrderForPayment] = useState<SaleOrder | null>(null);
-  const [payments, setPayments] = useState<Payment[]>([]);
-  const [isRecalculating, setIsRecalculating] = useState(false);
-  const [searchParams, setSearchParams] = useState<SaleOrderListQuery>({
-    code: '',
-    customerName: '',
-    createTimeRange: undefined,
-    status: undefined,
-  });
-  const [localSearchParams, setLocalSearchParams] = useState<SaleOrderListQuery>({
-    code: '',
-    customerName: '',
-    createTimeRange: undefined,
-    status: undefined,
-  });
+  const [searchParams, setSearchParams] = useState<SaleOrderListQuery>({});
+  const [localSearchParams, setLocalSearchParams] = useState<SaleOrderListQuery>({});
   const [currentPage, setCurrentPage] = useState(1);
   const [pageSize, setPageSize] = useState(10);
+  const [total, setTotal] = useState(0);
+  const [sortParams, setSortParams] = useState<Pick<ListParams, 'sort' | 'order'>>({});
   // 打印相关状态
   const [selectedRowKeys, setSelectedRowKeys] = useState<React.Key[]>([]);
+  const [selectedRows, setSelectedRows] = useState<SaleOrder[]>([]);
   const [isPrinting, setIsPrinting] = useState(false);
   const [currentPrintIndex, setCurrentPrintIndex] = useState(0);
   // 导入导出相关状态
@@ -114,131 +101,63 @@ const SalesPage = () => {
     const loadData = async () => {
       try {
         setLoading(true);
-        const [saleOrdersData, customersData, paymentsData, productsData] = await Promise.all([
-          saleOrderService.getSaleOrders(),
+        const [customersData, productsData] = await Promise.all([
           customerService.getCustomers(),
-          paymentService.getPayments(),
           productService.getProducts(),
         ]);
         setCustomers(Array.isArray(customersData) ? customersData : []);
         setProducts(Array.isArray(productsData) ? productsData : []);
-        
-        // 计算所有订单的收款金额
-        const allOrders = Array.isArray(saleOrdersData) ? saleOrdersData : [];
-        const allPayments = Array.isArray(paymentsData) ? paymentsData : [];
-        
-        const paymentMap = calculateAllOrderPaymentAmounts(allOrders, allPayments);
-        const updatedOrders = allOrders.map(order => ({
-          ...order,
-          paymentAmount: paymentMap.get(order.id) || 0
-        }));
-        
-        setSaleOrders(updatedOrders);
-        setPayments(allPayments);
       } catch (error) {
         console.error('Failed to load data:', error);
-        setSaleOrders([]);
         setCustomers([]);
         setProducts([]);
-        setPayments([]);
       } finally {
         setLoading(false);
       }
     };
     loadData();
+    fetchSaleOrders();
   }, []);
 
-  const fetchSaleOrders = async () => {
+  // 按搜索条件、页码和排序从后端查询一页销售订单，收款金额和付款状态由后端维护
+  const fetchSaleOrders = async (
+    query: SaleOrderListQuery = searchParams,
+    page: number = currentPage,
+    size: number = pageSize,
+    sorter: Pick<ListParams, 'sort' | 'order'> = sortParams,
+  ) => {
     try {
       setLoading(true);
-      // 获取最新的销售订单
-      const data = await saleOrderService.getSaleOrders(searchParams);
-      const allOrders = Array.isArray(data) ? data : [];
-      
-      // 确保使用最新的收款数据
-      const latestPayments = await paymentService.getPayments();
-      setPayments(latestPayments);
-      
-      // 计算所有订单的收款金额
-      const paymentMap = calculateAllOrderPaymentAmounts(allOrders, latestPayments);
-      const updatedOrders = allOrders.map(order => ({
-        ...order,
-        paymentAmount: paymentMap.get(order.id) || 0
-      }));
-      
-      setSaleOrders(updatedOrders);
+      const result = await saleOrderService.listSaleOrders(query, { page, pageSize: size, ...sorter });
+      setSaleOrders(result.records);
+      setTotal(result.total);
     } catch (error) {
       console.error('获取销售订单失败:', error);
       setSaleOrders([]);
+      setTotal(0);
     } finally {
       setLoading(false);
     }
   };
 
-  // 手动触发重新计算收款金额
-  const handleRecalculatePayments = async () => {
-    try {
-      setIsRecalculating(true);
-      antdMessage.info('开始重新计算收款金额...');
-      
-      // 获取最新的销售订单和收款记录
-      const [updatedOrders, updatedPayments] = await Promise.all([
-        saleOrderService.getSaleOrders(),
-        paymentService.getPayments()
-      ]);
-      
-      // 重新计算所有订单的收款金额
-      const paymentMap = calculateAllOrderPaymentAmounts(updatedOrders, updatedPayments);
-      const updatedOrdersWithPayment = updatedOrders.map(order => ({
-        ...order,
-        paymentAmount: paymentMap.get(order.id) || 0
-      }));
-      
-      setSaleOrders(updatedOrdersWithPayment);
-      setPayments(updatedPayments);
-      
-      antdMessage.success('收款金额重新计算完成');
-    } catch (error) {
-      console.error('重新计算收款金额失败:', error);
-      antdMessage.error('重新计算收款金额失败');
-    } finally {
-      setIsRecalculating(false);
-    }
-  };
-
-  // 每日0点自动重新计算
-  useEffect(() => {
-    const checkAndRecalculate = () => {
-      const now = new Date();
-      if (now.getHours() === 0 && now.getMinutes() === 0 && now.getSeconds() < 10) {
-        handleRecalculatePayments();
-      }
-    };
-
-    // 每分钟检查一次
-    const interval = setInterval(checkAndRecalculate, 60 * 1000);
-    
-    // 清理定时器
-    return () => clearInterval(interval);
-  }, []);
-
-  // 搜索处理
+  // 搜索处理，条件变化后回到第一页
   const handleSearch = () => {
-    setSearchParams(localSearchParams);
-    fetchSaleOrders();
+    const query = {
+      ...localSearchParams,
+      code: localSearchParams.code?.trim(),
+      customerName: localSearchParams.customerName?.trim(),
+    };
+    setSearchParams(query);
+    setCurrentPage(1);
+    fetchSaleOrders(query, 1);
   };
 
   // 重置搜索条件
   const handleReset = () => {
-    const resetParams = {
-      code: '',
-      customerName: '',
-      createTimeRange: undefined,
-      status: undefined,
-    };
-    setLocalSearchParams(resetParams);
-    setSearchParams(resetParams);
-    fetchSaleOrders();
+    setLocalSearchParams({});
+    setSearchParams({});
+    setCurrentPage(1);
+    fetchSaleOrders({}, 1);
   };
 
   // 新增销售订单
@@ -282,6 +201,7 @@ const SalesPage = () => {
       antdMessage.success(`成功删除 ${selectedRowKeys.length} 条销售订单`);
       fetchSaleOrders();
       setSelectedRowKeys([]); // 清空选中状态
+      setSelectedRows([]);
     } catch (error) {
       console.error('批量删除销售订单失败:', error);
       antdMessage.error('批量删除销售订单失败');
@@ -407,14 +327,11 @@ const SalesPage = () => {
       return;
     }
     
-    // 获取选中的销售单
-    const selectedOrders = saleOrders.filter(order => selectedRowKeys.includes(order.id));
-    
     // 设置打印状态
     setIsPrinting(true);
     
-    // 调用打印函数，一次性打印所有选中的销售单
-    handlePrint(selectedOrders);
+    // 调用打印函数，一次性打印所有选中的销售单（包括其他页勾选的）
+    handlePrint(selectedRows);
   };
 
   // 导入相关函数
@@ -521,16 +438,20 @@ const SalesPage = () => {
   };
 
   // 导出相关函数
-  const handleExport = (type: 'all' | 'filter' | 'selected') => {
+  const handleExport = async (type: 'all' | 'filter' | 'selected') => {
     let dataToExport: SaleOrder[] = [];
     
-    if (type === 'all') {
-      dataToExport = saleOrders;
-    } else if (type === 'filter') {
-      dataToExport = filteredSaleOrders;
-    } else if (type === 'selected') {
-      const selectedIds = selectedRowKeys.map(key => Number(key));
-      dataToExport = saleOrders.filter(order => selectedIds.includes(order.id));
+    if (type === 'selected') {
+      dataToExport = selectedRows;
+    } else {
+      // 列表只有当前页，导出时按条件重新查询全部结果
+      try {
+        dataToExport = await saleOrderService.getSaleOrders(type === 'filter' ? searchParams : undefined);
+      } catch (error) {
+        console.error('导出失败:', error);
+        antdMessage.error('导出失败');
+        return;
+      }
     }
     
     // 将订单数据转换为导出格式，每个产品明细一行
@@ -607,9 +528,6 @@ const SalesPage = () => {
   const handleCreatePayment = async (values: CreatePaymentDto) => {
     try {
       await paymentService.createPayment(values);
-      // 获取最新的收款记录，更新payments状态
-      const latestPayments = await paymentService.getPayments();
-      setPayments(latestPayments);
       antdMessage.success('收款记录创建成功');
       setIsPaymentDrawerVisible(false);
       fetchSaleOrders(); // 刷新销售订单列表，更新付款金额
@@ -718,6 +636,8 @@ const SalesPage = () => {
       key: 'code',
       width: '10%',
       ellipsis: true,
+      sorter: true,
+      sortOrder: columnSortOrder(sortParams, 'code'),
     },
     {
       title: '下单时间',
@@ -725,6 +645,8 @@ const SalesPage = () => {
       key: 'createTime',
       width: '12%',
       ellipsis: true,
+      sorter: true,
+      sortOrder: columnSortOrder(sortParams, 'createTime'),
       render: (time: string) => formatDateOnly(time),
     },
     {
@@ -733,6 +655,8 @@ const SalesPage = () => {
       key: 'customerName',
       width: '12%',
       ellipsis: true,
+      sorter: true,
+      sortOrder: columnSortOrder(sortParams, 'customerName'),
     },
     {
       title: '客户手机号',
@@ -747,6 +671,8 @@ const SalesPage = () => {
       key: 'customerCity',
       width: '10%',
       ellipsis: true,
+      sorter: true,
+      sortOrder: columnSortOrder(sortParams, 'customerCity'),
     },
     {
       title: '订单金额',
@@ -763,6 +689,8 @@ const SalesPage = () => {
       key: 'paymentAmount',
       width: '10%',
       ellipsis: true,
+      sorter: true,
+      sortOrder: columnSortOrder(sortParams, 'paymentAmount'),
       align: 'right' as const,
       render: (amount: number) => formatPrice(amount),
     },
@@ -790,6 +718,8 @@ const SalesPage = () => {
       key: 'createdAt',
       width: '12%',
       ellipsis: true,
+      sorter: true,
+      sortOrder: columnSortOrder(sortParams, 'createdAt'),
       render: (time: string) => formatDate(time),
     },
     {
@@ -840,6 +770,23 @@ const SalesPage = () => {
           </Button>
         );
 
+        const pdfButton = (
+          <Button
+            type="link"
+            onClick={(e) => {
+              e.stopPropagation(); // 阻止事件冒泡
+              saleOrderService.openSaleOrderPdf(record.id).catch((error) => {
+                console.error('Failed to open sale order pdf:', error);
+                message.error('打开PDF失败');
+              });
+            }}
+            size="small"
+            icon={<FilePdfOutlined />}
+          >
+            PDF
+          </Button>
+        );
+
         const deleteButton = (
           <Popconfirm
             title="确定要删除这条销售订单吗？"
@@ -859,7 +806,7 @@ const SalesPage = () => {
         );
 
         // 操作按钮列表
-        const actions = [editButton, addPaymentButton, printButton, deleteButton];
+        const actions = [editButton, addPaymentButton, printButton, pdfButton, deleteButton];
 
         // 如果按钮数量超过2个，使用下拉菜单
         if (actions.length > 2) {
@@ -901,30 +848,6 @@ const SalesPage = () => {
     },
   ];
 
-  // 过滤销售订单列表
-  const filteredSaleOrders = saleOrders.filter(saleOrder => {
-    const matchesCode = !searchParams.code || saleOrder.code.includes(searchParams.code);
-    const matchesCustomerName = !searchParams.customerName || 
-      saleOrder.customerName.includes(searchParams.customerName);
-    
-    // 日期范围过滤
-    let matchesDateRange = true;
-    if (searchParams.createTimeRange) {
-      const [startDate, endDate] = searchParams.createTimeRange;
-      const orderDate = new Date(saleOrder.createTime);
-      matchesDateRange = orderDate >= startDate && orderDate <= endDate;
-    }
-    
-    // 订单状态过滤
-    let matchesStatus = true;
-    if (searchParams.status) {
-      const orderStatus = getOrderStatus(saleOrder);
-      matchesStatus = orderStatus.value === searchParams.status;
-    }
-    
-    return matchesCode && matchesCustomerName && matchesDateRange && matchesStatus;
-  });
-
   // 渲染展开的商品列表
   const expandedRowRender = (record: SaleOrder) => (
     <div style={{ margin: 0 }}>
@@ -977,6 +900,7 @@ const SalesPage = () => {
               <Select.Option value={ORDER_STATUS.PENDING.value}>{ORDER_STATUS.PENDING.text}</Select.Option>
               <Select.Option value={ORDER_STATUS.UNSETTLED.value}>{ORDER_STATUS.UNSETTLED.text}</Select.Option>
               <Select.Option value={ORDER_STATUS.SETTLED.value}>{ORDER_STATUS.SETTLED.text}</Select.Option>
+              <Select.Option value={ORDER_STATUS.CLOSED.value}>{ORDER_STATUS.CLOSED.text}</Select.Option>
             </Select>
             <Button type="primary" icon={<SearchOutlined />} onClick={handleSearch}>
               搜索
@@ -1034,12 +958,6 @@ const SalesPage = () => {
             <Dropdown
               menu={{
                 items: [
-                  {
-                    key: 'recalculate',
-                    label: '收款更新',
-                    onClick: handleRecalculatePayments,
-                    disabled: isRecalculating
-                  },
                   {
                     key: 'batchDelete',
                     label: (
@@ -1073,17 +991,22 @@ const SalesPage = () => {
         }}>
           <Table
             columns={columns}
-            dataSource={filteredSaleOrders}
+            dataSource={saleOrders}
             rowKey="id"
             loading={loading}
             scroll={{ x: 'max-content' }}
             rowSelection={{
               selectedRowKeys,
-              onChange: setSelectedRowKeys,
+              preserveSelectedRowKeys: true,
+              onChange: (keys, rows) => {
+                setSelectedRowKeys(keys);
+                setSelectedRows(rows);
+              },
             }}
             pagination={{
               current: currentPage,
               pageSize: pageSize,
+              total,
               showSizeChanger: true,
               pageSizeOptions: ['10', '20', '50', '100'],
               showTotal: (total) => `共 ${total} 条数据`,
@@ -1097,14 +1020,17 @@ const SalesPage = () => {
                 next_page: '下一页',
                 page: '页',
               },
-              onChange: (page, size) => {
-                setCurrentPage(page);
-                setPageSize(size);
-              },
-              onShowSizeChange: (current, size) => {
-                setCurrentPage(1);
-                setPageSize(size);
-              }
+            }}
+            // 翻页、切换每页条数和排序都交给后端处理
+            onChange={(pagination, _filters, sorter) => {
+              const nextSort = sorterToParams(sorter);
+              const sortChanged = nextSort.sort !== sortParams.sort || nextSort.order !== sortParams.order;
+              const size = pagination.pageSize || pageSize;
+              const page = sortChanged || size !== pageSize ? 1 : pagination.current || 1;
+              setCurrentPage(page);
+              setPageSize(size);
+              setSortParams(nextSort);
+              fetchSaleOrders(searchParams, page, size, nextSort);
             }}
             expandable={{ expandedRowRender }}
             // 添加行点击事件，点击行打开编辑弹窗
@@ -1149,7 +1075,6 @@ const SalesPage = () => {
           <PaymentListModal
             order={currentOrderForPayment}
             customers={customers}
-            saleOrders={saleOrders}
             onClose={() => setIsPaymentListModalVisible(false)}
             onPaymentCreated={() => fetchSaleOrders()}
           />
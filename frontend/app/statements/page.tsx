@@ -1,7 +1,7 @@
 'use client';
 import React, { useState, useEffect } from 'react';
-import { Table, Button, Spin, DatePicker, Select, message, App, Tabs, Progress } from 'antd';
-import { SyncOutlined, SearchOutlined } from '@ant-design/icons';
+import { Table, Button, Spin, DatePicker, Select, message, App, Tabs, Progress, Tag } from 'antd';
+import { SyncOutlined, SearchOutlined, DownloadOutlined, FilePdfOutlined } from '@ant-design/icons';
 import { statementService } from '@/lib/services/statementService';
 import { customerService } from '@/lib/services/customerService';
 import { StatementRecord } from '@/lib/types/statement-types';
@@ -18,6 +18,7 @@ const StatementsPage = () => {
   const [customers, setCustomers] = useState<Customer[]>([]);
   const [loading, setLoading] = useState(true);
   const [syncing, setSyncing] = useState(false);
+  const [exporting, setExporting] = useState(false);
   const [activeTab, setActiveTab] = useState('statements');
   const [searchParams, setSearchParams] = useState({
     customerId: undefined as number | undefined,
@@ -82,8 +83,8 @@ const StatementsPage = () => {
   const handleSyncStatements = async () => {
     try {
       setSyncing(true);
-      await statementService.syncStatements();
-      antdMessage.success('对帐单同步成功');
+      const queued = await statementService.syncStatements();
+      antdMessage.success(`已提交 ${queued} 个客户的对帐单校对任务，后台完成后刷新即可查看`);
       await fetchStatements();
     } catch (error) {
       console.error('同步对帐单失败:', error);
@@ -93,6 +94,47 @@ const StatementsPage = () => {
     }
   };
 
+  // 按当前查询条件导出 Excel
+  const handleExport = async () => {
+    try {
+      setExporting(true);
+      const { blob, filename } = await statementService.exportStatements({
+        customerIds: searchParams.customerId ? [searchParams.customerId] : undefined,
+        startTime: searchParams.startTime,
+        endTime: searchParams.endTime,
+      });
+      const url = URL.createObjectURL(blob);
+      const link = document.createElement('a');
+      link.href = url;
+      link.download = filename;
+      link.click();
+      URL.revokeObjectURL(url);
+    } catch (error) {
+      console.error('导出对帐单失败:', error);
+      antdMessage.error(error instanceof Error ? error.message : '导出对帐单失败');
+    } finally {
+      setExporting(false);
+    }
+  };
+
+  // 在新窗口打开当前客户的对帐单PDF
+  const handleOpenPdf = async () => {
+    if (!searchParams.customerId) {
+      antdMessage.warning('请先选择客户并查询');
+      return;
+    }
+    try {
+      await statementService.openStatementPdf({
+        customerId: searchParams.customerId,
+        startTime: searchParams.startTime,
+        endTime: searchParams.endTime,
+      });
+    } catch (error) {
+      console.error('Failed to open statement pdf:', error);
+      antdMessage.error('打开PDF失败');
+    }
+  };
+
   // 搜索处理
   const handleSearch = () => {
     // 转换日期范围为字符串
@@ -228,6 +270,13 @@ const StatementsPage = () => {
       key: 'remark',
       width: '30%',
       ellipsis: true,
+      // 单据修改或删除后原分录保留，另记一条冲销分录
+      render: (remark: string, record: StatementRecord) => (
+        <>
+          {record.entryType === 'reversal' && <Tag color="orange">冲销</Tag>}
+          {remark}
+        </>
+      ),
     },
   ];
 
@@ -295,14 +344,29 @@ const StatementsPage = () => {
         {/* 标题行 */}
         <div style={{ marginBottom: 16, display: 'flex', justifyContent: 'space-between', alignItems: 'center' }}>
           <h2 style={{ margin: 0, fontSize: 18 }}>对帐单</h2>
-          <Button 
-            type="primary" 
-            icon={<SyncOutlined spin={syncing} />} 
-            onClick={handleSyncStatements}
-            loading={syncing}
-          >
-            手动同步
-          </Button>
+          <div style={{ display: 'flex', gap: 8 }}>
+            <Button
+              icon={<DownloadOutlined />}
+              onClick={handleExport}
+              loading={exporting}
+            >
+              导出Excel
+            </Button>
+            <Button
+              icon={<FilePdfOutlined />}
+              onClick={handleOpenPdf}
+            >
+              对帐单PDF
+            </Button>
+            <Button 
+              type="primary" 
+              icon={<SyncOutlined spin={syncing} />} 
+              onClick={handleSyncStatements}
+              loading={syncing}
+            >
+              手动同步
+            </Button>
+          </div>
         </div>
 
         {/* 标签页 */}
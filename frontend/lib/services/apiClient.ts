@@ -0,0 +1,68 @@
+// 后端接口地址
+export const API_BASE_URL = process.env.NEXT_PUBLIC_API_BASE_URL || 'http://localhost:8080/api';
+
+// 登录页路径
+export const LOGIN_PATH = '/login';
+
+// 登录令牌在 localStorage 中的 key
+const TOKEN_KEY = 'nb2_token';
+
+export function getToken(): string | null {
+  if (typeof window === 'undefined') return null;
+  return window.localStorage.getItem(TOKEN_KEY);
+}
+
+export function setToken(token: string): void {
+  window.localStorage.setItem(TOKEN_KEY, token);
+}
+
+export function clearToken(): void {
+  if (typeof window === 'undefined') return;
+  window.localStorage.removeItem(TOKEN_KEY);
+}
+
+// 跳转到登录页，登录成功后回到当前页面
+export function redirectToLogin(): void {
+  if (typeof window === 'undefined' || window.location.pathname === LOGIN_PATH) return;
+  const redirect = window.location.pathname + window.location.search;
+  window.location.href = `${LOGIN_PATH}?redirect=${encodeURIComponent(redirect)}`;
+}
+
+// 所有后端请求都经过这里：带上登录令牌，返回 401 时清除令牌并跳转登录页
+export async function apiFetch(input: string | URL, init: RequestInit = {}): Promise<Response> {
+  const headers = new Headers(init.headers);
+  const token = getToken();
+  if (token) {
+    headers.set('Authorization', `Bearer ${token}`);
+  }
+  const response = await fetch(input.toString(), { ...init, headers });
+  if (response.status === 401) {
+    clearToken();
+    redirectToLogin();
+  }
+  return response;
+}
+
+// 需要登录的文件（PDF 等）不能直接用地址打开，先带令牌下载再在新窗口中打开
+// 新窗口在请求前打开，避免异步之后被浏览器拦截弹窗
+export async function openAuthorizedFile(url: string, errorMessage: string): Promise<void> {
+  const win = window.open('', '_blank');
+  try {
+    const response = await apiFetch(url);
+    if (!response.ok) {
+      const errorData = await response.json().catch(() => ({}));
+      throw new Error(errorData.error || errorMessage);
+    }
+    const objectUrl = URL.createObjectURL(await response.blob());
+    if (win) {
+      win.location.href = objectUrl;
+    } else {
+      window.open(objectUrl, '_blank');
+    }
+    // 留出新窗口加载的时间后释放
+    setTimeout(() => URL.revokeObjectURL(objectUrl), 60 * 1000);
+  } catch (error) {
+    win?.close();
+    throw error;
+  }
+}
@@ -0,0 +1,39 @@
+import { LoginDto, LoginResponse, CurrentUser } from '../types/auth-types';
+import { API_BASE_URL, apiFetch, setToken, clearToken } from './apiClient';
+
+export const authService = {
+  // 登录成功后保存令牌；用户名或密码错误同样返回 401，这里直接用 fetch，不跳转登录页
+  async login(data: LoginDto): Promise<LoginResponse> {
+    const response = await fetch(`${API_BASE_URL}/auth/login`, {
+      method: 'POST',
+      headers: {
+        'Content-Type': 'application/json',
+      },
+      body: JSON.stringify(data),
+    });
+    if (!response.ok) {
+      const errorData = await response.json().catch(() => ({}));
+      throw new Error(errorData.error || 'Failed to login');
+    }
+    const result: LoginResponse = await response.json();
+    setToken(result.token);
+    return result;
+  },
+
+  // 退出登录，服务端令牌失效失败时也清除本地令牌
+  async logout(): Promise<void> {
+    try {
+      await apiFetch(`${API_BASE_URL}/auth/logout`, { method: 'POST' });
+    } finally {
+      clearToken();
+    }
+  },
+
+  async getCurrentUser(): Promise<CurrentUser> {
+    const response = await apiFetch(`${API_BASE_URL}/auth/me`);
+    if (!response.ok) {
+      throw new Error('Failed to fetch current user');
+    }
+    return response.json();
+  },
+};
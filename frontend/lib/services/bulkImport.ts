@@ -0,0 +1,29 @@
+import { apiFetch } from './apiClient';
+import { ImportResult } from '../types/import-types';
+
+// 上传 CSV/XLSX 到批量导入接口；mapping 为 {表头: 字段}，不传时由后端按列名自动识别
+// 校验不通过（400）时同样返回结果，由调用方展示错误
+export async function postImport(url: string, file: File, dryRun: boolean, mapping?: Record<string, string>): Promise<ImportResult> {
+  const formData = new FormData();
+  formData.append('file', file);
+  formData.append('dryRun', String(dryRun));
+  if (mapping) {
+    formData.append('mapping', JSON.stringify(mapping));
+  }
+
+  const response = await apiFetch(url, { method: 'POST', body: formData });
+  const data = await response.json().catch(() => ({}));
+  if (!response.ok && response.status !== 400) {
+    throw new Error(data.error || 'Failed to import');
+  }
+  return {
+    dryRun,
+    headers: [],
+    mapping: {},
+    fields: [],
+    total: 0,
+    errors: [],
+    imported: 0,
+    ...data,
+  };
+}
@@ -1,20 +1,44 @@
-import { Customer, CreateCustomerDto, UpdateCustomerDto, Invoice, CreateInvoiceDto, UpdateInvoiceDto } from '../types/customer-types';
+import { Customer, CreateCustomerDto, UpdateCustomerDto, CustomerListQuery, Invoice, CreateInvoiceDto, UpdateInvoiceDto } from '../types/customer-types';
+import { postImport } from './bulkImport';
+import { ImportResult } from '../types/import-types';
+import { fetchAllPages, fetchPage, ListParams, PageResult } from './pagination';
+import { API_BASE_URL, apiFetch } from './apiClient';
 
-const API_BASE_URL = process.env.NEXT_PUBLIC_API_BASE_URL || 'http://localhost:8080/api';
+// 客户列表接口地址，q 为单框搜索关键字，匹配客户所有字段、名称拼音以及开票资料中的税号和银行账号
+function customerListUrl(query?: CustomerListQuery): URL {
+  const url = new URL(`${API_BASE_URL}/customers`);
+  if (query?.q) url.searchParams.append('q', query.q);
+  if (query?.status !== undefined) url.searchParams.append('status', query.status.toString());
+  return url;
+}
 
 export const customerService = {
   // 客户管理
-  async getCustomers(): Promise<Customer[]> {
-    const response = await fetch(`${API_BASE_URL}/customers`);
+  // 读取全部符合条件的客户，用于下拉选择和导出
+  async getCustomers(query?: CustomerListQuery): Promise<Customer[]> {
+    return fetchAllPages<Customer>(customerListUrl(query), 'Failed to fetch customers');
+  },
+
+  // 分页读取客户列表
+  async listCustomers(query: CustomerListQuery, params: ListParams): Promise<PageResult<Customer>> {
+    return fetchPage<Customer>(customerListUrl(query), params, 'Failed to fetch customers');
+  },
+
+  // 按编号、名称、公司或拼音（全拼/首字母）检索客户，编号完全匹配的排在最前
+  async searchCustomers(keyword: string, limit?: number): Promise<Customer[]> {
+    const url = new URL(`${API_BASE_URL}/customers/search`);
+    url.searchParams.append('q', keyword);
+    if (limit) url.searchParams.append('limit', limit.toString());
+    const response = await apiFetch(url.toString());
     if (!response.ok) {
-      throw new Error('Failed to fetch customers');
+      throw new Error('Failed to search customers');
     }
     const data = await response.json();
     return Array.isArray(data) ? data : [];
   },
 
   async getCustomerById(id: number): Promise<Customer> {
-    const response = await fetch(`${API_BASE_URL}/customers/${id}`);
+    const response = await apiFetch(`${API_BASE_URL}/customers/${id}`);
     if (!response.ok) {
       throw new Error(`Failed to fetch customer with id ${id}`);
     }
@@ -22,7 +46,7 @@ export const customerService = {
   },
 
   async createCustomer(data: CreateCustomerDto): Promise<Customer> {
-    const response = await fetch(`${API_BASE_URL}/customers`, {
+    const response = await apiFetch(`${API_BASE_URL}/customers`, {
       method: 'POST',
       headers: {
         'Content-Type': 'application/json',
@@ -37,7 +61,7 @@ export const customerService = {
   },
 
   async updateCustomer(id: number, data: UpdateCustomerDto): Promise<Customer> {
-    const response = await fetch(`${API_BASE_URL}/customers/${id}`, {
+    const response = await apiFetch(`${API_BASE_URL}/customers/${id}`, {
       method: 'PUT',
       headers: {
         'Content-Type': 'application/json',
@@ -51,7 +75,7 @@ export const customerService = {
   },
 
   async deleteCustomer(id: number): Promise<void> {
-    const response = await fetch(`${API_BASE_URL}/customers/${id}`, {
+    const response = await apiFetch(`${API_BASE_URL}/customers/${id}`, {
       method: 'DELETE',
     });
     if (!response.ok) {
@@ -60,7 +84,7 @@ export const customerService = {
   },
 
   async batchDeleteCustomers(ids: number[]): Promise<void> {
-    const response = await fetch(`${API_BASE_URL}/customers/batch`, {
+    const response = await apiFetch(`${API_BASE_URL}/customers/batch`, {
       method: 'DELETE',
       headers: {
         'Content-Type': 'application/json',
@@ -74,7 +98,7 @@ export const customerService = {
 
   async generateCustomerCode(): Promise<string> {
     try {
-      const response = await fetch(`${API_BASE_URL}/customers/generate-code`);
+      const response = await apiFetch(`${API_BASE_URL}/customers/generate-code`);
       if (!response.ok) {
         const errorText = await response.text();
         console.error('Failed to generate customer code, response status:', response.status);
@@ -95,7 +119,7 @@ export const customerService = {
     if (id) {
       url += `&id=${id}`;
     }
-    const response = await fetch(url);
+    const response = await apiFetch(url);
     if (!response.ok) {
       throw new Error('Failed to check customer code');
     }
@@ -105,7 +129,7 @@ export const customerService = {
 
   // 发票管理
   async getCustomerInvoices(customerId: number): Promise<Invoice[]> {
-    const response = await fetch(`${API_BASE_URL}/customers/${customerId}/invoices`);
+    const response = await apiFetch(`${API_BASE_URL}/customers/${customerId}/invoices`);
     if (!response.ok) {
       throw new Error(`Failed to fetch invoices for customer ${customerId}`);
     }
@@ -114,7 +138,7 @@ export const customerService = {
   },
 
   async createInvoice(data: CreateInvoiceDto): Promise<Invoice> {
-    const response = await fetch(`${API_BASE_URL}/invoices`, {
+    const response = await apiFetch(`${API_BASE_URL}/invoices`, {
       method: 'POST',
       headers: {
         'Content-Type': 'application/json',
@@ -129,7 +153,7 @@ export const customerService = {
   },
 
   async updateInvoice(id: number, data: UpdateInvoiceDto): Promise<Invoice> {
-    const response = await fetch(`${API_BASE_URL}/invoices/${id}`, {
+    const response = await apiFetch(`${API_BASE_URL}/invoices/${id}`, {
       method: 'PUT',
       headers: {
         'Content-Type': 'application/json',
@@ -143,11 +167,16 @@ export const customerService = {
   },
 
   async deleteInvoice(id: number): Promise<void> {
-    const response = await fetch(`${API_BASE_URL}/invoices/${id}`, {
+    const response = await apiFetch(`${API_BASE_URL}/invoices/${id}`, {
       method: 'DELETE',
     });
     if (!response.ok) {
       throw new Error(`Failed to delete invoice with id ${id}`);
     }
   },
+
+  // 批量导入客户（CSV/XLSX），dryRun 为 true 时只校验并返回每行错误
+  async importCustomers(file: File, dryRun: boolean, mapping?: Record<string, string>): Promise<ImportResult> {
+    return postImport(`${API_BASE_URL}/customers/import`, file, dryRun, mapping);
+  },
 };
@@ -6,13 +6,12 @@ import {
   CreateDictionaryItemRequest,
   UpdateDictionaryItemRequest
 } from '../types/dictionary-types';
-
-const API_BASE_URL = process.env.NEXT_PUBLIC_API_BASE_URL || 'http://localhost:8080/api';
+import { API_BASE_URL, apiFetch } from './apiClient';
 
 export const dictionaryService = {
   // Dictionary Type Operations
   async getDictionaryTypes(): Promise<DictionaryType[]> {
-    const response = await fetch(`${API_BASE_URL}/dictionaries/types`);
+    const response = await apiFetch(`${API_BASE_URL}/dictionaries/types`);
     if (!response.ok) {
       throw new Error('Failed to fetch dictionary types');
     }
@@ -21,7 +20,7 @@ export const dictionaryService = {
   },
 
   async getDictionaryTypeById(id: number): Promise<DictionaryType> {
-    const response = await fetch(`${API_BASE_URL}/dictionaries/types/${id}`);
+    const response = await apiFetch(`${API_BASE_URL}/dictionaries/types/${id}`);
     if (!response.ok) {
       throw new Error(`Failed to fetch dictionary type with id ${id}`);
     }
@@ -34,7 +33,7 @@ export const dictionaryService = {
       throw new Error('字典类型名称不能为空');
     }
     
-    const response = await fetch(`${API_BASE_URL}/dictionaries/types`, {
+    const response = await apiFetch(`${API_BASE_URL}/dictionaries/types`, {
       method: 'POST',
       headers: {
         'Content-Type': 'application/json',
@@ -54,7 +53,7 @@ export const dictionaryService = {
       throw new Error('字典类型名称不能为空');
     }
     
-    const response = await fetch(`${API_BASE_URL}/dictionaries/types/${id}`, {
+    const response = await apiFetch(`${API_BASE_URL}/dictionaries/types/${id}`, {
       method: 'PUT',
       headers: {
         'Content-Type': 'application/json',
@@ -69,7 +68,7 @@ export const dictionaryService = {
   },
 
   async deleteDictionaryType(id: number): Promise<void> {
-    const response = await fetch(`${API_BASE_URL}/dictionaries/types/${id}`, {
+    const response = await apiFetch(`${API_BASE_URL}/dictionaries/types/${id}`, {
       method: 'DELETE',
     });
     if (!response.ok) {
@@ -78,7 +77,7 @@ export const dictionaryService = {
   },
 
   async batchDeleteDictionaryTypes(ids: number[]): Promise<void> {
-    const response = await fetch(`${API_BASE_URL}/dictionaries/types/batch`, {
+    const response = await apiFetch(`${API_BASE_URL}/dictionaries/types/batch`, {
       method: 'DELETE',
       headers: {
         'Content-Type': 'application/json',
@@ -92,20 +91,15 @@ export const dictionaryService = {
 
   // Dictionary Item Operations
   async getDictionaryItems(dictTypeCode?: string): Promise<DictionaryItem[]> {
-    let url = `${API_BASE_URL}/dictionaries/items`;
+    const url = new URL(`${API_BASE_URL}/dictionaries/items`);
     if (dictTypeCode) {
-      url += `?dictTypeCode=${encodeURIComponent(dictTypeCode)}`;
-    }
-    const response = await fetch(url);
-    if (!response.ok) {
-      throw new Error('Failed to fetch dictionary items');
+      url.searchParams.append('dictTypeCode', dictTypeCode);
     }
-    const data = await response.json();
-    return Array.isArray(data) ? data : [];
+    return fetchAllPages<DictionaryItem>(url, 'Failed to fetch dictionary items');
   },
 
   async getDictionaryItemById(id: number): Promise<DictionaryItem> {
-    const response = await fetch(`${API_BASE_URL}/dictionaries/items/${id}`);
+    const response = await apiFetch(`${API_BASE_URL}/dictionaries/items/${id}`);
     if (!response.ok) {
       throw new Error(`Failed to fetch dictionary item with id ${id}`);
     }
@@ -113,7 +107,7 @@ export const dictionaryService = {
   },
 
   async getDictionaryItemsByTypeCode(code: string): Promise<DictionaryItem[]> {
-    const response = await fetch(`${API_BASE_URL}/dictionaries/items/type/${code}`);
+    const response = await apiFetch(`${API_BASE_URL}/dictionaries/items/type/${code}`);
     if (!response.ok) {
       throw new Error(`Failed to fetch dictionary items for type ${code}`);
     }
@@ -127,7 +121,7 @@ export const dictionaryService = {
       throw new Error('字典值和字典类型不能为空');
     }
     
-    const response = await fetch(`${API_BASE_URL}/dictionaries/items`, {
+    const response = await apiFetch(`${API_BASE_URL}/dictionaries/items`, {
       method: 'POST',
       headers: {
         'Content-Type': 'application/json',
@@ -147,7 +141,7 @@ export const dictionaryService = {
       throw new Error('字典值不能为空');
     }
     
-    const response = await fetch(`${API_BASE_URL}/dictionaries/items/${id}`, {
+    const response = await apiFetch(`${API_BASE_URL}/dictionaries/items/${id}`, {
       method: 'PUT',
       headers: {
         'Content-Type': 'application/json',
@@ -162,7 +156,7 @@ export const dictionaryService = {
   },
 
   async deleteDictionaryItem(id: number): Promise<void> {
-    const response = await fetch(`${API_BASE_URL}/dictionaries/items/${id}`, {
+    const response = await apiFetch(`${API_BASE_URL}/dictionaries/items/${id}`, {
       method: 'DELETE',
     });
     if (!response.ok) {
@@ -171,7 +165,7 @@ export const dictionaryService = {
   },
 
   async batchDeleteDictionaryItems(ids: number[]): Promise<void> {
-    const response = await fetch(`${API_BASE_URL}/dictionaries/items/batch`, {
+    const response = await apiFetch(`${API_BASE_URL}/dictionaries/items/batch`, {
       method: 'DELETE',
       headers: {
         'Content-Type': 'application/json',
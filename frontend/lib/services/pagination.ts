@@ -0,0 +1,74 @@
+import { apiFetch } from './apiClient';
+import type React from 'react';
+
+// 后端列表接口的分页返回格式
+export interface PageResult<T> {
+  total: number;
+  records: T[];
+}
+
+// 后端单页最多返回的记录数
+const MAX_PAGE_SIZE = 1000;
+
+// 逐页读取列表接口的全部记录，用于下拉选择、前端关联计算等需要完整数据的场景
+export async function fetchAllPages<T>(url: URL, errorMessage: string): Promise<T[]> {
+  const records: T[] = [];
+  for (let page = 1; ; page++) {
+    url.searchParams.set('page', String(page));
+    url.searchParams.set('pageSize', String(MAX_PAGE_SIZE));
+    const response = await apiFetch(url.toString());
+    if (!response.ok) {
+      const errorData = await response.json().catch(() => ({}));
+      throw new Error(errorData.error || errorMessage);
+    }
+    const data: PageResult<T> = await response.json();
+    const pageRecords = Array.isArray(data.records) ? data.records : [];
+    records.push(...pageRecords);
+    if (pageRecords.length < MAX_PAGE_SIZE || records.length >= data.total) {
+      return records;
+    }
+  }
+}
+
+// 列表页请求的分页和排序参数，sort 为后端排序字段，order 直接使用表格排序的 ascend/descend
+export interface ListParams {
+  page: number;
+  pageSize: number;
+  sort?: string;
+  order?: 'ascend' | 'descend';
+}
+
+// 表格 onChange 回调中的排序信息
+type TableSorter = { columnKey?: React.Key; order?: 'ascend' | 'descend' | null };
+
+// 将表格排序转换为列表参数，列的 key 即后端排序字段；取消排序时回到后端默认排序
+export function sorterToParams(sorter: TableSorter | TableSorter[]): Pick<ListParams, 'sort' | 'order'> {
+  const current = Array.isArray(sorter) ? sorter[0] : sorter;
+  if (!current || !current.order || current.columnKey === undefined) {
+    return {};
+  }
+  return { sort: String(current.columnKey), order: current.order };
+}
+
+// 读取列表接口的一页记录及总数，用于列表页的服务端分页
+export async function fetchPage<T>(url: URL, params: ListParams, errorMessage: string): Promise<PageResult<T>> {
+  url.searchParams.set('page', String(params.page));
+  url.searchParams.set('pageSize', String(Math.min(params.pageSize, MAX_PAGE_SIZE)));
+  if (params.sort) url.searchParams.set('sort', params.sort);
+  if (params.order) url.searchParams.set('order', params.order);
+  const response = await apiFetch(url.toString());
+  if (!response.ok) {
+    const errorData = await response.json().catch(() => ({}));
+    throw new Error(errorData.error || errorMessage);
+  }
+  const data: PageResult<T> = await response.json();
+  return {
+    total: data.total || 0,
+    records: Array.isArray(data.records) ? data.records : [],
+  };
+}
+
+// 列当前的排序状态，用于受控的 sortOrder
+export function columnSortOrder(params: Pick<ListParams, 'sort' | 'order'>, key: string): 'ascend' | 'descend' | null {
+  return params.sort === key && params.order ? params.order : null;
+}
@@ -1,19 +1,37 @@
-import { Payment, CreatePaymentDto, UpdatePaymentDto, BatchCreatePaymentDto } from '../types/payment-types';
+import { Payment, CreatePaymentDto, UpdatePaymentDto, BatchCreatePaymentDto, PaymentListQuery } from '../types/payment-types';
+import { fetchAllPages, fetchPage, ListParams, PageResult } from './pagination';
+import dayjs from 'dayjs';
+import { API_BASE_URL, apiFetch } from './apiClient';
 
-const API_BASE_URL = process.env.NEXT_PUBLIC_API_BASE_URL || 'http://localhost:8080/api';
+// 收款列表接口地址，只附带填写了的筛选条件
+function paymentListUrl(query?: PaymentListQuery): URL {
+  const url = new URL(`${API_BASE_URL}/payments`);
+  if (query?.customerId) url.searchParams.append('customerId', query.customerId.toString());
+  // 日期选择器返回的是 dayjs 对象，统一格式化为后端要求的 YYYY-MM-DD
+  if (query?.paymentDateRange) {
+    url.searchParams.append('startDate', dayjs(query.paymentDateRange[0]).format('YYYY-MM-DD'));
+    url.searchParams.append('endDate', dayjs(query.paymentDateRange[1]).format('YYYY-MM-DD'));
+  }
+  if (query?.paymentMethod) url.searchParams.append('paymentMethod', query.paymentMethod);
+  if (query?.account) url.searchParams.append('account', query.account);
+  if (query?.saleOrderId) url.searchParams.append('saleOrderId', query.saleOrderId.toString());
+  if (query?.saleOrderCode) url.searchParams.append('saleOrderCode', query.saleOrderCode);
+  return url;
+}
 
 export const paymentService = {
-  async getPayments(): Promise<Payment[]> {
-    const response = await fetch(`${API_BASE_URL}/payments`);
-    if (!response.ok) {
-      throw new Error('Failed to fetch payments');
-    }
-    const data = await response.json();
-    return Array.isArray(data) ? data : [];
+  // 读取全部符合条件的收款记录，用于导出和订单的收款明细
+  async getPayments(query?: PaymentListQuery): Promise<Payment[]> {
+    return fetchAllPages<Payment>(paymentListUrl(query), 'Failed to fetch payments');
+  },
+
+  // 分页读取收款记录
+  async listPayments(query: PaymentListQuery, params: ListParams): Promise<PageResult<Payment>> {
+    return fetchPage<Payment>(paymentListUrl(query), params, 'Failed to fetch payments');
   },
 
   async createPayment(data: CreatePaymentDto): Promise<Payment> {
-    const response = await fetch(`${API_BASE_URL}/payments`, {
+    const response = await apiFetch(`${API_BASE_URL}/payments`, {
       method: 'POST',
       headers: {
         'Content-Type': 'application/json',
@@ -28,7 +46,7 @@ export const paymentService = {
   },
 
   async batchCreatePayments(data: BatchCreatePaymentDto): Promise<Payment[]> {
-    const response = await fetch(`${API_BASE_URL}/payments/batch`, {
+    const response = await apiFetch(`${API_BASE_URL}/payments/batch`, {
       method: 'POST',
       headers: {
         'Content-Type': 'application/json',
@@ -43,7 +61,7 @@ export const paymentService = {
   },
 
   async updatePayment(id: number, data: UpdatePaymentDto): Promise<Payment> {
-    const response = await fetch(`${API_BASE_URL}/payments/${id}`, {
+    const response = await apiFetch(`${API_BASE_URL}/payments/${id}`, {
       method: 'PUT',
       headers: {
         'Content-Type': 'application/json',
@@ -57,7 +75,7 @@ export const paymentService = {
   },
 
   async deletePayment(id: number): Promise<void> {
-    const response = await fetch(`${API_BASE_URL}/payments/${id}`, {
+    const response = await apiFetch(`${API_BASE_URL}/payments/${id}`, {
       method: 'DELETE',
     });
     if (!response.ok) {
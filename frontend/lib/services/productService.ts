@@ -1,20 +1,46 @@
-import { Product, CreateProductDto, UpdateProductDto } from '../types/product-types';
+import { Product, CreateProductDto, UpdateProductDto, ProductListQuery } from '../types/product-types';
+import { postImport } from './bulkImport';
+import { ImportResult } from '../types/import-types';
+import { fetchAllPages, fetchPage, ListParams, PageResult } from './pagination';
+import { API_BASE_URL, apiFetch } from './apiClient';
 
-const API_BASE_URL = process.env.NEXT_PUBLIC_API_BASE_URL || 'http://localhost:8080/api';
+// 产品列表接口地址，只附带填写了的筛选条件
+function productListUrl(query?: ProductListQuery): URL {
+  const url = new URL(`${API_BASE_URL}/products`);
+  if (query?.code) url.searchParams.append('code', query.code);
+  if (query?.name) url.searchParams.append('name', query.name);
+  if (query?.category) url.searchParams.append('category', query.category);
+  if (query?.brand) url.searchParams.append('brand', query.brand);
+  if (query?.status !== undefined) url.searchParams.append('status', query.status.toString());
+  return url;
+}
 
 export const productService = {
-  async getProducts(): Promise<Product[]> {
-    const response = await fetch(`${API_BASE_URL}/products`);
+  // 读取全部符合条件的产品，用于下拉选择和导出
+  async getProducts(query?: ProductListQuery): Promise<Product[]> {
+    return fetchAllPages<Product>(productListUrl(query), 'Failed to fetch products');
+  },
+
+  // 分页读取产品列表
+  async listProducts(query: ProductListQuery, params: ListParams): Promise<PageResult<Product>> {
+    return fetchPage<Product>(productListUrl(query), params, 'Failed to fetch products');
+  },
+
+  // 按编号、名称、品牌或拼音（全拼/首字母）检索产品，编号完全匹配的排在最前
+  async searchProducts(keyword: string, limit?: number): Promise<Product[]> {
+    const url = new URL(`${API_BASE_URL}/products/search`);
+    url.searchParams.append('q', keyword);
+    if (limit) url.searchParams.append('limit', limit.toString());
+    const response = await apiFetch(url.toString());
     if (!response.ok) {
-      throw new Error('Failed to fetch products');
+      throw new Error('Failed to search products');
     }
     const data = await response.json();
-    // 确保返回的数据是数组
     return Array.isArray(data) ? data : [];
   },
 
   async getProductById(id: number): Promise<Product> {
-    const response = await fetch(`${API_BASE_URL}/products/${id}`);
+    const response = await apiFetch(`${API_BASE_URL}/products/${id}`);
     if (!response.ok) {
       throw new Error(`Failed to fetch product with id ${id}`);
     }
@@ -22,7 +48,7 @@ export const productService = {
   },
 
   async generateProductCode(): Promise<string> {
-    const response = await fetch(`${API_BASE_URL}/products/generate-code`);
+    const response = await apiFetch(`${API_BASE_URL}/products/generate-code`);
     if (!response.ok) {
       throw new Error('Failed to generate product code');
     }
@@ -35,7 +61,7 @@ export const productService = {
     if (id) {
       url += `&id=${id}`;
     }
-    const response = await fetch(url);
+    const response = await apiFetch(url);
     if (!response.ok) {
       throw new Error('Failed to check product code');
     }
@@ -44,7 +70,7 @@ export const productService = {
   },
 
   async createProduct(data: CreateProductDto): Promise<Product> {
-    const response = await fetch(`${API_BASE_URL}/products`, {
+    const response = await apiFetch(`${API_BASE_URL}/products`, {
       method: 'POST',
       headers: {
         'Content-Type': 'application/json',
@@ -59,7 +85,7 @@ export const productService = {
   },
 
   async updateProduct(id: number, data: UpdateProductDto): Promise<Product> {
-    const response = await fetch(`${API_BASE_URL}/products/${id}`, {
+    const response = await apiFetch(`${API_BASE_URL}/products/${id}`, {
       method: 'PUT',
       headers: {
         'Content-Type': 'application/json',
@@ -73,7 +99,7 @@ export const productService = {
   },
 
   async deleteProduct(id: number): Promise<void> {
-    const response = await fetch(`${API_BASE_URL}/products/${id}`, {
+    const response = await apiFetch(`${API_BASE_URL}/products/${id}`, {
       method: 'DELETE',
     });
     if (!response.ok) {
@@ -82,7 +108,7 @@ export const productService = {
   },
 
   async batchDeleteProducts(ids: number[]): Promise<void> {
-    const response = await fetch(`${API_BASE_URL}/products/batch`, {
+    const response = await apiFetch(`${API_BASE_URL}/products/batch`, {
       method: 'DELETE',
       headers: {
         'Content-Type': 'application/json',
@@ -93,4 +119,9 @@ export const productService = {
       throw new Error('Failed to batch delete products');
     }
   },
+
+  // 批量导入产品（CSV/XLSX），dryRun 为 true 时只校验并返回每行错误
+  async importProducts(file: File, dryRun: boolean, mapping?: Record<string, string>): Promise<ImportResult> {
+    return postImport(`${API_BASE_URL}/products/import`, file, dryRun, mapping);
+  },
 };
@@ -1,30 +1,51 @@
 import { SaleOrder, CreateSaleOrderDto, UpdateSaleOrderDto, SaleOrderListQuery } from '../types/sale-order-types';
+import { fetchAllPages, fetchPage, ListParams, PageResult } from './pagination';
+import dayjs from 'dayjs';
+import { API_BASE_URL, apiFetch, openAuthorizedFile } from './apiClient';
 
-const API_BASE_URL = process.env.NEXT_PUBLIC_API_BASE_URL || 'http://localhost:8080/api';
+// 拼接后端返回的商品明细字段错误，如 items[0].totalAmount → 第1行：小计应为 …
+function formatSaleOrderError(errorData: any, fallback: string): string {
+  const message = errorData.error || fallback;
+  if (!errorData.fields) {
+    return message;
+  }
+  const details = Object.entries(errorData.fields as Record<string, string>).map(([field, detail]) => {
+    const match = field.match(/^items\[(\d+)\]/);
+    return match ? `第${Number(match[1]) + 1}行：${detail}` : detail;
+  });
+  return `${message}：${details.join('；')}`;
+}
+
+// 销售订单列表接口地址，只附带填写了的筛选条件
+function saleOrderListUrl(query?: SaleOrderListQuery): URL {
+  const url = new URL(`${API_BASE_URL}/sale-orders`);
+  if (query) {
+    if (query.code) url.searchParams.append('code', query.code);
+    if (query.customerId) url.searchParams.append('customerId', query.customerId.toString());
+    if (query.customerName) url.searchParams.append('customerName', query.customerName);
+    // 日期选择器返回的是 dayjs 对象，统一格式化为后端要求的 YYYY-MM-DD
+    if (query.createTimeRange) {
+      url.searchParams.append('startDate', dayjs(query.createTimeRange[0]).format('YYYY-MM-DD'));
+      url.searchParams.append('endDate', dayjs(query.createTimeRange[1]).format('YYYY-MM-DD'));
+    }
+    if (query.status) url.searchParams.append('status', query.status);
+  }
+  return url;
+}
 
 export const saleOrderService = {
+  // 读取全部符合条件的销售订单，用于下拉选择和导出
   async getSaleOrders(query?: SaleOrderListQuery): Promise<SaleOrder[]> {
-    const url = new URL(`${API_BASE_URL}/sale-orders`);
-    if (query) {
-      if (query.code) url.searchParams.append('code', query.code);
-      if (query.customerName) url.searchParams.append('customerName', query.customerName);
-      // 日期范围参数暂时不传递，后端可能尚未实现
-      // if (query.createTimeRange) {
-      //   url.searchParams.append('startDate', query.createTimeRange[0].toISOString());
-      //   url.searchParams.append('endDate', query.createTimeRange[1].toISOString());
-      // }
-    }
-    const response = await fetch(url.toString());
-    if (!response.ok) {
-      const errorData = await response.json().catch(() => ({}));
-      throw new Error(errorData.error || 'Failed to fetch sale orders');
-    }
-    const data = await response.json();
-    return Array.isArray(data) ? data : [];
+    return fetchAllPages<SaleOrder>(saleOrderListUrl(query), 'Failed to fetch sale orders');
+  },
+
+  // 分页读取销售订单列表
+  async listSaleOrders(query: SaleOrderListQuery, params: ListParams): Promise<PageResult<SaleOrder>> {
+    return fetchPage<SaleOrder>(saleOrderListUrl(query), params, 'Failed to fetch sale orders');
   },
 
   async getSaleOrderById(id: number): Promise<SaleOrder> {
-    const response = await fetch(`${API_BASE_URL}/sale-orders/${id}`);
+    const response = await apiFetch(`${API_BASE_URL}/sale-orders/${id}`);
     if (!response.ok) {
       throw new Error(`Failed to fetch sale order with id ${id}`);
     }
@@ -32,7 +53,7 @@ export const saleOrderService = {
   },
 
   async createSaleOrder(data: CreateSaleOrderDto): Promise<SaleOrder> {
-    const response = await fetch(`${API_BASE_URL}/sale-orders`, {
+    const response = await apiFetch(`${API_BASE_URL}/sale-orders`, {
       method: 'POST',
       headers: {
         'Content-Type': 'application/json',
@@ -41,13 +62,13 @@ export const saleOrderService = {
     });
     if (!response.ok) {
       const errorData = await response.json().catch(() => ({}));
-      throw new Error(errorData.error || 'Failed to create sale order');
+      throw new Error(formatSaleOrderError(errorData, 'Failed to create sale order'));
     }
     return response.json();
   },
 
   async updateSaleOrder(id: number, data: UpdateSaleOrderDto): Promise<SaleOrder> {
-    const response = await fetch(`${API_BASE_URL}/sale-orders/${id}`, {
+    const response = await apiFetch(`${API_BASE_URL}/sale-orders/${id}`, {
       method: 'PUT',
       headers: {
         'Content-Type': 'application/json',
@@ -56,13 +77,13 @@ export const saleOrderService = {
     });
     if (!response.ok) {
       const errorData = await response.json().catch(() => ({}));
-      throw new Error(errorData.error || `Failed to update sale order with id ${id}`);
+      throw new Error(formatSaleOrderError(errorData, `Failed to update sale order with id ${id}`));
     }
     return response.json();
   },
 
   async deleteSaleOrder(id: number): Promise<void> {
-    const response = await fetch(`${API_BASE_URL}/sale-orders/${id}`, {
+    const response = await apiFetch(`${API_BASE_URL}/sale-orders/${id}`, {
       method: 'DELETE',
     });
     if (!response.ok) {
@@ -71,7 +92,7 @@ export const saleOrderService = {
   },
 
   async generateSaleOrderCode(): Promise<string> {
-    const response = await fetch(`${API_BASE_URL}/sale-orders/generate-code`);
+    const response = await apiFetch(`${API_BASE_URL}/sale-orders/generate-code`);
     if (!response.ok) {
       throw new Error('Failed to generate sale order code');
     }
@@ -104,4 +125,9 @@ export const saleOrderService = {
       }
     );
   },
+
+  // 在新窗口打开服务端生成的销售单PDF，可预览或下载
+  async openSaleOrderPdf(id: number): Promise<void> {
+    return openAuthorizedFile(`${API_BASE_URL}/sale-orders/${id}/pdf`, 'Failed to fetch sale order pdf');
+  },
 };
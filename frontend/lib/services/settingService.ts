@@ -1,11 +1,10 @@
 import { Setting } from '../types/setting-types';
-
-const API_BASE_URL = process.env.NEXT_PUBLIC_API_BASE_URL || 'http://localhost:8080/api';
+import { API_BASE_URL, apiFetch } from './apiClient';
 
 export const settingService = {
   // 获取所有设置
   async getSettings(): Promise<Setting[]> {
-    const response = await fetch(`${API_BASE_URL}/settings`);
+    const response = await apiFetch(`${API_BASE_URL}/settings`);
     if (!response.ok) {
       throw new Error('Failed to fetch settings');
     }
@@ -15,7 +14,7 @@ export const settingService = {
 
   // 更新设置
   async updateSettings(settings: Setting[]): Promise<Setting[]> {
-    const response = await fetch(`${API_BASE_URL}/settings`, {
+    const response = await apiFetch(`${API_BASE_URL}/settings`, {
       method: 'PUT',
       headers: {
         'Content-Type': 'application/json',
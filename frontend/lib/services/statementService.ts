@@ -1,6 +1,5 @@
 import { StatementRecord, StatementQueryParams, StatementResponse } from '../types/statement-types';
-
-const API_BASE_URL = process.env.NEXT_PUBLIC_API_BASE_URL || 'http://localhost:8080/api';
+import { API_BASE_URL, apiFetch, openAuthorizedFile } from './apiClient';
 
 export const statementService = {
   async getStatements(params?: StatementQueryParams): Promise<StatementResponse> {
@@ -25,20 +24,61 @@ export const statementService = {
       }
     }
     
-    const response = await fetch(url.toString());
+    const response = await apiFetch(url.toString());
     if (!response.ok) {
       throw new Error('Failed to fetch statements');
     }
     return response.json();
   },
 
-  async syncStatements(): Promise<void> {
-    const response = await fetch(`${API_BASE_URL}/statements/sync`, {
+  // 导出对帐单 Excel，未指定客户时导出期间内有发生额的全部客户（每个客户一个工作表）
+  async exportStatements(params: { customerIds?: number[]; startTime?: string; endTime?: string }): Promise<{ blob: Blob; filename: string }> {
+    const url = new URL(`${API_BASE_URL}/statements/export`);
+    if (params.customerIds && params.customerIds.length > 0) {
+      url.searchParams.append('customerIds', params.customerIds.join(','));
+    }
+    if (params.startTime) {
+      url.searchParams.append('startTime', params.startTime);
+    }
+    if (params.endTime) {
+      url.searchParams.append('endTime', params.endTime);
+    }
+
+    const response = await apiFetch(url.toString());
+    if (!response.ok) {
+      const errorData = await response.json().catch(() => ({}));
+      throw new Error(errorData.error || 'Failed to export statements');
+    }
+    // 文件名取自 Content-Disposition 的 filename*=UTF-8''...
+    const disposition = response.headers.get('Content-Disposition') || '';
+    const match = disposition.match(/filename\*=UTF-8''([^;]+)/);
+    const filename = match ? decodeURIComponent(match[1]) : '对帐单.xlsx';
+    return { blob: await response.blob(), filename };
+  },
+
+  // 提交全部客户的对帐单校对任务，由后台队列执行，返回提交的任务数
+  async syncStatements(): Promise<number> {
+    const response = await apiFetch(`${API_BASE_URL}/statements/sync`, {
       method: 'GET',
     });
     if (!response.ok) {
       const errorData = await response.json().catch(() => ({}));
       throw new Error(errorData.error || 'Failed to sync statements');
     }
+    const data = await response.json();
+    return data.queued ?? 0;
+  },
+
+  // 在新窗口打开服务端生成的客户对帐单PDF
+  async openStatementPdf(params: { customerId: number; startTime?: string; endTime?: string }): Promise<void> {
+    const url = new URL(`${API_BASE_URL}/statements/pdf`);
+    url.searchParams.append('customerId', params.customerId.toString());
+    if (params.startTime) {
+      url.searchParams.append('startTime', params.startTime);
+    }
+    if (params.endTime) {
+      url.searchParams.append('endTime', params.endTime);
+    }
+    return openAuthorizedFile(url.toString(), 'Failed to fetch statement pdf');
   },
 };
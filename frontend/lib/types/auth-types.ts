@@ -0,0 +1,28 @@
+// 登录用户
+export interface User {
+  id: number;
+  username: string;
+  name: string;
+  status: number;
+  lastLoginAt: string;
+  createdAt: string;
+  updatedAt: string;
+}
+
+export interface LoginDto {
+  username: string;
+  password: string;
+}
+
+export interface LoginResponse {
+  token: string;
+  expiresAt: string;
+  user: User;
+}
+
+// 当前登录用户及其角色和权限
+export interface CurrentUser {
+  user: User;
+  roles: { id: number; code: string; name: string }[];
+  permissions: string[];
+}
@@ -15,6 +15,12 @@ export type Customer = {
   updatedAt: string;
 };
 
+// 客户列表查询参数
+export type CustomerListQuery = {
+  q?: string;
+  status?: number;
+};
+
 export type CreateCustomerDto = {
   name: string;
   code?: string;
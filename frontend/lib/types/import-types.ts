@@ -0,0 +1,26 @@
+// 批量导入可映射的字段
+export type ImportField = {
+  key: string;
+  label: string;
+  required: boolean;
+};
+
+// 一行数据的校验错误，row 为文件中的行号（表头为第1行）
+export type ImportRowError = {
+  row: number;
+  field?: string;
+  message: string;
+};
+
+// 导入接口返回结果，dryRun 为 true 时只校验不写入
+export type ImportResult = {
+  dryRun: boolean;
+  headers: string[];
+  mapping: Record<string, string>;
+  fields: ImportField[];
+  total: number;
+  errors: ImportRowError[];
+  imported: number;
+  // 文件或列映射有误时的错误说明
+  error?: string;
+};
@@ -15,6 +15,16 @@ export type Payment = {
   updatedAt: string;
 };
 
+// 收款记录筛选条件，订单号模糊匹配关联订单的编号
+export type PaymentListQuery = {
+  customerId?: number;
+  paymentDateRange?: [Date, Date];
+  paymentMethod?: string;
+  account?: string;
+  saleOrderId?: number;
+  saleOrderCode?: string;
+};
+
 export type CreatePaymentDto = {
   paymentDate: string;
   customerId: number;
@@ -13,6 +13,15 @@ export type Product = {
   updatedAt: string;
 };
 
+// 产品列表筛选条件，编号和名称模糊匹配，分类、品牌和状态精确匹配
+export type ProductListQuery = {
+  code?: string;
+  name?: string;
+  category?: string;
+  brand?: string;
+  status?: number;
+};
+
 export type CreateProductDto = {
   name: string;
   code?: string;
@@ -8,9 +8,16 @@ export interface SaleOrder {
   customerName: string;
   customerPhone: string;
   customerCity: string;
+  orderType: string;
   items: SaleOrderItem[];
   orderAmount: number;
-  paymentAmount: number;
+  freight: number;
+  payableAmount: number; // 应付金额：订单金额 + 运费
+  paymentAmount: number; // 已分配到本订单的收款金额，由后端按先进先出计算
+  invoiceStatus: string;
+  paymentStatus: string; // 待付款、未结清、已完成、已关闭
+  closedAt: string;
+  closeReason: string;
   remark: string;
   createdAt: string;
   updatedAt: string;
@@ -73,7 +80,8 @@ export interface UpdateSaleOrderItemDto {
 
 export interface SaleOrderListQuery {
   code?: string;
+  customerId?: number;
   customerName?: string;
   createTimeRange?: [Date, Date];
-  status?: string;
+  status?: string; // 付款状态
 }
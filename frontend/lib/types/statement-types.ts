@@ -11,6 +11,8 @@ export interface StatementRecord {
   remark: string;
   sourceType: string;
   sourceId: number;
+  entryType: 'entry' | 'reversal'; // entry 按单据入帐，reversal 冲销
+  reversalOf: number | null; // 冲销分录指向被冲销的分录
   createdAt: string;
   updatedAt: string;
 }
@@ -0,0 +1,168 @@
+'use client';
+import React, { useState } from 'react';
+import { Modal, Upload, Button, Table, Select, Alert, Space, message } from 'antd';
+import { UploadOutlined } from '@ant-design/icons';
+import { ImportResult, ImportRowError } from '@/lib/types/import-types';
+
+interface ImportModalProps {
+  title: string;
+  open: boolean;
+  onCancel: () => void;
+  onDownloadTemplate: () => void;
+  // 调用导入接口，dryRun 为 true 时只校验
+  onImport: (file: File, dryRun: boolean, mapping?: Record<string, string>) => Promise<ImportResult>;
+  // 正式导入成功后回调，用于刷新列表
+  onImported: (count: number) => void;
+}
+
+// 批量导入弹窗：上传文件 → 校验预览（可调整列映射）→ 无错误时确认导入
+const ImportModal: React.FC<ImportModalProps> = ({ title, open, onCancel, onDownloadTemplate, onImport, onImported }) => {
+  const [messageApi, contextHolder] = message.useMessage();
+  const [file, setFile] = useState<File | null>(null);
+  const [mapping, setMapping] = useState<Record<string, string> | undefined>(undefined);
+  const [result, setResult] = useState<ImportResult | null>(null);
+  const [loading, setLoading] = useState(false);
+
+  const reset = () => {
+    setFile(null);
+    setMapping(undefined);
+    setResult(null);
+  };
+
+  const handleCancel = () => {
+    reset();
+    onCancel();
+  };
+
+  // 预览校验，首次上传时由后端按列名自动识别映射
+  const validate = async (target: File, targetMapping?: Record<string, string>) => {
+    try {
+      setLoading(true);
+      const data = await onImport(target, true, targetMapping);
+      setResult(data);
+      if (data.headers.length > 0) {
+        setMapping(targetMapping || data.mapping);
+      }
+    } catch (error) {
+      console.error('导入校验失败:', error);
+      messageApi.error(error instanceof Error ? error.message : '导入校验失败');
+    } finally {
+      setLoading(false);
+    }
+  };
+
+  const handleUpload = (target: File) => {
+    setFile(target);
+    setMapping(undefined);
+    validate(target);
+    return false;
+  };
+
+  const handleCommit = async () => {
+    if (!file) return;
+    try {
+      setLoading(true);
+      const data = await onImport(file, false, mapping);
+      if (data.error || data.errors.length > 0) {
+        setResult(data);
+        messageApi.error(data.error || '数据有误，未导入任何记录');
+        return;
+      }
+      messageApi.success(`成功导入 ${data.imported} 条记录`);
+      reset();
+      onImported(data.imported);
+    } catch (error) {
+      console.error('导入失败:', error);
+      messageApi.error(error instanceof Error ? error.message : '导入失败');
+    } finally {
+      setLoading(false);
+    }
+  };
+
+  const fieldLabel = (key?: string) => result?.fields.find(f => f.key === key)?.label || key || '';
+  const canCommit = !!result && !result.error && result.errors.length === 0 && result.total > 0;
+
+  const errorColumns = [
+    { title: '行号', dataIndex: 'row', key: 'row', width: 80 },
+    { title: '列', dataIndex: 'field', key: 'field', width: 120, render: (field: string) => fieldLabel(field) },
+    { title: '错误', dataIndex: 'message', key: 'message' },
+  ];
+
+  return (
+    <Modal
+      title={title}
+      open={open}
+      onCancel={handleCancel}
+      width={800}
+      footer={[
+        <Button key="cancel" onClick={handleCancel}>
+          取消
+        </Button>,
+        <Button key="submit" type="primary" disabled={!canCommit} loading={loading} onClick={handleCommit}>
+          确认导入
+        </Button>,
+      ]}
+    >
+      {contextHolder}
+      <Space direction="vertical" style={{ width: '100%' }} size="middle">
+        <Space>
+          <Button onClick={onDownloadTemplate}>下载导入模板</Button>
+          <Upload beforeUpload={handleUpload} showUploadList={false} accept=".csv,.xlsx">
+            <Button type="primary" icon={<UploadOutlined />} loading={loading}>
+              {file ? '重新选择文件' : '选择文件'}
+            </Button>
+          </Upload>
+          {file && <span>{file.name}</span>}
+        </Space>
+        <div style={{ color: '#666', fontSize: '12px' }}>
+          支持 .csv、.xlsx，第一行为表头；编号留空时按系统规则自动生成。先校验全部数据，无错误后才能导入，导入时全部成功或全部不导入。
+        </div>
+
+        {result && result.headers.length > 0 && mapping && (
+          <div>
+            <div style={{ marginBottom: 8, fontWeight: 500 }}>列映射</div>
+            <div style={{ display: 'grid', gridTemplateColumns: 'repeat(2, 1fr)', gap: 8 }}>
+              {result.headers.map(header => (
+                <Space key={header}>
+                  <span style={{ display: 'inline-block', width: 100, overflow: 'hidden', textOverflow: 'ellipsis' }}>{header || '（空表头）'}</span>
+                  <Select
+                    style={{ width: 160 }}
+                    value={mapping[header] || ''}
+                    onChange={value => setMapping({ ...mapping, [header]: value })}
+                    options={[
+                      { value: '', label: '不导入' },
+                      ...result.fields.map(f => ({ value: f.key, label: f.required ? `${f.label} *` : f.label })),
+                    ]}
+                  />
+                </Space>
+              ))}
+            </div>
+            <Button style={{ marginTop: 8 }} loading={loading} onClick={() => file && validate(file, mapping)}>
+              按此映射重新校验
+            </Button>
+          </div>
+        )}
+
+        {result?.error && <Alert type="error" showIcon message={result.error} />}
+        {result && !result.error && (
+          result.errors.length === 0 ? (
+            <Alert type="success" showIcon message={`共 ${result.total} 行，校验通过，可以导入`} />
+          ) : (
+            <>
+              <Alert type="warning" showIcon message={`共 ${result.total} 行，发现 ${result.errors.length} 处错误，请修改文件后重新上传`} />
+              <Table<ImportRowError>
+                size="small"
+                rowKey={(record, index) => `${record.row}-${record.field}-${index}`}
+                columns={errorColumns}
+                dataSource={result.errors}
+                pagination={{ pageSize: 10 }}
+              />
+            </>
+          )
+        )}
+      </Space>
+    </Modal>
+  );
+};
+
+export default ImportModal;
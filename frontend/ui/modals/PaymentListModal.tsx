@@ -6,13 +6,13 @@ import { SaleOrder } from '../../lib/types/sale-order-types';
 import { Payment, CreatePaymentDto, UpdatePaymentDto } from '../../lib/types/payment-types';
 import { Customer } from '../../lib/types/customer-types';
 import { paymentService } from '../../lib/services/paymentService';
+import { saleOrderService } from '../../lib/services/saleOrderService';
 import { formatPrice, formatDate } from '../../lib/utils/format';
 import PaymentForm from '../forms/PaymentForm';
 
 interface PaymentListModalProps {
   order: SaleOrder;
   customers: Customer[];
-  saleOrders: SaleOrder[];
   onClose: () => void;
   onPaymentCreated: () => void;
 }
@@ -20,7 +20,6 @@ interface PaymentListModalProps {
 const PaymentListModal: React.FC<PaymentListModalProps> = ({
   order,
   customers,
-  saleOrders,
   onClose,
   onPaymentCreated
 }) => {
@@ -30,6 +29,7 @@ const PaymentListModal: React.FC<PaymentListModalProps> = ({
   // 状态管理
   const [isPaymentFormVisible, setIsPaymentFormVisible] = useState(false);
   const [payments, setPayments] = useState<Payment[]>([]);
+  const [customerOrders, setCustomerOrders] = useState<SaleOrder[]>([]);
   const [loading, setLoading] = useState(false);
   const [selectedPayment, setSelectedPayment] = useState<Payment | null>(null);
   const [isEditing, setIsEditing] = useState(false);
@@ -38,11 +38,7 @@ const PaymentListModal: React.FC<PaymentListModalProps> = ({
   const loadPayments = async () => {
     try {
       setLoading(true);
-      const allPayments = await paymentService.getPayments();
-      // 筛选出当前订单的收款记录
-      const orderPayments = allPayments.filter(payment => 
-        payment.saleOrderIds.includes(order.id)
-      );
+      const orderPayments = await paymentService.getPayments({ saleOrderId: order.id });
       setPayments(orderPayments);
     } catch (error) {
       console.error('Failed to load payments:', error);
@@ -52,15 +48,27 @@ const PaymentListModal: React.FC<PaymentListModalProps> = ({
     }
   };
 
+  // 加载同一客户的订单，供收款表单选择关联订单
+  const loadCustomerOrders = async () => {
+    try {
+      const orders = await saleOrderService.getSaleOrders({ customerId: order.customerId });
+      setCustomerOrders(orders);
+    } catch (error) {
+      console.error('Failed to load customer sale orders:', error);
+      setCustomerOrders([order]);
+    }
+  };
+
   // 初始加载
   useEffect(() => {
     loadPayments();
+    loadCustomerOrders();
   }, [order.id]);
 
   // 新增收款
   const handleAddPayment = () => {
-    // 计算建议金额：订单金额 - 已付金额
-    const suggestedAmount = order.orderAmount - order.paymentAmount;
+    // 计算建议金额：应付金额 - 已付金额
+    const suggestedAmount = order.payableAmount - order.paymentAmount;
     
     // 设置初始值，自动填充订单信息
     setSelectedPayment({
@@ -70,7 +78,7 @@ const PaymentListModal: React.FC<PaymentListModalProps> = ({
       customerId: order.customerId,
       customerName: order.customerName,
       saleOrderIds: [order.id],
-      amount: suggestedAmount > 0 ? suggestedAmount : order.orderAmount,
+      amount: suggestedAmount > 0 ? suggestedAmount : order.payableAmount,
       paymentMethod: '',
       account: '',
       payerCompany: '',
@@ -220,7 +228,7 @@ const PaymentListModal: React.FC<PaymentListModalProps> = ({
           isEditing={isEditing}
           visible={isPaymentFormVisible}
           customers={customers}
-          saleOrders={saleOrders}
+          saleOrders={customerOrders}
         />
       </Modal>
     </Modal>